@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+	"github.com/Morwran/ebpf-nftrace/pkg/client"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const commandUsage = `usage: nftrace [agent flags]
+       nftrace <command> [flags]
+
+commands of the gRPC trace API client (the agent runs with -api):
+  watch     print live traces matched by the filter
+  snapshot  print recent traces matched by the filter
+  rules     print rules known by the agent
+  ifaces    print network interfaces known by the agent
+`
+
+// runCommand - client of the agent trace API
+func runCommand(ctx context.Context, args []string) error {
+	cmd := args[0]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	var (
+		addr     = fs.String("addr", "127.0.0.1:5000", "telemetry endpoint of the agent")
+		jsonOut  = fs.Bool("j", false, "print in json format")
+		limit    = fs.Uint("limit", 0, "snapshot: max number of the traces (0 - all recent)")
+		buffer   = fs.Uint("buffer", 0, "watch: number of the traces buffered by the agent for the client (0 - agent default)")
+		tables   = fs.String("table", "", "filter: comma separated tables")
+		chains   = fs.String("chain", "", "filter: comma separated chains")
+		families = fs.String("family", "", "filter: comma separated families")
+		verdicts = fs.String("verdict", "", "filter: comma separated final verdicts")
+		ifaces   = fs.String("iface", "", "filter: comma separated input or output ifaces")
+		protos   = fs.String("proto", "", "filter: comma separated ip protocols")
+		nets     = fs.String("net", "", "filter: comma separated source or destination CIDRs or addresses")
+		ports    = fs.String("port", "", "filter: comma separated source or destination ports")
+	)
+	switch cmd {
+	case "watch", "snapshot", "rules", "ifaces":
+	default:
+		fmt.Fprint(os.Stderr, commandUsage)
+		return errors.Errorf("unknown command '%s'", cmd)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	filter := &api.Filter{
+		Tables:   splitList(*tables),
+		Chains:   splitList(*chains),
+		Families: splitList(*families),
+		Verdicts: splitList(*verdicts),
+		Ifaces:   splitList(*ifaces),
+		Protos:   splitList(*protos),
+		Nets:     splitList(*nets),
+	}
+	for _, p := range splitList(*ports) {
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return errors.Errorf("invalid port '%s'", p)
+		}
+		filter.Ports = append(filter.Ports, uint32(port))
+	}
+
+	c, err := client.New(ctx, *addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+	out := &printer{w: os.Stdout, json: *jsonOut}
+	switch cmd {
+	case "watch":
+		err = c.Watch(ctx, &api.WatchReq{Filter: filter, Buffer: uint32(*buffer)}, out.trace) //nolint:gosec
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+	case "snapshot":
+		var traces []*api.Trace
+		if traces, err = c.Snapshot(ctx, &api.SnapshotReq{Filter: filter, Limit: uint32(*limit)}); err == nil { //nolint:gosec
+			for _, t := range traces {
+				_ = out.trace(t)
+			}
+		}
+	case "rules":
+		var rules []*api.Rule
+		if rules, err = c.ListRules(ctx); err == nil {
+			for _, r := range rules {
+				out.print(r, "%s %s %s #%d: %s\n", r.GetFamily(), r.GetTable(), r.GetChain(), r.GetHandle(), r.GetRule())
+			}
+		}
+	case "ifaces":
+		var list []*api.Iface
+		if list, err = c.ListIfaces(ctx); err == nil {
+			for _, i := range list {
+				out.print(i, "%d: %s\n", i.GetIndex(), i.GetName())
+			}
+		}
+	}
+	return err
+}
+
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p *printer) trace(t *api.Trace) error {
+	verdict := t.GetFinal()
+	if verdict == "" {
+		verdict = t.GetVerdict()
+	}
+	p.print(t, "%s %s %s/%s src=%s:%d dst=%s:%d proto=%s iif=%s oif=%s verdict=%s cnt=%d\n",
+		t.GetTimestamp().AsTime().Local().Format(time.RFC3339Nano), t.GetFamily(), t.GetTable(), t.GetChain(),
+		t.GetIpSrc(), t.GetSport(), t.GetIpDst(), t.GetDport(), t.GetProto(),
+		t.GetIif(), t.GetOif(), verdict, t.GetCnt())
+	return nil
+}
+
+func (p *printer) print(m proto.Message, format string, args ...any) {
+	if p.json {
+		b, _ := protojson.Marshal(m)
+		_, _ = fmt.Fprintf(p.w, "%s\n", b)
+		return
+	}
+	_, _ = fmt.Fprintf(p.w, format, args...)
+}
+
+func splitList(s string) (ret []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/Morwran/ebpf-nftrace/internal/app"
 	. "github.com/Morwran/ebpf-nftrace/internal/app/nftrace" //nolint:revive
 	"github.com/Morwran/ebpf-nftrace/internal/nftrace"
-	"github.com/Morwran/ebpf-nftrace/internal/nftrace/printer"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/otlp"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/sink"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/spool"
+	traceapi "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-api"
 	"github.com/Morwran/ebpf-nftrace/internal/nl"
 	iface "github.com/Morwran/ebpf-nftrace/internal/providers/iface-provider"
 	"github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
@@ -26,8 +33,15 @@ import (
 
 func main() {
 	SetupContext()
-	SetupAgentSubject()
 	ctx := app.Context()
+	if flag.NArg() > 0 {
+		if err := runCommand(ctx, flag.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	SetupAgentSubject()
 	logger.SetLevel(zap.InfoLevel)
 	logger.Info(ctx, "-= HELLO =-")
 	if err := SetupLogger(LogLevel); err != nil {
@@ -38,7 +52,42 @@ func main() {
 		logger.Fatal(ctx, errors.WithMessage(err, "setup metrics"))
 	}
 
-	err := WhenSetupTelemtryServer(ctx, func(srv *server.APIServer) error {
+	AgentSubject().ObserversAttach(
+		observer.NewObserver(agentMetricsObserver, false,
+			nftrace.CountLostSampleEvent{},
+			nftrace.CountRcvSampleEvent{},
+			nftrace.CountRcvPktEvent{},
+			nftrace.CountQueDropEvent{},
+			nftrace.QueDepthEvent{},
+			nftrace.CountEvictTraceGroupEvent{},
+			nftrace.OpenTraceGroupsEvent{},
+			nftrace.CountRuleResolveEvent{},
+			nftrace.PendingTracesEvent{},
+			nftrace.ShardQueDepthEvent{},
+			nftrace.CountShardTraceEvent{},
+			iface.CountIfaceNlErrMemEvent{},
+			nfrule.CountRulerNlErrMemEvent{},
+			nftrace.CountCollectNlErrMemEvent{},
+			spool.SpoolSizeEvent{},
+			spool.SpoolLagEvent{},
+			spool.CountSpoolDiscardEvent{},
+			spool.CountSpoolCorruptEvent{},
+			sink.CountSinkTraceEvent{},
+			sink.CountSinkErrorEvent{},
+			sink.CountSinkDropEvent{},
+			sink.SinkHealthEvent{},
+			traceapi.CountWatchTraceEvent{},
+			traceapi.WatchersEvent{},
+			traceapi.CountSlowWatcherEvent{},
+		),
+	)
+
+	var jb mainJob
+	if err := jb.init(ctx); err != nil {
+		logger.Fatal(ctx, errors.WithMessage(err, "init jobs"))
+	}
+
+	err := WhenSetupTelemtryServer(ctx, jb.apiServices(), jb.apiHandlers(), func(srv *server.APIServer) error {
 		ep, e := pkgNet.ParseEndpoint(TelemetryEndpoint)
 		if e != nil {
 			return errors.WithMessagef(e, "parse telemetry endpoint (%s): %v", TelemetryEndpoint, e)
@@ -54,24 +103,12 @@ func main() {
 		logger.Fatal(ctx, errors.WithMessage(err, "setup telemetry server"))
 	}
 
-	AgentSubject().ObserversAttach(
-		observer.NewObserver(agentMetricsObserver, false,
-			nftrace.CountLostSampleEvent{},
-			nftrace.CountRcvSampleEvent{},
-			nftrace.CountRcvPktEvent{},
-			nftrace.CountOverflowQueEvent{},
-			iface.CountIfaceNlErrMemEvent{},
-			nfrule.CountRulerNlErrMemEvent{},
-			nftrace.CountCollectNlErrMemEvent{},
-		),
-	)
-
 	gracefulDuration := 5 * time.Second
 	errc := make(chan error, 1)
 
 	go func() {
 		defer close(errc)
-		errc <- runJobs(ctx)
+		errc <- jb.run(ctx)
 	}()
 	var jobErr error
 
@@ -107,14 +144,35 @@ func agentMetricsObserver(ev observer.EventType) {
 			metrics.ObserveCounters(RcvTraceCountSrc{Cnt: o.Cnt})
 		case nftrace.CountRcvPktEvent:
 			metrics.ObserveCounters(RcvPktCountSrc{Cnt: o.Cnt})
-		case nftrace.CountOverflowQueEvent:
+		case nftrace.CountQueDropEvent:
 			metrics.ObserveCounters(TraceQueOvflCountSrc{Cnt: o.Cnt})
+			metrics.ObserveQueDropCounter(o.Policy, o.Cnt)
+		case nftrace.QueDepthEvent:
+			metrics.ObserveQueDepth(o.Depth)
+		case nftrace.CountEvictTraceGroupEvent:
+			metrics.ObserveTraceGroupEvictCounter(o.Reason, o.Cnt)
+		case nftrace.OpenTraceGroupsEvent:
+			metrics.ObserveOpenTraceGroups(o.Shard, o.Cnt)
+		case nftrace.CountRuleResolveEvent:
+			metrics.ObserveRuleResolveCounter(o.Outcome, o.Cnt)
+		case nftrace.PendingTracesEvent:
+			metrics.ObservePendingTraces(o.Shard, o.Cnt)
+		case nftrace.ShardQueDepthEvent:
+			metrics.ObserveShardQueDepth(o.Shard, o.Depth)
+		case nftrace.CountShardTraceEvent:
+			metrics.ObserveShardTraceCounter(o.Shard, o.Cnt)
 		case iface.CountIfaceNlErrMemEvent:
 			metrics.ObserveErrNlMemCounter(ESrcIface)
 		case nfrule.CountRulerNlErrMemEvent:
 			metrics.ObserveErrNlMemCounter(ESrcRuler)
 		case nftrace.CountCollectNlErrMemEvent:
 			metrics.ObserveErrNlMemCounter(ESrcCollector)
+		case spool.SpoolSizeEvent, spool.SpoolLagEvent, spool.CountSpoolDiscardEvent, spool.CountSpoolCorruptEvent:
+			metrics.ObserveSpool(o)
+		case sink.CountSinkTraceEvent, sink.CountSinkErrorEvent, sink.CountSinkDropEvent, sink.SinkHealthEvent:
+			metrics.ObserveSink(o)
+		case traceapi.CountWatchTraceEvent, traceapi.WatchersEvent, traceapi.CountSlowWatcherEvent:
+			metrics.ObserveTraceApi(o)
 		}
 	}
 }
@@ -124,7 +182,10 @@ type mainJob struct {
 	nlWatcher     nl.NetlinkWatcher
 	ruleProvider  nfrule.RuleProvider
 	trCollect     nftrace.TraceCollector
+	spool         *spool.Spool
+	api           *traceapi.Service
 	printer       nftrace.TracePrinter
+	otlpMetrics   *otlp.MetricsPusher
 }
 
 func (m *mainJob) cleanup() {
@@ -143,6 +204,12 @@ func (m *mainJob) cleanup() {
 	if m.printer != nil {
 		_ = m.printer.Close()
 	}
+	if m.spool != nil {
+		_ = m.spool.Close()
+	}
+	if m.otlpMetrics != nil {
+		_ = m.otlpMetrics.Close()
+	}
 }
 
 func (m *mainJob) init(ctx context.Context) (err error) {
@@ -172,21 +239,27 @@ func (m *mainJob) init(ctx context.Context) (err error) {
 		return err
 	}
 
-	tracePrinter := printer.NewDummyPrinter()
-
-	if !NoPrintTrace {
-		var opts []printer.Option
-
-		if JsonFormat {
-			opts = append(opts, printer.WithJsonFormat())
+	if m.spool, err = SetupSpool(m.trCollect, as); err != nil {
+		return err
+	}
+	sinks, err := SetupSinks()
+	if err != nil {
+		return err
+	}
+	if m.api = SetupTraceApi(m.ifaceProvider, m.ruleProvider, as); m.api != nil {
+		sinks = append(sinks, sink.Named{Name: "grpc", Sink: m.api})
+	}
+	deps := sink.FanOutDeps{Source: m.trCollect, Subj: as}
+	if m.spool != nil {
+		if deps.Readers, err = SpoolReaders(m.spool, sinks); err != nil {
+			return err
 		}
-		tracePrinter = printer.NewTracePrinter(opts...)
 	}
+	m.printer = sink.NewFanOut(deps, sinks)
 
-	m.printer = nftrace.NewTracePrinter(nftrace.PrinterDeps{
-		TraceProvider: m.trCollect,
-		Printer:       tracePrinter,
-	})
+	if m.otlpMetrics, err = SetupOtlpMetrics(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -195,7 +268,7 @@ func (m *mainJob) run(ctx context.Context) error {
 	defer m.cleanup()
 	ctx1, cancel := context.WithCancel(ctx)
 	defer cancel()
-	ff := [...]func() error{
+	ff := []func() error{
 		func() error {
 			return m.ifaceProvider.Run(ctx1)
 		},
@@ -209,6 +282,16 @@ func (m *mainJob) run(ctx context.Context) error {
 			return m.printer.Run(ctx1)
 		},
 	}
+	if m.spool != nil {
+		ff = append(ff, func() error {
+			return m.spool.Run(ctx1)
+		})
+	}
+	if m.otlpMetrics != nil {
+		ff = append(ff, func() error {
+			return m.otlpMetrics.Run(ctx1)
+		})
+	}
 	errs := make([]error, len(ff))
 	_ = parallel.ExecAbstract(len(ff), int32(len(ff))-1, func(i int) error {
 		defer cancel()
@@ -223,11 +306,16 @@ func (m *mainJob) run(ctx context.Context) error {
 	return multierr.Combine(errs...)
 }
 
-func runJobs(ctx context.Context) (err error) {
-	var jb mainJob
-	if err = jb.init(ctx); err != nil {
-		return err
+func (m *mainJob) apiServices() []server.APIService {
+	if m.api == nil {
+		return nil
 	}
+	return []server.APIService{m.api}
+}
 
-	return jb.run(ctx)
+func (m *mainJob) apiHandlers() map[string]http.Handler {
+	if m.api == nil {
+		return nil
+	}
+	return map[string]http.Handler{"/traces": m.api.HttpHandler()}
 }
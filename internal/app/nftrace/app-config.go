@@ -2,6 +2,18 @@ package nftrace
 
 import (
 	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/otlp"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/printer"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/sink"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/spool"
+	traceapi "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-api"
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
 )
 
 var (
@@ -13,11 +25,51 @@ var (
 	CollectorType     string
 	UseAggregation    bool
 	JsonFormat        bool
+	Format            string
+	Summary           time.Duration
+	SummaryTop        int
+	SummaryBy         string
 	NoPrintTrace      bool
+	TraceGroupMaxAge  time.Duration
+	MaxTraceGroups    int
+	RuleResolveWindow time.Duration
+	MaxPendingTraces  int
+	Shards            int
+	AggKey            string
+	AggWindow         time.Duration
+	QueType           string
+	QueSize           int
+	QuePolicy         string
+	SpoolDir          string
+	SpoolSegmentSize  int64
+	SpoolMaxSize      int64
+	SpoolMaxAge       time.Duration
+	SpoolSyncEvery    time.Duration
+	QueBlockTimeout   time.Duration
+	Outputs           stringList
+	ApiEnabled        bool
+	ApiRecent         int
+	ApiWatchBuffer    int
+	SnapLen           int
+	OtlpMetrics       string
+	OtlpInterval      time.Duration
 )
 
+// stringList - value of the flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 func init() {
-	flag.Uint64Var(&SampleRate, "rate", 0, "sample rate value for the tracing")
+	flag.Uint64Var(&SampleRate, "rate", 0, "sample rate of the tracing: one of N flows is traced with the full path of every packet, "+
+		"0 or 1 traces all flows; the flows are sampled in user space, it doesn't cut the events read from the kernel")
 	flag.IntVar(&RingBuffSize, "size", 16777216, "receive ring buffer size in bytes")
 	flag.StringVar(&LogLevel, "level", "INFO", "log level: INFO|DEBUG|WARN|ERROR|PANIC|FATAL")
 	flag.StringVar(&TelemetryEndpoint, "tl", "0.0.0.0:5000", "telemetry endpoint addr")
@@ -25,6 +77,45 @@ func init() {
 	flag.StringVar(&CollectorType, "c", "ebpf", "type of collector: ebpf|netlink")
 	flag.BoolVar(&UseAggregation, "a", false, "use aggregation")
 	flag.BoolVar(&JsonFormat, "j", false, "print in json format")
+	flag.StringVar(&Format, "format", "", "print by the Go template if no -out is set, e.g. '{{.Table}}/{{.Chain}} {{verdict .}}', "+
+		"or by the built-in one: "+strings.Join(printer.BuiltinTemplates(), "|"))
+	flag.DurationVar(&Summary, "summary", 0, "print the table of the top trace groups every interval instead of "+
+		"every trace if no -out is set (0 - disabled)")
+	flag.IntVar(&SummaryTop, "summary-top", sink.DefSummaryTop, "number of the groups in the summary table (0 - all)")
+	flag.StringVar(&SummaryBy, "summary-by", sink.DefSummaryBy, "summary group fields: tuple,chain,rule,verdict,iif,oif,path")
 	flag.BoolVar(&NoPrintTrace, "np", false, "don't print trace (e.g. for debugging reasons)")
+	flag.DurationVar(&TraceGroupMaxAge, "tg-ttl", nftrace.DefTraceGroupMaxAge, "max age of a trace group without the final verdict")
+	flag.IntVar(&MaxTraceGroups, "tg-max", nftrace.DefMaxOpenTraceGroups, "max number of trace groups without the final verdict")
+	flag.DurationVar(&RuleResolveWindow, "rr-window", nftrace.DefRuleResolveWindow, "how long a trace waits for its rule if the rule is not known yet")
+	flag.IntVar(&MaxPendingTraces, "rr-max", nftrace.DefMaxPendingTraces, "max number of traces waiting for their rules")
+	flag.IntVar(&Shards, "shards", nftrace.DefTraceShards, "number of parallel trace assembly workers")
+	flag.StringVar(&AggKey, "agg-key", "", fmt.Sprintf("aggregation key fields: tuple,rule,verdict,iif,oif,chain,path "+
+		"(default: %s, ebpf: %s, path isn't supported by ebpf as the kernel aggregates every rule event)",
+		model.DefAggKey, model.DefKernelAggKey))
+	flag.DurationVar(&AggWindow, "agg-window", 0, "time window the aggregated record is held before it's printed")
+	flag.StringVar(&QueType, "que", nftrace.QueTypeRing, "trace que implementation: ring|list")
+	flag.IntVar(&QueSize, "que-size", 1<<20, "max number of traces in the trace que (the ring que allocates 16 bytes per trace upfront)")
+	flag.StringVar(&QuePolicy, "que-policy", queue.PolicyDropNewest.String(), "trace que overflow policy: drop-newest|drop-oldest|block|priority")
+	flag.DurationVar(&QueBlockTimeout, "que-block-timeout", queue.DefBlockTimeout, "max time the collector waits for free room in the trace que with the block policy")
+	flag.StringVar(&SpoolDir, "spool-dir", "", "directory of the disk spool between the collector and the output, the spool is disabled if empty")
+	flag.Int64Var(&SpoolSegmentSize, "spool-segment-size", spool.DefSegmentSize, "size of the spool segment file in bytes")
+	flag.Int64Var(&SpoolMaxSize, "spool-max-size", spool.DefMaxSize, "max size of the spool in bytes, the oldest segments are discarded above it")
+	flag.DurationVar(&SpoolMaxAge, "spool-max-age", spool.DefMaxAge, "max age of the spool segment, older segments are discarded (0 - no limit)")
+	flag.DurationVar(&SpoolSyncEvery, "spool-sync-every", spool.DefSyncEvery,
+		"interval of syncing the spool to the disk (0 - on every write, negative - left to the OS)")
+	flag.Var(&Outputs, "out", "output sink URL, may be repeated: "+strings.Join(sink.Schemes(), "|")+
+		" (e.g. stdout://?format=text, syslog://siem:514?format=cef|leef, "+
+		"file:///var/log/nftrace.ndjson?max-size=104857600&max-age=24h&keep=10&compress=zstd, "+
+		"pcapng:///tmp/nftrace.pcapng with -snaplen, ipfix://collector:4739?proto=tcp&domain=1, otlp://collector:4317, "+
+		"otlp+http://collector:4318, kafka://broker:9092/nftrace?key=flow&format=protobuf, summary://?interval=10s&top=10, "+
+		"loki://loki:3100?tenant=fw, elasticsearch://es:9200?index=nftrace-{2006.01.02}), default is log://")
+	flag.IntVar(&SnapLen, "snaplen", 0, fmt.Sprintf("number of the packet bytes from the network header captured for every trace "+
+		"(ebpf: up to %d, netlink: up to 60 bytes of the headers), 0 disables the capture", nftrace.MaxEbpfSnapLen))
+	flag.BoolVar(&ApiEnabled, "api", false, "serve the gRPC trace API and the HTTP /traces/stream, /traces/recent on the telemetry endpoint")
+	flag.IntVar(&ApiRecent, "api-recent", traceapi.DefRecentSize, "number of recent traces kept for the API snapshots and /traces/recent")
+	flag.IntVar(&ApiWatchBuffer, "api-buffer", traceapi.DefWatchBuffer, "number of traces buffered for the API watcher or stream client, a slower client is disconnected")
+	flag.StringVar(&OtlpMetrics, "otlp-metrics", "", "OTLP collector URL the agent metrics are pushed to "+
+		"(otlp://collector:4317 or otlp+http://collector:4318), the push is disabled if empty")
+	flag.DurationVar(&OtlpInterval, "otlp-metrics-interval", otlp.DefPushInterval, "period of the OTLP metrics push")
 	flag.Parse()
 }
@@ -4,10 +4,16 @@ import (
 	"context"
 	"os"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/Morwran/ebpf-nftrace/internal/app"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/sink"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/spool"
+	traceapi "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-api"
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
 
 	"github.com/H-BF/corlib/pkg/atomic"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,6 +27,25 @@ type AgentMetrics struct {
 	lostTraceCount    prometheus.Counter
 	rcvTraceCount     prometheus.Counter
 	traceQueOvflCount prometheus.Counter
+	queDropCount      *prometheus.CounterVec
+	queDepth          prometheus.Gauge
+	spoolSize         prometheus.Gauge
+	spoolSegments     prometheus.Gauge
+	spoolLag          *prometheus.GaugeVec
+	spoolDiscardCount prometheus.Counter
+	spoolCorruptCount prometheus.Counter
+	sinkTraceCount    *prometheus.CounterVec
+	sinkErrorCount    *prometheus.CounterVec
+	sinkDropCount     *prometheus.CounterVec
+	sinkHealthy       *prometheus.GaugeVec
+	apiWatchers       prometheus.Gauge
+	apiSlowWatchers   prometheus.Counter
+	tgEvictCount      *prometheus.CounterVec
+	openTraceGroups   *prometheus.GaugeVec
+	ruleResolveCount  *prometheus.CounterVec
+	pendingTraces     *prometheus.GaugeVec
+	shardQueDepth     *prometheus.GaugeVec
+	shardTraceCount   *prometheus.CounterVec
 	numCPU            prometheus.Gauge
 	gcEvents          prometheus.Counter
 }
@@ -32,6 +57,12 @@ const (
 	labelHostName  = "host_name"
 	nsTracer       = "tracer"
 	labelSource    = "source"
+	labelReason    = "reason"
+	labelOutcome   = "outcome"
+	labelShard     = "shard"
+	labelPolicy    = "policy"
+	labelConsumer  = "consumer"
+	labelSink      = "sink"
 )
 
 const ( // error sources
@@ -90,6 +121,25 @@ func SetupMetrics(ctx context.Context) error {
 			am.lostTraceCount,
 			am.rcvTraceCount,
 			am.traceQueOvflCount,
+			am.queDropCount,
+			am.queDepth,
+			am.spoolSize,
+			am.spoolSegments,
+			am.spoolLag,
+			am.spoolDiscardCount,
+			am.spoolCorruptCount,
+			am.sinkTraceCount,
+			am.sinkErrorCount,
+			am.sinkDropCount,
+			am.sinkHealthy,
+			am.apiWatchers,
+			am.apiSlowWatchers,
+			am.tgEvictCount,
+			am.openTraceGroups,
+			am.ruleResolveCount,
+			am.pendingTraces,
+			am.shardQueDepth,
+			am.shardTraceCount,
 			am.numCPU,
 			am.gcEvents,
 		},
@@ -149,6 +199,134 @@ func (am *AgentMetrics) init(labels prometheus.Labels) {
 		Help:        "count of overflow events in a trace queue",
 		ConstLabels: labels,
 	})
+	am.queDropCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "trace_que_drop_counter",
+		Help:        "count of traces dropped by the overflow policy of a trace queue",
+		ConstLabels: labels,
+	}, []string{labelPolicy})
+	for _, p := range queue.Policies() {
+		am.queDropCount.WithLabelValues(p.String()).Add(0)
+	}
+	am.queDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "trace_que_depth",
+		Help:        "number of traces waiting in a trace queue",
+		ConstLabels: labels,
+	})
+	am.spoolSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "spool_size_bytes",
+		Help:        "size of the disk spool",
+		ConstLabels: labels,
+	})
+	am.spoolSegments = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "spool_segments",
+		Help:        "number of segment files of the disk spool",
+		ConstLabels: labels,
+	})
+	am.spoolLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "spool_lag_bytes",
+		Help:        "bytes of the disk spool not committed by the consumer yet",
+		ConstLabels: labels,
+	}, []string{labelConsumer})
+	am.spoolDiscardCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "spool_discard_counter",
+		Help:        "count of traces discarded from the disk spool by its size or age cap, or too large to be spooled",
+		ConstLabels: labels,
+	})
+	am.spoolCorruptCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "spool_corrupt_counter",
+		Help:        "count of disk spool records that passed the checksum but failed to decode",
+		ConstLabels: labels,
+	})
+	am.sinkTraceCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "sink_trace_counter",
+		Help:        "count of traces written to the output sink",
+		ConstLabels: labels,
+	}, []string{labelSink})
+	am.sinkErrorCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "sink_error_counter",
+		Help:        "count of failed writes and flushes of the output sink",
+		ConstLabels: labels,
+	}, []string{labelSink})
+	am.sinkDropCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "sink_drop_counter",
+		Help:        "count of traces dropped because the output sink doesn't keep up",
+		ConstLabels: labels,
+	}, []string{labelSink})
+	am.sinkHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "sink_healthy",
+		Help:        "1 if the last write to the output sink succeeded, 0 otherwise",
+		ConstLabels: labels,
+	}, []string{labelSink})
+	am.apiWatchers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "api_watchers",
+		Help:        "number of clients watching the traces through grpc or the http stream",
+		ConstLabels: labels,
+	})
+	am.apiSlowWatchers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "api_slow_watcher_counter",
+		Help:        "count of grpc or http stream watchers disconnected because they don't keep up with the traces",
+		ConstLabels: labels,
+	})
+	am.tgEvictCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "trace_group_evict_counter",
+		Help:        "count of incomplete trace groups evicted by age or by max number of open groups",
+		ConstLabels: labels,
+	}, []string{labelReason})
+	for _, reason := range []string{nftrace.EvictReasonAge, nftrace.EvictReasonSize} {
+		am.tgEvictCount.WithLabelValues(reason).Add(0)
+	}
+	am.openTraceGroups = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "open_trace_groups",
+		Help:        "number of trace groups waiting for the final verdict",
+		ConstLabels: labels,
+	}, []string{labelShard})
+	am.ruleResolveCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "rule_resolve_counter",
+		Help:        "count of traces whose rule was not found in the rule cache at the first attempt by outcome",
+		ConstLabels: labels,
+	}, []string{labelOutcome})
+	for _, outcome := range []string{
+		nftrace.ResolveOutcomeDeferred,
+		nftrace.ResolveOutcomeResolved,
+		nftrace.ResolveOutcomeUnresolved,
+		nftrace.ResolveOutcomeDropped,
+	} {
+		am.ruleResolveCount.WithLabelValues(outcome).Add(0)
+	}
+	am.pendingTraces = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "pending_rule_traces",
+		Help:        "number of traces waiting for their rule",
+		ConstLabels: labels,
+	}, []string{labelShard})
+	am.shardQueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   nsTracer,
+		Name:        "shard_que_depth",
+		Help:        "number of trace events waiting for the trace assembly worker",
+		ConstLabels: labels,
+	}, []string{labelShard})
+	am.shardTraceCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   nsTracer,
+		Name:        "shard_trace_counter",
+		Help:        "count of trace events handled by the trace assembly worker",
+		ConstLabels: labels,
+	}, []string{labelShard})
 
 	am.numCPU = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace:   nsTracer,
@@ -181,6 +359,91 @@ func (am *AgentMetrics) ObserveCounters(cnt Counter) {
 	}
 }
 
+// ObserveQueDropCounter -
+func (am *AgentMetrics) ObserveQueDropCounter(policy string, cnt uint64) {
+	am.queDropCount.WithLabelValues(policy).Add(float64(cnt))
+}
+
+// ObserveQueDepth -
+func (am *AgentMetrics) ObserveQueDepth(depth int) {
+	am.queDepth.Set(float64(depth))
+}
+
+// ObserveSpool -
+func (am *AgentMetrics) ObserveSpool(ev any) {
+	switch o := ev.(type) {
+	case spool.SpoolSizeEvent:
+		am.spoolSize.Set(float64(o.Size))
+		am.spoolSegments.Set(float64(o.Segments))
+	case spool.SpoolLagEvent:
+		am.spoolLag.WithLabelValues(o.Consumer).Set(float64(o.Lag))
+	case spool.CountSpoolDiscardEvent:
+		am.spoolDiscardCount.Add(float64(o.Cnt))
+	case spool.CountSpoolCorruptEvent:
+		am.spoolCorruptCount.Add(float64(o.Cnt))
+	}
+}
+
+// ObserveSink -
+func (am *AgentMetrics) ObserveSink(ev any) {
+	switch o := ev.(type) {
+	case sink.CountSinkTraceEvent:
+		am.sinkTraceCount.WithLabelValues(o.Sink).Add(float64(o.Cnt))
+	case sink.CountSinkErrorEvent:
+		am.sinkErrorCount.WithLabelValues(o.Sink).Inc()
+	case sink.CountSinkDropEvent:
+		am.sinkDropCount.WithLabelValues(o.Sink).Add(float64(o.Cnt))
+	case sink.SinkHealthEvent:
+		var v float64
+		if o.Healthy {
+			v = 1
+		}
+		am.sinkHealthy.WithLabelValues(o.Sink).Set(v)
+	}
+}
+
+// ObserveTraceApi -
+func (am *AgentMetrics) ObserveTraceApi(ev any) {
+	switch o := ev.(type) {
+	case traceapi.CountWatchTraceEvent:
+		am.ObserveCounters(TraceCountSrc{Cnt: o.Cnt})
+	case traceapi.WatchersEvent:
+		am.apiWatchers.Set(float64(o.Cnt))
+	case traceapi.CountSlowWatcherEvent:
+		am.apiSlowWatchers.Inc()
+	}
+}
+
+// ObserveTraceGroupEvictCounter -
+func (am *AgentMetrics) ObserveTraceGroupEvictCounter(reason string, cnt uint64) {
+	am.tgEvictCount.WithLabelValues(reason).Add(float64(cnt))
+}
+
+// ObserveOpenTraceGroups -
+func (am *AgentMetrics) ObserveOpenTraceGroups(shard, cnt int) {
+	am.openTraceGroups.WithLabelValues(strconv.Itoa(shard)).Set(float64(cnt))
+}
+
+// ObserveRuleResolveCounter -
+func (am *AgentMetrics) ObserveRuleResolveCounter(outcome string, cnt uint64) {
+	am.ruleResolveCount.WithLabelValues(outcome).Add(float64(cnt))
+}
+
+// ObservePendingTraces -
+func (am *AgentMetrics) ObservePendingTraces(shard, cnt int) {
+	am.pendingTraces.WithLabelValues(strconv.Itoa(shard)).Set(float64(cnt))
+}
+
+// ObserveShardQueDepth -
+func (am *AgentMetrics) ObserveShardQueDepth(shard, depth int) {
+	am.shardQueDepth.WithLabelValues(strconv.Itoa(shard)).Set(float64(depth))
+}
+
+// ObserveShardTraceCounter -
+func (am *AgentMetrics) ObserveShardTraceCounter(shard int, cnt uint64) {
+	am.shardTraceCount.WithLabelValues(strconv.Itoa(shard)).Add(float64(cnt))
+}
+
 // ObserveErrNlMemCounter -
 func (am *AgentMetrics) ObserveErrNlMemCounter(errSource string) {
 	am.errNlMemCount.WithLabelValues(errSource).Inc()
@@ -0,0 +1,35 @@
+package nftrace
+
+import (
+	"net/url"
+
+	"github.com/Morwran/ebpf-nftrace/internal/app"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/otlp"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SetupOtlpMetrics - pusher of the agent metrics to the OTLP collector given by -otlp-metrics,
+// nil if the push is disabled
+func SetupOtlpMetrics() (*otlp.MetricsPusher, error) {
+	if OtlpMetrics == "" {
+		return nil, nil //nolint:nilnil
+	}
+	var reg *prometheus.Registry
+	app.WhenHaveMetricsRegistry(func(r *prometheus.Registry) {
+		reg = r
+	})
+	if reg == nil {
+		return nil, errors.New("metrics registry is not set up")
+	}
+	u, err := url.Parse(OtlpMetrics)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid OTLP metrics URL '%s'", OtlpMetrics)
+	}
+	exp, err := otlp.Dial(u)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to setup OTLP metrics '%s'", OtlpMetrics)
+	}
+	return &otlp.MetricsPusher{Exporter: exp, Gatherer: reg, Interval: OtlpInterval}, nil
+}
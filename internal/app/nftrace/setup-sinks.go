@@ -0,0 +1,56 @@
+package nftrace
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/sink"
+
+	"github.com/pkg/errors"
+)
+
+// SetupSinks - opens the output sinks given by the -out flags, the logger is the output by default
+func SetupSinks() (ret []sink.Named, err error) {
+	defer func() {
+		if err != nil {
+			for _, s := range ret {
+				_ = s.Sink.Close()
+			}
+			ret = nil
+		}
+	}()
+	if JsonFormat && Format != "" {
+		return nil, errors.New("-j and -format are mutually exclusive")
+	}
+	if Summary > 0 && (JsonFormat || Format != "") {
+		return nil, errors.New("-summary is mutually exclusive with -j and -format")
+	}
+	urls := Outputs
+	if len(urls) == 0 && !NoPrintTrace {
+		def := fmt.Sprintf("log://?json=%t", JsonFormat)
+		switch {
+		case Summary > 0:
+			def = fmt.Sprintf("summary://?interval=%s&top=%d&by=%s", Summary, SummaryTop, url.QueryEscape(SummaryBy))
+		case Format != "":
+			def = "log://?template=" + url.QueryEscape(Format)
+		}
+		urls = []string{def}
+	}
+	names := make(map[string]int, len(urls))
+	for _, u := range urls {
+		if SnapLen <= 0 && strings.HasPrefix(strings.ToLower(u), "pcapng:") {
+			return ret, errors.Errorf("output '%s' writes the captured packets, set -snaplen", u)
+		}
+		s, e := sink.Open(u)
+		if e != nil {
+			return ret, e
+		}
+		name := sink.Name(u)
+		if names[name]++; names[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, names[name])
+		}
+		ret = append(ret, sink.Named{Name: name, Sink: s})
+	}
+	return ret, nil
+}
@@ -0,0 +1,45 @@
+package nftrace
+
+import (
+	"strings"
+
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/sink"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/spool"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/pkg/errors"
+)
+
+// SetupSpool - disk spool between the collector and the output, nil if the spool is disabled
+func SetupSpool(source nftrace.TraceCollector, subj observer.Subject) (*spool.Spool, error) {
+	if SpoolDir == "" {
+		return nil, nil //nolint:nilnil
+	}
+	s, err := spool.New(spool.Deps{Source: source, Subj: subj}, SpoolDir,
+		spool.WithSegmentSize(SpoolSegmentSize),
+		spool.WithMaxSize(SpoolMaxSize),
+		spool.WithMaxAge(SpoolMaxAge),
+		spool.WithSyncEvery(SpoolSyncEvery),
+	)
+	return s, errors.WithMessage(err, "failed to open spool")
+}
+
+// SpoolReaders - spool consumer of every sink, so every sink reads and commits the spool at its own pace.
+// The offsets of the consumers not used anymore are forgotten
+func SpoolReaders(s *spool.Spool, sinks []sink.Named) (map[string]sink.TraceReader, error) {
+	ret := make(map[string]sink.TraceReader, len(sinks))
+	names := make([]string, 0, len(sinks))
+	for _, sn := range sinks {
+		name := "sink-" + spoolConsumerName.Replace(sn.Name)
+		c, err := s.Consumer(name)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to open spool consumer of sink '%s'", sn.Name)
+		}
+		ret[sn.Name] = c
+		names = append(names, name)
+	}
+	return ret, errors.WithMessage(s.Retain(names...), "failed to retain spool consumers")
+}
+
+var spoolConsumerName = strings.NewReplacer("/", "_", `\`, "_", ".", "_")
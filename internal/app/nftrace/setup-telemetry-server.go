@@ -2,6 +2,7 @@ package nftrace
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/Morwran/ebpf-nftrace/internal/app"
 
@@ -10,8 +11,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// WhenSetupTelemtryServer -
-func WhenSetupTelemtryServer(ctx context.Context, f func(*server.APIServer) error) error {
+// WhenSetupTelemtryServer - the services and the HTTP handlers by their patterns are served on the telemetry endpoint
+// along with the metrics
+func WhenSetupTelemtryServer(ctx context.Context, services []server.APIService, handlers map[string]http.Handler,
+	f func(*server.APIServer) error) error {
 	var (
 		opts []server.APIServerOption
 		err  error
@@ -25,6 +28,12 @@ func WhenSetupTelemtryServer(ctx context.Context, f func(*server.APIServer) erro
 	})
 
 	opts = append(opts, server.WithHttpHandler("/debug", app.PProfHandler()))
+	for pattern, h := range handlers {
+		opts = append(opts, server.WithHttpHandler(pattern, h))
+	}
+	if len(services) > 0 {
+		opts = append(opts, server.WithServices(services...))
+	}
 	if len(opts) == 0 {
 		return nil
 	}
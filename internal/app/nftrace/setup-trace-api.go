@@ -0,0 +1,25 @@
+package nftrace
+
+import (
+	traceapi "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-api"
+	iface "github.com/Morwran/ebpf-nftrace/internal/providers/iface-provider"
+	"github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+)
+
+// SetupTraceApi - gRPC and HTTP trace API, nil if the API is disabled
+func SetupTraceApi(ifaceProvider iface.IfaceProvider, ruleProvider nfrule.RuleProvider, subj observer.Subject) *traceapi.Service {
+	if !ApiEnabled {
+		return nil
+	}
+	return traceapi.NewService(
+		traceapi.Deps{
+			IfaceProvider: ifaceProvider,
+			RuleProvider:  ruleProvider,
+			Subj:          subj,
+		},
+		traceapi.WithRecentSize(ApiRecent),
+		traceapi.WithWatchBuffer(ApiWatchBuffer),
+	)
+}
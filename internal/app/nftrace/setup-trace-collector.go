@@ -4,7 +4,9 @@ import (
 	"context"
 	"strings"
 
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
 	"github.com/Morwran/ebpf-nftrace/internal/nftrace"
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
 	"github.com/Morwran/ebpf-nftrace/internal/providers/iface-provider"
 	"github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
 
@@ -29,7 +31,37 @@ func SetupCollector(ctx context.Context, ifaceProvider iface.IfaceProvider, rule
 	return collector(ctx, ifaceProvider, ruleProvider, subj)
 }
 
+func aggregation() (agg nftrace.Aggregation, err error) {
+	agg.Enabled = UseAggregation
+	agg.Window = AggWindow
+	if AggKey == "" {
+		return agg, nil
+	}
+	if agg.Key, err = model.ParseAggKey(AggKey); err != nil {
+		return agg, errors.WithMessage(err, "failed to parse aggregation key")
+	}
+	return agg, nil
+}
+
+func queSettings() (qs nftrace.QueSettings, err error) {
+	qs.Size = QueSize
+	qs.Type = strings.ToLower(strings.TrimSpace(QueType))
+	qs.BlockTimeout = QueBlockTimeout
+	if qs.Policy, err = queue.ParsePolicy(QuePolicy); err != nil {
+		return qs, errors.WithMessage(err, "failed to parse que policy")
+	}
+	return qs, nil
+}
+
 func setupNetlinkCollector(ctx context.Context, ifaceProvider iface.IfaceProvider, ruleProvider nfrule.RuleProvider, subj observer.Subject) (nftrace.TraceCollector, error) {
+	agg, err := aggregation()
+	if err != nil {
+		return nil, err
+	}
+	qs, err := queSettings()
+	if err != nil {
+		return nil, err
+	}
 	return nftrace.NewNetlinkCollector(
 		nftrace.NetlinkCollectorDeps{
 			IfaceProvider: ifaceProvider,
@@ -37,12 +69,25 @@ func setupNetlinkCollector(ctx context.Context, ifaceProvider iface.IfaceProvide
 			Subj:          subj,
 		},
 		1<<30,
-		UseAggregation,
-		5000000,
+		SampleRate,
+		agg,
+		qs,
+		Shards,
+		SnapLen,
+		ruleResolverOptions(),
+		traceGroupOptions()...,
 	)
 }
 
 func setupEbpfCollector(ctx context.Context, ifaceProvider iface.IfaceProvider, ruleProvider nfrule.RuleProvider, subj observer.Subject) (nftrace.TraceCollector, error) {
+	agg, err := aggregation()
+	if err != nil {
+		return nil, err
+	}
+	qs, err := queSettings()
+	if err != nil {
+		return nil, err
+	}
 	return nftrace.NewEbpfCollector(
 		nftrace.EbpfCollectorDeps{
 			IfaceProvider: ifaceProvider,
@@ -51,8 +96,26 @@ func setupEbpfCollector(ctx context.Context, ifaceProvider iface.IfaceProvider,
 		},
 		SampleRate,
 		RingBuffSize,
-		UseAggregation,
+		agg,
 		EvRate,
-		5000000,
+		qs,
+		Shards,
+		SnapLen,
+		ruleResolverOptions(),
+		traceGroupOptions()...,
 	)
 }
+
+func traceGroupOptions() []nftrace.TraceGroupOption {
+	return []nftrace.TraceGroupOption{
+		nftrace.WithGroupMaxAge(TraceGroupMaxAge),
+		nftrace.WithMaxOpenGroups(MaxTraceGroups),
+	}
+}
+
+func ruleResolverOptions() []nftrace.RuleResolverOption {
+	return []nftrace.RuleResolverOption{
+		nftrace.WithRuleResolveWindow(RuleResolveWindow),
+		nftrace.WithMaxPendingTraces(MaxPendingTraces),
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+)
+
+// AggKey - set of the trace fields the aggregation key is built from.
+// Values must be kept in sync with AGG_KEY_* in ebpf/input_params.h
+type AggKey uint32
+
+const (
+	// AggTuple - protocol, addresses and ports
+	AggTuple AggKey = 1 << iota
+	// AggRule - table, chain and handle of the rule
+	AggRule
+	// AggVerdict - final verdict of the trace, the rule one if the path is incomplete
+	AggVerdict
+	// AggIif - input interface
+	AggIif
+	// AggOif - output interface
+	AggOif
+	// AggChain - table and chain of the rule
+	AggChain
+	// AggPath - full path of the packet through the ruleset
+	AggPath
+)
+
+// DefAggKey - default aggregation key: the flow and the path it took through the ruleset
+const DefAggKey = AggTuple | AggPath
+
+// KernelAggKeys - fields the in-kernel aggregation of the eBPF collector supports. The kernel aggregates
+// every rule event before the events of the packet are assembled into the path, so AggPath can't be
+// computed there the way Trace.Key does it
+const KernelAggKeys = AggTuple | AggRule | AggVerdict | AggIif | AggOif | AggChain
+
+// DefKernelAggKey - default key of the in-kernel aggregation: the flow and the rule with its verdict
+const DefKernelAggKey = AggTuple | AggRule | AggVerdict
+
+var aggKeyNames = []struct {
+	key  AggKey
+	name string
+}{
+	{AggTuple, "tuple"},
+	{AggRule, "rule"},
+	{AggVerdict, "verdict"},
+	{AggIif, "iif"},
+	{AggOif, "oif"},
+	{AggChain, "chain"},
+	{AggPath, "path"},
+}
+
+// ParseAggKey - parse comma separated list of the key fields: tuple,rule,verdict,iif,oif,chain,path
+func ParseAggKey(s string) (k AggKey, err error) {
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		var found bool
+		for _, n := range aggKeyNames {
+			if n.name == f {
+				k |= n.key
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.Errorf("unknown aggregation key field '%s'", f)
+		}
+	}
+	if k == 0 {
+		return 0, errors.New("aggregation key is empty")
+	}
+	return k, nil
+}
+
+func (k AggKey) String() string {
+	var fields []string
+	for _, n := range aggKeyNames {
+		if k&n.key != 0 {
+			fields = append(fields, n.name)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Key - aggregation key of the trace built from the chosen fields. Every string is prefixed by its length,
+// so the adjacent fields can't be shifted into each other, e.g. table 'ab' and chain 'c' vs table 'a' and chain 'bc'
+func (t *Trace) Key(k AggKey) uint64 {
+	var (
+		d   xxhash.Digest
+		buf [8]byte
+	)
+	d.Reset()
+	str := func(s string) {
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(s))) //nolint:gosec
+		_, _ = d.Write(buf[:4])
+		_, _ = d.WriteString(s)
+	}
+	if k&AggTuple != 0 {
+		str(t.Family)
+		str(t.IpProto)
+		sa, da := t.SAddr.As16(), t.DAddr.As16()
+		_, _ = d.Write(sa[:])
+		_, _ = d.Write(da[:])
+		binary.BigEndian.PutUint32(buf[:4], t.SPort)
+		binary.BigEndian.PutUint32(buf[4:], t.DPort)
+		_, _ = d.Write(buf[:])
+	}
+	if k&(AggRule|AggChain) != 0 {
+		str(t.Table)
+		str(t.Chain)
+	}
+	if k&AggRule != 0 {
+		binary.BigEndian.PutUint64(buf[:], t.RuleHandle)
+		_, _ = d.Write(buf[:])
+	}
+	if k&AggVerdict != 0 {
+		// the final verdict of the path, the rule one if the path is incomplete
+		if t.Final != "" {
+			str(t.Final)
+		} else {
+			str(t.Verdict)
+		}
+	}
+	if k&AggIif != 0 {
+		str(t.Iifname)
+	}
+	if k&AggOif != 0 {
+		str(t.Oifname)
+	}
+	if k&AggPath != 0 {
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(t.Path))) //nolint:gosec
+		_, _ = d.Write(buf[:4])
+		for i := range t.Path {
+			h := &t.Path[i]
+			str(h.Type)
+			str(h.Table)
+			str(h.Chain)
+			binary.BigEndian.PutUint64(buf[:], h.Handle)
+			_, _ = d.Write(buf[:])
+			str(h.Verdict)
+			str(h.JumpTarget)
+		}
+	}
+	return d.Sum64()
+}
+
+// Merge - add the counters of the other trace aggregated by the same key
+func (t *Trace) Merge(o Trace) {
+	t.Cnt += o.Cnt
+	t.Bytes += o.Bytes
+	if !o.FirstSeen.IsZero() && (t.FirstSeen.IsZero() || o.FirstSeen.Before(t.FirstSeen)) {
+		t.FirstSeen = o.FirstSeen
+	}
+	if o.LastSeen.After(t.LastSeen) {
+		t.LastSeen = o.LastSeen
+	}
+}
@@ -3,13 +3,35 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
 	"strconv"
+	"strings"
 	"time"
-
-	"github.com/cespare/xxhash"
 )
 
 type (
+	// HwAddr - MAC address in the binary form
+	HwAddr [6]byte
+
+	// Hop - single step of the packet path through the ruleset
+	Hop struct {
+		// trace type (rule/return/policy)
+		Type string `json:"type"`
+		// nftables table name
+		Table string `json:"table_name"`
+		// nftables chain name
+		Chain string `json:"chain_name"`
+		// nftables rule number
+		Handle uint64 `json:"handle,omitempty"`
+		// rule expression as string
+		Rule string `json:"rule,omitempty"`
+		// verdict of the hop
+		Verdict string `json:"verdict"`
+		// nftables jump to a target name
+		JumpTarget string `json:"jt,omitempty"`
+	}
+
 	// Trace -
 	Trace struct {
 		// trace id
@@ -24,18 +46,24 @@ type (
 		RuleHandle uint64 `json:"handle"`
 		// protocols family
 		Family string `json:"family"`
+		// layer 3 protocol of the packet (ip/ip6), differs from family for inet, bridge and netdev tables
+		L3Proto string `json:"l3proto,omitempty"`
 		// input network interface
 		Iifname string `json:"iif,omitempty"`
 		// output network interface
 		Oifname string `json:"oif,omitempty"`
+		// input network interface index
+		Iif uint32 `json:"iif-index,omitempty"`
+		// output network interface index
+		Oif uint32 `json:"oif-index,omitempty"`
 		// source mac address
-		SMacAddr string `json:"hw-src,omitempty"`
+		SMacAddr HwAddr `json:"hw-src,omitempty"`
 		// destination mac address
-		DMacAddr string `json:"hw-dst,omitempty"`
+		DMacAddr HwAddr `json:"hw-dst,omitempty"`
 		// source ip address
-		SAddr string `json:"ip-src,omitempty"`
+		SAddr netip.Addr `json:"ip-src,omitempty"`
 		// destination ip address
-		DAddr string `json:"ip-dst,omitempty"`
+		DAddr netip.Addr `json:"ip-dst,omitempty"`
 		// source port
 		SPort uint32 `json:"sport,omitempty"`
 		// destination port
@@ -44,19 +72,119 @@ type (
 		Length uint32 `json:"len"`
 		// ip protocol (tcp/udp/icmp/...)
 		IpProto string `json:"proto"`
-		// verdict for the rule
+		// verdict for the rule, summary of the path
 		Verdict string `json:"verdict"`
+		// final verdict of the path (accept/drop/queue/stolen), empty if the path is incomplete or the packet
+		// goes on after it, e.g. accept in prerouting or in forward followed by a postrouting chain
+		Final string `json:"final,omitempty"`
 		// rule expression as string
 		Rule string `json:"rule"`
-		// aggregated trace counter
+		// full path of the packet through the ruleset
+		Path []Hop `json:"path,omitempty"`
+		// conntrack id
+		CtId uint32 `json:"ct-id,omitempty"`
+		// conntrack state (new/established/related/...)
+		CtState string `json:"ct-state,omitempty"`
+		// conntrack direction (original/reply)
+		CtDirection string `json:"ct-dir,omitempty"`
+		// conntrack status (assured/confirmed/snat/...)
+		CtStatus string `json:"ct-status,omitempty"`
+		// aggregated trace counter (packets)
 		Cnt uint64 `json:"cnt"`
+		// aggregated bytes
+		Bytes uint64 `json:"bytes"`
+		// first packet of the aggregated record
+		FirstSeen time.Time `json:"first_seen"`
+		// last packet of the aggregated record
+		LastSeen time.Time `json:"last_seen"`
+		// trace group was evicted before it got the final verdict
+		Incomplete bool `json:"incomplete,omitempty"`
 		// timestamp
 		Timestamp time.Time `json:"timestamp"`
+		// first bytes of the packet from the network header, captured if the snap length is set
+		Packet []byte `json:"packet,omitempty"`
 	}
 )
 
+// Hash - aggregation key by default: the flow and the path it took through the ruleset
 func (t *Trace) Hash() uint64 {
-	return xxhash.Sum64String(t.IpProto + t.SAddr + t.DAddr + strconv.Itoa(int(t.SPort)) + strconv.Itoa(int(t.DPort)))
+	return t.Key(DefAggKey)
+}
+
+// PathString - path in a short human readable form
+func (t *Trace) PathString() string {
+	sb := strings.Builder{}
+	for i, h := range t.Path {
+		if i > 0 {
+			sb.WriteString(" -> ")
+		}
+		sb.WriteString(h.String())
+	}
+	return sb.String()
+}
+
+func (h Hop) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(h.Type)
+	sb.WriteByte(' ')
+	sb.WriteString(h.Table)
+	sb.WriteByte('/')
+	sb.WriteString(h.Chain)
+	if h.Handle != 0 {
+		sb.WriteByte('#')
+		sb.WriteString(strconv.FormatUint(h.Handle, 10))
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(h.Verdict)
+	if h.JumpTarget != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(h.JumpTarget)
+	}
+	return sb.String()
+}
+
+// MarshalJSON - addresses are formatted here, the trace keeps them in the binary form until the output
+func (t Trace) MarshalJSON() ([]byte, error) {
+	type trace Trace
+	return json.Marshal(struct {
+		trace
+		SMacAddr string `json:"hw-src,omitempty"`
+		DMacAddr string `json:"hw-dst,omitempty"`
+		SAddr    string `json:"ip-src,omitempty"`
+		DAddr    string `json:"ip-dst,omitempty"`
+	}{
+		trace:    trace(t),
+		SMacAddr: t.SMacAddr.String(),
+		DMacAddr: t.DMacAddr.String(),
+		SAddr:    AddrString(t.SAddr),
+		DAddr:    AddrString(t.DAddr),
+	})
+}
+
+// UnmarshalJSON - reverse of MarshalJSON
+func (t *Trace) UnmarshalJSON(b []byte) (err error) {
+	type trace Trace
+	v := struct {
+		*trace
+		SMacAddr string `json:"hw-src"`
+		DMacAddr string `json:"hw-dst"`
+		SAddr    string `json:"ip-src"`
+		DAddr    string `json:"ip-dst"`
+	}{trace: (*trace)(t)}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if t.SMacAddr, err = ParseHwAddr(v.SMacAddr); err != nil {
+		return err
+	}
+	if t.DMacAddr, err = ParseHwAddr(v.DMacAddr); err != nil {
+		return err
+	}
+	if t.SAddr, err = parseAddr(v.SAddr); err != nil {
+		return err
+	}
+	t.DAddr, err = parseAddr(v.DAddr)
+	return err
 }
 
 func (t *Trace) JsonString() string {
@@ -66,7 +194,67 @@ func (t *Trace) JsonString() string {
 
 func (t *Trace) FiveTuple() string {
 	return fmt.Sprintf("src=%-25s dst=%-25s proto=%-8s",
-		fmt.Sprintf("%s:%d", t.SAddr, t.SPort),
-		fmt.Sprintf("%s:%d", t.DAddr, t.DPort),
+		fmt.Sprintf("%s:%d", AddrString(t.SAddr), t.SPort),
+		fmt.Sprintf("%s:%d", AddrString(t.DAddr), t.DPort),
 		t.IpProto)
 }
+
+// String - MAC address in the colon separated form, empty for zero address
+func (a HwAddr) String() string {
+	const hexDigit = "0123456789abcdef"
+	if a.IsZero() {
+		return ""
+	}
+	buf := make([]byte, 0, len(a)*3-1)
+	for i, b := range a {
+		if i > 0 {
+			buf = append(buf, ':')
+		}
+		buf = append(buf, hexDigit[b>>4], hexDigit[b&0xF])
+	}
+	return string(buf)
+}
+
+// IsZero -
+func (a HwAddr) IsZero() bool {
+	return a == HwAddr{}
+}
+
+// HwAddrFrom - MAC address from the slice, zero if the slice is not a MAC address
+func HwAddrFrom(b []byte) (a HwAddr) {
+	if len(b) == len(a) {
+		copy(a[:], b)
+	}
+	return a
+}
+
+// ParseHwAddr - parse MAC address in the colon separated form, empty string is zero address
+func ParseHwAddr(s string) (a HwAddr, err error) {
+	if s == "" {
+		return a, nil
+	}
+	hw, err := net.ParseMAC(s)
+	if err != nil {
+		return a, err
+	}
+	if len(hw) != len(a) {
+		return a, fmt.Errorf("invalid MAC address %q", s)
+	}
+	copy(a[:], hw)
+	return a, nil
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	if s == "" {
+		return netip.Addr{}, nil
+	}
+	return netip.ParseAddr(s)
+}
+
+// AddrString - ip address as string, empty for zero address
+func AddrString(a netip.Addr) string {
+	if !a.IsValid() {
+		return ""
+	}
+	return a.String()
+}
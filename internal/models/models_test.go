@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -33,25 +35,129 @@ func Test_TraceJson(t *testing.T) {
 		// length packet
 		Length: 123,
 		// source mac address
-		SMacAddr: "00:00:00:00:00:00",
+		SMacAddr: HwAddr{0, 1, 2, 3, 4, 5},
 		// destination mac address
-		DMacAddr: "00:00:00:00:00:00",
+		DMacAddr: HwAddr{},
 		// source ip address
-		SAddr: "192.168.0.1",
+		SAddr: netip.MustParseAddr("192.168.0.1"),
 		// destination ip address
-		DAddr: "192.168.0.2",
+		DAddr: netip.MustParseAddr("192.168.0.2"),
 		// source port
 		SPort: 80,
 		// destination port
 		DPort: 443,
 		// aggregated trace counter
 		Cnt: 10,
+		// aggregated bytes
+		Bytes: 1230,
 		Timestamp: func() time.Time {
 			t, _ := time.Parse("2006-01-02 15:04:05", "2024-09-28 01:11:14")
 			return t
 		}(),
 	}
-	expJson := `{"trace_id":123,"table_name":"tb1","chain_name":"ch1","jt":"jt1","handle":5,"family":"ip","iif":"eth0","oif":"eth1","hw-src":"00:00:00:00:00:00","hw-dst":"00:00:00:00:00:00","ip-src":"192.168.0.1","ip-dst":"192.168.0.2","sport":80,"dport":443,"len":123,"proto":"tcp","verdict":"accept","rule":"rule","cnt":10,"timestamp":"2024-09-28T01:11:14Z"}`
+	trace.FirstSeen, trace.LastSeen = trace.Timestamp, trace.Timestamp
+	expJson := `{"trace_id":123,"table_name":"tb1","chain_name":"ch1","jt":"jt1","handle":5,"family":"ip","iif":"eth0","oif":"eth1","sport":80,"dport":443,"len":123,"proto":"tcp","verdict":"accept","rule":"rule","cnt":10,"bytes":1230,"first_seen":"2024-09-28T01:11:14Z","last_seen":"2024-09-28T01:11:14Z","timestamp":"2024-09-28T01:11:14Z","hw-src":"00:01:02:03:04:05","ip-src":"192.168.0.1","ip-dst":"192.168.0.2"}`
 
 	require.Equal(t, expJson, trace.JsonString())
+
+	var got Trace
+	require.NoError(t, json.Unmarshal([]byte(expJson), &got))
+	require.Equal(t, trace, got)
+}
+
+func Test_TracePath(t *testing.T) {
+	trace := Trace{
+		Family:  "ip",
+		IpProto: "tcp",
+		SAddr:   netip.MustParseAddr("192.168.0.1"),
+		DAddr:   netip.MustParseAddr("192.168.0.2"),
+		Verdict: "rule::jump->rule::accept",
+		Path: []Hop{
+			{Type: "rule", Table: "filter", Chain: "input", Handle: 5, Verdict: "jump", JumpTarget: "web"},
+			{Type: "rule", Table: "filter", Chain: "web", Handle: 7, Verdict: "accept", Rule: "tcp dport 80 accept"},
+		},
+	}
+	require.Equal(t, "rule filter/input#5 jump web -> rule filter/web#7 accept", trace.PathString())
+
+	other := trace
+	other.Path = []Hop{trace.Path[0], trace.Path[1]}
+	require.Equal(t, trace.Hash(), other.Hash())
+	other.Path[1].Handle = 8
+	require.NotEqual(t, trace.Hash(), other.Hash())
+
+	expJson := `{"trace_id":0,"table_name":"","chain_name":"","handle":0,"family":"ip","len":0,"proto":"tcp","verdict":"rule::jump-\u003erule::accept","rule":"","path":[{"type":"rule","table_name":"filter","chain_name":"input","handle":5,"verdict":"jump","jt":"web"},{"type":"rule","table_name":"filter","chain_name":"web","handle":7,"rule":"tcp dport 80 accept","verdict":"accept"}],"cnt":0,"bytes":0,"first_seen":"0001-01-01T00:00:00Z","last_seen":"0001-01-01T00:00:00Z","timestamp":"0001-01-01T00:00:00Z","ip-src":"192.168.0.1","ip-dst":"192.168.0.2"}`
+	require.Equal(t, expJson, trace.JsonString())
+}
+
+func Benchmark_TraceHash(b *testing.B) {
+	tr := Trace{
+		Family:  "inet",
+		IpProto: "tcp",
+		SAddr:   netip.MustParseAddr("10.0.0.1"),
+		DAddr:   netip.MustParseAddr("10.0.0.2"),
+		SPort:   1000,
+		DPort:   80,
+		Path: []Hop{
+			{Type: "rule", Table: "filter", Chain: "input", Handle: 1, Verdict: "jump", JumpTarget: "allowed"},
+			{Type: "rule", Table: "filter", Chain: "allowed", Handle: 2, Verdict: "accept"},
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = tr.Hash()
+	}
+}
+
+func Test_AggKey(t *testing.T) {
+	k, err := ParseAggKey("tuple, verdict,iif")
+	require.NoError(t, err)
+	require.Equal(t, AggTuple|AggVerdict|AggIif, k)
+	require.Equal(t, "tuple,verdict,iif", k.String())
+	_, err = ParseAggKey("tuple,foo")
+	require.Error(t, err)
+	_, err = ParseAggKey("")
+	require.Error(t, err)
+
+	accept := Trace{
+		IpProto: "tcp",
+		SAddr:   netip.MustParseAddr("10.0.0.1"),
+		DAddr:   netip.MustParseAddr("10.0.0.2"),
+		Verdict: "rule::accept",
+		Path:    []Hop{{Type: "rule", Table: "filter", Chain: "input", Handle: 1, Verdict: "accept"}},
+	}
+	drop := accept
+	drop.Verdict = "rule::drop"
+	drop.Path = []Hop{{Type: "rule", Table: "filter", Chain: "input", Handle: 2, Verdict: "drop"}}
+
+	require.Equal(t, accept.Key(AggTuple), drop.Key(AggTuple))
+	require.Equal(t, accept.Key(AggTuple|AggChain), drop.Key(AggTuple|AggChain))
+	require.NotEqual(t, accept.Key(AggTuple|AggVerdict), drop.Key(AggTuple|AggVerdict))
+	require.NotEqual(t, accept.Key(AggTuple|AggPath), drop.Key(AggTuple|AggPath))
+	require.Equal(t, accept.Hash(), accept.Key(DefAggKey))
+
+	// the fields don't shift into each other
+	ab, bc := Trace{Table: "ab", Chain: "c"}, Trace{Table: "a", Chain: "bc"}
+	require.NotEqual(t, ab.Key(AggChain), bc.Key(AggChain))
+	iif, oif := Trace{Iifname: "eth0"}, Trace{Oifname: "eth0"}
+	require.NotEqual(t, iif.Key(AggIif|AggOif), oif.Key(AggIif|AggOif))
+
+	// the verdict is the final one if the path is complete
+	final := accept
+	final.Verdict, final.Final = "rule::jump", "drop"
+	finalDrop := final
+	finalDrop.Verdict = "rule::drop"
+	require.Equal(t, final.Key(AggTuple|AggVerdict), finalDrop.Key(AggTuple|AggVerdict))
+	final.Final = "accept"
+	require.NotEqual(t, final.Key(AggTuple|AggVerdict), finalDrop.Key(AggTuple|AggVerdict))
+}
+
+func Test_TraceMerge(t *testing.T) {
+	t0 := time.Now()
+	tr := Trace{Cnt: 1, Bytes: 100, FirstSeen: t0, LastSeen: t0}
+	tr.Merge(Trace{Cnt: 2, Bytes: 300, FirstSeen: t0.Add(-time.Second), LastSeen: t0.Add(time.Second)})
+	require.Equal(t, uint64(3), tr.Cnt)
+	require.Equal(t, uint64(400), tr.Bytes)
+	require.Equal(t, t0.Add(-time.Second), tr.FirstSeen)
+	require.Equal(t, t0.Add(time.Second), tr.LastSeen)
 }
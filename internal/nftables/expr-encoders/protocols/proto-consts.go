@@ -2,6 +2,8 @@
 package protocols
 
 import (
+	"sync"
+
 	"golang.org/x/sys/unix"
 )
 
@@ -55,6 +57,22 @@ func (p ProtoType) String() string {
 	return "unknown"
 }
 
+var protoTypes = sync.OnceValue(func() map[string]ProtoType {
+	ret := make(map[string]ProtoType)
+	for i := 0; i <= 0xff; i++ {
+		if p := ProtoType(i); p.String() != "unknown" {
+			ret[p.String()] = p
+		}
+	}
+	return ret
+})
+
+// ParseProtoType - reverse of ProtoType.String
+func ParseProtoType(s string) (ProtoType, bool) {
+	p, ok := protoTypes()[s]
+	return p, ok
+}
+
 // ICMP_TYPE
 const (
 	ICMP_ECHOREPLY      IcmpType = 0
@@ -16,7 +16,7 @@ const (
 	VerdictContinue = "continue"
 	VerdictDrop     = "drop"
 	VerdictAccept   = "accept"
-	VerdictStolen   = "storlen"
+	VerdictStolen   = "stolen"
 	VerdictQueue    = "queue"
 	VerdictRepeat   = "repeat"
 	VerdictStop     = "stop"
@@ -17,6 +17,8 @@ type (
 	TraceCollector interface {
 		Run(ctx context.Context) error
 		Reader() <-chan model.Trace
+		// ReadBatch - alternative to Reader, blocks until at least one trace is ready
+		ReadBatch(ctx context.Context, dst []model.Trace) (int, error)
 		Close() error
 	}
 
@@ -31,5 +33,7 @@ type (
 
 	ruleProvider interface {
 		GetRuleForTrace(tr rl.TraceRuleDescriptor) (rl.RuleEntry, error)
+		GetChainForTrace(tr rl.TraceRuleDescriptor) (rl.ChainEntry, error)
+		ListBaseChains() []rl.ChainEntry
 	}
 )
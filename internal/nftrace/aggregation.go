@@ -0,0 +1,49 @@
+package nftrace
+
+import (
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
+
+	"github.com/pkg/errors"
+)
+
+// Aggregation - aggregation settings of the collector
+type Aggregation struct {
+	// Enabled - traces with the same key are merged into one record
+	Enabled bool
+	// Key - fields of the aggregation key, model.DefAggKey if empty,
+	// model.DefKernelAggKey if empty and the traces are aggregated in the kernel
+	Key model.AggKey
+	// Window - time the aggregated record is held before it's flushed to the reader,
+	// zero means the record is flushed as soon as the reader is ready
+	Window time.Duration
+}
+
+func (a Aggregation) key() model.AggKey {
+	if a.Key == 0 {
+		return model.DefAggKey
+	}
+	return a.Key
+}
+
+// kernelKey - key of the in-kernel aggregation, the fields out of model.KernelAggKeys are rejected
+// so the kernel and the user space don't group the same key differently
+func (a Aggregation) kernelKey() (model.AggKey, error) {
+	if a.Key == 0 {
+		return model.DefKernelAggKey, nil
+	}
+	if k := a.Key &^ model.KernelAggKeys; k != 0 {
+		return 0, errors.Errorf("aggregation key '%s' isn't supported by the in-kernel aggregation, "+
+			"the kernel aggregates every rule event before the packet path is assembled", k)
+	}
+	return a.Key, nil
+}
+
+func (a Aggregation) queOptions() []queue.QueOption {
+	if !a.Enabled || a.Window <= 0 {
+		return nil
+	}
+	return []queue.QueOption{queue.WithFlushWindow(a.Window)}
+}
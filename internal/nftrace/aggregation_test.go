@@ -0,0 +1,34 @@
+package nftrace
+
+import (
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AggregationKernelKey(t *testing.T) {
+	testCases := []struct {
+		name   string
+		key    model.AggKey
+		exp    model.AggKey
+		expErr bool
+	}{
+		{name: "default", exp: model.DefKernelAggKey},
+		{name: "rule fields", key: model.AggTuple | model.AggChain | model.AggIif, exp: model.AggTuple | model.AggChain | model.AggIif},
+		{name: "path", key: model.AggTuple | model.AggPath, expErr: true},
+		{name: "user space default", key: model.DefAggKey, expErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			k, err := Aggregation{Enabled: true, Key: tc.key}.kernelKey()
+			if tc.expErr {
+				require.ErrorContains(t, err, "'path'")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.exp, k)
+		})
+	}
+}
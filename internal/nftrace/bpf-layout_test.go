@@ -0,0 +1,96 @@
+//go:build (386 || amd64) && linux
+
+package nftrace
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_BpfObjectLayout - the generated Go types must match the embedded eBPF object, both are regenerated
+// by 'make .ebpf' together and 'make .ebpf-check' fails if the generated Go types differ from the committed ones.
+// The test is skipped without the object on a dev box, but fails in CI (the CI variable is set)
+func Test_BpfObjectLayout(t *testing.T) {
+	if len(_BpfBytes) == 0 {
+		if os.Getenv("CI") != "" {
+			t.Fatal("the eBPF object is empty, run 'make .ebpf' before the tests")
+		}
+		t.Skip("the eBPF object isn't built, run 'make .ebpf'")
+	}
+	spec, err := loadBpf()
+	require.NoError(t, err)
+
+	var ti *btf.Struct
+	require.NoError(t, spec.Types.TypeByName("trace_info", &ti))
+	goType := reflect.TypeOf(bpfTraceInfo{})
+	require.Equal(t, uintptr(ti.Size), goType.Size(), "size of trace_info")
+	for _, m := range ti.Members {
+		f, ok := goType.FieldByName(bpfGoName(m.Name))
+		require.Truef(t, ok, "trace_info.%s has no Go field", m.Name)
+		require.Equalf(t, uintptr(m.Offset.Bytes()), f.Offset, "offset of trace_info.%s", m.Name)
+		sz, err := btf.Sizeof(m.Type)
+		require.NoError(t, err)
+		require.Equalf(t, uintptr(sz), f.Type.Size(), "size of trace_info.%s", m.Name)
+		if m.Name == "pkt" {
+			require.Equal(t, int(m.Type.(*btf.Array).Nelems), MaxEbpfSnapLen)
+		}
+	}
+
+	maps := make([]string, 0, len(spec.Maps))
+	for name := range spec.Maps {
+		if !strings.HasPrefix(name, ".") {
+			maps = append(maps, name)
+		}
+	}
+	progs := make([]string, 0, len(spec.Programs))
+	for name := range spec.Programs {
+		progs = append(progs, name)
+	}
+	for _, tc := range []struct {
+		name  string
+		typ   ebpf.MapType
+		value uintptr
+	}{
+		{name: "capture_len", typ: ebpf.Array, value: reflect.TypeOf(uint64(0)).Size()},
+		{name: "trace_scratch", typ: ebpf.PerCPUArray, value: goType.Size()},
+	} {
+		m := spec.Maps[tc.name]
+		require.NotNilf(t, m, "map %s", tc.name)
+		require.Equalf(t, tc.typ, m.Type, "type of map %s", tc.name)
+		require.Equalf(t, uint32(4), m.KeySize, "key size of map %s", tc.name)
+		require.Equalf(t, uint32(tc.value), m.ValueSize, "value size of map %s", tc.name) //nolint:gosec
+		require.Equalf(t, uint32(1), m.MaxEntries, "max entries of map %s", tc.name)
+	}
+	sort.Strings(maps)
+	sort.Strings(progs)
+	require.Equal(t, maps, bpfTags(bpfMapSpecs{}))
+	require.Equal(t, progs, bpfTags(bpfProgramSpecs{}))
+}
+
+// bpfGoName - Go field name of the C member as bpf2go makes it: 'src_ip6' - 'SrcIp6'
+func bpfGoName(name string) string {
+	parts := strings.Split(name, "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func bpfTags(v any) []string {
+	typ := reflect.TypeOf(v)
+	ret := make([]string, 0, typ.NumField())
+	for i := range typ.NumField() {
+		ret = append(ret, typ.Field(i).Tag.Get("ebpf"))
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -23,6 +23,8 @@ type bpfTraceInfo struct {
 	JumpTarget  [64]uint8
 	Time        uint64
 	Counter     uint64
+	Bytes       uint64
+	LastTime    uint64
 	Verdict     uint32
 	Type        uint8
 	Family      uint8
@@ -46,7 +48,9 @@ type bpfTraceInfo struct {
 	DstMac      [6]uint8
 	IpProto     uint8
 	IpVersion   uint8
-	_           [4]byte
+	PktLen      uint16
+	Pkt         [128]uint8
+	_           [2]byte
 }
 
 // loadBpf returns the embedded CollectionSpec for bpf.
@@ -98,12 +102,14 @@ type bpfProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
+	AggKey          *ebpf.MapSpec `ebpf:"agg_key"`
+	CaptureLen      *ebpf.MapSpec `ebpf:"capture_len"`
 	PerCpuQue       *ebpf.MapSpec `ebpf:"per_cpu_que"`
 	RcvTraceCounter *ebpf.MapSpec `ebpf:"rcv_trace_counter"`
 	RdTraceCounter  *ebpf.MapSpec `ebpf:"rd_trace_counter"`
 	RdWaitCounter   *ebpf.MapSpec `ebpf:"rd_wait_counter"`
-	SampleRate      *ebpf.MapSpec `ebpf:"sample_rate"`
 	TraceEvents     *ebpf.MapSpec `ebpf:"trace_events"`
+	TraceScratch    *ebpf.MapSpec `ebpf:"trace_scratch"`
 	TracesPerCpu    *ebpf.MapSpec `ebpf:"traces_per_cpu"`
 	UseAggregation  *ebpf.MapSpec `ebpf:"use_aggregation"`
 	WrTraceCounter  *ebpf.MapSpec `ebpf:"wr_trace_counter"`
@@ -129,12 +135,14 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
+	AggKey          *ebpf.Map `ebpf:"agg_key"`
+	CaptureLen      *ebpf.Map `ebpf:"capture_len"`
 	PerCpuQue       *ebpf.Map `ebpf:"per_cpu_que"`
 	RcvTraceCounter *ebpf.Map `ebpf:"rcv_trace_counter"`
 	RdTraceCounter  *ebpf.Map `ebpf:"rd_trace_counter"`
 	RdWaitCounter   *ebpf.Map `ebpf:"rd_wait_counter"`
-	SampleRate      *ebpf.Map `ebpf:"sample_rate"`
 	TraceEvents     *ebpf.Map `ebpf:"trace_events"`
+	TraceScratch    *ebpf.Map `ebpf:"trace_scratch"`
 	TracesPerCpu    *ebpf.Map `ebpf:"traces_per_cpu"`
 	UseAggregation  *ebpf.Map `ebpf:"use_aggregation"`
 	WrTraceCounter  *ebpf.Map `ebpf:"wr_trace_counter"`
@@ -143,12 +151,14 @@ type bpfMaps struct {
 
 func (m *bpfMaps) Close() error {
 	return _BpfClose(
+		m.AggKey,
+		m.CaptureLen,
 		m.PerCpuQue,
 		m.RcvTraceCounter,
 		m.RdTraceCounter,
 		m.RdWaitCounter,
-		m.SampleRate,
 		m.TraceEvents,
+		m.TraceScratch,
 		m.TracesPerCpu,
 		m.UseAggregation,
 		m.WrTraceCounter,
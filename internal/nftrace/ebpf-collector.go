@@ -42,30 +42,49 @@ type (
 
 	ebpfTraceCollector struct {
 		EbpfCollectorDeps
-		objs           bpfObjects
-		bufflen        int
-		useAggregation bool
-		useSampling    bool
-		evRate         uint64
-		que            queue.CachedQueFace
-		onceRun        sync.Once
-		onceClose      sync.Once
-		stop           chan struct{}
-		stopped        chan struct{}
+		objs      bpfObjects
+		bufflen   int
+		agg       Aggregation
+		sampler   flowSampler
+		evRate    uint64
+		shards    int
+		snapLen   int
+		que       queue.CachedQueFace
+		rrOpts    []RuleResolverOption
+		tgOpts    []TraceGroupOption
+		onceRun   sync.Once
+		onceClose sync.Once
+		stop      chan struct{}
+		stopped   chan struct{}
 	}
 )
 
 var _ TraceCollector = (*ebpfTraceCollector)(nil)
 
-func NewEbpfCollector(d EbpfCollectorDeps, sampleRate uint64, ringBuffSize int, useAggregation bool, evRate uint64, queSize int) (TraceCollector, error) {
+// NewEbpfCollector - snapLen is the number of the packet bytes captured for every trace, up to MaxEbpfSnapLen,
+// 0 disables the capture. The flows are sampled by sampleRate in user space as the netlink collector does,
+// so every trace event still crosses the perf buffer
+func NewEbpfCollector(d EbpfCollectorDeps, sampleRate uint64, ringBuffSize int, agg Aggregation, evRate uint64, qs QueSettings, shards int,
+	snapLen int, rrOpts []RuleResolverOption, tgOpts ...TraceGroupOption) (TraceCollector, error) {
 	if ringBuffSize < 1 {
 		panic(errors.Errorf("Collector/ringBuffSize is %d, but should be > 1", ringBuffSize))
 	}
-	if queSize <= 0 {
+	if qs.Size <= 0 {
 		panic(
-			errors.Errorf("'TraceCollector/queSize' must be > 0"),
+			errors.Errorf("'TraceCollector/que.Size' must be > 0"),
 		)
 	}
+	snapLen = min(max(snapLen, 0), MaxEbpfSnapLen)
+	if agg.Enabled {
+		var err error
+		if agg.Key, err = agg.kernelKey(); err != nil {
+			return nil, err
+		}
+	}
+	que, err := qs.newQue(agg, d.Subj)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to create trace que")
+	}
 	if err := checkKernelVersion(minKernelVersionSupport); err != nil {
 		return nil, errors.WithMessage(err, "failed to check kernel version")
 	}
@@ -102,23 +121,30 @@ func NewEbpfCollector(d EbpfCollectorDeps, sampleRate uint64, ringBuffSize int,
 	}
 
 	key := uint32(0)
-	if err = objs.SampleRate.Put(key, sampleRate); err != nil {
-		return nil, errors.WithMessage(err, "failed to update sample_rate map")
+	if err = objs.CaptureLen.Put(key, uint64(snapLen)); err != nil { //nolint:gosec
+		return nil, errors.WithMessage(err, "failed to update capture_len map")
 	}
-	if useAggregation {
+	if agg.Enabled {
 		if err = objs.UseAggregation.Put(key, uint64(1)); err != nil {
 			return nil, errors.WithMessage(err, "failed to update aggregation value in ebpf map")
 		}
+		if err = objs.AggKey.Put(key, uint64(agg.key())); err != nil {
+			return nil, errors.WithMessage(err, "failed to update aggregation key in ebpf map")
+		}
 	}
 
 	return &ebpfTraceCollector{
 		EbpfCollectorDeps: d,
 		objs:              objs,
 		bufflen:           ringBuffSize,
-		useAggregation:    useAggregation,
-		useSampling:       sampleRate > 0,
+		agg:               agg,
+		sampler:           flowSampler(sampleRate),
 		evRate:            evRate,
-		que:               queue.NewCachedQue(queSize),
+		shards:            shards,
+		snapLen:           snapLen,
+		que:               que,
+		rrOpts:            rrOpts,
+		tgOpts:            tgOpts,
 		stop:              make(chan struct{}),
 	}, nil
 }
@@ -150,7 +176,7 @@ func (t *ebpfTraceCollector) Run(ctx context.Context) error {
 	}
 	defer func() { _ = kp.Close() }()
 
-	if t.useAggregation {
+	if t.agg.Enabled {
 		cancel, err := newPerCpuPerfEventTimer(runtime.NumCPU(), t.objs.SendAgregatedTrace, t.evRate)
 		if err != nil {
 			return err
@@ -158,33 +184,26 @@ func (t *ebpfTraceCollector) Run(ctx context.Context) error {
 		defer cancel()
 	}
 
-	tg := NewTraceGroup(t.IfaceProvider, t.RuleProvider)
-	defer tg.Close()
-
-	return t.pushTraces(ctx1, func(tr EbpfTrace) (err error) {
-		if err = tg.AddTrace(tr.ToNftTrace()); err != nil {
-			return err
-		}
-		if !t.useAggregation && !t.useSampling && !tg.GroupReady() {
-			return ErrTraceDataNotReady
-		}
-		m, err := tg.ToModel()
-		if err != nil {
-			return errors.WithMessage(err, "failed to convert obtained trace into model")
-		}
-		tg.Reset()
-
-		if t.useAggregation {
-			err = t.que.Upsert(uint64(tr.TraceHash), m)
-		} else {
-			err = t.que.Enque(m)
-		}
-		if errors.Is(err, queue.ErrQueIsFull) {
-			t.Subj.Notify(CountOverflowQueEvent{Cnt: 1})
-			err = nil
-		}
-		return err
+	shards := newTraceShards(t.shards, t.Subj, func() *traceAssembler {
+		return newTraceAssembler(traceAssemblerDeps{
+			TraceGroup: NewTraceGroup(t.IfaceProvider, t.RuleProvider, t.tgOpts...),
+			Que:        t.que,
+			Subj:       t.Subj,
+		}, t.agg, !t.agg.Enabled, t.sampler, t.rrOpts...)
+	})
+	shardsErr := make(chan error, 1)
+	go func() {
+		shardsErr <- shards.Run(ctx1)
+	}()
+	names := newNameInterner()
+	err = t.pushTraces(ctx1, func(tr *EbpfTrace) error {
+		return shards.Dispatch(tr.ToNftTrace(names))
 	})
+	shards.Close()
+	if err1 := <-shardsErr; err == nil {
+		err = err1
+	}
+	return err
 }
 
 // Reader
@@ -192,6 +211,11 @@ func (t *ebpfTraceCollector) Reader() <-chan model.Trace {
 	return t.que.Reader()
 }
 
+// ReadBatch
+func (t *ebpfTraceCollector) ReadBatch(ctx context.Context, dst []model.Trace) (int, error) {
+	return t.que.ReadBatch(ctx, dst)
+}
+
 // Close
 func (t *ebpfTraceCollector) Close() error {
 	t.onceClose.Do(func() {
@@ -205,7 +229,7 @@ func (t *ebpfTraceCollector) Close() error {
 	return nil
 }
 
-func (t *ebpfTraceCollector) pushTraces(ctx context.Context, callback func(event EbpfTrace) error) error {
+func (t *ebpfTraceCollector) pushTraces(ctx context.Context, callback func(event *EbpfTrace) error) error {
 	log := logger.FromContext(ctx)
 	rd, err := perf.NewReader(t.objs.TraceEvents, t.bufflen)
 	if err != nil {
@@ -213,15 +237,15 @@ func (t *ebpfTraceCollector) pushTraces(ctx context.Context, callback func(event
 	}
 	defer func() { _ = rd.Close() }()
 
-	log.Infof("start with options: cpu=%d, rcv-buffer-size=%d, use-aggregation=%v, sampling=%v, events-rate=%d",
-		t.objs.TraceEvents.MaxEntries(), rd.BufferSize(), t.useAggregation, t.useSampling, t.evRate)
+	log.Infof("start with options: cpu=%d, rcv-buffer-size=%d, use-aggregation=%v, agg-key=%s, agg-window=%s, sampling=%v, events-rate=%d, shards=%d",
+		t.objs.TraceEvents.MaxEntries(), rd.BufferSize(), t.agg.Enabled, t.agg.key(), t.agg.Window, t.sampler.Enabled(), t.evRate, t.shards)
 
 	errCh := make(chan error)
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		var (
-			trace                   bpfTraceInfo
+			trace                   *EbpfTrace
 			err                     error
 			lostCnt, rcvCnt, pktCnt uint64
 			record                  = new(perf.Record)
@@ -265,13 +289,13 @@ func (t *ebpfTraceCollector) pushTraces(ctx context.Context, callback func(event
 				continue
 			}
 
-			trace = *(*bpfTraceInfo)(unsafe.Pointer(&record.RawSample[0]))
+			trace = (*EbpfTrace)(unsafe.Pointer(&record.RawSample[0]))
 			pktCnt += trace.Counter
 			rcvCnt++
 			t.Subj.Notify(CountRcvPktEvent{Cnt: trace.Counter})
 			t.Subj.Notify(CountRcvSampleEvent{Cnt: 1})
 			if callback != nil {
-				if err = callback(EbpfTrace(trace)); err != nil {
+				if err = callback(trace); err != nil {
 					if errors.Is(err, ErrTraceDataNotReady) {
 						err = nil
 						continue
@@ -91,6 +91,27 @@ static __always_inline void fill_ipv6_info(struct trace_info *trace, struct ipv6
     }
 }
 
+/* bounded copy of the linear packet data from the network header */
+static __always_inline void fill_pkt_capture(struct trace_info *trace, const struct sk_buff *skb)
+{
+    u64 snap_len = get_capture_len();
+    if (!snap_len)
+        return;
+
+    void *nh = skb_network_header(skb);
+    void *tail = BPF_CORE_READ(skb, head) + BPF_CORE_READ(skb, tail);
+    if (nh >= tail)
+        return;
+
+    u32 len = tail - nh;
+    if (len > snap_len)
+        len = snap_len;
+    if (len > PKT_CAPTURE_MAX)
+        len = PKT_CAPTURE_MAX;
+    if (len > 0 && bpf_probe_read_kernel(trace->pkt, len, nh) == 0)
+        trace->pkt_len = len;
+}
+
 static __always_inline void fill_trace_pkt_info(
     struct trace_info *trace,
     const struct sk_buff *skb)
@@ -109,6 +130,8 @@ static __always_inline void fill_trace_pkt_info(
         bpf_probe_read_kernel(trace->dst_mac, sizeof(trace->dst_mac), BPF_CORE_READ(eth, h_dest));
     }
 
+    fill_pkt_capture(trace, skb);
+
     if (trace->family == NFPROTO_IPV4)
     {
         struct iphdr *iph = (struct iphdr *)skb_network_header(skb);
@@ -330,6 +353,7 @@ static __always_inline u8 get_nfproto(const void *pkt)
         fill_trace_pkt_info(trace, skb);                                                                                           \
         trace->trace_hash = get_trace_hash(trace, skb);                                                                            \
         __sync_fetch_and_add(&trace->counter, 1);                                                                                  \
+        trace->bytes = trace->len;                                                                                                 \
     })
 
 #endif
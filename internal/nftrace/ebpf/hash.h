@@ -4,6 +4,7 @@
 #include "jhash.h"
 #include "common.h"
 #include "nftrace.h"
+#include "input_params.h"
 
 #define HASH_INIT4_SEED 0xcafe
 #define HASH_INIT6_SEED 0xeb9f
@@ -49,29 +50,74 @@ static __always_inline u32 hash_from_tuple_v6(const struct ip6_tuple *tuple)
 
 static __always_inline u32 get_trace_hash(struct trace_info *trace, struct sk_buff *skb)
 {
-    if (trace->family == NFPROTO_IPV4)
+    if (trace->ip_version == 4)
     {
         const struct ip4_tuple tuple = {
             .src_port = trace->src_port,
             .dst_port = trace->dst_port,
             .src_ip = trace->src_ip,
             .dst_ip = trace->dst_ip,
-            .ip_proto = trace->family,
+            .ip_proto = trace->ip_proto,
         };
         return hash_from_tuple_v4(&tuple);
     }
-    else if (trace->family == NFPROTO_IPV6)
+    else if (trace->ip_version == 6)
     {
         const struct ip6_tuple tuple = {
             .src_port = trace->src_port,
             .dst_port = trace->dst_port,
             .src_ip6 = trace->src_ip6,
             .dst_ip6 = trace->dst_ip6,
-            .ip_proto = trace->family,
+            .ip_proto = trace->ip_proto,
         };
         return hash_from_tuple_v6(&tuple);
     }
     return BPF_CORE_READ(skb, hash);
 }
 
+/* Aggregation key of the rule event, the same fields as model.Trace.Key hashes. The kernel aggregates every
+ * rule event before the packet path is assembled, so AGG_KEY_PATH isn't supported (the collector rejects it) */
+static __always_inline u32 get_agg_hash(const struct trace_info *trace, u64 key)
+{
+    u32 hash = HASH_INIT4_SEED;
+
+    if (key & AGG_KEY_TUPLE)
+    {
+        hash = jhash_2words(((u32)trace->family << 8) | trace->ip_proto,
+                            ((u32)trace->dst_port << 16) | trace->src_port, hash);
+        if (trace->ip_version == 6)
+        {
+            hash = jhash_4words(trace->src_ip6.in6_u.u6_addr32[0], trace->src_ip6.in6_u.u6_addr32[1],
+                                trace->src_ip6.in6_u.u6_addr32[2], trace->src_ip6.in6_u.u6_addr32[3], hash);
+            hash = jhash_4words(trace->dst_ip6.in6_u.u6_addr32[0], trace->dst_ip6.in6_u.u6_addr32[1],
+                                trace->dst_ip6.in6_u.u6_addr32[2], trace->dst_ip6.in6_u.u6_addr32[3], hash);
+        }
+        else
+        {
+            hash = jhash_2words(trace->src_ip, trace->dst_ip, hash);
+        }
+    }
+    if (key & (AGG_KEY_RULE | AGG_KEY_CHAIN))
+    {
+        hash = jhash_2words((u32)trace->table_handle, (u32)trace->chain_handle, hash);
+    }
+    if (key & AGG_KEY_RULE)
+    {
+        hash = jhash_2words((u32)trace->rule_handle, (u32)(trace->rule_handle >> 32), hash);
+    }
+    if (key & AGG_KEY_VERDICT)
+    {
+        hash = jhash_1word(trace->verdict, hash);
+    }
+    if (key & AGG_KEY_IIF)
+    {
+        hash = jhash_1word(trace->iif, hash);
+    }
+    if (key & AGG_KEY_OIF)
+    {
+        hash = jhash_1word(trace->oif, hash);
+    }
+    return hash;
+}
+
 #endif
\ No newline at end of file
@@ -7,7 +7,20 @@ struct
     __uint(max_entries, 1);
     __type(key, u32);
     __type(value, u64);
-} sample_rate SEC(".maps");
+} use_aggregation SEC(".maps");
+
+/* fields of the aggregation key, must be kept in sync with model.AggKey; AGG_KEY_PATH is
+ * reserved, the path isn't known to the kernel */
+#define AGG_KEY_TUPLE (1 << 0)
+#define AGG_KEY_RULE (1 << 1)
+#define AGG_KEY_VERDICT (1 << 2)
+#define AGG_KEY_IIF (1 << 3)
+#define AGG_KEY_OIF (1 << 4)
+#define AGG_KEY_CHAIN (1 << 5)
+#define AGG_KEY_PATH (1 << 6)
+
+/* model.DefKernelAggKey */
+#define AGG_KEY_DEFAULT (AGG_KEY_TUPLE | AGG_KEY_RULE | AGG_KEY_VERDICT)
 
 struct
 {
@@ -15,19 +28,21 @@ struct
     __uint(max_entries, 1);
     __type(key, u32);
     __type(value, u64);
-} use_aggregation SEC(".maps");
+} agg_key SEC(".maps");
 
-static __always_inline bool is_aggregation_enabled()
+/* number of the packet bytes to capture, 0 disables the capture */
+struct
 {
-    u32 key = 0;
-    u64 *val = bpf_map_lookup_elem(&use_aggregation, &key);
-    return val && *val > 0;
-}
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, u64);
+} capture_len SEC(".maps");
 
-static __always_inline u64 get_sample_rate()
+static __always_inline u64 get_capture_len()
 {
     u32 key = 0;
-    u64 *val = bpf_map_lookup_elem(&sample_rate, &key);
+    u64 *val = bpf_map_lookup_elem(&capture_len, &key);
     if (!val)
     {
         return 0;
@@ -35,9 +50,22 @@ static __always_inline u64 get_sample_rate()
     return *val;
 }
 
-static __always_inline bool is_sampling_enabled()
+static __always_inline u64 get_agg_key()
+{
+    u32 key = 0;
+    u64 *val = bpf_map_lookup_elem(&agg_key, &key);
+    if (!val || *val == 0)
+    {
+        return AGG_KEY_DEFAULT;
+    }
+    return *val;
+}
+
+static __always_inline bool is_aggregation_enabled()
 {
-    return get_sample_rate() > 0;
+    u32 key = 0;
+    u64 *val = bpf_map_lookup_elem(&use_aggregation, &key);
+    return val && *val > 0;
 }
 
 #endif
\ No newline at end of file
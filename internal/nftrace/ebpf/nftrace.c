@@ -37,6 +37,15 @@ struct
     __uint(max_entries, 128); // number of CPUs
 } trace_events SEC(".maps");
 
+/* the trace is filled here instead of the stack, it doesn't fit the stack limit with the captured packet */
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, struct trace_info);
+} trace_scratch SEC(".maps");
+
 SEC("perf_event")
 int send_agregated_trace(struct bpf_perf_event_data *ctx)
 {
@@ -80,39 +89,39 @@ int send_agregated_trace(struct bpf_perf_event_data *ctx)
 SEC("kprobe/nft_trace_notify")
 int kprobe_nft_trace_notify(struct pt_regs *ctx)
 {
-    u32 sample_cnt = 0;
-
-    struct trace_info trace = {};
+    u32 zero = 0;
 
-    FILL_TRACE(&trace, ctx);
+    struct trace_info *trace = bpf_map_lookup_elem(&trace_scratch, &zero);
+    if (!trace)
+    {
+        return 0;
+    }
+    __builtin_memset(trace, 0, sizeof(*trace));
 
-    u64 sample_rate_val = get_sample_rate();
+    FILL_TRACE(trace, ctx);
 
-    bool is_rule = (trace.type == NFT_TRACETYPE_RULE);
+    /* the flows are sampled in user space: the tuple may be changed by NAT on the path,
+     * so it can't decide for all the events of the packet here */
+    bool is_rule = (trace->type == NFT_TRACETYPE_RULE);
 
-    if ((is_sampling_enabled() || is_aggregation_enabled()) && !is_rule)
+    if (is_aggregation_enabled() && !is_rule)
     {
         return 0;
     }
 
     if (is_rule)
     {
-        sample_cnt = TRACE_COUNT();
-    }
-
-    if (is_sampling_enabled() && (sample_cnt % sample_rate_val != 0))
-    {
-        return 0;
+        TRACE_COUNT();
     }
 
     if (!is_aggregation_enabled())
     {
-        bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, &trace, sizeof(trace));
+        bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, trace, sizeof(*trace));
         return 0;
     }
 
     u32 cpu_id = bpf_get_smp_processor_id();
-    u32 per_cpu_trace_hash = jhash_1word(trace.trace_hash, cpu_id);
+    u32 per_cpu_trace_hash = jhash_1word(get_agg_hash(trace, get_agg_key()), cpu_id);
 
     struct trace_info *old_trace = (struct trace_info *)bpf_map_lookup_elem(&traces_per_cpu, &per_cpu_trace_hash);
     if (!old_trace)
@@ -120,21 +129,22 @@ int kprobe_nft_trace_notify(struct pt_regs *ctx)
         struct que_data trace_que_data = {
             .hash = per_cpu_trace_hash,
         };
-        trace.time = bpf_ktime_get_ns();
+        trace->time = bpf_ktime_get_ns();
+        trace->last_time = trace->time;
 
         void *active_que = bpf_map_lookup_elem(&per_cpu_que, &cpu_id);
         if (!active_que)
         {
             bpf_printk("kprobe not found que for cpu=%d", cpu_id);
-            bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, &trace, sizeof(trace));
+            bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, trace, sizeof(*trace));
             WR_TRACE_ADD_COUNT(1);
             WR_WAIT_COUNT();
             return 0;
         }
-        if (bpf_map_update_elem(&traces_per_cpu, &per_cpu_trace_hash, &trace, BPF_NOEXIST) != 0)
+        if (bpf_map_update_elem(&traces_per_cpu, &per_cpu_trace_hash, trace, BPF_NOEXIST) != 0)
         {
             bpf_printk("kprobe failed to upd trace for cpu=%d", cpu_id);
-            bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, &trace, sizeof(trace));
+            bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, trace, sizeof(*trace));
             WR_TRACE_ADD_COUNT(1);
             WR_WAIT_COUNT();
             return 0;
@@ -142,7 +152,7 @@ int kprobe_nft_trace_notify(struct pt_regs *ctx)
         if (bpf_map_push_elem(active_que, &trace_que_data, BPF_ANY) != 0)
         {
             bpf_printk("kprobe failed to push trace into que for cpu=%d", cpu_id);
-            bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, &trace, sizeof(trace));
+            bpf_perf_event_output(ctx, &trace_events, BPF_F_CURRENT_CPU, trace, sizeof(*trace));
             WR_TRACE_ADD_COUNT(1);
             WR_WAIT_COUNT();
             return 0;
@@ -152,6 +162,8 @@ int kprobe_nft_trace_notify(struct pt_regs *ctx)
     }
     WR_TRACE_ADD_COUNT(1);
     __sync_fetch_and_add(&old_trace->counter, 1);
+    __sync_fetch_and_add(&old_trace->bytes, trace->len);
+    old_trace->last_time = bpf_ktime_get_ns();
 
     return 0;
 }
\ No newline at end of file
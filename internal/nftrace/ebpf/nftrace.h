@@ -271,6 +271,9 @@ DECLARE_NFT_BASE_CHAIN;
 DECLARE_NFT_TRACEINFO_NOCORE;
 DECLARE_NFT_TRACEINFO;
 
+/* max number of the packet bytes captured from the network header, must be kept in sync with MaxEbpfSnapLen */
+#define PKT_CAPTURE_MAX 128
+
 struct trace_info
 {
     u32 id;
@@ -283,6 +286,8 @@ struct trace_info
     u8 jump_target[64];
     u64 time;
     u64 counter;
+    u64 bytes;
+    u64 last_time;
     u32 verdict;
     u8 type;
     u8 family;
@@ -306,6 +311,8 @@ struct trace_info
     u8 dst_mac[6];
     u8 ip_proto;
     u8 ip_version;
+    u16 pkt_len;
+    u8 pkt[PKT_CAPTURE_MAX];
 };
 
 const struct trace_info *unused __attribute__((unused));
@@ -0,0 +1,33 @@
+package nftrace
+
+// defMaxInternedNames - table, chain and interface names are a small set,
+// the limit only protects from unbounded growth
+const defMaxInternedNames = 4096
+
+// nameInterner - set of names shared by all decoded traces, so decoding of a known name doesn't allocate.
+// It's not safe for concurrent use, each reader owns its interner
+type nameInterner struct {
+	names map[string]string
+}
+
+func newNameInterner() *nameInterner {
+	return &nameInterner{names: make(map[string]string)}
+}
+
+// Intern - get the shared string for the name. Nil interner just copies the name
+func (n *nameInterner) Intern(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	if n == nil {
+		return string(b)
+	}
+	if s, ok := n.names[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(n.names) < defMaxInternedNames {
+		n.names[s] = s
+	}
+	return s
+}
@@ -7,9 +7,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/shirou/gopsutil/v3/host"
+	"golang.org/x/sys/unix"
 )
 
 var (
@@ -135,3 +138,20 @@ func checkKernelModules(modules ...string) error {
 
 	return nil
 }
+
+// bootTime - wall clock time of the monotonic clock start, it converts bpf_ktime_get_ns() into time.Time
+var bootTime = sync.OnceValue(func() time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(ts.Nano()))
+})
+
+// KtimeToTime - convert kernel monotonic time in ns into the wall clock time
+func KtimeToTime(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return bootTime().Add(time.Duration(ns)) //nolint:gosec
+}
@@ -3,9 +3,14 @@ package nftrace
 import "github.com/H-BF/corlib/pkg/patterns/observer"
 
 type (
-	CountOverflowQueEvent struct {
+	CountQueDropEvent struct {
 		observer.EventType
-		Cnt uint64
+		Policy string
+		Cnt    uint64
+	}
+	QueDepthEvent struct {
+		observer.EventType
+		Depth int
 	}
 	CountRcvSampleEvent struct {
 		observer.EventType
@@ -22,4 +27,34 @@ type (
 		observer.EventType
 		Cnt uint64
 	}
+	CountEvictTraceGroupEvent struct {
+		observer.EventType
+		Reason string
+		Cnt    uint64
+	}
+	OpenTraceGroupsEvent struct {
+		observer.EventType
+		Shard int
+		Cnt   int
+	}
+	CountRuleResolveEvent struct {
+		observer.EventType
+		Outcome string
+		Cnt     uint64
+	}
+	PendingTracesEvent struct {
+		observer.EventType
+		Shard int
+		Cnt   int
+	}
+	ShardQueDepthEvent struct {
+		observer.EventType
+		Shard int
+		Depth int
+	}
+	CountShardTraceEvent struct {
+		observer.EventType
+		Shard int
+		Cnt   uint64
+	}
 )
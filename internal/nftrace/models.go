@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"net"
-	"unsafe"
+	"net/netip"
+	"time"
 
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
 	"github.com/Morwran/ebpf-nftrace/internal/nl/nlheaders"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/mdlayher/netlink"
 	"golang.org/x/sys/unix"
 )
@@ -17,6 +20,18 @@ const (
 	IPVersion6 = 6
 )
 
+// MaxEbpfSnapLen - max number of the packet bytes captured by the eBPF program, PKT_CAPTURE_MAX in ebpf/nftrace.h.
+// The netlink collector gets at most the network header and 20 bytes of the transport header from the kernel
+const MaxEbpfSnapLen = len(bpfTraceInfo{}.Pkt)
+
+// Conntrack trace attributes. They are sent by kernels >= 6.16 only and are missing in x/sys/unix yet
+const (
+	NFTA_TRACE_CT_ID        = 0x12
+	NFTA_TRACE_CT_DIRECTION = 0x13
+	NFTA_TRACE_CT_STATUS    = 0x14
+	NFTA_TRACE_CT_STATE     = 0x15
+)
+
 type (
 	EbpfTrace bpfTraceInfo
 
@@ -38,15 +53,30 @@ type (
 		Oiftype    uint16
 		Iifname    string
 		Oifname    string
-		SMacAddr   string
-		DMacAddr   string
-		SAddr      string
-		DAddr      string
+		SMacAddr   model.HwAddr
+		DMacAddr   model.HwAddr
+		SAddr      netip.Addr
+		DAddr      netip.Addr
 		SPort      uint32
 		DPort      uint32
 		Length     uint32
 		IpProtocol uint8
 		Cnt        uint64
+		Bytes      uint64
+		FirstSeen  time.Time
+		LastSeen   time.Time
+		Ct         CtInfo
+		// Packet - first bytes of the packet from the network header, nil if the capture is disabled
+		Packet []byte
+	}
+
+	// CtInfo - conntrack info of the traced packet
+	CtInfo struct {
+		Valid     bool
+		Id        uint32
+		State     uint32
+		Status    uint32
+		Direction uint8
 	}
 
 	NetlinkTrace struct {
@@ -68,20 +98,43 @@ type (
 		Policy     uint32
 		Iiftype    uint16
 		Oiftype    uint16
+		Iifname    string
+		Oifname    string
+		Ct         CtInfo
+		Packet     []byte
+		nhRaw      []byte
+		thRaw      []byte
 	}
-
-	FastHardwareAddr net.HardwareAddr
 )
 
 func (n *NftTrace) Reset() {
 	*n = NftTrace{}
 }
 
-func (t *EbpfTrace) ToNftTrace() NftTrace {
+// FlowHash - hash of the flow the trace belongs to. It is used both as the aggregation key
+// and as the flow-consistent sampling key, so it must not depend on the collector type
+func (n *NftTrace) FlowHash() uint64 {
+	var (
+		d   xxhash.Digest
+		buf [10]byte
+	)
+	d.Reset()
+	sa, da := n.SAddr.As16(), n.DAddr.As16()
+	_, _ = d.Write(sa[:])
+	_, _ = d.Write(da[:])
+	buf[0], buf[1] = n.Family, n.IpProtocol
+	binary.BigEndian.PutUint32(buf[2:], n.SPort)
+	binary.BigEndian.PutUint32(buf[6:], n.DPort)
+	_, _ = d.Write(buf[:])
+	return d.Sum64()
+}
+
+// ToNftTrace - decode the raw record. Names are interned, so the trace doesn't refer to the record memory
+func (t *EbpfTrace) ToNftTrace(names *nameInterner) NftTrace {
 	return NftTrace{
-		Table:      FastBytes2String(bytes.TrimRight(t.TableName[:], "\x00")),
-		Chain:      FastBytes2String(bytes.TrimRight(t.ChainName[:], "\x00")),
-		JumpTarget: FastBytes2String(bytes.TrimRight(t.JumpTarget[:], "\x00")),
+		Table:      names.Intern(cString(t.TableName[:])),
+		Chain:      names.Intern(cString(t.ChainName[:])),
+		JumpTarget: names.Intern(cString(t.JumpTarget[:])),
 		RuleHandle: t.RuleHandle,
 		Family:     t.Family,
 		Type:       uint32(t.Type),
@@ -94,20 +147,45 @@ func (t *EbpfTrace) ToNftTrace() NftTrace {
 		Policy:     uint32(t.Policy),
 		Iiftype:    t.IifType,
 		Oiftype:    t.OifType,
-		Iifname:    FastBytes2String(bytes.TrimRight(t.IifName[:], "\x00")),
-		Oifname:    FastBytes2String(bytes.TrimRight(t.OifName[:], "\x00")),
-		SMacAddr:   FastHardwareAddr(t.SrcMac[:]).String(),
-		DMacAddr:   FastHardwareAddr(t.DstMac[:]).String(),
-		SAddr:      Ip2String(t.IpVersion == IPVersion6, t.SrcIp, t.SrcIp6.In6U.U6Addr8[:]),
-		DAddr:      Ip2String(t.IpVersion == IPVersion6, t.DstIp, t.DstIp6.In6U.U6Addr8[:]),
+		Iifname:    names.Intern(cString(t.IifName[:])),
+		Oifname:    names.Intern(cString(t.OifName[:])),
+		SMacAddr:   t.SrcMac,
+		DMacAddr:   t.DstMac,
+		SAddr:      t.ipAddr(t.SrcIp, t.SrcIp6.In6U.U6Addr8),
+		DAddr:      t.ipAddr(t.DstIp, t.DstIp6.In6U.U6Addr8),
 		SPort:      uint32(t.SrcPort),
 		DPort:      uint32(t.DstPort),
 		Length:     uint32(t.Len),
 		IpProtocol: t.IpProto,
 		Cnt:        t.Counter,
+		Bytes:      t.Bytes,
+		FirstSeen:  KtimeToTime(t.Time),
+		LastSeen:   KtimeToTime(t.LastTime),
+		Packet:     t.packet(),
 	}
 }
 
+// packet - copy of the captured bytes, the record memory is reused
+func (t *EbpfTrace) packet() []byte {
+	n := min(int(t.PktLen), len(t.Pkt))
+	if n == 0 {
+		return nil
+	}
+	return append([]byte(nil), t.Pkt[:n]...)
+}
+
+func (t *EbpfTrace) ipAddr(ip4 uint32, ip6 [16]byte) netip.Addr {
+	switch t.IpVersion {
+	case IPVersion4:
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], ip4)
+		return netip.AddrFrom4(b)
+	case IPVersion6:
+		return netip.AddrFrom16(ip6)
+	}
+	return netip.Addr{}
+}
+
 func (tr *NetlinkTrace) InitFromMsg(msg netlink.Message) error {
 	ad, err := netlink.NewAttributeDecoder(msg.Data[4:])
 	if err != nil {
@@ -159,23 +237,101 @@ func (tr *NetlinkTrace) InitFromMsg(msg netlink.Message) error {
 				return err
 			}
 		case unix.NFTA_TRACE_NETWORK_HEADER:
-			if err = tr.Nh.Decode(ad.Bytes()); err != nil {
+			tr.nhRaw = ad.Bytes()
+			if err = tr.Nh.Decode(tr.nhRaw); err != nil {
 				return err
 			}
 		case unix.NFTA_TRACE_TRANSPORT_HEADER:
-			if err = tr.Th.Decode(ad.Bytes()); err != nil {
+			tr.thRaw = ad.Bytes()
+			if err = tr.Th.Decode(tr.thRaw); err != nil {
 				return err
 			}
 		case unix.NFTA_TRACE_NFPROTO:
 			tr.Nfproto = ad.Uint32()
 		case unix.NFTA_TRACE_POLICY:
 			tr.Policy = ad.Uint32()
+		case NFTA_TRACE_CT_ID:
+			tr.Ct.Id = ad.Uint32()
+			tr.Ct.Valid = true
+		case NFTA_TRACE_CT_DIRECTION:
+			tr.Ct.Direction = ad.Uint8()
+			tr.Ct.Valid = true
+		case NFTA_TRACE_CT_STATUS:
+			tr.Ct.Status = ad.Uint32()
+			tr.Ct.Valid = true
+		case NFTA_TRACE_CT_STATE:
+			tr.Ct.State = ad.Uint32()
+			tr.Ct.Valid = true
 		}
 	}
+	if err = ad.Err(); err != nil {
+		return err
+	}
 	tr.Family = msg.Data[0]
+	if tr.Nfproto == 0 {
+		tr.Nfproto = tr.l3ProtoFromHeader()
+	}
 	return nil
 }
 
+// l3ProtoFromHeader - fallback for kernels that don't send NFTA_TRACE_NFPROTO:
+// the protocol of inet, bridge and netdev tables is taken from the network header
+func (tr *NetlinkTrace) l3ProtoFromHeader() uint32 {
+	switch tr.Nh.Version {
+	case nlheaders.IPv4Version:
+		return unix.NFPROTO_IPV4
+	case nlheaders.IPv6Version:
+		return unix.NFPROTO_IPV6
+	}
+	return uint32(tr.Family)
+}
+
+// Capture - keep up to snapLen bytes of the network and transport headers sent by the kernel as the packet
+func (tr *NetlinkTrace) Capture(snapLen int) {
+	if snapLen <= 0 || len(tr.nhRaw) == 0 {
+		return
+	}
+	pkt := make([]byte, 0, len(tr.nhRaw)+len(tr.thRaw))
+	pkt = append(pkt, tr.nhRaw...)
+	if tr.transportFollows() {
+		pkt = append(pkt, tr.thRaw...)
+	}
+	tr.Packet = pkt[:min(len(pkt), snapLen)]
+}
+
+// ipv6ExtHeaders - extension headers skipped by the kernel on the way to the transport header
+var ipv6ExtHeaders = map[uint8]bool{
+	unix.IPPROTO_HOPOPTS:  true,
+	unix.IPPROTO_ROUTING:  true,
+	unix.IPPROTO_FRAGMENT: true,
+	unix.IPPROTO_AH:       true,
+	unix.IPPROTO_NONE:     true,
+	unix.IPPROTO_DSTOPTS:  true,
+}
+
+// transportFollows - the transport header is next to the network one only if the kernel sent the whole network header:
+// the header is cut at 40 bytes, so IPv4 options or IPv6 extension headers leave a gap
+func (tr *NetlinkTrace) transportFollows() bool {
+	switch tr.Nh.Version {
+	case nlheaders.IPv4Version:
+		return int(tr.Nh.IHL)*4 == len(tr.nhRaw)
+	case nlheaders.IPv6Version:
+		return len(tr.nhRaw) == nlheaders.NlHeaderLenIPv6 && !ipv6ExtHeaders[tr.Nh.Protocol]
+	}
+	return false
+}
+
+// ResolveIfaces - fill interface names at the moment the trace is received, so they match
+// what the eBPF collector reads from the kernel even if the interface disappears later
+func (tr *NetlinkTrace) ResolveIfaces(p ifaceProvider) {
+	if tr.Iif != 0 && tr.Iifname == "" {
+		tr.Iifname, _ = p.GetIface(int(tr.Iif))
+	}
+	if tr.Oif != 0 && tr.Oifname == "" {
+		tr.Oifname, _ = p.GetIface(int(tr.Oif))
+	}
+}
+
 func (tr *NetlinkTrace) ToNftTrace() NftTrace {
 	return NftTrace{
 		Table:      tr.Table,
@@ -193,46 +349,32 @@ func (tr *NetlinkTrace) ToNftTrace() NftTrace {
 		Policy:     tr.Policy,
 		Iiftype:    tr.Iiftype,
 		Oiftype:    tr.Oiftype,
-		SMacAddr:   FastHardwareAddr(tr.Lh.SAddr).String(),
-		DMacAddr:   FastHardwareAddr(tr.Lh.DAddr).String(),
-		SAddr:      tr.Nh.SAddr.String(),
-		DAddr:      tr.Nh.DAddr.String(),
+		Iifname:    tr.Iifname,
+		Oifname:    tr.Oifname,
+		SMacAddr:   model.HwAddrFrom(tr.Lh.SAddr),
+		DMacAddr:   model.HwAddrFrom(tr.Lh.DAddr),
+		SAddr:      ipAddr(tr.Nh.SAddr),
+		DAddr:      ipAddr(tr.Nh.DAddr),
 		SPort:      uint32(tr.Th.SPort),
 		DPort:      uint32(tr.Th.DPort),
 		Length:     uint32(tr.Nh.Length),
 		IpProtocol: tr.Nh.Protocol,
 		Cnt:        1,
+		Bytes:      uint64(tr.Nh.Length),
+		Ct:         tr.Ct,
+		Packet:     tr.Packet,
 	}
 }
 
-func (a FastHardwareAddr) String() string {
-	const hexDigit = "0123456789abcdef"
-	if len(a) == 0 {
-		return ""
-	}
-	buf := make([]byte, 0, len(a)*3-1)
-	for i, b := range a {
-		if i > 0 {
-			buf = append(buf, ':')
-		}
-		buf = append(buf, hexDigit[b>>4])
-		buf = append(buf, hexDigit[b&0xF])
-	}
-	return FastBytes2String(buf)
-}
-
-func Ip2String(isIp6 bool, ip4 uint32, ip6 []byte) string {
-	if isIp6 {
-		return net.IP(ip6[:]).String()
-	}
-	var b [4]byte
-	binary.BigEndian.PutUint32(b[:], ip4)
-	return net.IP(b[:]).String()
+func ipAddr(ip net.IP) netip.Addr {
+	a, _ := netip.AddrFromSlice(ip)
+	return a
 }
 
-func FastBytes2String(b []byte) string {
-	if len(b) == 0 {
-		return ""
+// cString - bytes of the NUL terminated string
+func cString(b []byte) []byte {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i]
 	}
-	return unsafe.String(unsafe.SliceData(b), len(b))
+	return b
 }
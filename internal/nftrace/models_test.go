@@ -0,0 +1,212 @@
+package nftrace
+
+import (
+	"encoding/binary"
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	nfte "github.com/google/nftables/expr"
+	"github.com/mdlayher/netlink"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func encodeTraceMsg(t *testing.T, family byte, attrs func(ae *netlink.AttributeEncoder)) netlink.Message {
+	ae := netlink.NewAttributeEncoder()
+	ae.ByteOrder = binary.BigEndian
+	attrs(ae)
+	b, err := ae.Encode()
+	require.NoError(t, err)
+	return netlink.Message{Data: append([]byte{family, 0, 0, 0}, b...)}
+}
+
+func Test_NetlinkTraceCtAttrs(t *testing.T) {
+	ipv6Hdr := make([]byte, 40)
+	ipv6Hdr[0] = 6 << 4
+	ipv6Hdr[6] = unix.IPPROTO_TCP
+
+	testCases := []struct {
+		name       string
+		attrs      func(ae *netlink.AttributeEncoder)
+		expCt      CtInfo
+		expNfproto uint32
+	}{
+		{
+			name: "kernel sends conntrack and nfproto",
+			attrs: func(ae *netlink.AttributeEncoder) {
+				ae.Uint32(unix.NFTA_TRACE_ID, 1)
+				ae.Uint32(unix.NFTA_TRACE_TYPE, unix.NFT_TRACETYPE_RULE)
+				ae.Uint32(unix.NFTA_TRACE_NFPROTO, unix.NFPROTO_IPV4)
+				ae.Uint32(NFTA_TRACE_CT_ID, 42)
+				ae.Uint8(NFTA_TRACE_CT_DIRECTION, 1)
+				ae.Uint32(NFTA_TRACE_CT_STATUS, 0xa)
+				ae.Uint32(NFTA_TRACE_CT_STATE, 1<<1)
+			},
+			expCt:      CtInfo{Valid: true, Id: 42, Direction: 1, Status: 0xa, State: 1 << 1},
+			expNfproto: unix.NFPROTO_IPV4,
+		},
+		{
+			name: "old kernel without conntrack and nfproto",
+			attrs: func(ae *netlink.AttributeEncoder) {
+				ae.Uint32(unix.NFTA_TRACE_ID, 1)
+				ae.Uint32(unix.NFTA_TRACE_TYPE, unix.NFT_TRACETYPE_RULE)
+				ae.Bytes(unix.NFTA_TRACE_NETWORK_HEADER, ipv6Hdr)
+			},
+			expNfproto: unix.NFPROTO_IPV6,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tr NetlinkTrace
+			require.NoError(t, tr.InitFromMsg(encodeTraceMsg(t, unix.NFPROTO_INET, tc.attrs)))
+			require.Equal(t, tc.expCt, tr.Ct)
+			require.Equal(t, tc.expNfproto, tr.Nfproto)
+			require.Equal(t, tc.expCt, tr.ToNftTrace().Ct)
+		})
+	}
+}
+
+func Test_NetlinkTraceCapture(t *testing.T) {
+	ipv4Hdr := []byte{0x45, 0, 0, 40, 0, 0, 0, 0, 64, unix.IPPROTO_TCP, 0, 0, 10, 0, 0, 1, 10, 0, 0, 2}
+	ipv4OptsHdr := append([]byte{0x46}, append(ipv4Hdr[1:], 1, 1, 1, 0)...)
+	ipv6Hdr := make([]byte, 40)
+	ipv6Hdr[0], ipv6Hdr[6] = 6<<4, unix.IPPROTO_TCP
+	ipv6ExtHdr := append([]byte(nil), ipv6Hdr...)
+	ipv6ExtHdr[6] = unix.IPPROTO_HOPOPTS
+	tcpHdr := []byte{0x9c, 0x40, 0, 22, 0, 0, 0, 1, 0, 0, 0, 0, 0x50, 0x02, 0xff, 0xff, 0, 0, 0, 0}
+
+	testCases := []struct {
+		name    string
+		nh      []byte
+		snapLen int
+		exp     []byte
+	}{
+		{name: "disabled", nh: ipv4Hdr, snapLen: 0},
+		{name: "ipv4", nh: ipv4Hdr, snapLen: 128, exp: append(append([]byte(nil), ipv4Hdr...), tcpHdr...)},
+		{name: "cut by snap length", nh: ipv4Hdr, snapLen: 24, exp: append(append([]byte(nil), ipv4Hdr...), tcpHdr[:4]...)},
+		{name: "ipv4 options", nh: ipv4OptsHdr, snapLen: 128, exp: append(append([]byte(nil), ipv4OptsHdr...), tcpHdr...)},
+		{name: "ipv6", nh: ipv6Hdr, snapLen: 128, exp: append(append([]byte(nil), ipv6Hdr...), tcpHdr...)},
+		{name: "ipv6 extension header", nh: ipv6ExtHdr, snapLen: 128, exp: ipv6ExtHdr},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tr NetlinkTrace
+			require.NoError(t, tr.InitFromMsg(encodeTraceMsg(t, unix.NFPROTO_INET, func(ae *netlink.AttributeEncoder) {
+				ae.Uint32(unix.NFTA_TRACE_ID, 1)
+				ae.Bytes(unix.NFTA_TRACE_NETWORK_HEADER, tc.nh)
+				ae.Bytes(unix.NFTA_TRACE_TRANSPORT_HEADER, tcpHdr)
+			})))
+			tr.Capture(tc.snapLen)
+			require.Equal(t, tc.exp, tr.ToNftTrace().Packet)
+		})
+	}
+}
+
+func Test_TraceGroupCtInfo(t *testing.T) {
+	tg := NewTraceGroup(&ifaceProviderMock{}, &ruleProviderMock{})
+	defer tg.Close()
+	require.NoError(t, tg.AddTrace(NftTrace{
+		Type:       unix.NFT_TRACETYPE_RULE,
+		RuleHandle: 1,
+		Family:     unix.NFPROTO_INET,
+		Nfproto:    unix.NFPROTO_IPV6,
+		Verdict:    uint32(nfte.VerdictAccept),
+		Ct:         CtInfo{Valid: true, Id: 7, State: 1 << 3, Status: 1 << 3},
+	}))
+	m, err := tg.ToModel()
+	require.NoError(t, err)
+	require.Equal(t, model.Trace{
+		Family:      "inet",
+		L3Proto:     "ip6",
+		CtId:        7,
+		CtState:     "new",
+		CtDirection: "original",
+		CtStatus:    "confirmed",
+	}, model.Trace{
+		Family:      m.Family,
+		L3Proto:     m.L3Proto,
+		CtId:        m.CtId,
+		CtState:     m.CtState,
+		CtDirection: m.CtDirection,
+		CtStatus:    m.CtStatus,
+	})
+}
+
+func Test_EbpfTracePacket(t *testing.T) {
+	traces := benchEbpfTraces()
+	pkt := []byte{0x45, 0, 0, 40}
+	copy(traces[0].Pkt[:], pkt)
+	traces[0].PktLen = uint16(len(pkt))
+
+	tg := NewTraceGroup(&ifaceProviderMock{}, &ruleProviderMock{})
+	defer tg.Close()
+	for i := range traces {
+		require.NoError(t, tg.AddTrace(traces[i].ToNftTrace(nil)))
+	}
+	traces[0].Pkt[0] = 0 // the record memory is reused by the reader
+	m, err := tg.ToModel()
+	require.NoError(t, err)
+	require.Equal(t, pkt, m.Packet)
+}
+
+func benchEbpfTraces() []EbpfTrace {
+	verdictJump := nfte.VerdictJump
+	mk := func(chain string, handle uint64, verdict uint32, jt string) EbpfTrace {
+		var tr EbpfTrace
+		tr.Id = 7
+		copy(tr.TableName[:], "filter")
+		copy(tr.ChainName[:], chain)
+		copy(tr.JumpTarget[:], jt)
+		copy(tr.IifName[:], "eth0")
+		tr.RuleHandle = handle
+		tr.Verdict = verdict
+		tr.Type = unix.NFT_TRACETYPE_RULE
+		tr.Family = unix.NFPROTO_INET
+		tr.Nfproto = unix.NFPROTO_IPV4
+		tr.IpVersion = IPVersion4
+		tr.IpProto = unix.IPPROTO_TCP
+		tr.SrcIp, tr.DstIp = 0x0a000001, 0x0a000002
+		tr.SrcPort, tr.DstPort = 1000, 80
+		tr.SrcMac = [6]uint8{0, 1, 2, 3, 4, 5}
+		tr.DstMac = [6]uint8{0, 1, 2, 3, 4, 6}
+		tr.Counter = 1
+		return tr
+	}
+	return []EbpfTrace{
+		mk("input", 1, uint32(verdictJump), "allowed"),
+		mk("allowed", 2, uint32(nfte.VerdictAccept), ""),
+	}
+}
+
+func Benchmark_EbpfTraceToNftTrace(b *testing.B) {
+	traces := benchEbpfTraces()
+	names := newNameInterner()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = traces[i&1].ToNftTrace(names)
+	}
+}
+
+func Benchmark_EbpfTraceToModel(b *testing.B) {
+	traces := benchEbpfTraces()
+	names := newNameInterner()
+	tg := NewTraceGroup(&ifaceProviderMock{}, &ruleProviderMock{})
+	defer tg.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range traces {
+			if err := tg.AddTrace(traces[j].ToNftTrace(names)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		m, err := tg.ToModel()
+		if err != nil {
+			b.Fatal(err)
+		}
+		tg.Reset()
+		_ = m.Hash()
+	}
+}
@@ -26,7 +26,12 @@ type (
 		NetlinkCollectorDeps
 		que          queue.CachedQueFace
 		nlRcvBuffLen int
-		aggregate    bool
+		agg          Aggregation
+		sampler      flowSampler
+		shards       int
+		snapLen      int
+		rrOpts       []RuleResolverOption
+		tgOpts       []TraceGroupOption
 		onceRun      sync.Once
 		onceClose    sync.Once
 		stop         chan struct{}
@@ -36,22 +41,34 @@ type (
 
 var _ TraceCollector = (*netlinkTraceCollector)(nil)
 
-func NewNetlinkCollector(d NetlinkCollectorDeps, nlBuffLen int, useAggregation bool, queSize int) (TraceCollector, error) {
+// NewNetlinkCollector - snapLen is the number of the packet bytes kept for every trace, the kernel sends up to
+// 40 bytes of the network header and 20 bytes of the transport one, 0 disables the capture
+func NewNetlinkCollector(d NetlinkCollectorDeps, nlBuffLen int, sampleRate uint64, agg Aggregation, qs QueSettings, shards int,
+	snapLen int, rrOpts []RuleResolverOption, tgOpts ...TraceGroupOption) (TraceCollector, error) {
 	if nlBuffLen < nl.SockBuffLen16MB {
 		panic(
 			fmt.Errorf("'TraceCollector/nlBuffLen' is %d bytes less than %d bytes", nlBuffLen, nl.SockBuffLen16MB),
 		)
 	}
-	if queSize <= 0 {
+	if qs.Size <= 0 {
 		panic(
-			fmt.Errorf("'TraceCollector/queSize' must be > 0"),
+			fmt.Errorf("'TraceCollector/que.Size' must be > 0"),
 		)
 	}
+	que, err := qs.newQue(agg, d.Subj)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to create trace que")
+	}
 	cl := &netlinkTraceCollector{
 		NetlinkCollectorDeps: d,
-		que:                  queue.NewCachedQue(queSize),
+		que:                  que,
 		nlRcvBuffLen:         nlBuffLen,
-		aggregate:            useAggregation,
+		agg:                  agg,
+		sampler:              flowSampler(sampleRate),
+		shards:               shards,
+		snapLen:              snapLen,
+		rrOpts:               rrOpts,
+		tgOpts:               tgOpts,
 		stop:                 make(chan struct{}),
 	}
 
@@ -79,18 +96,41 @@ func (c *netlinkTraceCollector) Run(ctx context.Context) (err error) {
 	}
 
 	log := logger.FromContext(ctx).Named("netlink-trace-collector")
-	log.Infof("start with options: rcv-buffer-size=%d, use-aggregation=%v",
-		c.nlRcvBuffLen, c.aggregate)
+	log.Infof("start with options: rcv-buffer-size=%d, use-aggregation=%v, agg-key=%s, agg-window=%s, sampling=%v, shards=%d",
+		c.nlRcvBuffLen, c.agg.Enabled, c.agg.key(), c.agg.Window, c.sampler.Enabled(), c.shards)
+
+	var lostCnt, rcvCnt, pktCnt uint64
 
 	defer func() {
+		rateLost := float64(0)
+		if (rcvCnt + lostCnt) > 0 {
+			rateLost = float64(lostCnt) / float64(rcvCnt+lostCnt) * 100
+		}
+		log.Infof("lost samples: %d (%.2f%%), expected samples: %d, agregated pkt: %d",
+			lostCnt, rateLost, rcvCnt+lostCnt, pktCnt)
 		log.Info("stop")
 		_ = nlWatcher.Close()
 		close(c.stopped)
 	}()
 	reader := nlWatcher.Reader(0)
 
-	tg := NewTraceGroup(c.IfaceProvider, c.RuleProvider)
-	defer tg.Close()
+	shards := newTraceShards(c.shards, c.Subj, func() *traceAssembler {
+		return newTraceAssembler(traceAssemblerDeps{
+			TraceGroup: NewTraceGroup(c.IfaceProvider, c.RuleProvider, c.tgOpts...),
+			Que:        c.que,
+			Subj:       c.Subj,
+		}, c.agg, true, c.sampler, c.rrOpts...)
+	})
+	var shardsErr error
+	shardsDone := make(chan struct{})
+	go func() {
+		defer close(shardsDone)
+		shardsErr = shards.Run(ctx)
+	}()
+	defer func() {
+		shards.Close()
+		<-shardsDone
+	}()
 
 	for {
 		select {
@@ -100,6 +140,9 @@ func (c *netlinkTraceCollector) Run(ctx context.Context) (err error) {
 		case <-c.stop:
 			log.Info("will exit cause it has closed")
 			return nil
+		case <-shardsDone:
+			log.Info("will exit cause trace shards have stopped")
+			return shardsErr
 		case nlData, ok := <-reader.Read():
 			if !ok {
 				log.Info("will exit cause trace watcher has already closed")
@@ -110,7 +153,9 @@ func (c *netlinkTraceCollector) Run(ctx context.Context) (err error) {
 
 			if err != nil {
 				if errors.Is(err, nl.ErrNlMem) {
+					lostCnt++
 					c.Subj.Notify(CountCollectNlErrMemEvent{})
+					c.Subj.Notify(CountLostSampleEvent{Cnt: 1})
 					continue
 				}
 				if errors.Is(err, nl.ErrNlDataNotReady) ||
@@ -126,31 +171,17 @@ func (c *netlinkTraceCollector) Run(ctx context.Context) (err error) {
 				if err = tr.InitFromMsg(msg); err != nil {
 					return err
 				}
-				if err = tg.AddTrace(tr.ToNftTrace()); err != nil {
-					return err
-				}
-				if !tg.GroupReady() {
-					continue
-				}
-				m, err := tg.ToModel()
-				if err != nil {
-					return errors.WithMessage(err, "failed to convert obtained trace into model")
-				}
-				tg.Reset()
+				tr.ResolveIfaces(c.IfaceProvider)
+				tr.Capture(c.snapLen)
+				nft := tr.ToNftTrace()
+				rcvCnt++
+				pktCnt += nft.Cnt
+				c.Subj.Notify(CountRcvPktEvent{Cnt: nft.Cnt})
+				c.Subj.Notify(CountRcvSampleEvent{Cnt: 1})
 
-				if !c.aggregate {
-					err = c.que.Enque(m)
-				} else {
-					err = c.que.Upsert(m.Hash(), m)
-				}
-				if errors.Is(err, queue.ErrQueIsFull) {
-					c.Subj.Notify(CountOverflowQueEvent{Cnt: 1})
-					err = nil
-				}
-				if err != nil {
+				if err = shards.Dispatch(nft); err != nil {
 					return err
 				}
-				c.Subj.Notify(CountRcvSampleEvent{Cnt: 1})
 			}
 		}
 	}
@@ -161,6 +192,11 @@ func (c *netlinkTraceCollector) Reader() <-chan model.Trace {
 	return c.que.Reader()
 }
 
+// ReadBatch
+func (c *netlinkTraceCollector) ReadBatch(ctx context.Context, dst []model.Trace) (int, error) {
+	return c.que.ReadBatch(ctx, dst)
+}
+
 // Close collector
 func (c *netlinkTraceCollector) Close() (err error) {
 	c.onceClose.Do(func() {
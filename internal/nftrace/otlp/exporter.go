@@ -0,0 +1,216 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ServiceName - service.name of the exported resource
+	ServiceName = "nftrace"
+
+	defGrpcPort   = "4317"
+	defHttpPort   = "4318"
+	defTimeout    = 10 * time.Second
+	logsPath      = "/v1/logs"
+	metricsPath   = "/v1/metrics"
+	maxErrBodyLen = 512
+)
+
+// Exporter - OTLP client of the collector, the transport is selected by the URL scheme:
+//
+//	otlp://collector:4317              - gRPC, TLS with tls=true
+//	otlp+http://collector:4318         - HTTP with the binary protobuf, the URL path is the prefix of /v1/logs and /v1/metrics
+//	otlp+https://collector:4318/prefix - HTTPS
+//
+// the query also takes: header=Name:Value (may be repeated) - the request headers (gRPC metadata),
+// timeout - timeout of the request (10s by default)
+type Exporter struct {
+	resource *resourcepb.Resource
+	timeout  time.Duration
+	headers  map[string]string
+
+	// gRPC
+	conn    *grpc.ClientConn
+	logs    collogs.LogsServiceClient
+	metrics colmetrics.MetricsServiceClient
+
+	// HTTP
+	client  *http.Client
+	baseURL string
+}
+
+// Dial - creates the exporter by the URL, the connection is made on demand
+func Dial(u *url.URL) (*Exporter, error) {
+	q := u.Query()
+	e := &Exporter{
+		resource: NewResource(),
+		timeout:  defTimeout,
+		headers:  make(map[string]string),
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("collector host is not set")
+	}
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("invalid timeout '%s'", v)
+		}
+		e.timeout = d
+	}
+	for _, h := range q["header"] {
+		k, v, ok := strings.Cut(h, ":")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, errors.Errorf("invalid header '%s', expected 'Name:Value'", h)
+		}
+		e.headers[k] = strings.TrimSpace(v)
+	}
+	switch scheme := strings.ToLower(u.Scheme); scheme {
+	case "otlp":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defGrpcPort)
+		}
+		creds := insecure.NewCredentials()
+		if q.Get("tls") == "true" {
+			creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		}
+		conn, err := grpc.Dial(host, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to dial otlp collector '%s'", host)
+		}
+		e.conn = conn
+		e.logs = collogs.NewLogsServiceClient(conn)
+		e.metrics = colmetrics.NewMetricsServiceClient(conn)
+	case "otlp+http", "otlp+https":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defHttpPort)
+		}
+		e.client = &http.Client{Timeout: e.timeout}
+		e.baseURL = strings.TrimPrefix(scheme, "otlp+") + "://" + host + strings.TrimSuffix(u.Path, "/")
+	default:
+		return nil, errors.Errorf("unknown otlp scheme '%s', expected one of: otlp, otlp+http, otlp+https", u.Scheme)
+	}
+	return e, nil
+}
+
+// Resource - resource of the exported logs and metrics
+func (e *Exporter) Resource() *resourcepb.Resource {
+	return e.resource
+}
+
+// ExportLogs -
+func (e *Exporter) ExportLogs(ctx context.Context, req *collogs.ExportLogsServiceRequest) error {
+	if e.conn != nil {
+		ctx, cancel := e.grpcContext(ctx)
+		defer cancel()
+		_, err := e.logs.Export(ctx, req)
+		return errors.WithMessage(err, "failed to export logs")
+	}
+	return errors.WithMessage(e.post(ctx, logsPath, req), "failed to export logs")
+}
+
+// ExportMetrics -
+func (e *Exporter) ExportMetrics(ctx context.Context, req *colmetrics.ExportMetricsServiceRequest) error {
+	if e.conn != nil {
+		ctx, cancel := e.grpcContext(ctx)
+		defer cancel()
+		_, err := e.metrics.Export(ctx, req)
+		return errors.WithMessage(err, "failed to export metrics")
+	}
+	return errors.WithMessage(e.post(ctx, metricsPath, req), "failed to export metrics")
+}
+
+// Close -
+func (e *Exporter) Close() error {
+	if e.conn != nil {
+		return errors.WithStack(e.conn.Close())
+	}
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func (e *Exporter) grpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(e.headers))
+	}
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+func (e *Exporter) post(ctx context.Context, path string, m proto.Message) error {
+	body, err := proto.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrBodyLen))
+		return errors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// NewResource - service.name and host.name
+func NewResource() *resourcepb.Resource {
+	attrs := []*commonpb.KeyValue{StringAttr("service.name", ServiceName)}
+	if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, StringAttr("host.name", host))
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+// StringAttr -
+func StringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+// IntAttr -
+func IntAttr(k string, v int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}}
+}
+
+// BoolAttr -
+func BoolAttr(k string, v bool) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}}
+}
+
+// TimeUnixNano -
+func TimeUnixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()) //nolint:gosec
+}
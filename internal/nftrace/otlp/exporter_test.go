@@ -0,0 +1,158 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type testCollector struct {
+	collogs.UnimplementedLogsServiceServer
+	colmetrics.UnimplementedMetricsServiceServer
+	logs    chan *collogs.ExportLogsServiceRequest
+	metrics chan *colmetrics.ExportMetricsServiceRequest
+	md      chan metadata.MD
+}
+
+func newTestCollector() *testCollector {
+	return &testCollector{
+		logs:    make(chan *collogs.ExportLogsServiceRequest, 10),
+		metrics: make(chan *colmetrics.ExportMetricsServiceRequest, 10),
+		md:      make(chan metadata.MD, 10),
+	}
+}
+
+func (c *testCollector) Export(ctx context.Context, req *collogs.ExportLogsServiceRequest) (*collogs.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.md <- md
+	c.logs <- req
+	return &collogs.ExportLogsServiceResponse{}, nil
+}
+
+type testMetricsCollector struct {
+	*testCollector
+}
+
+func (c testMetricsCollector) Export(_ context.Context, req *colmetrics.ExportMetricsServiceRequest) (*colmetrics.ExportMetricsServiceResponse, error) {
+	c.metrics <- req
+	return &colmetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func testLogsRequest() *collogs.ExportLogsServiceRequest {
+	return &collogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: NewResource(),
+			ScopeLogs: []*logspb.ScopeLogs{{
+				LogRecords: []*logspb.LogRecord{{SeverityText: "WARN", Attributes: []*commonpb.KeyValue{StringAttr("k", "v")}}},
+			}},
+		}},
+	}
+}
+
+func Test_Dial(t *testing.T) {
+	testCases := []struct {
+		url     string
+		baseURL string
+		expErr  bool
+	}{
+		{url: "otlp://collector"},
+		{url: "otlp://collector:4317?tls=true&header=Authorization:Bearer%20x&timeout=1s"},
+		{url: "otlp+http://collector", baseURL: "http://collector:4318"},
+		{url: "otlp+https://collector:443/otlp/", baseURL: "https://collector:443/otlp"},
+		{url: "otlp://", expErr: true},
+		{url: "otlp://collector?timeout=soon", expErr: true},
+		{url: "otlp://collector?header=x", expErr: true},
+		{url: "otlp+ftp://collector", expErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			require.NoError(t, err)
+			e, err := Dial(u)
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.baseURL, e.baseURL)
+			require.NoError(t, e.Close())
+		})
+	}
+}
+
+func Test_ExporterGrpc(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c := newTestCollector()
+	srv := grpc.NewServer()
+	collogs.RegisterLogsServiceServer(srv, c)
+	colmetrics.RegisterMetricsServiceServer(srv, testMetricsCollector{c})
+	go srv.Serve(l) //nolint:errcheck
+	defer srv.Stop()
+
+	u, err := url.Parse("otlp://" + l.Addr().String() + "?header=X-Tenant:team1")
+	require.NoError(t, err)
+	e, err := Dial(u)
+	require.NoError(t, err)
+	defer e.Close() //nolint:errcheck
+	ctx := context.Background()
+
+	req := testLogsRequest()
+	require.NoError(t, e.ExportLogs(ctx, req))
+	require.True(t, proto.Equal(req, <-c.logs))
+	require.Equal(t, []string{"team1"}, (<-c.md).Get("x-tenant"))
+
+	mreq := &colmetrics.ExportMetricsServiceRequest{}
+	require.NoError(t, e.ExportMetrics(ctx, mreq))
+	require.True(t, proto.Equal(mreq, <-c.metrics))
+}
+
+func Test_ExporterHttp(t *testing.T) {
+	type received struct {
+		path, contentType, tenant string
+		body                      []byte
+	}
+	rcv := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv <- received{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("X-Tenant"), body}
+		if r.URL.Path == "/otlp/v1/metrics" {
+			http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse("otlp+http://" + srv.Listener.Addr().String() + "/otlp?header=X-Tenant:team1")
+	require.NoError(t, err)
+	e, err := Dial(u)
+	require.NoError(t, err)
+	defer e.Close() //nolint:errcheck
+	ctx := context.Background()
+
+	req := testLogsRequest()
+	require.NoError(t, e.ExportLogs(ctx, req))
+	r := <-rcv
+	require.Equal(t, "/otlp/v1/logs", r.path)
+	require.Equal(t, "application/x-protobuf", r.contentType)
+	require.Equal(t, "team1", r.tenant)
+	var got collogs.ExportLogsServiceRequest
+	require.NoError(t, proto.Unmarshal(r.body, &got))
+	require.True(t, proto.Equal(req, &got))
+
+	err = e.ExportMetrics(ctx, &colmetrics.ExportMetricsServiceRequest{})
+	require.ErrorContains(t, err, "429")
+	require.ErrorContains(t, err, "quota exceeded")
+}
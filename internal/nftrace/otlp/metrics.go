@@ -0,0 +1,198 @@
+package otlp
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/H-BF/corlib/logger"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// DefPushInterval - default period of the metrics push
+const DefPushInterval = 30 * time.Second
+
+// MetricsPusher - pushes the metrics of the Prometheus gatherer to the OTLP collector periodically.
+// The counters become cumulative monotonic sums, the gauges and untyped metrics become gauges,
+// the histograms and summaries keep their type
+type MetricsPusher struct {
+	Exporter *Exporter
+	Gatherer prometheus.Gatherer
+	Interval time.Duration
+
+	onceRun sync.Once
+	start   time.Time
+}
+
+// Run - pushes the metrics until the context is done, the last push is made on the exit
+func (p *MetricsPusher) Run(ctx context.Context) error {
+	var doRun bool
+	p.onceRun.Do(func() {
+		doRun = true
+	})
+	if !doRun {
+		return errors.New("it has been run yet")
+	}
+	log := logger.FromContext(ctx).Named("otlp-metrics")
+	log.Info("start")
+	defer log.Info("stop")
+
+	p.start = time.Now()
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefPushInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx1, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.Exporter.timeout)
+			defer cancel()
+			if err := p.Push(ctx1); err != nil {
+				log.Errorf("%v", err)
+			}
+			return nil
+		case <-t.C:
+			if err := p.Push(ctx); err != nil {
+				log.Errorf("%v", err)
+			}
+		}
+	}
+}
+
+// Push - pushes the current values of the metrics
+func (p *MetricsPusher) Push(ctx context.Context) error {
+	families, err := p.Gatherer.Gather()
+	if err != nil {
+		return errors.WithMessage(err, "failed to gather metrics")
+	}
+	start := p.start
+	if start.IsZero() {
+		start = time.Now()
+	}
+	req := &colmetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: p.Exporter.Resource(),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: ServiceName},
+				Metrics: ConvertMetrics(families, start, time.Now()),
+			}},
+		}},
+	}
+	return p.Exporter.ExportMetrics(ctx, req)
+}
+
+// Close -
+func (p *MetricsPusher) Close() error {
+	return p.Exporter.Close()
+}
+
+// ConvertMetrics - OTLP metrics of the Prometheus metric families, start is the start time of the cumulative values
+func ConvertMetrics(families []*dto.MetricFamily, start, now time.Time) []*metricspb.Metric {
+	t0, t1 := TimeUnixNano(start), TimeUnixNano(now)
+	ret := make([]*metricspb.Metric, 0, len(families))
+	for _, mf := range families {
+		m := &metricspb.Metric{Name: mf.GetName(), Description: mf.GetHelp()}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			sum := &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}
+			for _, pm := range mf.GetMetric() {
+				sum.DataPoints = append(sum.DataPoints, numberPoint(pm, pm.GetCounter().GetValue(), t0, t1))
+			}
+			m.Data = &metricspb.Metric_Sum{Sum: sum}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			g := &metricspb.Gauge{}
+			for _, pm := range mf.GetMetric() {
+				v := pm.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					v = pm.GetUntyped().GetValue()
+				}
+				g.DataPoints = append(g.DataPoints, numberPoint(pm, v, 0, t1))
+			}
+			m.Data = &metricspb.Metric_Gauge{Gauge: g}
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			h := &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			}
+			for _, pm := range mf.GetMetric() {
+				h.DataPoints = append(h.DataPoints, histogramPoint(pm, t0, t1))
+			}
+			m.Data = &metricspb.Metric_Histogram{Histogram: h}
+		case dto.MetricType_SUMMARY:
+			s := &metricspb.Summary{}
+			for _, pm := range mf.GetMetric() {
+				ps := pm.GetSummary()
+				dp := &metricspb.SummaryDataPoint{
+					Attributes:        labelAttrs(pm),
+					StartTimeUnixNano: t0,
+					TimeUnixNano:      t1,
+					Count:             ps.GetSampleCount(),
+					Sum:               ps.GetSampleSum(),
+				}
+				for _, q := range ps.GetQuantile() {
+					dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+						Quantile: q.GetQuantile(),
+						Value:    q.GetValue(),
+					})
+				}
+				s.DataPoints = append(s.DataPoints, dp)
+			}
+			m.Data = &metricspb.Metric_Summary{Summary: s}
+		default:
+			continue
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func numberPoint(pm *dto.Metric, v float64, t0, t1 uint64) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        labelAttrs(pm),
+		StartTimeUnixNano: t0,
+		TimeUnixNano:      t1,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+	}
+}
+
+// histogramPoint - the cumulative Prometheus buckets become the counts of the explicit bounds, +Inf is implicit
+func histogramPoint(pm *dto.Metric, t0, t1 uint64) *metricspb.HistogramDataPoint {
+	ph := pm.GetHistogram()
+	sum := ph.GetSampleSum()
+	dp := &metricspb.HistogramDataPoint{
+		Attributes:        labelAttrs(pm),
+		StartTimeUnixNano: t0,
+		TimeUnixNano:      t1,
+		Count:             ph.GetSampleCount(),
+		Sum:               &sum,
+	}
+	var prev uint64
+	for _, b := range ph.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		dp.ExplicitBounds = append(dp.ExplicitBounds, b.GetUpperBound())
+		dp.BucketCounts = append(dp.BucketCounts, b.GetCumulativeCount()-prev)
+		prev = b.GetCumulativeCount()
+	}
+	dp.BucketCounts = append(dp.BucketCounts, dp.Count-min(prev, dp.Count))
+	return dp
+}
+
+func labelAttrs(pm *dto.Metric) []*commonpb.KeyValue {
+	ret := make([]*commonpb.KeyValue, 0, len(pm.GetLabel()))
+	for _, l := range pm.GetLabel() {
+		ret = append(ret, StringAttr(l.GetName(), l.GetValue()))
+	}
+	return ret
+}
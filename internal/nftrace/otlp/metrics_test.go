@@ -0,0 +1,98 @@
+package otlp
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+func testRegistry(t *testing.T) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	cnt := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "sink_traces", Help: "traces"}, []string{"sink"})
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "que_depth"})
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "batch_size", Buckets: []float64{1, 10}})
+	s := prometheus.NewSummary(prometheus.SummaryOpts{Name: "latency", Objectives: map[float64]float64{0.5: 0.05}})
+	require.NoError(t, reg.Register(cnt))
+	require.NoError(t, reg.Register(g))
+	require.NoError(t, reg.Register(h))
+	require.NoError(t, reg.Register(s))
+	cnt.WithLabelValues("file").Add(3)
+	g.Set(7)
+	for _, v := range []float64{0.5, 5, 50, 60} {
+		h.Observe(v)
+	}
+	s.Observe(2)
+	return reg
+}
+
+func Test_ConvertMetrics(t *testing.T) {
+	families, err := testRegistry(t).Gather()
+	require.NoError(t, err)
+	start, now := time.Unix(100, 0), time.Unix(130, 0)
+	byName := make(map[string]*metricspb.Metric)
+	for _, m := range ConvertMetrics(families, start, now) {
+		byName[m.GetName()] = m
+	}
+	require.Len(t, byName, 4)
+
+	sum := byName["sink_traces"].GetSum()
+	require.NotNil(t, sum)
+	require.True(t, sum.GetIsMonotonic())
+	require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.GetAggregationTemporality())
+	require.Len(t, sum.GetDataPoints(), 1)
+	dp := sum.GetDataPoints()[0]
+	require.Equal(t, 3.0, dp.GetAsDouble())
+	require.Equal(t, TimeUnixNano(start), dp.GetStartTimeUnixNano())
+	require.Equal(t, TimeUnixNano(now), dp.GetTimeUnixNano())
+	require.Equal(t, "sink", dp.GetAttributes()[0].GetKey())
+	require.Equal(t, "file", dp.GetAttributes()[0].GetValue().GetStringValue())
+	require.Equal(t, "traces", byName["sink_traces"].GetDescription())
+
+	require.Equal(t, 7.0, byName["que_depth"].GetGauge().GetDataPoints()[0].GetAsDouble())
+
+	hp := byName["batch_size"].GetHistogram().GetDataPoints()[0]
+	require.Equal(t, uint64(4), hp.GetCount())
+	require.Equal(t, 115.5, hp.GetSum())
+	require.Equal(t, []float64{1, 10}, hp.GetExplicitBounds())
+	require.Equal(t, []uint64{1, 1, 2}, hp.GetBucketCounts())
+
+	sp := byName["latency"].GetSummary().GetDataPoints()[0]
+	require.Equal(t, uint64(1), sp.GetCount())
+	require.Equal(t, 0.5, sp.GetQuantileValues()[0].GetQuantile())
+	require.Equal(t, 2.0, sp.GetQuantileValues()[0].GetValue())
+}
+
+func Test_MetricsPusher(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c := newTestCollector()
+	srv := grpc.NewServer()
+	colmetrics.RegisterMetricsServiceServer(srv, testMetricsCollector{c})
+	go srv.Serve(l) //nolint:errcheck
+	defer srv.Stop()
+
+	u, err := url.Parse("otlp://" + l.Addr().String())
+	require.NoError(t, err)
+	e, err := Dial(u)
+	require.NoError(t, err)
+	p := &MetricsPusher{Exporter: e, Gatherer: testRegistry(t), Interval: 10 * time.Millisecond}
+	defer p.Close() //nolint:errcheck
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	req := <-c.metrics
+	require.Equal(t, ServiceName, req.GetResourceMetrics()[0].GetResource().GetAttributes()[0].GetValue().GetStringValue())
+	require.Len(t, req.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics(), 4)
+	cancel()
+	require.NoError(t, <-done)
+	require.Error(t, p.Run(context.Background()))
+}
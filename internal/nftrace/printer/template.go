@@ -0,0 +1,262 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// Template - the trace rendered by text/template, the dot is *model.Trace. The text is either a Go template
+// or the name of a built-in one:
+//
+//	short       - time, verdict, 5-tuple, table and chain
+//	full        - all the trace fields in one line
+//	nft-monitor - the packet and its path as 'nft monitor trace' prints them
+//
+// the helper functions:
+//
+//	pad N v, lpad N v   - v left (right) aligned in N columns
+//	trunc N v           - v cut to N runes
+//	upper v, lower v
+//	color NAME v        - v in the ANSI color: red, green, yellow, blue, magenta, cyan, gray, bold
+//	vcolor v            - v colored by the verdict it holds: accept - green, drop and reject - red, other - yellow
+//	symbol VERDICT      - ✓ accept, ✗ drop, ⊘ reject, ⇢ queue, ↳ jump, ↪ goto, ↩ return, → continue, • other
+//	verdict T           - the final verdict of the trace, the rule one if the path is incomplete
+//	time LAYOUT T       - the time in the Go layout
+//	duration FROM TO    - the duration between the times, e.g. 'duration .FirstSeen .LastSeen'
+//	ip ADDR             - the address, '*' if unknown
+//	hostport ADDR PORT  - 'ip:port', '[ip6]:port', the port is omitted if zero
+//	mac HWADDR          - 'aa:bb:cc:dd:ee:ff', empty if unknown
+//	nftpacket T, nfthop HOP - the packet and the hop as 'nft monitor trace' prints them
+//
+// The colors are on only if ParseTemplate is asked for them and NO_COLOR isn't set. The trailing line breaks of the output are trimmed
+type Template struct {
+	t *template.Template
+}
+
+// builtinTemplates - the templates by name
+var builtinTemplates = map[string]string{
+	"short": `{{time "15:04:05.000" .Timestamp}} {{symbol (verdict .)}} {{verdict . | pad 7 | vcolor}} ` +
+		`{{.IpProto | pad 5}} {{hostport .SAddr .SPort}} -> {{hostport .DAddr .DPort}} {{.Table}}/{{.Chain}}`,
+
+	"full": `{{time "2006-01-02T15:04:05.000000Z07:00" .Timestamp}} trace={{.TrId}} {{.Family}} ` +
+		`{{.Table}}/{{.Chain}}{{if .RuleHandle}}#{{.RuleHandle}}{{end}} {{symbol (verdict .)}} {{verdict . | vcolor}}` +
+		`{{with .JumpTarget}} jt={{.}}{{end}} {{.IpProto}} {{hostport .SAddr .SPort}} -> {{hostport .DAddr .DPort}}` +
+		`{{with .Iifname}} iif={{.}}{{end}}{{with .Oifname}} oif={{.}}{{end}}` +
+		`{{with mac .SMacAddr}} hw-src={{.}}{{end}}{{with mac .DMacAddr}} hw-dst={{.}}{{end}} len={{.Length}}` +
+		`{{with .CtState}} ct={{.}}{{end}}{{with .CtDirection}} ct-dir={{.}}{{end}}` +
+		`{{with .Rule}} rule="{{.}}"{{end}}{{with .PathString}} path="{{.}}"{{end}} cnt={{.Cnt}}` +
+		`{{if .Bytes}} bytes={{.Bytes}}{{end}}{{if not .FirstSeen.IsZero}} dur={{duration .FirstSeen .LastSeen}}{{end}}` +
+		`{{if .Incomplete}} incomplete{{end}}`,
+
+	"nft-monitor": `{{$t := .}}{{$id := printf "%08x" .TrId}}` +
+		`trace id {{$id}} {{.Family}} {{.Table}} {{.Chain}} packet: {{nftpacket .}}` +
+		`{{range .Path}}{{"\n"}}trace id {{$id}} {{$t.Family}} {{.Table}} {{.Chain}} {{nfthop .}}{{else}}` +
+		`{{"\n"}}trace id {{$id}} {{.Family}} {{.Table}} {{.Chain}} rule {{.Rule}} (verdict {{.Verdict}})` +
+		`{{end}}`,
+}
+
+var ansiColors = map[string]string{
+	"red": "31", "green": "32", "yellow": "33", "blue": "34", "magenta": "35", "cyan": "36", "gray": "90", "bold": "1",
+}
+
+var verdictSymbols = map[string]string{
+	"accept": "✓", "drop": "✗", "reject": "⊘", "queue": "⇢", "jump": "↳", "goto": "↪", "return": "↩", "continue": "→",
+}
+
+// BuiltinTemplates - names of the built-in templates
+func BuiltinTemplates() []string {
+	ret := make([]string, 0, len(builtinTemplates))
+	for n := range builtinTemplates {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ParseTemplate - the template by the text or the built-in name, colors turns on the ANSI colors
+func ParseTemplate(text string, colors bool) (*Template, error) {
+	if text == "" {
+		return nil, errors.New("template is empty")
+	}
+	name := "format"
+	if b, ok := builtinTemplates[text]; ok {
+		name, text = text, b
+	}
+	t, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs(colors && os.Getenv("NO_COLOR") == "")).Parse(text)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid template")
+	}
+	return &Template{t: t}, nil
+}
+
+// Format - appends the rendered trace
+func (t *Template) Format(dst []byte, tr *model.Trace) ([]byte, error) {
+	w := bytes.NewBuffer(dst)
+	if err := t.t.Execute(w, tr); err != nil {
+		return dst, errors.WithMessagef(err, "failed to render template '%s'", t.t.Name())
+	}
+	return bytes.TrimRight(w.Bytes(), "\r\n"), nil
+}
+
+func templateFuncs(colors bool) template.FuncMap {
+	colorize := func(name string, v any) (string, error) {
+		s := fmt.Sprint(v)
+		code, ok := ansiColors[name]
+		if !ok {
+			return "", errors.Errorf("unknown color '%s'", name)
+		}
+		if !colors {
+			return s, nil
+		}
+		return "\x1b[" + code + "m" + s + "\x1b[0m", nil
+	}
+	return template.FuncMap{
+		"pad": func(n int, v any) string {
+			s := fmt.Sprint(v)
+			return s + strings.Repeat(" ", max(n-utf8.RuneCountInString(s), 0))
+		},
+		"lpad": func(n int, v any) string {
+			s := fmt.Sprint(v)
+			return strings.Repeat(" ", max(n-utf8.RuneCountInString(s), 0)) + s
+		},
+		"trunc": func(n int, v any) string {
+			s := fmt.Sprint(v)
+			if utf8.RuneCountInString(s) <= n {
+				return s
+			}
+			return string([]rune(s)[:max(n, 0)])
+		},
+		"upper": func(v any) string { return strings.ToUpper(fmt.Sprint(v)) },
+		"lower": func(v any) string { return strings.ToLower(fmt.Sprint(v)) },
+		"color": colorize,
+		"vcolor": func(v any) (string, error) {
+			switch strings.TrimSpace(strings.ToLower(fmt.Sprint(v))) {
+			case "accept":
+				return colorize("green", v)
+			case "drop", "reject":
+				return colorize("red", v)
+			}
+			return colorize("yellow", v)
+		},
+		"symbol": func(verdict string) string {
+			if s, ok := verdictSymbols[strings.ToLower(verdict)]; ok {
+				return s
+			}
+			return "•"
+		},
+		"verdict": func(t *model.Trace) string {
+			if t.Final != "" {
+				return t.Final
+			}
+			return t.Verdict
+		},
+		"time": func(layout string, ts time.Time) string { return ts.Format(layout) },
+		"duration": func(from, to time.Time) string {
+			d := to.Sub(from)
+			switch {
+			case d >= time.Second:
+				d = d.Round(time.Millisecond)
+			case d >= time.Millisecond:
+				d = d.Round(time.Microsecond)
+			}
+			return d.String()
+		},
+		"ip": func(a netip.Addr) string {
+			if !a.IsValid() {
+				return "*"
+			}
+			return a.String()
+		},
+		"hostport": func(a netip.Addr, port uint32) string {
+			host := "*"
+			if a.IsValid() {
+				host = a.String()
+			}
+			if port == 0 {
+				return host
+			}
+			if a.Is6() && !a.Is4In6() {
+				host = "[" + host + "]"
+			}
+			return host + ":" + strconv.FormatUint(uint64(port), 10)
+		},
+		"mac":       func(a model.HwAddr) string { return a.String() },
+		"nftpacket": nftPacket,
+		"nfthop":    nftHop,
+	}
+}
+
+// nftPacket - the packet fields as 'nft monitor trace' prints them
+func nftPacket(t *model.Trace) string {
+	var sb strings.Builder
+	add := func(s ...string) {
+		for _, v := range s {
+			if sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(v)
+		}
+	}
+	if t.Iifname != "" {
+		add("iif", strconv.Quote(t.Iifname))
+	}
+	if t.Oifname != "" {
+		add("oif", strconv.Quote(t.Oifname))
+	}
+	if !t.SMacAddr.IsZero() {
+		add("ether saddr", t.SMacAddr.String())
+	}
+	if !t.DMacAddr.IsZero() {
+		add("ether daddr", t.DMacAddr.String())
+	}
+	l3, proto := "ip", "protocol"
+	if t.L3Proto == "ip6" || (t.SAddr.Is6() && !t.SAddr.Is4In6()) {
+		l3, proto = "ip6", "nexthdr"
+	}
+	if t.SAddr.IsValid() {
+		add(l3+" saddr", t.SAddr.String())
+	}
+	if t.DAddr.IsValid() {
+		add(l3+" daddr", t.DAddr.String())
+	}
+	if t.IpProto != "" {
+		add(l3+" "+proto, t.IpProto)
+	}
+	if t.Length != 0 {
+		add(l3+" length", strconv.FormatUint(uint64(t.Length), 10))
+	}
+	if t.SPort != 0 {
+		add(t.IpProto+" sport", strconv.FormatUint(uint64(t.SPort), 10))
+	}
+	if t.DPort != 0 {
+		add(t.IpProto+" dport", strconv.FormatUint(uint64(t.DPort), 10))
+	}
+	return sb.String()
+}
+
+// nftHop - 'rule EXPR (verdict V)', 'policy V' or 'verdict V'
+func nftHop(h model.Hop) string {
+	verdict := h.Verdict
+	if h.JumpTarget != "" {
+		verdict += " " + h.JumpTarget
+	}
+	switch h.Type {
+	case "rule":
+		return "rule " + h.Rule + " (verdict " + verdict + ")"
+	case "policy":
+		return "policy " + verdict
+	}
+	return "verdict " + verdict
+}
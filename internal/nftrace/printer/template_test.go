@@ -0,0 +1,149 @@
+package printer
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+var templateTestTrace = model.Trace{
+	TrId:       0x1a2b,
+	Table:      "filter",
+	Chain:      "input",
+	RuleHandle: 4,
+	Family:     "ip",
+	L3Proto:    "ip",
+	Iifname:    "eth0",
+	SMacAddr:   model.HwAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+	SAddr:      netip.MustParseAddr("10.0.0.1"),
+	DAddr:      netip.MustParseAddr("10.0.0.2"),
+	SPort:      1234,
+	DPort:      80,
+	Length:     60,
+	IpProto:    "tcp",
+	Verdict:    "drop",
+	Final:      "drop",
+	Rule:       "tcp dport 80 drop",
+	Path: []model.Hop{
+		{Type: "rule", Table: "filter", Chain: "input", Handle: 2, Rule: "iif eth0 jump in_eth0", Verdict: "jump", JumpTarget: "in_eth0"},
+		{Type: "return", Table: "filter", Chain: "in_eth0", Verdict: "continue"},
+		{Type: "rule", Table: "filter", Chain: "input", Handle: 4, Rule: "tcp dport 80 drop", Verdict: "drop"},
+	},
+	Cnt:       3,
+	Bytes:     180,
+	FirstSeen: time.Date(2024, 5, 1, 10, 20, 29, 0, time.UTC),
+	LastSeen:  time.Date(2024, 5, 1, 10, 20, 30, 500000000, time.UTC),
+	Timestamp: time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.UTC),
+}
+
+func Test_Template(t *testing.T) {
+	v6 := model.Trace{
+		TrId: 1, Family: "inet", Table: "fw", Chain: "in", L3Proto: "ip6", IpProto: "udp",
+		SAddr: netip.MustParseAddr("2001:db8::1"), DAddr: netip.MustParseAddr("2001:db8::2"), DPort: 53,
+		Verdict: "accept", Rule: "udp dport 53 accept",
+	}
+	testCases := []struct {
+		name    string
+		text    string
+		trace   model.Trace
+		noColor bool
+		plain   bool
+		exp     string
+	}{
+		{
+			name:    "short",
+			text:    "short",
+			trace:   templateTestTrace,
+			noColor: true,
+			exp:     "10:20:30.123 ✗ drop    tcp   10.0.0.1:1234 -> 10.0.0.2:80 filter/input",
+		},
+		{
+			name:  "short colored",
+			text:  "short",
+			trace: v6,
+			exp:   "00:00:00.000 ✓ \x1b[32maccept \x1b[0m udp   2001:db8::1 -> [2001:db8::2]:53 fw/in",
+		},
+		{
+			name:    "full",
+			text:    "full",
+			trace:   templateTestTrace,
+			noColor: true,
+			exp: `2024-05-01T10:20:30.123456Z trace=6699 ip filter/input#4 ✗ drop tcp 10.0.0.1:1234 -> 10.0.0.2:80 ` +
+				`iif=eth0 hw-src=aa:bb:cc:dd:ee:ff len=60 rule="tcp dport 80 drop" ` +
+				`path="rule filter/input#2 jump in_eth0 -> return filter/in_eth0 continue -> rule filter/input#4 drop" ` +
+				`cnt=3 bytes=180 dur=1.5s`,
+		},
+		{
+			name:  "nft-monitor",
+			text:  "nft-monitor",
+			trace: templateTestTrace,
+			exp: `trace id 00001a2b ip filter input packet: iif "eth0" ether saddr aa:bb:cc:dd:ee:ff ` +
+				`ip saddr 10.0.0.1 ip daddr 10.0.0.2 ip protocol tcp ip length 60 tcp sport 1234 tcp dport 80` + "\n" +
+				`trace id 00001a2b ip filter input rule iif eth0 jump in_eth0 (verdict jump in_eth0)` + "\n" +
+				`trace id 00001a2b ip filter in_eth0 verdict continue` + "\n" +
+				`trace id 00001a2b ip filter input rule tcp dport 80 drop (verdict drop)`,
+		},
+		{
+			name:  "nft-monitor without path",
+			text:  "nft-monitor",
+			trace: v6,
+			exp: `trace id 00000001 inet fw in packet: ip6 saddr 2001:db8::1 ip6 daddr 2001:db8::2 ip6 nexthdr udp udp dport 53` + "\n" +
+				`trace id 00000001 inet fw in rule udp dport 53 accept (verdict accept)`,
+		},
+		{
+			name:  "helpers",
+			text:  `[{{.Chain | pad 7}}][{{.Table | lpad 8}}][{{trunc 3 .Rule}}][{{upper .IpProto}}][{{ip .DAddr}}]` + "\n\n",
+			trace: templateTestTrace,
+			exp:   "[input  ][  filter][tcp][TCP][10.0.0.2]",
+		},
+		{
+			name: "unknown address",
+			text: `{{ip .SAddr}} {{hostport .DAddr .DPort}} {{duration .FirstSeen .LastSeen}}`,
+			exp:  "* * 0s",
+		},
+		{
+			name:    "colors are off",
+			text:    `{{color "red" .Verdict}} {{symbol "queue"}} {{symbol "stolen"}}`,
+			trace:   templateTestTrace,
+			noColor: true,
+			exp:     "drop ⇢ •",
+		},
+		{
+			name:  "colors are not asked for",
+			text:  `{{color "red" .Verdict}} {{vcolor .Verdict}}`,
+			trace: templateTestTrace,
+			plain: true,
+			exp:   "drop drop",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.noColor {
+				t.Setenv("NO_COLOR", "1")
+			}
+			tmpl, err := ParseTemplate(tc.text, !tc.plain)
+			require.NoError(t, err)
+			got, err := tmpl.Format([]byte("> "), &tc.trace)
+			require.NoError(t, err)
+			require.Equal(t, "> "+tc.exp, string(got))
+		})
+	}
+}
+
+func Test_TemplateErrors(t *testing.T) {
+	for _, text := range []string{"", "{{.Table", "{{nosuchfunc .}}"} {
+		_, err := ParseTemplate(text, false)
+		require.Error(t, err, text)
+	}
+	for _, text := range []string{"{{.NoSuchField}}", `{{color "pink" .Table}}`} {
+		tmpl, err := ParseTemplate(text, false)
+		require.NoError(t, err)
+		_, err = tmpl.Format(nil, &templateTestTrace)
+		require.Error(t, err, text)
+	}
+	require.Equal(t, []string{"full", "nft-monitor", "short"}, BuiltinTemplates())
+}
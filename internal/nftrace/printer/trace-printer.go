@@ -6,7 +6,6 @@ import (
 	model "github.com/Morwran/ebpf-nftrace/internal/models"
 
 	"github.com/H-BF/corlib/logger"
-	linq "github.com/ahmetb/go-linq/v3"
 	"go.uber.org/zap"
 )
 
@@ -24,6 +23,13 @@ func WithJsonFormat() Option {
 	}
 }
 
+// WithTemplate - every trace is printed by the template
+func WithTemplate(t *Template) Option {
+	return func(p *printerImpl) {
+		p.tmpl = t
+	}
+}
+
 type TracePrinter interface {
 	Print(...model.Trace)
 }
@@ -33,6 +39,7 @@ type (
 	printerImpl struct {
 		log        logger.TypeOfLogger
 		jsonFormat bool
+		tmpl       *Template
 	}
 	dummyPrinter struct{}
 )
@@ -48,6 +55,18 @@ func NewTracePrinter(options ...Option) TracePrinter {
 }
 
 func (p printerImpl) Print(traces ...model.Trace) {
+	if p.tmpl != nil {
+		var buf []byte
+		for i := range traces {
+			var err error
+			if buf, err = p.tmpl.Format(buf[:0], &traces[i]); err != nil {
+				p.log.Errorf("%v", err)
+				continue
+			}
+			p.log.Info(string(buf))
+		}
+		return
+	}
 	print := p.log.Infow
 	if !p.jsonFormat {
 		print = p.log.Infof
@@ -62,24 +81,29 @@ func NewDummyPrinter() TracePrinter {
 func (p dummyPrinter) Print(traces ...model.Trace) {
 }
 
+// PrintTrace - prints the traces in the order of arrival, the same traces of the call are printed once
+// with the counter summed up
 func PrintTrace(traces []model.Trace, jsonFormat, printTimestamp bool, print PrinterF, callback func(trace model.Trace)) {
 	cntUniqueTrace := make(map[string]uint64, len(traces))
 	uniqueTrace := make(map[string]model.Trace, len(traces))
+	keys := make([]string, 0, len(traces))
 
 	for _, trace := range traces {
 		key := trace.FiveTuple()
+		if len(trace.Path) > 0 {
+			key += " path=" + trace.PathString()
+		}
 		if jsonFormat {
 			key = trace.JsonString()
 		}
 		cntUniqueTrace[key]++
 		if _, ok := uniqueTrace[key]; !ok {
 			uniqueTrace[key] = trace
+			keys = append(keys, key)
 		}
 	}
-	linq.From(uniqueTrace).ForEach(func(i any) {
-		kv := i.(linq.KeyValue)
-		key := kv.Key.(string)
-		val := kv.Value.(model.Trace)
+	for _, key := range keys {
+		val := uniqueTrace[key]
 		if !jsonFormat {
 			timestamp := ""
 			if printTimestamp {
@@ -92,5 +116,5 @@ func PrintTrace(traces []model.Trace, jsonFormat, printTimestamp bool, print Pri
 		if callback != nil {
 			callback(val)
 		}
-	})
+	}
 }
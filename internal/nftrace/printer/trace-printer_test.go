@@ -0,0 +1,38 @@
+package printer
+
+import (
+	"fmt"
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PrintTraceOrder(t *testing.T) {
+	var traces []model.Trace
+	for _, port := range []uint32{443, 22, 8080, 22, 53, 443, 1} {
+		tr := templateTestTrace
+		tr.DPort, tr.Cnt = port, 1
+		traces = append(traces, tr)
+	}
+	for _, jsonFormat := range []bool{false, true} {
+		t.Run(fmt.Sprintf("json=%v", jsonFormat), func(t *testing.T) {
+			for range 10 {
+				var ports []uint32
+				var counts []uint64
+				PrintTrace(traces, jsonFormat, false, func(msg string, kv ...interface{}) {
+					if jsonFormat {
+						counts = append(counts, kv[3].(uint64))
+					} else {
+						counts = append(counts, kv[2].(uint64))
+					}
+				}, func(tr model.Trace) {
+					ports = append(ports, tr.DPort)
+				})
+				require.Equal(t, []uint32{443, 22, 8080, 53, 1}, ports)
+				require.Equal(t, []uint64{2, 2, 1, 1, 1}, counts)
+			}
+		})
+	}
+}
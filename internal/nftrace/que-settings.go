@@ -0,0 +1,48 @@
+package nftrace
+
+import (
+	"fmt"
+	"time"
+
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+)
+
+// QueSettings - settings of the que the collected traces are read from
+type QueSettings struct {
+	// Type - implementation of the que: QueTypeRing or QueTypeList, QueTypeRing if empty
+	Type string
+	// Size - max count of the records in the que
+	Size int
+	// Policy - what to do with a new record when the que is full
+	Policy queue.Policy
+	// BlockTimeout - max time the collector waits for free room with queue.PolicyBlock,
+	// queue.DefBlockTimeout if zero
+	BlockTimeout time.Duration
+}
+
+// Que implementations
+const (
+	QueTypeList = "list"
+	QueTypeRing = "ring"
+)
+
+func (s QueSettings) newQue(agg Aggregation, subj observer.Subject) (queue.CachedQueFace, error) {
+	opts := append(agg.queOptions(),
+		queue.WithPolicy(s.Policy),
+		queue.WithDropHandler(func(p queue.Policy, cnt int) {
+			subj.Notify(CountQueDropEvent{Policy: p.String(), Cnt: uint64(cnt)}) //nolint:gosec
+		}),
+	)
+	if s.BlockTimeout > 0 {
+		opts = append(opts, queue.WithBlockTimeout(s.BlockTimeout))
+	}
+	switch s.Type {
+	case "", QueTypeRing:
+		return queue.NewRingQue(s.Size, opts...)
+	case QueTypeList:
+		return queue.NewCachedQue(s.Size, opts...), nil
+	}
+	return nil, fmt.Errorf("unknown que type '%s'", s.Type)
+}
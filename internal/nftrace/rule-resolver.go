@@ -0,0 +1,158 @@
+package nftrace
+
+import (
+	"strconv"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	rl "github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
+
+	nftLib "github.com/google/nftables"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefRuleResolveWindow - default time a trace waits for its rule to appear in the rule provider
+	DefRuleResolveWindow = 3 * time.Second
+	// DefMaxPendingTraces - default max number of traces waiting for their rules
+	DefMaxPendingTraces = 10000
+
+	ruleResolveRetryInterval = 200 * time.Millisecond
+)
+
+const ( // rule resolution outcomes
+	// ResolveOutcomeDeferred - rule was not found at once, the trace waits for it
+	ResolveOutcomeDeferred = "deferred"
+	// ResolveOutcomeResolved - rule was found on retry
+	ResolveOutcomeResolved = "resolved"
+	// ResolveOutcomeUnresolved - rule was not found during the window, trace is emitted with the handle only
+	ResolveOutcomeUnresolved = "unresolved"
+	// ResolveOutcomeDropped - there was no room for the trace in the pending stage
+	ResolveOutcomeDropped = "dropped"
+)
+
+type (
+	// RuleResolverOption - option of the pending stage of the traces waiting for their rules
+	RuleResolverOption func(*ruleResolver)
+
+	// ResolveStats - number of pending traces by outcome
+	ResolveStats struct {
+		Resolved   uint64
+		Unresolved uint64
+	}
+
+	pendingTrace struct {
+		trace    model.Trace
+		rule     rl.TraceRuleDescriptor
+		deadline time.Time
+	}
+
+	// ruleResolver - pending stage for traces that came before the rule provider learned their rules,
+	// e.g. a trace of a new rule which arrives before the NFT_MSG_NEWRULE notification
+	ruleResolver struct {
+		ruleProvider ruleProvider
+		window       time.Duration
+		maxPending   int
+		pending      []pendingTrace
+		nextRetry    time.Time
+	}
+)
+
+// WithRuleResolveWindow - time a trace waits for its rule if the rule provider doesn't know it yet
+func WithRuleResolveWindow(d time.Duration) RuleResolverOption {
+	return func(r *ruleResolver) {
+		r.window = d
+	}
+}
+
+// WithMaxPendingTraces - max number of traces waiting for their rules
+func WithMaxPendingTraces(n int) RuleResolverOption {
+	return func(r *ruleResolver) {
+		r.maxPending = n
+	}
+}
+
+func newRuleResolver(p ruleProvider, opts ...RuleResolverOption) *ruleResolver {
+	r := &ruleResolver{
+		ruleProvider: p,
+		window:       DefRuleResolveWindow,
+		maxPending:   DefMaxPendingTraces,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Len - number of pending traces
+func (r *ruleResolver) Len() int {
+	return len(r.pending)
+}
+
+// Defer - put the trace into the pending stage. It returns false if there is no room for the trace
+func (r *ruleResolver) Defer(m model.Trace, rd rl.TraceRuleDescriptor, now time.Time) bool {
+	if len(r.pending) >= r.maxPending {
+		return false
+	}
+	if len(r.pending) == 0 {
+		r.nextRetry = now.Add(ruleResolveRetryInterval)
+	}
+	r.pending = append(r.pending, pendingTrace{trace: m, rule: rd, deadline: now.Add(r.window)})
+	return true
+}
+
+// Resolve - retry rule lookup for the pending traces. Traces are returned either with the resolved rule
+// or, when the window is over or the rule was replaced after the packet was traced, with the rule handle only.
+// The rule is looked up at the time the packet was traced, and the provider dumps the chain if the rule
+// isn't cached, so a rule which isn't found is not looked up again until the next retry
+func (r *ruleResolver) Resolve(now time.Time) (traces []model.Trace, st ResolveStats) {
+	if len(r.pending) == 0 || now.Before(r.nextRetry) {
+		return nil, st
+	}
+	r.nextRetry = now.Add(ruleResolveRetryInterval)
+	notFound := make(map[rl.RuleEntryKey]struct{})
+	rest := r.pending[:0]
+	for _, p := range r.pending {
+		rd := p.rule
+		key := rl.RuleEntryKey{
+			TableName:   rd.TableName,
+			TableFamily: nftLib.TableFamily(rd.Family),
+			ChainName:   rd.ChainName,
+			Handle:      rd.RuleHandle,
+		}
+		err := rl.ErrNotFoundRule
+		if _, ok := notFound[key]; !ok {
+			var re rl.RuleEntry
+			if re, err = r.ruleProvider.GetRuleForTrace(rd); err == nil {
+				setTraceRule(&p.trace, rd.RuleHandle, re.RuleStr)
+				traces = append(traces, p.trace)
+				st.Resolved++
+				continue
+			}
+			if errors.Is(err, rl.ErrNotFoundRule) {
+				notFound[key] = struct{}{}
+			}
+		}
+		if !now.Before(p.deadline) || errors.Is(err, rl.ErrExpiredTrace) {
+			setTraceRule(&p.trace, rd.RuleHandle, "handle "+strconv.FormatUint(rd.RuleHandle, 10))
+			traces = append(traces, p.trace)
+			st.Unresolved++
+			continue
+		}
+		rest = append(rest, p)
+	}
+	for i := len(rest); i < len(r.pending); i++ {
+		r.pending[i] = pendingTrace{}
+	}
+	r.pending = rest
+	return traces, st
+}
+
+func setTraceRule(m *model.Trace, handle uint64, rule string) {
+	m.Rule = rule
+	for i := range m.Path {
+		if m.Path[i].Handle == handle && m.Path[i].Rule == "" {
+			m.Path[i].Rule = rule
+		}
+	}
+}
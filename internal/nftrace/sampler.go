@@ -0,0 +1,14 @@
+package nftrace
+
+// flowSampler - flow-consistent sampler: either every packet of a flow is taken or none of them,
+// so sampled traces keep the full rule path of the flow. Zero rate means sampling is disabled
+type flowSampler uint64
+
+func (s flowSampler) Enabled() bool {
+	return s > 1
+}
+
+// Sample - reports whether a flow with the given hash is taken into the sample
+func (s flowSampler) Sample(flowHash uint64) bool {
+	return !s.Enabled() || flowHash%uint64(s) == 0
+}
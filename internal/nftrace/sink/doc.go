@@ -0,0 +1,48 @@
+// Package sink - outputs of the traces.
+//
+// The sinks are selected by URL, e.g. 'stdout://?format=text' or 'file:///var/log/nftrace.ndjson',
+// and are fed by FanOut concurrently.
+//
+// # NDJSON schema
+//
+// The 'json' format, the default one of the stdout and file sinks, writes one JSON object per line.
+// The object is the model.Trace with the schema version in front:
+//
+//	version     int     schema version, SchemaVersion; a field is never removed or changed without a new version
+//	trace_id    int     nftables trace id of the packet
+//	table_name  string  table of the final verdict
+//	chain_name  string  chain of the final verdict
+//	jt          string  jump target, omitted if empty
+//	handle      int     rule handle
+//	family      string  table family: ip|ip6|inet|arp|bridge|netdev
+//	l3proto     string  ip|ip6, omitted if unknown
+//	iif, oif    string  input and output interfaces, omitted if unknown
+//	iif-index   int     input interface index, omitted if unknown
+//	oif-index   int     output interface index, omitted if unknown
+//	hw-src      string  source MAC address 'aa:bb:cc:dd:ee:ff', omitted if unknown
+//	hw-dst      string  destination MAC address, omitted if unknown
+//	ip-src      string  source IP address, omitted if unknown
+//	ip-dst      string  destination IP address, omitted if unknown
+//	sport       int     source port, omitted if zero
+//	dport       int     destination port, omitted if zero
+//	len         int     packet length
+//	proto       string  ip protocol: tcp|udp|icmp|...
+//	verdict     string  verdict of the rule
+//	final       string  final verdict of the path: accept|drop|queue|stolen, omitted if the path is incomplete
+//	rule        string  rule expression
+//	path        array   hops through the ruleset: {type, table_name, chain_name, handle, rule, verdict, jt}
+//	ct-id       int     conntrack id, omitted if zero
+//	ct-state    string  conntrack state, omitted if unknown
+//	ct-dir      string  conntrack direction, omitted if unknown
+//	ct-status   string  conntrack status, omitted if unknown
+//	cnt         int     number of aggregated packets
+//	bytes       int     number of aggregated bytes
+//	first_seen  string  RFC 3339 time of the first aggregated packet
+//	last_seen   string  RFC 3339 time of the last aggregated packet
+//	incomplete  bool    the trace group was evicted before the final verdict, omitted if false
+//	timestamp   string  RFC 3339 time of the trace
+//	packet      string  base64 of the first packet bytes from the network header, omitted if the capture is disabled
+package sink
+
+// SchemaVersion - version of the NDJSON schema
+const SchemaVersion = 1
@@ -0,0 +1,249 @@
+package sink
+
+import (
+	"strconv"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+)
+
+// ecsDocument - the trace in the Elastic Common Schema:
+//
+//	@timestamp               timestamp
+//	event.*                  kind=event, category=network, type=connection and allowed|denied,
+//	                         action - verdict, start/end - first_seen/last_seen
+//	source.*, destination.*  ip, port, mac
+//	network.*                type ipv4|ipv6, transport, packets, bytes
+//	observer.*               hostname, the nftables firewall, ingress/egress interface
+//	rule.*                   id - handle, ruleset - table, category - chain, description - rule expression
+//	nftables.*               fields out of ECS: trace_id, family, verdict, final, jump_target, path, length, ct, incomplete
+type ecsDocument struct {
+	Timestamp   time.Time    `json:"@timestamp"`
+	Ecs         ecsVersion   `json:"ecs"`
+	Event       ecsEvent     `json:"event"`
+	Source      ecsEndpoint  `json:"source"`
+	Destination ecsEndpoint  `json:"destination"`
+	Network     ecsNetwork   `json:"network"`
+	Observer    ecsObserver  `json:"observer"`
+	Rule        ecsRule      `json:"rule"`
+	Nftables    ecsNftables  `json:"nftables"`
+	Host        *ecsHostName `json:"host,omitempty"`
+}
+
+type (
+	ecsVersion struct {
+		Version string `json:"version"`
+	}
+
+	ecsEvent struct {
+		Kind     string     `json:"kind"`
+		Category []string   `json:"category"`
+		Type     []string   `json:"type"`
+		Action   string     `json:"action,omitempty"`
+		Dataset  string     `json:"dataset"`
+		Start    *time.Time `json:"start,omitempty"`
+		End      *time.Time `json:"end,omitempty"`
+	}
+
+	ecsEndpoint struct {
+		Ip   string `json:"ip,omitempty"`
+		Port uint32 `json:"port,omitempty"`
+		Mac  string `json:"mac,omitempty"`
+	}
+
+	ecsNetwork struct {
+		Type      string `json:"type,omitempty"`
+		Transport string `json:"transport,omitempty"`
+		Packets   uint64 `json:"packets,omitempty"`
+		Bytes     uint64 `json:"bytes,omitempty"`
+	}
+
+	ecsInterface struct {
+		Interface struct {
+			Name string `json:"name,omitempty"`
+			Id   string `json:"id,omitempty"`
+		} `json:"interface"`
+	}
+
+	ecsObserver struct {
+		Hostname string        `json:"hostname,omitempty"`
+		Type     string        `json:"type"`
+		Vendor   string        `json:"vendor"`
+		Product  string        `json:"product"`
+		Ingress  *ecsInterface `json:"ingress,omitempty"`
+		Egress   *ecsInterface `json:"egress,omitempty"`
+	}
+
+	ecsRule struct {
+		Id          string `json:"id,omitempty"`
+		Ruleset     string `json:"ruleset,omitempty"`
+		Category    string `json:"category,omitempty"`
+		Description string `json:"description,omitempty"`
+	}
+
+	ecsCt struct {
+		Id        uint32 `json:"id,omitempty"`
+		State     string `json:"state,omitempty"`
+		Direction string `json:"direction,omitempty"`
+		Status    string `json:"status,omitempty"`
+	}
+
+	ecsNftables struct {
+		TraceId    uint32      `json:"trace_id"`
+		Family     string      `json:"family,omitempty"`
+		Verdict    string      `json:"verdict,omitempty"`
+		Final      string      `json:"final,omitempty"`
+		JumpTarget string      `json:"jump_target,omitempty"`
+		Path       []model.Hop `json:"path,omitempty"`
+		Length     uint32      `json:"length,omitempty"`
+		Ct         *ecsCt      `json:"ct,omitempty"`
+		Incomplete bool        `json:"incomplete,omitempty"`
+	}
+
+	ecsHostName struct {
+		Name string `json:"name"`
+	}
+)
+
+func newEcsDocument(t *model.Trace, hostname string) *ecsDocument {
+	d := &ecsDocument{
+		Timestamp: t.Timestamp,
+		Ecs:       ecsVersion{Version: elasticEcsVersion},
+		Event: ecsEvent{
+			Kind:     "event",
+			Category: []string{"network"},
+			Type:     []string{"connection"},
+			Action:   t.Verdict,
+			Dataset:  "nftrace.trace",
+		},
+		Source:      ecsEndpoint{Ip: model.AddrString(t.SAddr), Port: t.SPort, Mac: ecsMac(t.SMacAddr)},
+		Destination: ecsEndpoint{Ip: model.AddrString(t.DAddr), Port: t.DPort, Mac: ecsMac(t.DMacAddr)},
+		Network:     ecsNetwork{Transport: t.IpProto, Packets: t.Cnt, Bytes: t.Bytes},
+		Observer: ecsObserver{
+			Hostname: hostname,
+			Type:     "firewall",
+			Vendor:   "netfilter",
+			Product:  "nftables",
+			Ingress:  ecsIface(t.Iifname, t.Iif),
+			Egress:   ecsIface(t.Oifname, t.Oif),
+		},
+		Rule: ecsRule{
+			Ruleset:     t.Table,
+			Category:    t.Chain,
+			Description: t.Rule,
+		},
+		Nftables: ecsNftables{
+			TraceId:    t.TrId,
+			Family:     t.Family,
+			Verdict:    t.Verdict,
+			Final:      t.Final,
+			JumpTarget: t.JumpTarget,
+			Path:       t.Path,
+			Length:     t.Length,
+			Incomplete: t.Incomplete,
+		},
+	}
+	if hostname != "" {
+		d.Host = &ecsHostName{Name: hostname}
+	}
+	switch t.Final {
+	case "accept":
+		d.Event.Type = append(d.Event.Type, "allowed")
+	case "drop", "reject":
+		d.Event.Type = append(d.Event.Type, "denied")
+	}
+	if !t.FirstSeen.IsZero() {
+		d.Event.Start = &t.FirstSeen
+	}
+	if !t.LastSeen.IsZero() {
+		d.Event.End = &t.LastSeen
+	}
+	switch t.L3Proto {
+	case "ip":
+		d.Network.Type = "ipv4"
+	case "ip6":
+		d.Network.Type = "ipv6"
+	}
+	if t.RuleHandle != 0 {
+		d.Rule.Id = strconv.FormatUint(t.RuleHandle, 10)
+	}
+	if t.CtId != 0 || t.CtState != "" || t.CtDirection != "" || t.CtStatus != "" {
+		d.Nftables.Ct = &ecsCt{Id: t.CtId, State: t.CtState, Direction: t.CtDirection, Status: t.CtStatus}
+	}
+	return d
+}
+
+// ecsMac - MAC address in the ECS form 'AA-BB-CC-DD-EE-FF'
+func ecsMac(a model.HwAddr) string {
+	s := []byte(a.String())
+	for i, c := range s {
+		switch {
+		case c == ':':
+			s[i] = '-'
+		case c >= 'a' && c <= 'f':
+			s[i] = c - 'a' + 'A'
+		}
+	}
+	return string(s)
+}
+
+func ecsIface(name string, index uint32) *ecsInterface {
+	if name == "" && index == 0 {
+		return nil
+	}
+	var i ecsInterface
+	i.Interface.Name = name
+	if index != 0 {
+		i.Interface.Id = strconv.FormatUint(uint64(index), 10)
+	}
+	return &i
+}
+
+// ecsMapping - mapping of the index template, the strings are keywords by the dynamic template
+var ecsMapping = map[string]any{
+	"dynamic_templates": []any{
+		map[string]any{"strings_as_keyword": map[string]any{
+			"match_mapping_type": "string",
+			"mapping":            map[string]any{"type": "keyword", "ignore_above": 1024},
+		}},
+	},
+	"properties": map[string]any{
+		"@timestamp": ecsType("date"),
+		"event": ecsProps(map[string]any{
+			"start": ecsType("date"),
+			"end":   ecsType("date"),
+		}),
+		"source":      ecsEndpointMapping(),
+		"destination": ecsEndpointMapping(),
+		"network": ecsProps(map[string]any{
+			"packets": ecsType("long"),
+			"bytes":   ecsType("long"),
+		}),
+		"rule": ecsProps(map[string]any{
+			"description": ecsType("text"),
+		}),
+		"nftables": ecsProps(map[string]any{
+			"trace_id": ecsType("long"),
+			"length":   ecsType("long"),
+			"ct": ecsProps(map[string]any{
+				"id": ecsType("long"),
+			}),
+			"incomplete": ecsType("boolean"),
+		}),
+	},
+}
+
+func ecsType(t string) map[string]any {
+	return map[string]any{"type": t}
+}
+
+func ecsProps(p map[string]any) map[string]any {
+	return map[string]any{"properties": p}
+}
+
+func ecsEndpointMapping() map[string]any {
+	return ecsProps(map[string]any{
+		"ip":   ecsType("ip"),
+		"port": ecsType("long"),
+	})
+}
@@ -0,0 +1,275 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+const (
+	defElasticPort       = "9200"
+	defElasticIndex      = "nftrace-{2006.01.02}"
+	defElasticBatch      = 1000
+	elasticEcsVersion    = "8.11.0"
+	elasticTemplateName  = "nftrace"
+	elasticTemplatePrior = 200
+)
+
+// elasticSink - the traces indexed by the _bulk API of Elasticsearch or OpenSearch as the ECS documents,
+// see ecsDocument:
+//
+//	elasticsearch://es:9200            - HTTP, opensearch:// is the same
+//	elasticsearch+https://user:pass@es - HTTPS with the basic authentication
+//
+// the query also takes:
+//
+//	index    - index name, the Go time layout in braces is replaced by the trace UTC time,
+//	           'nftrace-{2006.01.02}' (an index per day) by default
+//	template - the index template with the ECS mapping is put on the first bulk, true by default
+//	api-key  - the API key authentication
+//	batch    - max number of documents in the bulk, 1000 by default
+//
+// and the parameters of httpClient. The bulk is sent on Flush or when the batch is full, the documents
+// failed with 429 or 5xx are retried, the document id is the hash of the document so the retries don't
+// duplicate it
+type elasticSink struct {
+	mu          sync.Mutex
+	c           *httpClient
+	base        string // URL of the cluster
+	index       []string
+	host        string
+	batch       int
+	putTemplate bool
+	docs        []elasticDoc
+}
+
+type (
+	elasticDoc struct {
+		index string
+		id    string
+		body  []byte
+	}
+
+	elasticBulkResponse struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+)
+
+func init() {
+	for _, scheme := range []string{"elasticsearch", "elasticsearch+https", "opensearch", "opensearch+https"} {
+		Register(scheme, openElasticSink)
+	}
+}
+
+func openElasticSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &elasticSink{batch: defElasticBatch, putTemplate: true}
+	if v := q.Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid batch '%s'", v)
+		}
+		s.batch = n
+	}
+	if v := q.Get("template"); v != "" {
+		var err error
+		if s.putTemplate, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.Errorf("invalid template '%s'", v)
+		}
+	}
+	index := q.Get("index")
+	if index == "" {
+		index = defElasticIndex
+	}
+	var err error
+	if s.index, err = parseIndexPattern(index); err != nil {
+		return nil, err
+	}
+	if s.c, err = newHttpClient(u, defElasticPort, ""); err != nil {
+		return nil, err
+	}
+	s.base = strings.TrimSuffix(s.c.url, "/")
+	s.c.url = s.base + "/_bulk"
+	if v := q.Get("api-key"); v != "" {
+		s.c.headers.Set("Authorization", "ApiKey "+v)
+	}
+	s.host, _ = os.Hostname()
+	return s, nil
+}
+
+// parseIndexPattern - the literal parts at the even positions and the time layouts at the odd ones
+func parseIndexPattern(p string) ([]string, error) {
+	var ret []string
+	for {
+		i := strings.IndexByte(p, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(p[i:], '}')
+		if j < 0 {
+			return nil, errors.Errorf("invalid index '%s': unclosed '{'", p)
+		}
+		ret = append(ret, p[:i], p[i+1:i+j])
+		p = p[i+j+1:]
+	}
+	ret = append(ret, p)
+	if strings.Join(ret, "") == "" {
+		return nil, errors.New("index is empty")
+	}
+	return ret, nil
+}
+
+func (s *elasticSink) indexName(ts time.Time) string {
+	if len(s.index) == 1 {
+		return s.index[0]
+	}
+	ts = ts.UTC()
+	var sb strings.Builder
+	for i, p := range s.index {
+		if i%2 == 0 {
+			sb.WriteString(p)
+		} else {
+			sb.WriteString(ts.Format(p))
+		}
+	}
+	return sb.String()
+}
+
+// Write -
+func (s *elasticSink) Write(ctx context.Context, traces []model.Trace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range traces {
+		t := &traces[i]
+		body, err := json.Marshal(newEcsDocument(t, s.host))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		s.docs = append(s.docs, elasticDoc{
+			index: s.indexName(t.Timestamp),
+			id:    strconv.FormatUint(xxhash.Sum64(body), 16),
+			body:  body,
+		})
+		if len(s.docs) >= s.batch {
+			if err = s.send(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *elasticSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.send(ctx)
+}
+
+// Close -
+func (s *elasticSink) Close() error {
+	s.c.close()
+	return nil
+}
+
+// send - indexes the batch, the documents failed with not retriable errors are dropped
+func (s *elasticSink) send(ctx context.Context) error {
+	if len(s.docs) == 0 {
+		return nil
+	}
+	docs := s.docs
+	s.docs = nil
+	if s.putTemplate {
+		if err := s.template(ctx); err != nil {
+			return err
+		}
+		s.putTemplate = false
+	}
+	var failed error
+	for attempt := 0; ; attempt++ {
+		var body []byte
+		for _, d := range docs {
+			body = append(body, `{"index":{"_index":`...)
+			body = strconv.AppendQuote(body, d.index)
+			body = append(body, `,"_id":"`...)
+			body = append(body, d.id...)
+			body = append(body, "\"}}\n"...)
+			body = append(body, d.body...)
+			body = append(body, '\n')
+		}
+		resp, err := s.c.post(ctx, "application/x-ndjson", body)
+		if err != nil {
+			return errors.WithMessage(multierr.Append(failed, err), "failed to index the bulk")
+		}
+		var br elasticBulkResponse
+		if err = json.Unmarshal(resp, &br); err != nil {
+			return errors.WithMessage(err, "invalid bulk response")
+		}
+		if !br.Errors {
+			break
+		}
+		if len(br.Items) != len(docs) {
+			return errors.Errorf("bulk response has %d items, expected %d", len(br.Items), len(docs))
+		}
+		var retry []elasticDoc
+		for i, item := range br.Items {
+			for _, r := range item {
+				switch {
+				case r.Error == nil:
+				case httpRetriableStatus(r.Status):
+					retry = append(retry, docs[i])
+				default:
+					failed = multierr.Append(failed, errors.Errorf("index '%s': %s: %s", docs[i].index, r.Error.Type, r.Error.Reason))
+				}
+			}
+		}
+		if docs = retry; len(docs) == 0 {
+			break
+		}
+		if attempt >= s.c.retries {
+			failed = multierr.Append(failed, errors.Errorf("%d documents are rejected after %d retries", len(docs), attempt))
+			break
+		}
+		if err = s.c.wait(ctx, attempt, 0); err != nil {
+			return multierr.Append(failed, err)
+		}
+	}
+	return errors.WithMessage(failed, "failed to index the documents")
+}
+
+// template - puts the index template with the ECS mapping of the index pattern
+func (s *elasticSink) template(ctx context.Context) error {
+	pattern := s.index[0]
+	if len(s.index) > 1 {
+		pattern += "*"
+	}
+	body, err := json.Marshal(map[string]any{
+		"index_patterns": []string{pattern},
+		"priority":       elasticTemplatePrior,
+		"template":       map[string]any{"mappings": ecsMapping},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = s.c.request(ctx, http.MethodPut, s.base+"/_index_template/"+elasticTemplateName, "application/json", body)
+	return errors.WithMessagef(err, "failed to put the index template '%s'", elasticTemplateName)
+}
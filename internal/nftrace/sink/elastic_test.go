@@ -0,0 +1,173 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// elasticStandIn - _bulk and _index_template of the cluster, the documents of the 'reject' indices are rejected
+// with the status and the first 'throttle' documents are throttled
+type elasticStandIn struct {
+	mu        sync.Mutex
+	templates map[string]json.RawMessage
+	docs      map[string]map[string]json.RawMessage // by index and id
+	bulks     int
+	throttle  int
+	reject    int
+}
+
+func (e *elasticStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r.Header.Get("Authorization") != "ApiKey key" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		e.templates[strings.TrimPrefix(r.URL.Path, "/_index_template/")] = body
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		e.bulks++
+		var items []string
+		hasErrors := false
+		sc := bufio.NewScanner(bytes.NewReader(body))
+		for sc.Scan() {
+			var action struct {
+				Index struct {
+					Index string `json:"_index"`
+					Id    string `json:"_id"`
+				} `json:"index"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &action); err != nil || !sc.Scan() {
+				http.Error(w, "invalid bulk", http.StatusBadRequest)
+				return
+			}
+			a := action.Index
+			switch {
+			case e.throttle > 0:
+				e.throttle--
+				hasErrors = true
+				items = append(items, `{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue is full"}}}`)
+			case strings.HasPrefix(a.Index, "reject"):
+				hasErrors = true
+				items = append(items, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}`, e.reject))
+			default:
+				if e.docs[a.Index] == nil {
+					e.docs[a.Index] = make(map[string]json.RawMessage)
+				}
+				e.docs[a.Index][a.Id] = append(json.RawMessage(nil), sc.Bytes()...)
+				items = append(items, `{"index":{"status":201}}`)
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, hasErrors, strings.Join(items, ","))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func Test_ElasticSink(t *testing.T) {
+	es := &elasticStandIn{templates: make(map[string]json.RawMessage), docs: make(map[string]map[string]json.RawMessage)}
+	srv := httptest.NewServer(es)
+	defer srv.Close()
+	ctx := context.Background()
+	addr := srv.Listener.Addr().String()
+
+	s, err := Open("elasticsearch://" + addr + "?api-key=key&batch=2&retry-backoff=1ms")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	nextDay := syslogTestTrace
+	nextDay.Timestamp = nextDay.Timestamp.Add(24 * time.Hour)
+	nextDay.Final, nextDay.Verdict = "accept", "accept"
+	es.throttle = 1
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace, nextDay, syslogTestTrace}))
+	require.Equal(t, 2, es.bulks, "the throttled document is retried")
+	require.NoError(t, s.Flush(ctx))
+	require.Len(t, es.docs["nftrace-2024.05.01"], 1, "the same document isn't duplicated")
+	require.Len(t, es.docs["nftrace-2024.05.02"], 1)
+
+	var tmpl struct {
+		IndexPatterns []string `json:"index_patterns"`
+		Template      struct {
+			Mappings struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"mappings"`
+		} `json:"template"`
+	}
+	require.NoError(t, json.Unmarshal(es.templates[elasticTemplateName], &tmpl))
+	require.Equal(t, []string{"nftrace-*"}, tmpl.IndexPatterns)
+	require.Contains(t, tmpl.Template.Mappings.Properties, "source")
+
+	var doc map[string]any
+	for _, d := range es.docs["nftrace-2024.05.02"] {
+		require.NoError(t, json.Unmarshal(d, &doc))
+	}
+	require.Equal(t, "2024-05-02T10:20:30.123456Z", doc["@timestamp"])
+	require.Equal(t, map[string]any{"ip": "10.0.0.1", "port": float64(1234)}, doc["source"])
+	require.Equal(t, map[string]any{"ip": "10.0.0.2", "port": float64(80)}, doc["destination"])
+	event := doc["event"].(map[string]any)
+	require.Equal(t, []any{"connection", "allowed"}, event["type"])
+	require.Equal(t, "accept", event["action"])
+	require.Equal(t, map[string]any{"transport": "tcp", "packets": float64(1)}, doc["network"])
+	require.Equal(t, map[string]any{
+		"ruleset":     "filter",
+		"category":    "input",
+		"description": syslogTestTrace.Rule,
+	}, doc["rule"])
+	require.Equal(t, float64(7), doc["nftables"].(map[string]any)["trace_id"])
+
+	// not retriable documents
+	s, err = Open("opensearch://" + addr + "?api-key=key&index=reject-{2006}&template=false")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	es.reject = 400
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace}))
+	require.ErrorContains(t, s.Flush(ctx), "mapper_parsing_exception")
+	require.Len(t, es.templates, 1)
+
+	// retries are exhausted
+	s, err = Open("opensearch://" + addr + "?api-key=key&index=reject&template=false&retries=2&retry-backoff=1ms")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	es.reject, es.bulks = 503, 0
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace}))
+	require.ErrorContains(t, s.Flush(ctx), "rejected after 2 retries")
+	require.Equal(t, 3, es.bulks)
+}
+
+func Test_ParseIndexPattern(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		exp     []string
+		expErr  bool
+	}{
+		{"nftrace", []string{"nftrace"}, false},
+		{"nftrace-{2006.01.02}", []string{"nftrace-", "2006.01.02", ""}, false},
+		{"fw-{2006}-traces-{01}", []string{"fw-", "2006", "-traces-", "01", ""}, false},
+		{"nftrace-{2006", nil, true},
+	}
+	for _, tc := range testCases {
+		got, err := parseIndexPattern(tc.pattern)
+		if tc.expErr {
+			require.Error(t, err, tc.pattern)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tc.exp, got)
+	}
+}
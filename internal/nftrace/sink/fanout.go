@@ -0,0 +1,350 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/H-BF/corlib/logger"
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefSinkQueLen       = 64
+	DefFlushInterval    = time.Second
+	defFanOutBatchSize  = 256
+	sinkCloseFlushLimit = 5 * time.Second
+)
+
+type (
+	// TraceReader - source of the traces
+	TraceReader interface {
+		ReadBatch(ctx context.Context, dst []model.Trace) (int, error)
+	}
+
+	// committer - reader that keeps the read position, e.g. a spool consumer
+	committer interface {
+		Commit() error
+	}
+
+	// FanOutDeps -
+	FanOutDeps struct {
+		// Source - the traces for all the sinks, it isn't read if Readers is set
+		Source TraceReader
+		// Readers - own reader of every sink by the sink name, e.g. the spool consumer
+		Readers map[string]TraceReader
+		Subj    observer.Subject
+	}
+
+	// Named - sink with its name in metrics and logs
+	Named struct {
+		Name string
+		Sink Sink
+	}
+
+	// FanOutOption -
+	FanOutOption func(*FanOut)
+
+	// FanOut - reads the traces from the source and writes them to all the sinks concurrently.
+	// Every sink has its own bounded que of batches, so a slow or failed sink loses its own batches
+	// only and doesn't hold the others.
+	//
+	// If every sink has its own reader (the spool consumer) nothing is dropped: the sink reads the batch,
+	// writes and flushes it and commits the read position of its reader. The failed write or flush is retried
+	// every flush interval until it succeeds or the fan-out stops, so a slow or down sink lags behind in the spool
+	// without holding the other sinks; the batches read but not committed on the stop are read again after restart
+	FanOut struct {
+		FanOutDeps
+		outs          []*output
+		queLen        int
+		flushInterval time.Duration
+		onceRun       sync.Once
+		onceClose     sync.Once
+		stop          chan struct{}
+		stopped       chan struct{}
+	}
+
+	output struct {
+		Named
+		que     chan []model.Trace
+		healthy bool
+	}
+)
+
+// WithSinkQueLen - max number of batches waiting for the sink
+func WithSinkQueLen(n int) FanOutOption {
+	return func(f *FanOut) {
+		f.queLen = n
+	}
+}
+
+// WithFlushInterval - how often the sinks are flushed
+func WithFlushInterval(d time.Duration) FanOutOption {
+	return func(f *FanOut) {
+		f.flushInterval = d
+	}
+}
+
+// NewFanOut -
+func NewFanOut(d FanOutDeps, sinks []Named, opts ...FanOutOption) *FanOut {
+	f := &FanOut{
+		FanOutDeps:    d,
+		queLen:        DefSinkQueLen,
+		flushInterval: DefFlushInterval,
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	for _, s := range sinks {
+		o := &output{
+			Named:   s,
+			healthy: true,
+		}
+		if d.Readers == nil {
+			o.que = make(chan []model.Trace, f.queLen)
+		}
+		f.outs = append(f.outs, o)
+	}
+	return f
+}
+
+// Run -
+func (f *FanOut) Run(ctx context.Context) (err error) {
+	var doRun bool
+	f.onceRun.Do(func() {
+		doRun = true
+		f.stopped = make(chan struct{})
+	})
+	if !doRun {
+		return errors.New("it has been run or closed yet")
+	}
+	log := logger.FromContext(ctx).Named("sink-fanout")
+	log.Info("start")
+	defer func() {
+		close(f.stopped)
+		log.Info("stop")
+	}()
+
+	ctx1, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-f.stop:
+			cancel()
+		case <-ctx1.Done():
+		}
+	}()
+	if f.Readers != nil {
+		return f.runReaders(ctx, ctx1)
+	}
+
+	var wg sync.WaitGroup
+	for _, o := range f.outs {
+		f.notify(SinkHealthEvent{Sink: o.Name, Healthy: true})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.runOutput(ctx1, o)
+		}()
+	}
+	defer func() {
+		for _, o := range f.outs {
+			close(o.que)
+		}
+		wg.Wait()
+	}()
+
+	buf := make([]model.Trace, defFanOutBatchSize)
+	for {
+		n, e := f.Source.ReadBatch(ctx1, buf)
+		if e != nil {
+			select {
+			case <-f.stop:
+				return nil
+			default:
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.WithMessage(e, "failed to read traces")
+		}
+		// the batch is shared by all the sinks, they must not modify it
+		batch := append([]model.Trace(nil), buf[:n]...)
+		for _, o := range f.outs {
+			select {
+			case o.que <- batch:
+			default:
+				f.notify(CountSinkDropEvent{Sink: o.Name, Cnt: uint64(n)})
+			}
+		}
+	}
+}
+
+// runReaders - runs every sink with its own reader until the fan-out stops or a reader fails
+func (f *FanOut) runReaders(ctx, ctx1 context.Context) error {
+	for _, o := range f.outs {
+		if f.Readers[o.Name] == nil {
+			return errors.Errorf("sink '%s' has no reader", o.Name)
+		}
+	}
+	errs := make([]error, len(f.outs))
+	var wg sync.WaitGroup
+	for i, o := range f.outs {
+		f.notify(SinkHealthEvent{Sink: o.Name, Healthy: true})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f.runReaderOutput(ctx1, o, f.Readers[o.Name])
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-f.stop:
+		return nil
+	default:
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close - stops the fan-out and closes the sinks
+func (f *FanOut) Close() error {
+	var errs []error
+	f.onceClose.Do(func() {
+		close(f.stop)
+		f.onceRun.Do(func() {})
+		if f.stopped != nil {
+			<-f.stopped
+		}
+		for _, o := range f.outs {
+			if err := o.Sink.Close(); err != nil {
+				errs = append(errs, errors.WithMessagef(err, "sink '%s'", o.Name))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// runOutput - writes the batches to the sink until its que is closed, the rest of the que is written out
+// with a limited time after the context is canceled
+func (f *FanOut) runOutput(ctx context.Context, o *output) {
+	log := logger.FromContext(ctx).Named("sink").Named(o.Name)
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+	wctx, done := f.writeContext(ctx)
+	defer done()
+	defer func() {
+		f.result(log, o, o.Sink.Flush(wctx), 0)
+	}()
+	for {
+		select {
+		case batch, ok := <-o.que:
+			if !ok {
+				return
+			}
+			f.result(log, o, o.Sink.Write(wctx, batch), len(batch))
+		case <-ticker.C:
+			f.result(log, o, o.Sink.Flush(wctx), 0)
+		}
+	}
+}
+
+// runReaderOutput - reads the batches by the reader of the sink, writes and flushes every batch until it succeeds
+// and commits it, gives up the batch if the context is canceled
+func (f *FanOut) runReaderOutput(ctx context.Context, o *output, r TraceReader) error {
+	log := logger.FromContext(ctx).Named("sink").Named(o.Name)
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+	wctx, done := f.writeContext(ctx)
+	defer done()
+	defer func() {
+		f.result(log, o, o.Sink.Flush(wctx), 0)
+	}()
+	commit, _ := r.(committer)
+	buf := make([]model.Trace, defFanOutBatchSize)
+	for {
+		n, err := r.ReadBatch(ctx, buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.WithMessagef(err, "failed to read traces of sink '%s'", o.Name)
+		}
+		batch := buf[:n]
+		for written := false; ; {
+			if !written {
+				err = o.Sink.Write(wctx, batch)
+				written = err == nil
+			}
+			if err == nil {
+				err = o.Sink.Flush(wctx)
+			}
+			f.result(log, o, err, len(batch))
+			if err == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				// the batch isn't committed, it's read again after restart
+				return nil
+			case <-ticker.C:
+			}
+		}
+		if commit != nil {
+			if err = commit.Commit(); err != nil {
+				log.Errorf("failed to commit written traces: %v", err)
+			}
+		}
+	}
+}
+
+// writeContext - context of the sink writes, it outlives the context for a limited time
+// to write out the rest of the que
+func (f *FanOut) writeContext(ctx context.Context) (context.Context, func()) {
+	wctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(sinkCloseFlushLimit, cancel)
+	})
+	return wctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (f *FanOut) result(log logger.TypeOfLogger, o *output, err error, cnt int) {
+	if err != nil {
+		f.notify(CountSinkErrorEvent{Sink: o.Name})
+		if o.healthy {
+			log.Errorf("sink is unhealthy: %v", err)
+		}
+	} else if cnt > 0 {
+		f.notify(CountSinkTraceEvent{Sink: o.Name, Cnt: uint64(cnt)})
+	}
+	if healthy := err == nil; healthy != o.healthy {
+		o.healthy = healthy
+		f.notify(SinkHealthEvent{Sink: o.Name, Healthy: healthy})
+		if healthy {
+			log.Info("sink is healthy again")
+		}
+	}
+}
+
+func (f *FanOut) notify(ev observer.EventType) {
+	if f.Subj != nil {
+		f.Subj.Notify(ev)
+	}
+}
@@ -0,0 +1,51 @@
+package sink
+
+import (
+	"strconv"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+)
+
+// traceFields - flat fields of the trace for the structured outputs (syslog structured data, journal fields),
+// the fields with empty values are skipped
+func traceFields(t *model.Trace, fn func(name, value string)) {
+	add := func(name, value string) {
+		if value != "" {
+			fn(name, value)
+		}
+	}
+	addUint := func(name string, v uint64) {
+		if v != 0 {
+			fn(name, strconv.FormatUint(v, 10))
+		}
+	}
+	addUint("trace_id", uint64(t.TrId))
+	add("table", t.Table)
+	add("chain", t.Chain)
+	addUint("handle", t.RuleHandle)
+	add("family", t.Family)
+	add("iif", t.Iifname)
+	add("oif", t.Oifname)
+	add("hw_src", t.SMacAddr.String())
+	add("hw_dst", t.DMacAddr.String())
+	add("src", model.AddrString(t.SAddr))
+	add("dst", model.AddrString(t.DAddr))
+	addUint("sport", uint64(t.SPort))
+	addUint("dport", uint64(t.DPort))
+	add("proto", t.IpProto)
+	addUint("len", uint64(t.Length))
+	add("verdict", t.Verdict)
+	add("final", t.Final)
+	add("jt", t.JumpTarget)
+	add("rule", t.Rule)
+	add("path", t.PathString())
+	addUint("ct_id", uint64(t.CtId))
+	add("ct_state", t.CtState)
+	add("ct_dir", t.CtDirection)
+	add("ct_status", t.CtStatus)
+	addUint("cnt", t.Cnt)
+	addUint("bytes", t.Bytes)
+	if t.Incomplete {
+		fn("incomplete", "true")
+	}
+}
@@ -0,0 +1,353 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/H-BF/corlib/pkg/signals"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+
+	fileMode          = 0o640
+	rotatedTimeLayout = "20060102T150405.000000000"
+	compressTmpSuffix = ".tmp"
+)
+
+type (
+	// fileConfig - parameters of the file sink from its URL:
+	// file:///var/log/nftrace.ndjson?max-size=104857600&max-age=1h&keep=10&compress=zstd
+	fileConfig struct {
+		path     string
+		maxSize  int64
+		maxAge   time.Duration
+		keep     int
+		compress string
+	}
+
+	// fileSink - appends formatted traces to the file. The file is rotated by size and age: it is renamed to
+	// '<path>.<time>', compressed in the background and only the last 'keep' rotated files are kept.
+	// A failed compression leaves the rotated file uncompressed and is returned by the next Flush or Close.
+	// SIGHUP makes the sink reopen the file, e.g. after an external logrotate
+	fileSink struct {
+		fileConfig
+		mu      sync.Mutex
+		fd      *os.File
+		bw      *bufio.Writer
+		f       Formatter
+		line    []byte
+		size    int64
+		opened  time.Time
+		reopen  atomic.Bool
+		hupObs  observer.Observer
+		bg      sync.WaitGroup
+		bgErr   error // guarded by mu
+		pruneMu sync.Mutex
+	}
+)
+
+func init() {
+	Register("file", openFileSink)
+}
+
+func parseFileConfig(u *url.URL) (c fileConfig, err error) {
+	q := u.Query()
+	c.path = u.Path
+	if c.path == "" {
+		return c, errors.New("file path is not set")
+	}
+	if v := q.Get("max-size"); v != "" {
+		if c.maxSize, err = strconv.ParseInt(v, 10, 64); err != nil || c.maxSize < 0 {
+			return c, errors.Errorf("invalid max-size '%s'", v)
+		}
+	}
+	if v := q.Get("max-age"); v != "" {
+		if c.maxAge, err = time.ParseDuration(v); err != nil || c.maxAge < 0 {
+			return c, errors.Errorf("invalid max-age '%s'", v)
+		}
+	}
+	if v := q.Get("keep"); v != "" {
+		if c.keep, err = strconv.Atoi(v); err != nil || c.keep < 0 {
+			return c, errors.Errorf("invalid keep '%s'", v)
+		}
+	}
+	switch c.compress = strings.ToLower(q.Get("compress")); c.compress {
+	case "":
+		c.compress = CompressNone
+	case CompressNone, CompressGzip, CompressZstd:
+	default:
+		return c, errors.Errorf("unknown compress '%s', expected one of: %s, %s, %s",
+			c.compress, CompressNone, CompressGzip, CompressZstd)
+	}
+	return c, nil
+}
+
+// openFileSink - appends the traces to the file, the path is taken from the URL: file:///var/log/nftrace.ndjson
+func openFileSink(u *url.URL) (Sink, error) {
+	c, err := parseFileConfig(u)
+	if err != nil {
+		return nil, err
+	}
+	f, err := formatterFromURL(u, "json")
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSink{fileConfig: c, f: f}
+	if err = s.open(); err != nil {
+		return nil, err
+	}
+	s.hupObs = observer.NewObserver(func(ev observer.EventType) {
+		if sig, _ := ev.(signals.SignalFromOS); sig.Signal == syscall.SIGHUP {
+			s.reopen.Store(true)
+		}
+	}, false, signals.SignalFromOS{})
+	signals.SubjOfSignalsFromOS().ObserversAttach(s.hupObs)
+	return s, nil
+}
+
+// Write -
+func (s *fileSink) Write(_ context.Context, traces []model.Trace) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = s.checkReopen(); err != nil {
+		return err
+	}
+	for i := range traces {
+		if s.line, err = s.f.Format(s.line[:0], &traces[i]); err != nil {
+			return errors.WithMessage(err, "failed to format trace")
+		}
+		s.line = append(s.line, '\n')
+		if s.needRotate(len(s.line)) {
+			if err = s.rotate(); err != nil {
+				return err
+			}
+		}
+		if _, err = s.bw.Write(s.line); err != nil {
+			return errors.WithStack(err)
+		}
+		s.size += int64(len(s.line))
+	}
+	return nil
+}
+
+// Flush - writes out the buffer, rotates the file by age
+func (s *fileSink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.checkReopen()
+	switch {
+	case err != nil:
+	case s.needRotate(0):
+		err = s.rotate()
+	default:
+		err = errors.WithStack(s.bw.Flush())
+	}
+	if err == nil {
+		err, s.bgErr = s.bgErr, nil
+	}
+	return err
+}
+
+// Close - closes the file and waits for the background compression
+func (s *fileSink) Close() error {
+	signals.SubjOfSignalsFromOS().ObserversDetach(s.hupObs)
+	s.mu.Lock()
+	err := s.close()
+	s.mu.Unlock()
+	s.bg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		err, s.bgErr = s.bgErr, nil
+	}
+	return err
+}
+
+func (s *fileSink) open() error {
+	fd, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	st, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return errors.WithStack(err)
+	}
+	s.fd, s.size, s.opened = fd, st.Size(), time.Now()
+	if s.bw == nil {
+		s.bw = bufio.NewWriterSize(fd, streamBuffLen)
+	} else {
+		s.bw.Reset(fd)
+	}
+	return nil
+}
+
+func (s *fileSink) close() error {
+	if s.fd == nil {
+		return nil
+	}
+	err := s.bw.Flush()
+	if e := s.fd.Close(); err == nil {
+		err = e
+	}
+	s.fd = nil
+	return errors.WithStack(err)
+}
+
+func (s *fileSink) checkReopen() error {
+	if s.fd != nil && !s.reopen.Swap(false) {
+		return nil
+	}
+	if err := s.close(); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// needRotate - the file is rotated before it exceeds the max size or after its max age, an empty file is never rotated
+func (s *fileSink) needRotate(n int) bool {
+	if s.size == 0 {
+		return false
+	}
+	return (s.maxSize > 0 && s.size+int64(n) > s.maxSize) ||
+		(s.maxAge > 0 && time.Since(s.opened) >= s.maxAge)
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.close(); err != nil {
+		return err
+	}
+	rotated := s.path + "." + time.Now().UTC().Format(rotatedTimeLayout)
+	if err := os.Rename(s.path, rotated); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.bg.Add(1)
+	go func() {
+		defer s.bg.Done()
+		if s.compress != CompressNone {
+			// the file may be pruned by the rotation that followed, it isn't a failure
+			if err := compressFile(rotated, s.compress); err != nil && !errors.Is(err, os.ErrNotExist) {
+				s.mu.Lock()
+				s.bgErr = errors.WithMessagef(err, "failed to compress rotated file '%s'", rotated)
+				s.mu.Unlock()
+			}
+		}
+		s.prune()
+	}()
+	return nil
+}
+
+// prune - removes the oldest rotated files above the 'keep' number
+func (s *fileSink) prune() {
+	if s.keep == 0 {
+		return
+	}
+	s.pruneMu.Lock()
+	defer s.pruneMu.Unlock()
+	rotated, err := s.rotatedFiles()
+	if err != nil {
+		return
+	}
+	for ; len(rotated) > s.keep; rotated = rotated[1:] {
+		for _, n := range rotated[0] {
+			_ = os.Remove(n)
+		}
+	}
+}
+
+// rotatedFiles - rotated files of the sink from the oldest to the newest grouped by the rotation time,
+// the file being compressed may exist in both forms for a moment; temporary files are skipped
+func (s *fileSink) rotatedFiles() ([][]string, error) {
+	names, err := filepath.Glob(s.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var (
+		ret    [][]string
+		lastTs string
+	)
+	for _, n := range names {
+		ts := strings.TrimPrefix(n, s.path+".")
+		ts = strings.TrimSuffix(strings.TrimSuffix(ts, ".gz"), ".zst")
+		if _, e := time.Parse(rotatedTimeLayout, ts); e != nil {
+			continue
+		}
+		if len(ret) > 0 && ts == lastTs {
+			ret[len(ret)-1] = append(ret[len(ret)-1], n)
+			continue
+		}
+		ret, lastTs = append(ret, []string{n}), ts
+	}
+	return ret, nil
+}
+
+// compressFile - compresses the file into '<name>.gz' or '<name>.zst' and removes it,
+// on failure the file is kept and the partial compressed one is removed
+func compressFile(name, method string) (err error) {
+	ext := ".gz"
+	if method == CompressZstd {
+		ext = ".zst"
+	}
+	tmp := name + ext + compressTmpSuffix
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	src, err := os.Open(name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer src.Close() //nolint:errcheck
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer dst.Close() //nolint:errcheck
+	var w io.WriteCloser
+	if method == CompressZstd {
+		if w, err = zstd.NewWriter(dst); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		w = gzip.NewWriter(dst)
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		_ = w.Close()
+		return errors.WithStack(err)
+	}
+	if err = w.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = dst.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = os.Rename(tmp, name+ext); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Remove(name))
+}
@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Formatter - renders the trace as one line of the output, without the line terminator
+	Formatter interface {
+		Format(dst []byte, t *model.Trace) ([]byte, error)
+	}
+
+	// FormatterFactory - creates the formatter, the URL query holds the format parameters
+	FormatterFactory func(q url.Values) (Formatter, error)
+
+	// FormatterFunc -
+	FormatterFunc func(dst []byte, t *model.Trace) ([]byte, error)
+
+	jsonFormatter struct{}
+	textFormatter struct{}
+)
+
+// Format -
+func (f FormatterFunc) Format(dst []byte, t *model.Trace) ([]byte, error) {
+	return f(dst, t)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]FormatterFactory{
+		"json": func(url.Values) (Formatter, error) { return jsonFormatter{}, nil },
+		"text": func(url.Values) (Formatter, error) { return textFormatter{}, nil },
+	}
+)
+
+// RegisterFormat - makes the format available by the name
+func RegisterFormat(name string, f FormatterFactory) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if _, dup := formats[name]; dup {
+		panic(errors.Errorf("format '%s' is registered twice", name))
+	}
+	formats[name] = f
+}
+
+// Formats - names of the registered formats
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	ret := make([]string, 0, len(formats))
+	for n := range formats {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NewFormatter - formatter by the name, the query holds the format parameters
+func NewFormatter(name string, q url.Values) (Formatter, error) {
+	formatsMu.RLock()
+	f, ok := formats[strings.ToLower(name)]
+	formatsMu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown format '%s', expected one of: %s", name, strings.Join(Formats(), ", "))
+	}
+	return f(q)
+}
+
+// formatterFromURL - formatter selected by the 'format' query parameter, the 'template' one selects the template format
+func formatterFromURL(u *url.URL, def string) (Formatter, error) {
+	return formatterFromQuery(u.Query(), def)
+}
+
+func formatterFromQuery(q url.Values, def string) (Formatter, error) {
+	name := q.Get("format")
+	switch {
+	case name != "":
+	case q.Get("template") != "":
+		name = "template"
+	default:
+		name = def
+	}
+	return NewFormatter(name, q)
+}
+
+// Format - the trace object with the schema version in front, see the package doc
+func (jsonFormatter) Format(dst []byte, t *model.Trace) ([]byte, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, `{"version":`...)
+	dst = strconv.AppendInt(dst, SchemaVersion, 10)
+	if len(b) > 2 {
+		dst = append(dst, ',')
+	}
+	return append(dst, b[1:]...), nil
+}
+
+// Format - the five tuple, the path and the counter, the same as the text output of the printer
+func (textFormatter) Format(dst []byte, t *model.Trace) ([]byte, error) {
+	dst = append(dst, t.FiveTuple()...)
+	if len(t.Path) > 0 {
+		dst = append(dst, " path="...)
+		dst = append(dst, t.PathString()...)
+	}
+	dst = append(dst, " cnt="...)
+	return strconv.AppendUint(dst, t.Cnt, 10), nil
+}
@@ -0,0 +1,177 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defHttpTimeout      = 10 * time.Second
+	defHttpRetries      = 3
+	defHttpRetryBackoff = 500 * time.Millisecond
+	maxHttpRetryBackoff = 30 * time.Second
+	maxHttpErrBodyLen   = 512
+)
+
+// httpClient - client of the HTTP sinks, the scheme of the sink URL is '<name>' for HTTP and '<name>+https' for HTTPS.
+// The query takes: header=Name:Value (may be repeated), timeout - of the request (10s by default),
+// retries (3 by default) and retry-backoff (500ms by default, doubled on every retry).
+// The user info of the URL is the basic authentication
+type httpClient struct {
+	client  *http.Client
+	url     string
+	headers http.Header
+	retries int
+	backoff time.Duration
+}
+
+// httpStatusError - not successful response
+type httpStatusError struct {
+	code int
+	msg  string
+}
+
+func (e *httpStatusError) Error() string {
+	return strconv.Itoa(e.code) + " " + http.StatusText(e.code) + ": " + e.msg
+}
+
+// newHttpClient - the path is used if the URL has no path
+func newHttpClient(u *url.URL, defPort, defPath string) (*httpClient, error) {
+	q := u.Query()
+	if u.Hostname() == "" {
+		return nil, errors.New("host is not set")
+	}
+	scheme := "http"
+	if strings.HasSuffix(strings.ToLower(u.Scheme), "+https") {
+		scheme = "https"
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defPort)
+	}
+	path := u.Path
+	if path == "" || path == "/" {
+		path = defPath
+	}
+	c := &httpClient{
+		url:     scheme + "://" + host + path,
+		headers: make(http.Header),
+		retries: defHttpRetries,
+		backoff: defHttpRetryBackoff,
+	}
+	timeout := defHttpTimeout
+	for name, d := range map[string]*time.Duration{"timeout": &timeout, "retry-backoff": &c.backoff} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *d, err = time.ParseDuration(v); err != nil || *d <= 0 {
+				return nil, errors.Errorf("invalid %s '%s'", name, v)
+			}
+		}
+	}
+	if v := q.Get("retries"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid retries '%s'", v)
+		}
+		c.retries = n
+	}
+	for _, h := range q["header"] {
+		k, v, ok := strings.Cut(h, ":")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, errors.Errorf("invalid header '%s', expected 'Name:Value'", h)
+		}
+		c.headers.Add(k, strings.TrimSpace(v))
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		r := http.Request{Header: make(http.Header)}
+		r.SetBasicAuth(u.User.Username(), pass)
+		c.headers.Set("Authorization", r.Header.Get("Authorization"))
+	}
+	c.client = &http.Client{Timeout: timeout}
+	return c, nil
+}
+
+// post - posts the body to the sink URL and returns the response body
+func (c *httpClient) post(ctx context.Context, contentType string, body []byte) ([]byte, error) {
+	return c.request(ctx, http.MethodPost, c.url, contentType, body)
+}
+
+// request - the request is retried on the connection errors, 429 and 5xx responses
+func (c *httpClient) request(ctx context.Context, method, target, contentType string, body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		resp, retryAfter, err := c.do(ctx, method, target, contentType, body)
+		if err == nil || attempt >= c.retries || !httpRetriable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if err = c.wait(ctx, attempt, retryAfter); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait - the backoff before the retry
+func (c *httpClient) wait(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	d := min(c.backoff<<min(attempt, 10), maxHttpRetryBackoff)
+	if retryAfter > 0 {
+		d = min(retryAfter, maxHttpRetryBackoff)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func (c *httpClient) do(ctx context.Context, method, target, contentType string, body []byte) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	for k, v := range c.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxHttpErrBodyLen))
+		var retryAfter time.Duration
+		if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && n > 0 {
+			retryAfter = time.Duration(n) * time.Second
+		}
+		return nil, retryAfter, &httpStatusError{code: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+	}
+	ret, err := io.ReadAll(resp.Body)
+	return ret, 0, errors.WithStack(err)
+}
+
+func (c *httpClient) close() {
+	c.client.CloseIdleConnections()
+}
+
+// httpRetriable - connection error, 429 or 5xx
+func httpRetriable(err error) bool {
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		return httpRetriableStatus(se.code)
+	}
+	return true
+}
+
+func httpRetriableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,451 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	"github.com/Morwran/ebpf-nftrace/internal/nftables/expr-encoders/protocols"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defIpfixPort            = "4739"
+	defIpfixEnterprise      = 32473
+	defIpfixTemplateRefresh = time.Minute
+	defIpfixUdpMsgLen       = 1400
+	ipfixMaxMsgLen          = 0xffff
+	ipfixMaxString          = 1024
+	ipfixDialTimeout        = 5 * time.Second
+
+	ipfixVersion       = 10
+	ipfixHeaderLen     = 16
+	ipfixTemplateSetId = 2
+	ipfixTemplateIPv4  = 256
+	ipfixTemplateIPv6  = 257
+	ipfixVarLen        = 0xffff
+	ipfixEnterpriseBit = 0x8000
+	ipfixUnknownProto  = 0xff
+)
+
+// IPFIX information elements. The standard ones are from the IANA registry, the nftables specific ones are
+// enterprise-specific under the enterprise number of the sink URL
+const (
+	ieOctetDeltaCount          = 1
+	iePacketDeltaCount         = 2
+	ieProtocolIdentifier       = 4
+	ieSourceTransportPort      = 7
+	ieSourceIPv4Address        = 8
+	ieIngressInterface         = 10
+	ieDestinationTransportPort = 11
+	ieDestinationIPv4Address   = 12
+	ieEgressInterface          = 14
+	ieSourceIPv6Address        = 27
+	ieDestinationIPv6Address   = 28
+	ieFlowStartMilliseconds    = 152
+	ieFlowEndMilliseconds      = 153
+
+	ieNftTable      = 1 // string
+	ieNftChain      = 2 // string
+	ieNftRuleHandle = 3 // unsigned64
+	ieNftVerdict    = 4 // string, the final verdict if it's known
+	ieNftFamily     = 5 // string
+	ieNftRule       = 6 // string
+	ieNftIifName    = 7 // string
+	ieNftOifName    = 8 // string
+)
+
+type (
+	// ipfixField - field specifier of the template and the encoder of its value
+	ipfixField struct {
+		id         uint16
+		length     uint16
+		enterprise bool
+		enc        func(b []byte, t *model.Trace) []byte
+	}
+
+	// ipfixSink - RFC 7011 exporter, every trace is a flow record:
+	//
+	//	ipfix://collector:4739 - UDP, the templates are resent every template-refresh
+	//	ipfix://collector:4739?proto=tcp - TCP, the templates are sent once per connection
+	//
+	// the query also takes: domain - observation domain id (0 by default), enterprise - enterprise number of the
+	// nftables IEs (32473 by default), template-refresh (1m by default), msg-size - max UDP message size (1400 by default).
+	// The traces without IP addresses are skipped
+	ipfixSink struct {
+		mu              sync.Mutex
+		network         string
+		addr            string
+		domain          uint32
+		enterprise      uint32
+		templateRefresh time.Duration
+		maxMsgLen       int
+		conn            net.Conn
+		bw              *bufio.Writer
+		templates       []byte
+		templatesSent   time.Time
+		seq             uint32
+		msg             []byte
+		msgRecords      uint32
+		setStart        int
+		setTemplate     uint16
+	}
+)
+
+func init() {
+	Register("ipfix", openIpfixSink)
+}
+
+func openIpfixSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &ipfixSink{
+		network:         strings.ToLower(q.Get("proto")),
+		addr:            u.Host,
+		enterprise:      defIpfixEnterprise,
+		templateRefresh: defIpfixTemplateRefresh,
+		maxMsgLen:       defIpfixUdpMsgLen,
+	}
+	switch s.network {
+	case "":
+		s.network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, errors.Errorf("unknown protocol '%s', expected one of: udp, tcp", s.network)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("collector host is not set")
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), defIpfixPort)
+	}
+	if v := q.Get("domain"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid domain '%s'", v)
+		}
+		s.domain = uint32(n)
+	}
+	if v := q.Get("enterprise"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid enterprise number '%s'", v)
+		}
+		s.enterprise = uint32(n)
+	}
+	if v := q.Get("template-refresh"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("invalid template-refresh '%s'", v)
+		}
+		s.templateRefresh = d
+	}
+	if v := q.Get("msg-size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 512 || n > ipfixMaxMsgLen {
+			return nil, errors.Errorf("invalid msg-size '%s', expected 512...%d", v, ipfixMaxMsgLen)
+		}
+		s.maxMsgLen = n
+	}
+	if s.network == "tcp" {
+		s.maxMsgLen = ipfixMaxMsgLen
+	}
+	s.templates = s.appendTemplates(nil)
+	return s, nil
+}
+
+// Write - the records are sent by messages, the messages are buffered until Flush for TCP
+func (s *ipfixSink) Write(ctx context.Context, traces []model.Trace) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = s.connect(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.disconnect()
+		}
+	}()
+	for i := range traces {
+		t := &traces[i]
+		var tmpl uint16
+		switch {
+		case t.SAddr.Unmap().Is4() && t.DAddr.Unmap().Is4():
+			tmpl = ipfixTemplateIPv4
+		case t.SAddr.Is6() && t.DAddr.Is6():
+			tmpl = ipfixTemplateIPv6
+		default:
+			continue
+		}
+		if err = s.appendRecord(tmpl, t); err != nil {
+			return err
+		}
+	}
+	return s.send()
+}
+
+// Flush -
+func (s *ipfixSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bw == nil {
+		return nil
+	}
+	setDeadline(ctx, s.conn)
+	if err := s.bw.Flush(); err != nil {
+		s.disconnect()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close -
+func (s *ipfixSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.bw != nil {
+		err = s.bw.Flush()
+	}
+	s.disconnect()
+	return errors.WithStack(err)
+}
+
+// connect - the connection is made on the first write and after a failure
+func (s *ipfixSink) connect(ctx context.Context) error {
+	if s.conn == nil {
+		d := net.Dialer{Timeout: ipfixDialTimeout}
+		conn, err := d.DialContext(ctx, s.network, s.addr)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to connect to ipfix collector '%s://%s'", s.network, s.addr)
+		}
+		s.conn = conn
+		s.templatesSent = time.Time{}
+		if s.network == "tcp" {
+			s.bw = bufio.NewWriterSize(conn, streamBuffLen)
+		}
+	}
+	setDeadline(ctx, s.conn)
+	return nil
+}
+
+func (s *ipfixSink) disconnect() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.conn, s.bw = nil, nil
+	s.msg, s.msgRecords = s.msg[:0], 0
+}
+
+// appendRecord - adds the data record to the message, the message is sent when it is full
+func (s *ipfixSink) appendRecord(tmpl uint16, t *model.Trace) error {
+	fields := ipfixFields(tmpl)
+	for attempt := 0; ; attempt++ {
+		if len(s.msg) == 0 {
+			s.beginMsg()
+		}
+		if s.setTemplate != tmpl {
+			s.endSet()
+			s.setStart, s.setTemplate = len(s.msg), tmpl
+			s.msg = binary.BigEndian.AppendUint16(s.msg, tmpl)
+			s.msg = append(s.msg, 0, 0)
+		}
+		n := len(s.msg)
+		for _, f := range fields {
+			s.msg = f.enc(s.msg, t)
+		}
+		// the record alone may exceed the UDP message size, it's sent anyway
+		if len(s.msg) <= s.maxMsgLen || s.msgRecords == 0 || attempt > 0 {
+			s.msgRecords++
+			return nil
+		}
+		if s.setStart+4 == n { // the set has been opened for this record
+			n, s.setTemplate = s.setStart, 0
+		}
+		s.msg = s.msg[:n]
+		if err := s.send(); err != nil {
+			return err
+		}
+	}
+}
+
+// beginMsg - message header and the templates if they are due
+func (s *ipfixSink) beginMsg() {
+	s.msg = append(s.msg[:0], make([]byte, ipfixHeaderLen)...)
+	s.setStart, s.setTemplate = 0, 0
+	now := time.Now()
+	if s.templatesSent.IsZero() || (s.network == "udp" && now.Sub(s.templatesSent) >= s.templateRefresh) {
+		s.msg = append(s.msg, s.templates...)
+		s.templatesSent = now
+	}
+}
+
+func (s *ipfixSink) endSet() {
+	if s.setTemplate != 0 {
+		binary.BigEndian.PutUint16(s.msg[s.setStart+2:], uint16(len(s.msg)-s.setStart)) //nolint:gosec
+		s.setTemplate = 0
+	}
+}
+
+// send - completes the message header and sends the message
+func (s *ipfixSink) send() (err error) {
+	if s.msgRecords == 0 {
+		s.msg = s.msg[:0]
+		return nil
+	}
+	s.endSet()
+	binary.BigEndian.PutUint16(s.msg[0:], ipfixVersion)
+	binary.BigEndian.PutUint16(s.msg[2:], uint16(len(s.msg))) //nolint:gosec
+	binary.BigEndian.PutUint32(s.msg[4:], uint32(time.Now().Unix()))
+	binary.BigEndian.PutUint32(s.msg[8:], s.seq)
+	binary.BigEndian.PutUint32(s.msg[12:], s.domain)
+	if s.bw != nil {
+		_, err = s.bw.Write(s.msg)
+	} else {
+		_, err = s.conn.Write(s.msg)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	s.seq += s.msgRecords
+	s.msg, s.msgRecords = s.msg[:0], 0
+	return nil
+}
+
+// appendTemplates - the template set with the IPv4 and IPv6 templates
+func (s *ipfixSink) appendTemplates(b []byte) []byte {
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, ipfixTemplateSetId)
+	b = append(b, 0, 0)
+	for _, id := range []uint16{ipfixTemplateIPv4, ipfixTemplateIPv6} {
+		fields := ipfixFields(id)
+		b = binary.BigEndian.AppendUint16(b, id)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(fields))) //nolint:gosec
+		for _, f := range fields {
+			if f.enterprise {
+				b = binary.BigEndian.AppendUint16(b, f.id|ipfixEnterpriseBit)
+				b = binary.BigEndian.AppendUint16(b, f.length)
+				b = binary.BigEndian.AppendUint32(b, s.enterprise)
+				continue
+			}
+			b = binary.BigEndian.AppendUint16(b, f.id)
+			b = binary.BigEndian.AppendUint16(b, f.length)
+		}
+	}
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start)) //nolint:gosec
+	return b
+}
+
+var ipfixCommonFields = []ipfixField{
+	{id: ieProtocolIdentifier, length: 1, enc: func(b []byte, t *model.Trace) []byte {
+		p, ok := protocols.ParseProtoType(t.IpProto)
+		if !ok {
+			p = ipfixUnknownProto
+		}
+		return append(b, byte(p))
+	}},
+	{id: ieSourceTransportPort, length: 2, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint16(b, uint16(t.SPort)) //nolint:gosec
+	}},
+	{id: ieDestinationTransportPort, length: 2, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint16(b, uint16(t.DPort)) //nolint:gosec
+	}},
+	{id: ieIngressInterface, length: 4, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint32(b, t.Iif)
+	}},
+	{id: ieEgressInterface, length: 4, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint32(b, t.Oif)
+	}},
+	{id: iePacketDeltaCount, length: 8, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint64(b, t.Cnt)
+	}},
+	{id: ieOctetDeltaCount, length: 8, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint64(b, t.Bytes)
+	}},
+	{id: ieFlowStartMilliseconds, length: 8, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixTime(b, t.FirstSeen, t.Timestamp)
+	}},
+	{id: ieFlowEndMilliseconds, length: 8, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixTime(b, t.LastSeen, t.Timestamp)
+	}},
+	{id: ieNftTable, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixString(b, t.Table)
+	}},
+	{id: ieNftChain, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixString(b, t.Chain)
+	}},
+	{id: ieNftRuleHandle, length: 8, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return binary.BigEndian.AppendUint64(b, t.RuleHandle)
+	}},
+	{id: ieNftVerdict, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		if t.Final != "" {
+			return appendIpfixString(b, t.Final)
+		}
+		return appendIpfixString(b, t.Verdict)
+	}},
+	{id: ieNftFamily, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixString(b, t.Family)
+	}},
+	{id: ieNftRule, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixString(b, t.Rule)
+	}},
+	{id: ieNftIifName, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixString(b, t.Iifname)
+	}},
+	{id: ieNftOifName, length: ipfixVarLen, enterprise: true, enc: func(b []byte, t *model.Trace) []byte {
+		return appendIpfixString(b, t.Oifname)
+	}},
+}
+
+var ipfixTemplateFields = map[uint16][]ipfixField{
+	ipfixTemplateIPv4: append([]ipfixField{
+		{id: ieSourceIPv4Address, length: 4, enc: func(b []byte, t *model.Trace) []byte {
+			a := t.SAddr.Unmap().As4()
+			return append(b, a[:]...)
+		}},
+		{id: ieDestinationIPv4Address, length: 4, enc: func(b []byte, t *model.Trace) []byte {
+			a := t.DAddr.Unmap().As4()
+			return append(b, a[:]...)
+		}},
+	}, ipfixCommonFields...),
+	ipfixTemplateIPv6: append([]ipfixField{
+		{id: ieSourceIPv6Address, length: 16, enc: func(b []byte, t *model.Trace) []byte {
+			a := t.SAddr.As16()
+			return append(b, a[:]...)
+		}},
+		{id: ieDestinationIPv6Address, length: 16, enc: func(b []byte, t *model.Trace) []byte {
+			a := t.DAddr.As16()
+			return append(b, a[:]...)
+		}},
+	}, ipfixCommonFields...),
+}
+
+func ipfixFields(tmpl uint16) []ipfixField {
+	return ipfixTemplateFields[tmpl]
+}
+
+// appendIpfixString - variable length value: one byte length below 255, 255 and two bytes length otherwise
+func appendIpfixString(b []byte, v string) []byte {
+	v = v[:min(len(v), ipfixMaxString)]
+	if len(v) < 0xff {
+		b = append(b, byte(len(v)))
+	} else {
+		b = append(b, 0xff)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(v))) //nolint:gosec
+	}
+	return append(b, v...)
+}
+
+func appendIpfixTime(b []byte, ts, fallback time.Time) []byte {
+	if ts.IsZero() {
+		ts = fallback
+	}
+	return binary.BigEndian.AppendUint64(b, uint64(ts.UnixMilli())) //nolint:gosec
+}
@@ -0,0 +1,227 @@
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	ipfixTestIE struct {
+		pen uint32
+		id  uint16
+	}
+
+	ipfixTestField struct {
+		ipfixTestIE
+		length uint16
+	}
+
+	ipfixTestMsg struct {
+		seq       uint32
+		domain    uint32
+		templates int
+		records   []map[ipfixTestIE][]byte
+	}
+
+	// ipfixTestDecoder - collector side, keeps the templates between the messages
+	ipfixTestDecoder struct {
+		templates map[uint16][]ipfixTestField
+	}
+)
+
+func (d *ipfixTestDecoder) decode(t *testing.T, b []byte) ipfixTestMsg {
+	require.GreaterOrEqual(t, len(b), ipfixHeaderLen)
+	require.Equal(t, uint16(ipfixVersion), binary.BigEndian.Uint16(b))
+	require.Equal(t, len(b), int(binary.BigEndian.Uint16(b[2:])))
+	msg := ipfixTestMsg{seq: binary.BigEndian.Uint32(b[8:]), domain: binary.BigEndian.Uint32(b[12:])}
+	for b = b[ipfixHeaderLen:]; len(b) > 0; {
+		require.GreaterOrEqual(t, len(b), 4)
+		id, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		require.LessOrEqual(t, n, len(b))
+		set := b[4:n]
+		b = b[n:]
+		if id == ipfixTemplateSetId {
+			for len(set) > 0 {
+				tmpl, cnt := binary.BigEndian.Uint16(set), int(binary.BigEndian.Uint16(set[2:]))
+				set = set[4:]
+				var fields []ipfixTestField
+				for range cnt {
+					f := ipfixTestField{length: binary.BigEndian.Uint16(set[2:])}
+					f.id, set = binary.BigEndian.Uint16(set), set[4:]
+					if f.id&ipfixEnterpriseBit != 0 {
+						f.id &^= ipfixEnterpriseBit
+						f.pen, set = binary.BigEndian.Uint32(set), set[4:]
+					}
+					fields = append(fields, f)
+				}
+				d.templates[tmpl] = fields
+				msg.templates++
+			}
+			continue
+		}
+		fields, ok := d.templates[id]
+		require.True(t, ok, "data set %d without template", id)
+		for len(set) > 0 {
+			rec := make(map[ipfixTestIE][]byte)
+			for _, f := range fields {
+				n := int(f.length)
+				if f.length == ipfixVarLen {
+					n, set = int(set[0]), set[1:]
+					if n == 0xff {
+						n, set = int(binary.BigEndian.Uint16(set)), set[2:]
+					}
+				}
+				rec[f.ipfixTestIE], set = set[:n], set[n:]
+			}
+			msg.records = append(msg.records, rec)
+		}
+	}
+	return msg
+}
+
+var ipfixTestTrace = model.Trace{
+	TrId:       7,
+	Table:      "filter",
+	Chain:      "input",
+	Family:     "ip",
+	RuleHandle: 12,
+	Iif:        2,
+	Iifname:    "eth0",
+	SAddr:      netip.MustParseAddr("10.0.0.1"),
+	DAddr:      netip.MustParseAddr("10.0.0.2"),
+	SPort:      1234,
+	DPort:      80,
+	IpProto:    "tcp",
+	Verdict:    "continue",
+	Final:      "drop",
+	Rule:       "tcp dport 80 drop",
+	Cnt:        3,
+	Bytes:      180,
+	Timestamp:  time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC),
+	FirstSeen:  time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC),
+	LastSeen:   time.Date(2024, 5, 1, 10, 20, 31, 0, time.UTC),
+}
+
+func checkIpfixRecord(t *testing.T, rec map[ipfixTestIE][]byte, tr *model.Trace) {
+	std := func(id uint16) []byte { return rec[ipfixTestIE{id: id}] }
+	nft := func(id uint16) string { return string(rec[ipfixTestIE{pen: defIpfixEnterprise, id: id}]) }
+	if tr.SAddr.Is4() {
+		require.Equal(t, tr.SAddr.AsSlice(), std(ieSourceIPv4Address))
+		require.Equal(t, tr.DAddr.AsSlice(), std(ieDestinationIPv4Address))
+	} else {
+		require.Equal(t, tr.SAddr.AsSlice(), std(ieSourceIPv6Address))
+		require.Equal(t, tr.DAddr.AsSlice(), std(ieDestinationIPv6Address))
+	}
+	require.Equal(t, []byte{6}, std(ieProtocolIdentifier))
+	require.Equal(t, uint16(tr.SPort), binary.BigEndian.Uint16(std(ieSourceTransportPort)))
+	require.Equal(t, uint16(tr.DPort), binary.BigEndian.Uint16(std(ieDestinationTransportPort)))
+	require.Equal(t, tr.Iif, binary.BigEndian.Uint32(std(ieIngressInterface)))
+	require.Equal(t, tr.Cnt, binary.BigEndian.Uint64(std(iePacketDeltaCount)))
+	require.Equal(t, tr.Bytes, binary.BigEndian.Uint64(std(ieOctetDeltaCount)))
+	require.Equal(t, uint64(tr.FirstSeen.UnixMilli()), binary.BigEndian.Uint64(std(ieFlowStartMilliseconds)))
+	require.Equal(t, uint64(tr.LastSeen.UnixMilli()), binary.BigEndian.Uint64(std(ieFlowEndMilliseconds)))
+	require.Equal(t, tr.Table, nft(ieNftTable))
+	require.Equal(t, tr.Chain, nft(ieNftChain))
+	require.Equal(t, tr.RuleHandle, binary.BigEndian.Uint64([]byte(nft(ieNftRuleHandle))))
+	require.Equal(t, tr.Final, nft(ieNftVerdict))
+	require.Equal(t, tr.Family, nft(ieNftFamily))
+	require.Equal(t, tr.Rule, nft(ieNftRule))
+	require.Equal(t, tr.Iifname, nft(ieNftIifName))
+	require.Equal(t, "", nft(ieNftOifName))
+}
+
+func Test_IpfixSink(t *testing.T) {
+	ctx := context.Background()
+	tr6 := ipfixTestTrace
+	tr6.Family, tr6.SAddr, tr6.DAddr = "ip6", netip.MustParseAddr("fd00::1"), netip.MustParseAddr("fd00::2")
+	long := ipfixTestTrace
+	long.Rule = string(make([]byte, 300))
+	noIp := model.Trace{Table: "filter", Family: "arp"}
+
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pc.Close() //nolint:errcheck
+		s, err := Open("ipfix://" + pc.LocalAddr().String() + "?domain=5&template-refresh=50ms&msg-size=512")
+		require.NoError(t, err)
+		defer s.Close() //nolint:errcheck
+		d := ipfixTestDecoder{templates: make(map[uint16][]ipfixTestField)}
+		read := func() ipfixTestMsg {
+			buf := make([]byte, 64<<10)
+			_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := pc.ReadFrom(buf)
+			require.NoError(t, err)
+			require.LessOrEqual(t, n, 512)
+			return d.decode(t, buf[:n])
+		}
+
+		require.NoError(t, s.Write(ctx, []model.Trace{ipfixTestTrace, noIp, tr6, long}))
+		msg := read()
+		require.Equal(t, uint32(5), msg.domain)
+		require.Equal(t, uint32(0), msg.seq)
+		require.Equal(t, 2, msg.templates)
+		require.Len(t, msg.records, 2)
+		checkIpfixRecord(t, msg.records[0], &ipfixTestTrace)
+		checkIpfixRecord(t, msg.records[1], &tr6)
+		msg = read() // the record doesn't fit the first message
+		require.Equal(t, uint32(2), msg.seq)
+		require.Equal(t, 0, msg.templates)
+		require.Len(t, msg.records, 1)
+		checkIpfixRecord(t, msg.records[0], &long)
+
+		require.NoError(t, s.Write(ctx, []model.Trace{ipfixTestTrace}))
+		msg = read()
+		require.Equal(t, uint32(3), msg.seq)
+		require.Equal(t, 0, msg.templates)
+
+		time.Sleep(60 * time.Millisecond)
+		require.NoError(t, s.Write(ctx, []model.Trace{ipfixTestTrace}))
+		msg = read()
+		require.Equal(t, uint32(4), msg.seq)
+		require.Equal(t, 2, msg.templates)
+		require.Len(t, msg.records, 1)
+	})
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close() //nolint:errcheck
+		s, err := Open("ipfix://" + l.Addr().String() + "?proto=tcp&enterprise=32473")
+		require.NoError(t, err)
+		require.NoError(t, s.Write(ctx, []model.Trace{ipfixTestTrace, tr6}))
+		require.NoError(t, s.Write(ctx, []model.Trace{long}))
+		require.NoError(t, s.Flush(ctx))
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+		require.NoError(t, s.Close())
+		d := ipfixTestDecoder{templates: make(map[uint16][]ipfixTestField)}
+		read := func() ipfixTestMsg {
+			hdr := make([]byte, ipfixHeaderLen)
+			_, err := io.ReadFull(conn, hdr)
+			require.NoError(t, err)
+			b := make([]byte, binary.BigEndian.Uint16(hdr[2:]))
+			copy(b, hdr)
+			_, err = io.ReadFull(conn, b[ipfixHeaderLen:])
+			require.NoError(t, err)
+			return d.decode(t, b)
+		}
+		msg := read()
+		require.Equal(t, 2, msg.templates)
+		require.Len(t, msg.records, 2)
+		checkIpfixRecord(t, msg.records[0], &ipfixTestTrace)
+		checkIpfixRecord(t, msg.records[1], &tr6)
+		msg = read()
+		require.Equal(t, uint32(2), msg.seq)
+		require.Equal(t, 0, msg.templates)
+		checkIpfixRecord(t, msg.records[0], &long)
+	})
+}
@@ -0,0 +1,131 @@
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defJournalSocket     = "/run/systemd/journal/socket"
+	journalFieldPrefix   = "NFTRACE_"
+	defJournalIdentifier = "nftrace"
+)
+
+// journaldSink - native journal protocol, every trace is a datagram of the fields:
+// MESSAGE, PRIORITY, SYSLOG_FACILITY, SYSLOG_IDENTIFIER and NFTRACE_<FIELD> of the trace (NFTRACE_TABLE=, NFTRACE_VERDICT=, ...).
+//
+//	journald:// - the journal socket of systemd
+//	journald:///path/to/socket - other socket
+//
+// the query also takes: identifier, facility, severity (see priorityMap) and format of the message text
+type journaldSink struct {
+	mu         sync.Mutex
+	addr       string
+	conn       net.Conn
+	f          Formatter
+	prio       priorityMap
+	identifier string
+	msg, buf   []byte
+}
+
+func init() {
+	Register("journald", openJournaldSink)
+}
+
+func openJournaldSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &journaldSink{addr: u.Path, identifier: q.Get("identifier")}
+	if s.addr == "" {
+		s.addr = defJournalSocket
+	}
+	if s.identifier == "" {
+		s.identifier = defJournalIdentifier
+	}
+	var err error
+	if s.f, err = formatterFromURL(u, "text"); err != nil {
+		return nil, err
+	}
+	if s.prio, err = parsePriorityMap(q); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write -
+func (s *journaldSink) Write(ctx context.Context, traces []model.Trace) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		var d net.Dialer
+		if s.conn, err = d.DialContext(ctx, "unixgram", s.addr); err != nil {
+			return errors.WithMessagef(err, "failed to connect to journal '%s'", s.addr)
+		}
+	}
+	setDeadline(ctx, s.conn)
+	for i := range traces {
+		if s.buf, err = s.format(s.buf[:0], &traces[i]); err != nil {
+			return err
+		}
+		if _, err = s.conn.Write(s.buf); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *journaldSink) Flush(context.Context) error {
+	return nil
+}
+
+// Close -
+func (s *journaldSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return errors.WithStack(err)
+}
+
+func (s *journaldSink) format(dst []byte, t *model.Trace) (_ []byte, err error) {
+	if s.msg, err = s.f.Format(s.msg[:0], t); err != nil {
+		return dst, errors.WithMessage(err, "failed to format trace")
+	}
+	facility, severity := s.prio.get(t)
+	dst = appendJournalField(dst, "MESSAGE", string(s.msg))
+	dst = appendJournalField(dst, "PRIORITY", strconv.Itoa(severity))
+	dst = appendJournalField(dst, "SYSLOG_FACILITY", strconv.Itoa(facility))
+	dst = appendJournalField(dst, "SYSLOG_IDENTIFIER", s.identifier)
+	traceFields(t, func(name, value string) {
+		dst = appendJournalField(dst, journalFieldPrefix+strings.ToUpper(name), value)
+	})
+	return dst, nil
+}
+
+// appendJournalField - 'NAME=value\n', a value with new lines is written as 'NAME\n<64-bit LE length><value>\n'
+func appendJournalField(dst []byte, name, value string) []byte {
+	dst = append(dst, name...)
+	if strings.IndexByte(value, '\n') < 0 {
+		dst = append(dst, '=')
+		dst = append(dst, value...)
+	} else {
+		dst = append(dst, '\n')
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(len(value)))
+		dst = append(dst, value...)
+	}
+	return append(dst, '\n')
+}
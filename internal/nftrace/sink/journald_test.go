@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+// parseJournalFields - reverse of appendJournalField
+func parseJournalFields(t *testing.T, b []byte) map[string]string {
+	ret := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		require.GreaterOrEqual(t, i, 0)
+		name := string(b[:i])
+		if b[i] == '=' {
+			j := bytes.IndexByte(b[i:], '\n')
+			require.GreaterOrEqual(t, j, 0)
+			ret[name] = string(b[i+1 : i+j])
+			b = b[i+j+1:]
+			continue
+		}
+		n := int(binary.LittleEndian.Uint64(b[i+1:]))
+		ret[name] = string(b[i+9 : i+9+n])
+		b = b[i+9+n+1:]
+	}
+	return ret
+}
+
+func Test_JournaldSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	pc, err := net.ListenPacket("unixgram", path)
+	require.NoError(t, err)
+	defer pc.Close() //nolint:errcheck
+	s, err := Open("journald://" + path + "?severity=drop:crit")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+
+	tr := syslogTestTrace
+	tr.Rule = "meta mark set 0x1\ncounter"
+	require.NoError(t, s.Write(context.Background(), []model.Trace{tr}))
+	buf := make([]byte, 64<<10)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+
+	fields := parseJournalFields(t, buf[:n])
+	require.Equal(t, "2", fields["PRIORITY"])
+	require.Equal(t, "16", fields["SYSLOG_FACILITY"])
+	require.Equal(t, "nftrace", fields["SYSLOG_IDENTIFIER"])
+	require.Equal(t, "filter", fields["NFTRACE_TABLE"])
+	require.Equal(t, "drop", fields["NFTRACE_VERDICT"])
+	require.Equal(t, "10.0.0.2", fields["NFTRACE_DST"])
+	require.Equal(t, "80", fields["NFTRACE_DPORT"])
+	require.Equal(t, tr.Rule, fields["NFTRACE_RULE"])
+	require.Contains(t, fields["MESSAGE"], "dst=10.0.0.2:80")
+	require.NotContains(t, fields, "NFTRACE_OIF")
+}
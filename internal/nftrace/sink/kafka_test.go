@@ -0,0 +1,175 @@
+package sink
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test_KafkaSink(t *testing.T) {
+	c, err := kfake.NewCluster(kfake.SeedTopics(4, "traces"))
+	require.NoError(t, err)
+	defer c.Close()
+	addr := c.ListenAddrs()[0]
+	ctx := context.Background()
+
+	reply := syslogTestTrace
+	reply.SAddr, reply.DAddr, reply.SPort, reply.DPort = syslogTestTrace.DAddr, syslogTestTrace.SAddr, 80, 1234
+	other := syslogTestTrace
+	other.SAddr = netip.MustParseAddr("10.0.0.3")
+
+	s, err := Open("kafka://" + addr + "/traces?batch=2&compression=gzip")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace, reply, other}))
+	require.Len(t, kafkaTestConsume(t, 2, kgo.SeedBrokers(addr)), 2) // the batch is full
+	require.NoError(t, s.Flush(ctx))
+	recs := make(map[netip.Addr]*kgo.Record)
+	for _, r := range kafkaTestConsume(t, 3, kgo.SeedBrokers(addr)) {
+		var got model.Trace
+		require.NoError(t, json.Unmarshal(r.Value, &got))
+		require.Equal(t, syslogTestTrace.Rule, got.Rule)
+		recs[got.SAddr] = r
+	}
+	require.Len(t, recs, 3)
+	fwd, rev, oth := recs[syslogTestTrace.SAddr], recs[reply.SAddr], recs[other.SAddr]
+	require.Equal(t, fwd.Key, rev.Key, "both directions of the flow have one key")
+	require.Equal(t, fwd.Partition, rev.Partition)
+	require.NotEqual(t, fwd.Key, oth.Key)
+	require.Equal(t, "content-type", fwd.Headers[0].Key)
+	require.Equal(t, "application/json", string(fwd.Headers[0].Value))
+	require.Equal(t, syslogTestTrace.Timestamp.UnixMilli(), fwd.Timestamp.UnixMilli())
+
+	s, err = Open("kafka://" + addr + "/traces?key=rule&format=protobuf&acks=leader")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace}))
+	require.NoError(t, s.Flush(ctx))
+	var rec *kgo.Record
+	for _, r := range kafkaTestConsume(t, 4, kgo.SeedBrokers(addr)) {
+		if string(r.Headers[0].Value) == "application/x-protobuf" {
+			rec = r
+		}
+	}
+	require.NotNil(t, rec)
+	require.Equal(t, "ip/filter/0", string(rec.Key))
+	var pb api.Trace
+	require.NoError(t, proto.Unmarshal(rec.Value, &pb))
+	require.Equal(t, syslogTestTrace.TrId, pb.GetTraceId())
+	require.Equal(t, syslogTestTrace.Chain, pb.GetChain())
+
+	s, err = Open("kafka://" + addr + "/unknown?retries=0")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace}))
+	require.Error(t, s.Flush(ctx))
+}
+
+func Test_KafkaSinkAuth(t *testing.T) {
+	dir := t.TempDir()
+	cert, certFile := kafkaTestCert(t, dir)
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	c, err := kfake.NewCluster(
+		kfake.SeedTopics(1, "traces"),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "nftrace", "secret"),
+		kfake.TLS(tlsCfg),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+	addr := c.ListenAddrs()[0]
+	ctx := context.Background()
+
+	testCases := []struct {
+		name   string
+		url    string
+		expErr bool
+	}{
+		{"tls and sasl", "kafka://nftrace:secret@" + addr + "/traces?sasl=plain&tls-ca=" + certFile, false},
+		{"insecure tls", "kafka://nftrace:secret@" + addr + "/traces?tls-insecure=true", false},
+		{"bad password", "kafka://nftrace:wrong@" + addr + "/traces?tls-ca=" + certFile, true},
+		{"unknown ca", "kafka://nftrace:secret@" + addr + "/traces?tls=true", true},
+		{"no tls", "kafka://nftrace:secret@" + addr + "/traces", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := Open(tc.url + "&retries=0&timeout=1s")
+			require.NoError(t, err)
+			defer s.Close() //nolint:errcheck
+			require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace}))
+			if err = s.Flush(ctx); tc.expErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	recs := kafkaTestConsume(t, 2,
+		kgo.SeedBrokers(addr),
+		kgo.DialTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}),
+		kgo.SASL(plain.Auth{User: "nftrace", Pass: "secret"}.AsMechanism()),
+	)
+	require.Len(t, recs, 2)
+}
+
+// kafkaTestConsume - first n records of the 'traces' topic
+func kafkaTestConsume(t *testing.T, n int, opts ...kgo.Opt) []*kgo.Record {
+	cl, err := kgo.NewClient(append(opts, kgo.ConsumeTopics("traces"))...)
+	require.NoError(t, err)
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var ret []*kgo.Record
+	for len(ret) < n {
+		fs := cl.PollFetches(ctx)
+		require.NoError(t, ctx.Err())
+		fs.EachRecord(func(r *kgo.Record) { ret = append(ret, r) })
+	}
+	return ret
+}
+
+// kafkaTestCert - self-signed certificate of the loopback address and its PEM file
+func kafkaTestCert(t *testing.T, dir string) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	file := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, file
+}
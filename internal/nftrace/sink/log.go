@@ -0,0 +1,58 @@
+package sink
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/printer"
+)
+
+// logSink - prints the traces through the logger as the printer does, log://?json=true,
+// log://?template=<template or built-in name> prints them by the template, see printer.Template,
+// the template is colored if the stdout the logger writes to is a terminal, color=true|false overrides it
+type logSink struct {
+	p printer.TracePrinter
+}
+
+func init() {
+	Register("log", func(u *url.URL) (Sink, error) {
+		var opts []printer.Option
+		q := u.Query()
+		if j, _ := strconv.ParseBool(q.Get("json")); j {
+			opts = append(opts, printer.WithJsonFormat())
+		}
+		if text := q.Get("template"); text != "" {
+			colors, err := colorParam(q, isTerminal(os.Stdout))
+			if err != nil {
+				return nil, err
+			}
+			t, err := printer.ParseTemplate(text, colors)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, printer.WithTemplate(t))
+		}
+		return logSink{p: printer.NewTracePrinter(opts...)}, nil
+	})
+}
+
+// Write -
+func (s logSink) Write(_ context.Context, traces []model.Trace) error {
+	for i := range traces {
+		s.p.Print(traces[i])
+	}
+	return nil
+}
+
+// Flush -
+func (logSink) Flush(context.Context) error {
+	return nil
+}
+
+// Close -
+func (logSink) Close() error {
+	return nil
+}
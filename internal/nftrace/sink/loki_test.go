@@ -0,0 +1,91 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LokiSink(t *testing.T) {
+	var fails atomic.Int32
+	pushes := make(chan lokiPush, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defLokiPath {
+			http.NotFound(w, r)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "nftrace" || pass != "secret" || r.Header.Get("X-Scope-OrgID") != "fw" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if fails.Add(-1) >= 0 {
+			http.Error(w, "ingester is busy", http.StatusServiceUnavailable)
+			return
+		}
+		var p lokiPush
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pushes <- p
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	s, err := Open("loki://nftrace:secret@" + srv.Listener.Addr().String() +
+		"?tenant=fw&batch=3&max-streams=2&retry-backoff=1ms")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+
+	accepted := syslogTestTrace
+	accepted.Verdict = "accept"
+	forward := syslogTestTrace
+	forward.Chain = "forward"
+	fails.Store(2)
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace, accepted, syslogTestTrace, forward}))
+	p := <-pushes // the batch is full, pushed on the third attempt
+	require.Len(t, p.Streams, 2)
+	require.Equal(t, "filter", p.Streams[0].Stream.Table)
+	require.Equal(t, "input", p.Streams[0].Stream.Chain)
+	require.Equal(t, "drop", p.Streams[0].Stream.Verdict)
+	require.Len(t, p.Streams[0].Values, 2)
+	require.Equal(t, strconv.FormatInt(syslogTestTrace.Timestamp.UnixNano(), 10), p.Streams[0].Values[0][0])
+	var got model.Trace
+	require.NoError(t, json.Unmarshal([]byte(p.Streams[0].Values[0][1]), &got))
+	require.Equal(t, syslogTestTrace.Rule, got.Rule)
+	require.Equal(t, "accept", p.Streams[1].Stream.Verdict)
+
+	require.NoError(t, s.Flush(ctx))
+	p = <-pushes // the streams are capped
+	require.Len(t, p.Streams, 1)
+	require.Equal(t, lokiOverflow, p.Streams[0].Stream.Table)
+	require.Equal(t, lokiOverflow, p.Streams[0].Stream.Chain)
+	require.Equal(t, "drop", p.Streams[0].Stream.Verdict)
+	require.NoError(t, s.Flush(ctx))
+	require.Len(t, pushes, 0)
+
+	fails.Store(10)
+	require.NoError(t, s.Write(ctx, []model.Trace{accepted}))
+	require.Error(t, s.Flush(ctx), "retries are exhausted")
+	fails.Store(0)
+	require.NoError(t, s.Flush(ctx), "the failed batch is dropped")
+	require.Len(t, pushes, 0)
+
+	s, err = Open("loki://" + srv.Listener.Addr().String() + "?retry-backoff=1ms")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	require.NoError(t, s.Write(ctx, []model.Trace{accepted}))
+	err = s.Flush(ctx)
+	require.ErrorContains(t, err, "401", "not retriable")
+}
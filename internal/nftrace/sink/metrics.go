@@ -0,0 +1,25 @@
+package sink
+
+import "github.com/H-BF/corlib/pkg/patterns/observer"
+
+type (
+	CountSinkTraceEvent struct {
+		observer.EventType
+		Sink string
+		Cnt  uint64
+	}
+	CountSinkErrorEvent struct {
+		observer.EventType
+		Sink string
+	}
+	CountSinkDropEvent struct {
+		observer.EventType
+		Sink string
+		Cnt  uint64
+	}
+	SinkHealthEvent struct {
+		observer.EventType
+		Sink    string
+		Healthy bool
+	}
+)
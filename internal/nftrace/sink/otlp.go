@@ -0,0 +1,198 @@
+package sink
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/otlp"
+
+	"github.com/pkg/errors"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+const defOtlpBatch = 512
+
+// otlpSeverities - OpenTelemetry severity of the syslog one
+var otlpSeverities = [...]struct {
+	num  logspb.SeverityNumber
+	text string
+}{
+	{logspb.SeverityNumber_SEVERITY_NUMBER_FATAL, "FATAL"}, // emerg
+	{logspb.SeverityNumber_SEVERITY_NUMBER_FATAL, "FATAL"}, // alert
+	{logspb.SeverityNumber_SEVERITY_NUMBER_ERROR2, "ERROR"},
+	{logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, "ERROR"},
+	{logspb.SeverityNumber_SEVERITY_NUMBER_WARN, "WARN"},
+	{logspb.SeverityNumber_SEVERITY_NUMBER_INFO2, "INFO"}, // notice
+	{logspb.SeverityNumber_SEVERITY_NUMBER_INFO, "INFO"},
+	{logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG, "DEBUG"},
+}
+
+// otlpSink - every trace is an OpenTelemetry log record, the body is the trace in the 'format' (text by default)
+// and the attributes are network.*, source.*, destination.* and nftables.*:
+//
+//	otlp://collector:4317      - OTLP/gRPC
+//	otlp+http://collector:4318 - OTLP/HTTP, the logs are posted to /v1/logs, otlp+https for HTTPS
+//
+// the query also takes: batch - max number of records in the request (512 by default), severity (see priorityMap)
+// and the exporter parameters, see otlp.Exporter. The records are sent on Flush or when the batch is full
+type otlpSink struct {
+	mu      sync.Mutex
+	exp     *otlp.Exporter
+	f       Formatter
+	prio    priorityMap
+	batch   int
+	records []*logspb.LogRecord
+	buf     []byte
+}
+
+func init() {
+	for _, scheme := range []string{"otlp", "otlp+http", "otlp+https"} {
+		Register(scheme, openOtlpSink)
+	}
+}
+
+func openOtlpSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &otlpSink{batch: defOtlpBatch}
+	if v := q.Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid batch '%s'", v)
+		}
+		s.batch = n
+	}
+	var err error
+	if s.f, err = formatterFromURL(u, "text"); err != nil {
+		return nil, err
+	}
+	if s.prio, err = parsePriorityMap(q); err != nil {
+		return nil, err
+	}
+	if s.exp, err = otlp.Dial(u); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write -
+func (s *otlpSink) Write(ctx context.Context, traces []model.Trace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := otlp.TimeUnixNano(time.Now())
+	for i := range traces {
+		rec, err := s.record(&traces[i])
+		if err != nil {
+			return err
+		}
+		rec.ObservedTimeUnixNano = now
+		if s.records = append(s.records, rec); len(s.records) >= s.batch {
+			if err = s.export(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *otlpSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.export(ctx)
+}
+
+// Close -
+func (s *otlpSink) Close() error {
+	return s.exp.Close()
+}
+
+// export - sends the batch, the batch is dropped if the collector fails it
+func (s *otlpSink) export(ctx context.Context) error {
+	if len(s.records) == 0 {
+		return nil
+	}
+	req := &collogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: s.exp.Resource(),
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otlp.ServiceName},
+				LogRecords: s.records,
+			}},
+		}},
+	}
+	s.records = nil
+	return s.exp.ExportLogs(ctx, req)
+}
+
+func (s *otlpSink) record(t *model.Trace) (*logspb.LogRecord, error) {
+	var err error
+	if s.buf, err = s.f.Format(s.buf[:0], t); err != nil {
+		return nil, err
+	}
+	_, severity := s.prio.get(t)
+	sev := otlpSeverities[severity]
+	return &logspb.LogRecord{
+		TimeUnixNano:   otlp.TimeUnixNano(t.Timestamp),
+		SeverityNumber: sev.num,
+		SeverityText:   sev.text,
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: string(s.buf)}},
+		Attributes:     otlpAttributes(t),
+	}, nil
+}
+
+// otlpAttributes - attributes of the trace, the empty ones are skipped
+func otlpAttributes(t *model.Trace) []*commonpb.KeyValue {
+	var ret []*commonpb.KeyValue
+	str := func(k, v string) {
+		if v != "" {
+			ret = append(ret, otlp.StringAttr(k, v))
+		}
+	}
+	num := func(k string, v uint64) {
+		if v != 0 {
+			ret = append(ret, otlp.IntAttr(k, int64(v))) //nolint:gosec
+		}
+	}
+	switch t.L3Proto {
+	case "ip":
+		str("network.type", "ipv4")
+	case "ip6":
+		str("network.type", "ipv6")
+	}
+	str("network.transport", t.IpProto)
+	str("source.address", model.AddrString(t.SAddr))
+	num("source.port", uint64(t.SPort))
+	str("destination.address", model.AddrString(t.DAddr))
+	num("destination.port", uint64(t.DPort))
+	num("nftables.trace_id", uint64(t.TrId))
+	str("nftables.family", t.Family)
+	str("nftables.table", t.Table)
+	str("nftables.chain", t.Chain)
+	num("nftables.rule.handle", t.RuleHandle)
+	str("nftables.rule.text", t.Rule)
+	str("nftables.verdict", t.Verdict)
+	str("nftables.final_verdict", t.Final)
+	str("nftables.jump_target", t.JumpTarget)
+	str("nftables.path", t.PathString())
+	str("nftables.iif", t.Iifname)
+	str("nftables.oif", t.Oifname)
+	str("nftables.hw_src", t.SMacAddr.String())
+	str("nftables.hw_dst", t.DMacAddr.String())
+	num("nftables.packet.length", uint64(t.Length))
+	num("nftables.packet.count", t.Cnt)
+	num("nftables.packet.bytes", t.Bytes)
+	num("nftables.ct.id", uint64(t.CtId))
+	str("nftables.ct.state", t.CtState)
+	str("nftables.ct.direction", t.CtDirection)
+	str("nftables.ct.status", t.CtStatus)
+	if t.Incomplete {
+		ret = append(ret, otlp.BoolAttr("nftables.incomplete", true))
+	}
+	return ret
+}
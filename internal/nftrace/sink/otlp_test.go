@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test_OtlpSink(t *testing.T) {
+	reqs := make(chan *collogs.ExportLogsServiceRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req collogs.ExportLogsServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqs <- &req
+	}))
+	defer srv.Close()
+
+	s, err := Open("otlp+http://" + srv.Listener.Addr().String() + "?batch=2")
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	ctx := context.Background()
+
+	accepted := syslogTestTrace
+	accepted.Verdict, accepted.Final = "accept", "accept"
+	require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace, accepted, syslogTestTrace}))
+	records := func(req *collogs.ExportLogsServiceRequest) []*logspb.LogRecord {
+		require.Len(t, req.GetResourceLogs(), 1)
+		return req.GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords()
+	}
+	recs := records(<-reqs) // the batch is full
+	require.Len(t, recs, 2)
+	require.Len(t, reqs, 0)
+	require.NoError(t, s.Flush(ctx))
+	require.Len(t, records(<-reqs), 1)
+	require.NoError(t, s.Flush(ctx))
+	require.Len(t, reqs, 0)
+
+	rec := recs[0]
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, rec.GetSeverityNumber())
+	require.Equal(t, "WARN", rec.GetSeverityText())
+	require.Equal(t, uint64(syslogTestTrace.Timestamp.UnixNano()), rec.GetTimeUnixNano())
+	require.NotZero(t, rec.GetObservedTimeUnixNano())
+	require.Contains(t, rec.GetBody().GetStringValue(), "10.0.0.1")
+	attrs := make(map[string]any)
+	for _, kv := range rec.GetAttributes() {
+		switch v := kv.GetValue(); {
+		case v.GetStringValue() != "":
+			attrs[kv.GetKey()] = v.GetStringValue()
+		default:
+			attrs[kv.GetKey()] = v.GetIntValue()
+		}
+	}
+	require.Equal(t, map[string]any{
+		"network.transport":      "tcp",
+		"source.address":         "10.0.0.1",
+		"source.port":            int64(1234),
+		"destination.address":    "10.0.0.2",
+		"destination.port":       int64(80),
+		"nftables.trace_id":      int64(7),
+		"nftables.family":        "ip",
+		"nftables.table":         "filter",
+		"nftables.chain":         "input",
+		"nftables.rule.text":     syslogTestTrace.Rule,
+		"nftables.verdict":       "drop",
+		"nftables.final_verdict": "drop",
+		"nftables.packet.count":  int64(1),
+	}, attrs)
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, recs[1].GetSeverityNumber())
+}
@@ -0,0 +1,263 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// pcapng block types and options, https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-03.html
+const (
+	pcapngSHB = 0x0A0D0D0A
+	pcapngIDB = 0x00000001
+	pcapngEPB = 0x00000006
+
+	pcapngByteOrderMagic = 0x1A2B3C4D
+
+	pcapngOptEnd         = 0
+	pcapngOptComment     = 1
+	pcapngOptShbUserAppl = 4
+	pcapngOptIfName      = 2
+	pcapngOptIfTsResol   = 9
+
+	// linkTypeRaw - the packet starts with the IPv4 or IPv6 header
+	linkTypeRaw = 101
+
+	pcapngMaxOptLen = 0xffff
+	pcapngNoIface   = "any"
+)
+
+// pcapngSink - writes the captured packets of the traces as pcapng, one enhanced packet block per trace with the
+// table, chain, handle, verdict and rule in the packet comments. Every input (or output) interface has its own
+// interface block. The traces without the captured packet are skipped.
+//
+//	pcapng:///var/log/nftrace.pcapng - the file is truncated at the start
+//	pcapng:///run/nftrace.fifo       - a named pipe, e.g. read by 'wireshark -k -i /run/nftrace.fifo';
+//	                                   the sink waits for the reader when it is opened
+type pcapngSink struct {
+	mu     sync.Mutex
+	fd     io.WriteCloser
+	bw     *bufio.Writer
+	ifaces map[string]uint32
+	block  []byte
+}
+
+func init() {
+	Register("pcapng", openPcapngSink)
+}
+
+func openPcapngSink(u *url.URL) (Sink, error) {
+	if u.Path == "" {
+		return nil, errors.New("file path is not set")
+	}
+	fd, err := os.OpenFile(u.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s := newPcapngSink(fd)
+	if err = s.writeSectionHeader(); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newPcapngSink(w io.WriteCloser) *pcapngSink {
+	return &pcapngSink{
+		fd:     w,
+		bw:     bufio.NewWriterSize(w, streamBuffLen),
+		ifaces: make(map[string]uint32),
+	}
+}
+
+// Write -
+func (s *pcapngSink) Write(_ context.Context, traces []model.Trace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range traces {
+		t := &traces[i]
+		if len(t.Packet) == 0 {
+			continue
+		}
+		id, err := s.iface(t)
+		if err != nil {
+			return err
+		}
+		if err = s.writePacket(id, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *pcapngSink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.WithStack(s.bw.Flush())
+}
+
+// Close -
+func (s *pcapngSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.bw.Flush()
+	if e := s.fd.Close(); err == nil {
+		err = e
+	}
+	return errors.WithStack(err)
+}
+
+func (s *pcapngSink) writeSectionHeader() error {
+	b := s.beginBlock(pcapngSHB)
+	b = binary.LittleEndian.AppendUint32(b, pcapngByteOrderMagic)
+	b = binary.LittleEndian.AppendUint16(b, 1) // major version
+	b = binary.LittleEndian.AppendUint16(b, 0) // minor version
+	b = binary.LittleEndian.AppendUint64(b, ^uint64(0))
+	b = appendPcapngOpt(b, pcapngOptShbUserAppl, []byte("nftrace"))
+	return s.endBlock(b)
+}
+
+// iface - id of the interface block, the block is written on the first packet of the interface
+func (s *pcapngSink) iface(t *model.Trace) (uint32, error) {
+	name := t.Iifname
+	if name == "" {
+		name = t.Oifname
+	}
+	if name == "" {
+		name = pcapngNoIface
+	}
+	if id, ok := s.ifaces[name]; ok {
+		return id, nil
+	}
+	b := s.beginBlock(pcapngIDB)
+	b = binary.LittleEndian.AppendUint16(b, linkTypeRaw)
+	b = binary.LittleEndian.AppendUint16(b, 0) // reserved
+	b = binary.LittleEndian.AppendUint32(b, 0) // snap length, no limit
+	b = appendPcapngOpt(b, pcapngOptIfName, []byte(name))
+	b = appendPcapngOpt(b, pcapngOptIfTsResol, []byte{9}) // nanoseconds
+	if err := s.endBlock(b); err != nil {
+		return 0, err
+	}
+	id := uint32(len(s.ifaces)) //nolint:gosec
+	s.ifaces[name] = id
+	return id, nil
+}
+
+func (s *pcapngSink) writePacket(iface uint32, t *model.Trace) error {
+	ts := t.FirstSeen
+	if ts.IsZero() {
+		ts = t.Timestamp
+	}
+	nsec := uint64(ts.UnixNano()) //nolint:gosec
+	b := s.beginBlock(pcapngEPB)
+	b = binary.LittleEndian.AppendUint32(b, iface)
+	b = binary.LittleEndian.AppendUint32(b, uint32(nsec>>32))
+	b = binary.LittleEndian.AppendUint32(b, uint32(nsec))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(t.Packet))) //nolint:gosec
+	b = binary.LittleEndian.AppendUint32(b, uint32(packetLen(t)))  //nolint:gosec
+	b = appendPadded(b, t.Packet)
+	for _, c := range packetComments(t) {
+		b = appendPcapngOpt(b, pcapngOptComment, []byte(c))
+	}
+	return s.endBlock(b)
+}
+
+// beginBlock - block type and the place for its length
+func (s *pcapngSink) beginBlock(typ uint32) []byte {
+	b := binary.LittleEndian.AppendUint32(s.block[:0], typ)
+	return append(b, 0, 0, 0, 0)
+}
+
+// endBlock - ends the options, sets the block length in front and at the end, writes the block
+func (s *pcapngSink) endBlock(b []byte) error {
+	b = binary.LittleEndian.AppendUint32(b, pcapngOptEnd)
+	n := uint32(len(b) + 4) //nolint:gosec
+	binary.LittleEndian.PutUint32(b[4:], n)
+	b = binary.LittleEndian.AppendUint32(b, n)
+	s.block = b
+	_, err := s.bw.Write(b)
+	return errors.WithStack(err)
+}
+
+func appendPcapngOpt(b []byte, code uint16, v []byte) []byte {
+	v = v[:min(len(v), pcapngMaxOptLen)]
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(v))) //nolint:gosec
+	return appendPadded(b, v)
+}
+
+// appendPadded - the value padded to 32 bits
+func appendPadded(b, v []byte) []byte {
+	b = append(b, v...)
+	for i := len(v); i%4 != 0; i++ {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// packetLen - original length of the packet from its IP header, the captured length if the header is cut
+func packetLen(t *model.Trace) int {
+	p := t.Packet
+	n := len(p)
+	switch {
+	case len(p) >= 4 && p[0]>>4 == 4:
+		n = int(binary.BigEndian.Uint16(p[2:4]))
+	case len(p) >= 6 && p[0]>>4 == 6:
+		n = int(binary.BigEndian.Uint16(p[4:6])) + 40
+	}
+	return max(n, len(p))
+}
+
+// packetComments - where the packet has been traced and what happened to it
+func packetComments(t *model.Trace) []string {
+	verdict := t.Final
+	if verdict == "" {
+		verdict = t.Verdict
+	}
+	head := fmt.Sprintf("nftrace: %s %s/%s handle=%d verdict=%s trace_id=%#08x",
+		t.Family, t.Table, t.Chain, t.RuleHandle, verdict, t.TrId)
+	if t.JumpTarget != "" {
+		head += " target=" + t.JumpTarget
+	}
+	if t.Incomplete {
+		head += " incomplete"
+	}
+	ret := []string{head}
+	if t.Rule != "" {
+		ret = append(ret, "rule: "+t.Rule)
+	}
+	if len(t.Path) > 1 {
+		ret = append(ret, "path: "+t.PathString())
+	}
+	var ext []string
+	if t.Iifname != "" {
+		ext = append(ext, "iif="+t.Iifname)
+	}
+	if t.Oifname != "" {
+		ext = append(ext, "oif="+t.Oifname)
+	}
+	if t.CtState != "" {
+		ext = append(ext, "ct-state="+t.CtState)
+	}
+	if t.Cnt > 1 {
+		ext = append(ext, "cnt="+strconv.FormatUint(t.Cnt, 10), "bytes="+strconv.FormatUint(t.Bytes, 10),
+			"last_seen="+t.LastSeen.Format(time.RFC3339Nano))
+	}
+	if len(ext) > 0 {
+		ret = append(ret, strings.Join(ext, " "))
+	}
+	return ret
+}
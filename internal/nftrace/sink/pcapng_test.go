@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+type pcapngBlock struct {
+	typ  uint32
+	body []byte
+}
+
+// pcapngOpts - options of the block body from the offset, comments are collected by their code
+func pcapngOpts(t *testing.T, b []byte) map[uint16][]string {
+	ret := map[uint16][]string{}
+	for len(b) >= 4 {
+		code, n := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if code == pcapngOptEnd {
+			return ret
+		}
+		require.GreaterOrEqual(t, len(b), 4+n)
+		ret[code] = append(ret[code], string(b[4:4+n]))
+		b = b[4+(n+3)/4*4:]
+	}
+	t.Fatal("no end of options")
+	return nil
+}
+
+func readPcapng(t *testing.T, path string) (blocks []pcapngBlock) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for len(data) > 0 {
+		require.GreaterOrEqual(t, len(data), 12)
+		n := binary.LittleEndian.Uint32(data[4:])
+		require.Zero(t, n%4)
+		require.GreaterOrEqual(t, len(data), int(n))
+		require.Equal(t, n, binary.LittleEndian.Uint32(data[n-4:]))
+		blocks = append(blocks, pcapngBlock{typ: binary.LittleEndian.Uint32(data), body: data[8 : n-4]})
+		data = data[n:]
+	}
+	return blocks
+}
+
+func Test_PcapngSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.pcapng")
+	s, err := Open("pcapng://" + path)
+	require.NoError(t, err)
+
+	ipv4 := []byte{0x45, 0, 0, 60, 0, 0, 0, 0, 64, 6, 0, 0, 10, 0, 0, 1, 10, 0, 0, 2, 0x9c, 0x40, 0, 22}
+	ipv6 := make([]byte, 41)
+	ipv6[0], ipv6[5], ipv6[6] = 6<<4, 20, 6
+	ts := time.Unix(1700000000, 123456789)
+	require.NoError(t, s.Write(context.Background(), []model.Trace{
+		{TrId: 1, Family: "inet", Table: "filter", Chain: "input", RuleHandle: 7, Verdict: "drop", Final: "drop",
+			Rule: "tcp dport 22 drop", Iifname: "eth0", Packet: ipv4, FirstSeen: ts},
+		{TrId: 2, Table: "filter", Iifname: "eth0"}, // nothing captured
+		{TrId: 3, Family: "ip6", Table: "filter", Chain: "output", Verdict: "accept", Oifname: "eth1",
+			Packet: ipv6, Timestamp: ts, Cnt: 3, Bytes: 180},
+	}))
+	require.NoError(t, s.Close())
+
+	blocks := readPcapng(t, path)
+	var types []uint32
+	for _, b := range blocks {
+		types = append(types, b.typ)
+	}
+	require.Equal(t, []uint32{pcapngSHB, pcapngIDB, pcapngEPB, pcapngIDB, pcapngEPB}, types)
+	require.Equal(t, uint32(pcapngByteOrderMagic), binary.LittleEndian.Uint32(blocks[0].body))
+
+	idb := blocks[3].body
+	require.Equal(t, uint16(linkTypeRaw), binary.LittleEndian.Uint16(idb))
+	require.Equal(t, []string{"eth1"}, pcapngOpts(t, idb[8:])[pcapngOptIfName])
+
+	epb := blocks[2].body
+	require.Equal(t, uint32(0), binary.LittleEndian.Uint32(epb))
+	nsec := uint64(binary.LittleEndian.Uint32(epb[4:]))<<32 | uint64(binary.LittleEndian.Uint32(epb[8:]))
+	require.Equal(t, uint64(ts.UnixNano()), nsec) //nolint:gosec
+	require.Equal(t, uint32(len(ipv4)), binary.LittleEndian.Uint32(epb[12:]))
+	require.Equal(t, uint32(60), binary.LittleEndian.Uint32(epb[16:]))
+	require.Equal(t, ipv4, epb[20:20+len(ipv4)])
+	require.Equal(t, []string{
+		"nftrace: inet filter/input handle=7 verdict=drop trace_id=0x00000001",
+		"rule: tcp dport 22 drop",
+		"iif=eth0",
+	}, pcapngOpts(t, epb[20+len(ipv4):])[pcapngOptComment])
+
+	epb = blocks[4].body
+	require.Equal(t, uint32(1), binary.LittleEndian.Uint32(epb))
+	require.Equal(t, uint32(60), binary.LittleEndian.Uint32(epb[16:]))
+	comments := pcapngOpts(t, epb[20+(len(ipv6)+3)/4*4:])[pcapngOptComment]
+	require.Len(t, comments, 2)
+	require.Contains(t, comments[1], "oif=eth1 cnt=3 bytes=180")
+}
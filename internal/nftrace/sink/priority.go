@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"net/url"
+	"strings"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// priorityMap - syslog facility and severity of the trace by its verdict. It's taken from the URL query:
+	// facility=local0&severity=drop:warning,accept:info,notice - a value without the verdict is the default one
+	priorityMap struct {
+		facility verdictMap
+		severity verdictMap
+	}
+
+	verdictMap struct {
+		def       int
+		byVerdict map[string]int
+	}
+)
+
+var (
+	facilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+		"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+	severities = map[string]int{
+		"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+	}
+)
+
+const (
+	defFacility = 16 // local0
+	defSeverity = 6  // info
+	sevWarning  = 4
+)
+
+func parsePriorityMap(q url.Values) (p priorityMap, err error) {
+	p.facility = verdictMap{def: defFacility}
+	p.severity = verdictMap{def: defSeverity, byVerdict: map[string]int{"drop": sevWarning}}
+	if err = p.facility.parse(q.Get("facility"), facilities); err != nil {
+		return p, errors.WithMessage(err, "invalid facility")
+	}
+	err = p.severity.parse(q.Get("severity"), severities)
+	return p, errors.WithMessage(err, "invalid severity")
+}
+
+// parse - 'verdict:name,...,name', the listed verdicts replace the defaults
+func (m *verdictMap) parse(s string, names map[string]int) error {
+	if s == "" {
+		return nil
+	}
+	m.byVerdict = make(map[string]int)
+	for _, item := range strings.Split(s, ",") {
+		verdict, name, found := strings.Cut(strings.TrimSpace(item), ":")
+		if !found {
+			verdict, name = "", verdict
+		}
+		v, ok := names[strings.ToLower(name)]
+		if !ok {
+			return errors.Errorf("unknown name '%s'", name)
+		}
+		if verdict == "" {
+			m.def = v
+		} else {
+			m.byVerdict[strings.ToLower(verdict)] = v
+		}
+	}
+	return nil
+}
+
+func (m verdictMap) get(verdict string) int {
+	if v, ok := m.byVerdict[verdict]; ok {
+		return v
+	}
+	return m.def
+}
+
+// get - facility and severity by the final verdict of the trace, by the rule verdict if the path is incomplete
+func (p priorityMap) get(t *model.Trace) (facility, severity int) {
+	verdict := t.Final
+	if verdict == "" {
+		verdict = t.Verdict
+	}
+	verdict = strings.ToLower(verdict)
+	return p.facility.get(verdict), p.severity.get(verdict)
+}
@@ -0,0 +1,283 @@
+package sink
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	identity "github.com/H-BF/corlib/app/identity"
+)
+
+const (
+	siemVendor         = "netfilter"
+	siemProduct        = "nftables"
+	leefTimeFormat     = "yyyy-MM-dd'T'HH:mm:ss.SSSZ"
+	leefTimeLayout     = "2006-01-02T15:04:05.000-0700"
+	defSiemVersion     = "dev"
+	cefIPv6SrcLabel    = "Source IPv6 Address"
+	cefIPv6DstLabel    = "Destination IPv6 Address"
+	cefRuleHandleLabel = "Rule Handle"
+	cefTraceIdLabel    = "Trace ID"
+)
+
+// cefSeverities - CEF severity 0..10 of the syslog one
+var cefSeverities = [...]int{10, 9, 8, 7, 6, 4, 2, 0}
+
+type (
+	// cefFormatter - ArcSight Common Event Format:
+	//
+	//	CEF:0|netfilter|nftables|<version>|<verdict>|<table>/<chain> <verdict>|<severity>|<extension>
+	//
+	// the extension holds: rt, src/dst or c6a2/c6a3 for IPv6, spt, dpt, proto, smac, dmac, deviceInboundInterface,
+	// deviceOutboundInterface, act, cnt, in (bytes), start, end, dvchost, cs1 table, cs2 chain, cs3 rule,
+	// cs4 path, cs5 family, cn1 rule handle and cn2 trace id. The severity is of the 'severity' parameter
+	// (see priorityMap): emerg - 10 ... warning - 6 (drop by default), notice - 4, info - 2, debug - 0
+	cefFormatter struct {
+		prio    priorityMap
+		version string
+		host    string
+	}
+
+	// leefFormatter - IBM QRadar Log Event Extended Format 2.0 with the tab delimiter:
+	//
+	//	LEEF:2.0|netfilter|nftables|<version>|<verdict>|x09|<attributes>
+	//
+	// the attributes are: devTime, devTimeFormat, cat (verdict), sev 1..10 (the same as CEF), src, dst, srcPort,
+	// dstPort, proto, srcMAC, dstMAC, totalPackets, and the custom ones: bytes, iif, oif, action, final, table,
+	// chain, ruleHandle, rule, path, family, traceId, identHostName
+	leefFormatter struct {
+		prio    priorityMap
+		version string
+		host    string
+	}
+)
+
+func init() {
+	RegisterFormat("cef", func(q url.Values) (Formatter, error) {
+		prio, err := parsePriorityMap(q)
+		if err != nil {
+			return nil, err
+		}
+		host, _ := os.Hostname()
+		return &cefFormatter{prio: prio, version: siemVersion(), host: host}, nil
+	})
+	RegisterFormat("leef", func(q url.Values) (Formatter, error) {
+		prio, err := parsePriorityMap(q)
+		if err != nil {
+			return nil, err
+		}
+		host, _ := os.Hostname()
+		return &leefFormatter{prio: prio, version: siemVersion(), host: host}, nil
+	})
+}
+
+func siemVersion() string {
+	if identity.Version != "" {
+		return identity.Version
+	}
+	return defSiemVersion
+}
+
+// siemSeverity - CEF severity of the trace
+func siemSeverity(p priorityMap, t *model.Trace) int {
+	_, severity := p.get(t)
+	return cefSeverities[severity]
+}
+
+// siemVerdict - the final verdict, the rule one if the path is incomplete
+func siemVerdict(t *model.Trace) string {
+	if t.Final != "" {
+		return t.Final
+	}
+	return t.Verdict
+}
+
+// Format -
+func (f *cefFormatter) Format(dst []byte, t *model.Trace) ([]byte, error) {
+	verdict := siemVerdict(t)
+	dst = append(dst, "CEF:0|"...)
+	for _, h := range []string{siemVendor, siemProduct, f.version, verdict, t.Table + "/" + t.Chain + " " + verdict} {
+		dst = appendCefHeader(dst, h)
+		dst = append(dst, '|')
+	}
+	dst = strconv.AppendInt(dst, int64(siemSeverity(f.prio, t)), 10)
+	dst = append(dst, '|')
+
+	first := true
+	add := func(k, v string) {
+		if v == "" {
+			return
+		}
+		if !first {
+			dst = append(dst, ' ')
+		}
+		first = false
+		dst = append(dst, k...)
+		dst = append(dst, '=')
+		dst = appendCefValue(dst, v)
+	}
+	num := func(k string, v uint64) {
+		if v != 0 {
+			add(k, strconv.FormatUint(v, 10))
+		}
+	}
+	ms := func(k string, ts time.Time) {
+		if !ts.IsZero() {
+			add(k, strconv.FormatInt(ts.UnixMilli(), 10))
+		}
+	}
+	ms("rt", t.Timestamp)
+	if t.SAddr.Is6() && !t.SAddr.Is4In6() {
+		add("c6a2", t.SAddr.String())
+		add("c6a2Label", cefIPv6SrcLabel)
+	} else {
+		add("src", model.AddrString(t.SAddr))
+	}
+	if t.DAddr.Is6() && !t.DAddr.Is4In6() {
+		add("c6a3", t.DAddr.String())
+		add("c6a3Label", cefIPv6DstLabel)
+	} else {
+		add("dst", model.AddrString(t.DAddr))
+	}
+	num("spt", uint64(t.SPort))
+	num("dpt", uint64(t.DPort))
+	add("proto", strings.ToUpper(t.IpProto))
+	add("smac", t.SMacAddr.String())
+	add("dmac", t.DMacAddr.String())
+	add("deviceInboundInterface", t.Iifname)
+	add("deviceOutboundInterface", t.Oifname)
+	add("act", verdict)
+	num("cnt", t.Cnt)
+	num("in", t.Bytes)
+	ms("start", t.FirstSeen)
+	ms("end", t.LastSeen)
+	add("dvchost", f.host)
+	add("cs1Label", "Table")
+	add("cs1", t.Table)
+	add("cs2Label", "Chain")
+	add("cs2", t.Chain)
+	if t.Rule != "" {
+		add("cs3Label", "Rule")
+		add("cs3", t.Rule)
+	}
+	if len(t.Path) > 0 {
+		add("cs4Label", "Path")
+		add("cs4", t.PathString())
+	}
+	add("cs5Label", "Family")
+	add("cs5", t.Family)
+	if t.RuleHandle != 0 {
+		add("cn1Label", cefRuleHandleLabel)
+		num("cn1", t.RuleHandle)
+	}
+	add("cn2Label", cefTraceIdLabel)
+	add("cn2", strconv.FormatUint(uint64(t.TrId), 10))
+	return dst, nil
+}
+
+// appendCefHeader - '|' and '\' are escaped, the line breaks are replaced by the space
+func appendCefHeader(dst []byte, v string) []byte {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '|', '\\':
+			dst = append(dst, '\\', c)
+		case '\r', '\n':
+			dst = append(dst, ' ')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// appendCefValue - '=' and '\' are escaped, the line breaks are '\n' and '\r'
+func appendCefValue(dst []byte, v string) []byte {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '=', '\\':
+			dst = append(dst, '\\', c)
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// Format -
+func (f *leefFormatter) Format(dst []byte, t *model.Trace) ([]byte, error) {
+	verdict := siemVerdict(t)
+	dst = append(dst, "LEEF:2.0|"...)
+	for _, h := range []string{siemVendor, siemProduct, f.version, verdict} {
+		dst = appendLeefValue(dst, strings.ReplaceAll(h, "|", " "))
+		dst = append(dst, '|')
+	}
+	dst = append(dst, "x09|"...)
+
+	first := true
+	add := func(k, v string) {
+		if v == "" {
+			return
+		}
+		if !first {
+			dst = append(dst, '\t')
+		}
+		first = false
+		dst = append(dst, k...)
+		dst = append(dst, '=')
+		dst = appendLeefValue(dst, v)
+	}
+	num := func(k string, v uint64) {
+		if v != 0 {
+			add(k, strconv.FormatUint(v, 10))
+		}
+	}
+	if !t.Timestamp.IsZero() {
+		add("devTime", t.Timestamp.Format(leefTimeLayout))
+		add("devTimeFormat", leefTimeFormat)
+	}
+	add("cat", verdict)
+	add("sev", strconv.Itoa(max(siemSeverity(f.prio, t), 1)))
+	add("src", model.AddrString(t.SAddr))
+	add("dst", model.AddrString(t.DAddr))
+	num("srcPort", uint64(t.SPort))
+	num("dstPort", uint64(t.DPort))
+	add("proto", strings.ToUpper(t.IpProto))
+	add("srcMAC", t.SMacAddr.String())
+	add("dstMAC", t.DMacAddr.String())
+	num("totalPackets", t.Cnt)
+	num("bytes", t.Bytes)
+	add("iif", t.Iifname)
+	add("oif", t.Oifname)
+	add("action", t.Verdict)
+	add("final", t.Final)
+	add("table", t.Table)
+	add("chain", t.Chain)
+	num("ruleHandle", t.RuleHandle)
+	add("rule", t.Rule)
+	add("path", t.PathString())
+	add("family", t.Family)
+	add("traceId", strconv.FormatUint(uint64(t.TrId), 10))
+	add("identHostName", f.host)
+	return dst, nil
+}
+
+// appendLeefValue - the tab delimiter and the line breaks are replaced by the space
+func appendLeefValue(dst []byte, v string) []byte {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '\t', '\r', '\n':
+			dst = append(dst, ' ')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CefFormat(t *testing.T) {
+	ipv6 := syslogTestTrace
+	ipv6.SAddr, ipv6.DAddr = netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::2")
+	ipv6.Table, ipv6.Final, ipv6.Verdict = "fw|6", "accept", "accept"
+	ipv6.Rule = "meta l4proto tcp counter \\ comment \"x=1\nline\""
+	ipv6.Iifname, ipv6.RuleHandle = "eth0", 4
+
+	testCases := []struct {
+		name  string
+		query string
+		trace model.Trace
+		exp   string
+		ext   []string
+	}{
+		{
+			name:  "ipv4 drop",
+			trace: syslogTestTrace,
+			exp:   "CEF:0|netfilter|nftables|dev|drop|filter/input drop|6|",
+			ext: []string{
+				"rt=1714558830123", "src=10.0.0.1", "dst=10.0.0.2", "spt=1234", "dpt=80", "proto=TCP", "act=drop", "cnt=1",
+				"cs1Label=Table", "cs1=filter", "cs2=input", `cs3=tcp dport 80 meta mark set 0x1 comment "a]b"`,
+				"cs5=ip", "cn2Label=Trace ID", "cn2=7",
+			},
+		},
+		{
+			name:  "ipv6 accept",
+			trace: ipv6,
+			exp:   `CEF:0|netfilter|nftables|dev|accept|fw\|6/input accept|2|`,
+			ext: []string{
+				"c6a2=2001:db8::1", "c6a2Label=Source IPv6 Address", "c6a3=2001:db8::2",
+				`cs1=fw|6`, `cs3=meta l4proto tcp counter \\ comment "x\=1\nline"`,
+				"deviceInboundInterface=eth0", "cn1Label=Rule Handle", "cn1=4",
+			},
+		},
+		{
+			name:  "custom severity",
+			query: "severity=drop:crit",
+			trace: syslogTestTrace,
+			exp:   "CEF:0|netfilter|nftables|dev|drop|filter/input drop|8|",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+			f, err := NewFormatter("cef", q)
+			require.NoError(t, err)
+			b, err := f.Format(nil, &tc.trace)
+			require.NoError(t, err)
+			line := string(b)
+			require.True(t, strings.HasPrefix(line, tc.exp), line)
+			require.NotContains(t, line, "\n")
+			ext := " " + strings.TrimPrefix(line, tc.exp) + " "
+			for _, e := range tc.ext {
+				require.Contains(t, ext, " "+e+" ")
+			}
+		})
+	}
+	_, err := NewFormatter("cef", url.Values{"severity": {"drop:loud"}})
+	require.Error(t, err)
+}
+
+func Test_LeefFormat(t *testing.T) {
+	tr := syslogTestTrace
+	tr.Rule = "ip saddr 10.0.0.1\tdrop"
+	f, err := NewFormatter("leef", nil)
+	require.NoError(t, err)
+	b, err := f.Format(nil, &tr)
+	require.NoError(t, err)
+	line := string(b)
+	const hdr = "LEEF:2.0|netfilter|nftables|dev|drop|x09|"
+	require.True(t, strings.HasPrefix(line, hdr), line)
+	attrs := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimPrefix(line, hdr), "\t") {
+		k, v, ok := strings.Cut(kv, "=")
+		require.True(t, ok, kv)
+		attrs[k] = v
+	}
+	require.Equal(t, "2024-05-01T10:20:30.123+0000", attrs["devTime"])
+	require.Equal(t, leefTimeFormat, attrs["devTimeFormat"])
+	require.Equal(t, "drop", attrs["cat"])
+	require.Equal(t, "6", attrs["sev"])
+	require.Equal(t, "10.0.0.1", attrs["src"])
+	require.Equal(t, "80", attrs["dstPort"])
+	require.Equal(t, "TCP", attrs["proto"])
+	require.Equal(t, "filter", attrs["table"])
+	require.Equal(t, "ip saddr 10.0.0.1 drop", attrs["rule"])
+	require.Equal(t, "7", attrs["traceId"])
+
+	debug, err := NewFormatter("leef", url.Values{"severity": {"debug"}})
+	require.NoError(t, err)
+	tr.Final, tr.Verdict = "accept", "accept"
+	b, err = debug.Format(nil, &tr)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "\tsev=1\t", "the LEEF severity is 1..10")
+}
@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Sink - output of the traces
+	Sink interface {
+		// Write - writes the traces, the sink may buffer them until Flush
+		Write(ctx context.Context, traces []model.Trace) error
+		// Flush - writes out the buffered traces
+		Flush(ctx context.Context) error
+		Close() error
+	}
+
+	// Factory - creates the sink from its URL
+	Factory func(u *url.URL) (Sink, error)
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register - makes the sink available by the URL scheme
+func Register(scheme string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	scheme = strings.ToLower(scheme)
+	if _, dup := registry[scheme]; dup {
+		panic(errors.Errorf("sink '%s' is registered twice", scheme))
+	}
+	registry[scheme] = f
+}
+
+// Schemes - URL schemes of the registered sinks
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ret := make([]string, 0, len(registry))
+	for s := range registry {
+		ret = append(ret, s)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Open - creates the sink selected by the URL scheme, e.g. 'stdout://' or 'file:///var/log/nftrace.ndjson'
+func Open(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid sink URL '%s'", rawURL)
+	}
+	registryMu.RLock()
+	f, ok := registry[strings.ToLower(u.Scheme)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown sink '%s', expected one of: %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	s, err := f(u)
+	return s, errors.WithMessagef(err, "failed to open sink '%s'", rawURL)
+}
+
+// Name - name of the sink in metrics and logs: the 'name' query parameter or the URL scheme
+func Name(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if n := u.Query().Get("name"); n != "" {
+		return n
+	}
+	return strings.ToLower(u.Scheme)
+}
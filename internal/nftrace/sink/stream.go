@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const streamBuffLen = 64 << 10
+
+// streamSink - writes one formatted trace per line into the writer
+type streamSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	bw     *bufio.Writer
+	f      Formatter
+	line   []byte
+	closer io.Closer
+}
+
+func init() {
+	Register("stdout", func(u *url.URL) (Sink, error) {
+		q := u.Query()
+		if q.Get("color") == "" {
+			q.Set("color", strconv.FormatBool(isTerminal(os.Stdout)))
+		}
+		f, err := formatterFromQuery(q, "json")
+		if err != nil {
+			return nil, err
+		}
+		return newStreamSink(os.Stdout, f, nil), nil
+	})
+}
+
+func newStreamSink(w io.Writer, f Formatter, closer io.Closer) *streamSink {
+	return &streamSink{
+		w:      w,
+		bw:     bufio.NewWriterSize(w, streamBuffLen),
+		f:      f,
+		closer: closer,
+	}
+}
+
+// Write -
+func (s *streamSink) Write(_ context.Context, traces []model.Trace) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range traces {
+		if s.line, err = s.f.Format(s.line[:0], &traces[i]); err != nil {
+			return errors.WithMessage(err, "failed to format trace")
+		}
+		s.line = append(s.line, '\n')
+		if _, err = s.bw.Write(s.line); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *streamSink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.WithStack(s.bw.Flush())
+}
+
+// Close -
+func (s *streamSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.bw.Flush()
+	if s.closer != nil {
+		if e := s.closer.Close(); err == nil {
+			err = e
+		}
+	}
+	return errors.WithStack(err)
+}
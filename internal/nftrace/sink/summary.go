@@ -0,0 +1,286 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefSummaryInterval - default window of the summary
+	DefSummaryInterval = 10 * time.Second
+
+	// DefSummaryTop - default number of the groups in the summary table
+	DefSummaryTop = 10
+
+	// DefSummaryBy - default fields the traces are grouped by
+	DefSummaryBy = "rule,verdict"
+
+	summaryMaxColumn  = 60
+	summaryTimeLayout = "2006-01-02T15:04:05Z07:00"
+)
+
+// summaryColumns - columns of the group fields in the table order
+var summaryColumns = []struct {
+	key   model.AggKey
+	title string
+	value func(t *model.Trace) string
+}{
+	{model.AggTuple, "TUPLE", func(t *model.Trace) string {
+		return fmt.Sprintf("%s %s -> %s", t.IpProto, summaryHostPort(t.SAddr, t.SPort), summaryHostPort(t.DAddr, t.DPort))
+	}},
+	{model.AggChain, "CHAIN", func(t *model.Trace) string { return t.Family + " " + t.Table + "/" + t.Chain }},
+	{model.AggRule, "RULE", func(t *model.Trace) string {
+		s := t.Family + " " + t.Table + "/" + t.Chain
+		if t.RuleHandle != 0 {
+			s += "#" + strconv.FormatUint(t.RuleHandle, 10)
+		}
+		if t.Rule != "" {
+			s += " " + t.Rule
+		}
+		return s
+	}},
+	{model.AggVerdict, "VERDICT", func(t *model.Trace) string {
+		if t.Final != "" {
+			return t.Final
+		}
+		return t.Verdict
+	}},
+	{model.AggIif, "IIF", func(t *model.Trace) string { return t.Iifname }},
+	{model.AggOif, "OIF", func(t *model.Trace) string { return t.Oifname }},
+	{model.AggPath, "PATH", func(t *model.Trace) string { return t.PathString() }},
+}
+
+// summarySink - the traces are counted by the group over the interval and the table of the top groups
+// is printed once the interval is over (checked on Flush) and on Close:
+//
+//	summary://?interval=10s&top=10&by=rule,verdict&out=stdout
+//
+// by - the group fields: tuple, chain, rule, verdict, iif, oif, path; top - number of the groups in the table,
+// 0 - all of them; out - stdout or stderr. The groups are sorted by packets, bytes and the fields, so the table
+// of the same traces is the same; the groups out of the top are summed up in the 'other' row
+type summarySink struct {
+	mu       sync.Mutex
+	w        io.Writer
+	interval time.Duration
+	top      int
+	columns  []int // indexes in summaryColumns
+	now      func() time.Time
+	start    time.Time
+	groups   map[string]*summaryGroup
+}
+
+type summaryGroup struct {
+	fields  []string
+	packets uint64
+	bytes   uint64
+}
+
+func init() {
+	Register("summary", openSummarySink)
+}
+
+func openSummarySink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &summarySink{
+		w:        os.Stdout,
+		interval: DefSummaryInterval,
+		top:      DefSummaryTop,
+		now:      time.Now,
+		groups:   make(map[string]*summaryGroup),
+	}
+	if v := q.Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("invalid interval '%s'", v)
+		}
+		s.interval = d
+	}
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid top '%s'", v)
+		}
+		s.top = n
+	}
+	by := q.Get("by")
+	if by == "" {
+		by = DefSummaryBy
+	}
+	key, err := model.ParseAggKey(by)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range summaryColumns {
+		if key&c.key != 0 {
+			s.columns = append(s.columns, i)
+		}
+	}
+	switch out := strings.ToLower(q.Get("out")); out {
+	case "", "stdout":
+	case "stderr":
+		s.w = os.Stderr
+	default:
+		return nil, errors.Errorf("invalid out '%s', expected one of: stdout, stderr", out)
+	}
+	s.start = s.now()
+	return s, nil
+}
+
+// Write -
+func (s *summarySink) Write(_ context.Context, traces []model.Trace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := make([]string, len(s.columns))
+	for i := range traces {
+		t := &traces[i]
+		for j, c := range s.columns {
+			fields[j] = summaryColumns[c].value(t)
+		}
+		key := strings.Join(fields, "\x00")
+		g := s.groups[key]
+		if g == nil {
+			g = &summaryGroup{fields: append([]string(nil), fields...)}
+			s.groups[key] = g
+		}
+		packets, bytes := t.Cnt, t.Bytes
+		if packets == 0 {
+			packets = 1
+		}
+		if bytes == 0 {
+			bytes = packets * uint64(t.Length)
+		}
+		g.packets += packets
+		g.bytes += bytes
+	}
+	return nil
+}
+
+// Flush - prints the table if the interval is over
+func (s *summarySink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); now.Sub(s.start) >= s.interval {
+		return s.print(now)
+	}
+	return nil
+}
+
+// Close - prints the table of the last window
+func (s *summarySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.print(s.now())
+}
+
+// print - the table of the window up to the time, the next window starts
+func (s *summarySink) print(end time.Time) error {
+	start := s.start
+	s.start = end
+	if len(s.groups) == 0 {
+		return nil
+	}
+	groups := make([]*summaryGroup, 0, len(s.groups))
+	var total summaryGroup
+	for _, g := range s.groups {
+		groups = append(groups, g)
+		total.packets += g.packets
+		total.bytes += g.bytes
+	}
+	clear(s.groups)
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.packets != b.packets {
+			return a.packets > b.packets
+		}
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		for k := range a.fields {
+			if a.fields[k] != b.fields[k] {
+				return a.fields[k] < b.fields[k]
+			}
+		}
+		return false
+	})
+
+	fmt.Fprintf(s.w, "--- nftrace summary %s .. %s (%s) ---\n", //nolint:errcheck
+		start.Format(summaryTimeLayout), end.Format(summaryTimeLayout), end.Sub(start).Round(time.Millisecond))
+	tw := tabwriter.NewWriter(s.w, 0, 0, 2, ' ', 0)
+	header := []string{"#"}
+	for _, c := range s.columns {
+		header = append(header, summaryColumns[c].title)
+	}
+	header = append(header, "PACKETS", "BYTES", "SHARE")
+	summaryRow(tw, header)
+	row := func(rank string, fields []string, g *summaryGroup) {
+		r := append([]string{rank}, fields...)
+		share := float64(g.packets) * 100 / float64(total.packets)
+		r = append(r, strconv.FormatUint(g.packets, 10), strconv.FormatUint(g.bytes, 10), strconv.FormatFloat(share, 'f', 1, 64)+"%")
+		summaryRow(tw, r)
+	}
+	shown, other := groups, summaryGroup{}
+	if s.top > 0 && len(groups) > s.top {
+		shown = groups[:s.top]
+		for _, g := range groups[s.top:] {
+			other.packets += g.packets
+			other.bytes += g.bytes
+		}
+	}
+	for i, g := range shown {
+		fields := make([]string, len(g.fields))
+		for k, f := range g.fields {
+			fields[k] = summaryTrunc(f)
+		}
+		row(strconv.Itoa(i+1), fields, g)
+	}
+	label := func(l string) []string {
+		ret := make([]string, max(len(s.columns), 1))
+		ret[0] = l
+		return ret
+	}
+	if len(shown) < len(groups) {
+		row("", label(fmt.Sprintf("other (%d groups)", len(groups)-len(shown))), &other)
+	}
+	row("", label(fmt.Sprintf("total (%d groups)", len(groups))), &total)
+	return errors.WithStack(tw.Flush())
+}
+
+func summaryRow(w io.Writer, cells []string) {
+	fmt.Fprintln(w, strings.Join(cells, "\t")) //nolint:errcheck
+}
+
+func summaryTrunc(s string) string {
+	if utf8.RuneCountInString(s) <= summaryMaxColumn {
+		return s
+	}
+	return string([]rune(s)[:summaryMaxColumn-1]) + "…"
+}
+
+func summaryHostPort(a netip.Addr, port uint32) string {
+	host := "*"
+	if a.IsValid() {
+		host = a.String()
+	}
+	if port == 0 {
+		return host
+	}
+	if a.Is6() && !a.Is4In6() {
+		host = "[" + host + "]"
+	}
+	return host + ":" + strconv.FormatUint(uint64(port), 10)
+}
@@ -0,0 +1,94 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func openTestSummary(t *testing.T, query string, now *time.Time) (*summarySink, *bytes.Buffer) {
+	u, err := url.Parse("summary://?" + query)
+	require.NoError(t, err)
+	s, err := openSummarySink(u)
+	require.NoError(t, err)
+	ss := s.(*summarySink)
+	var buf bytes.Buffer
+	ss.w, ss.now, ss.start = &buf, func() time.Time { return *now }, *now
+	return ss, &buf
+}
+
+func Test_SummarySink(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)
+	s, buf := openTestSummary(t, "interval=10s&top=2", &now)
+
+	accepted := syslogTestTrace
+	accepted.Final, accepted.Verdict, accepted.RuleHandle, accepted.Rule = "accept", "accept", 3, "tcp dport 22 accept"
+	accepted.Cnt, accepted.Length = 0, 60
+	masq := accepted
+	masq.Table, masq.Chain, masq.RuleHandle, masq.Rule, masq.Bytes = "nat", "postrouting", 9, "masquerade", 1000
+	// the order of arrival doesn't change the table
+	traces := []model.Trace{accepted, syslogTestTrace, masq, syslogTestTrace, accepted, syslogTestTrace}
+	for _, tr := range traces {
+		require.NoError(t, s.Write(ctx, []model.Trace{tr}))
+	}
+	now = now.Add(5 * time.Second)
+	require.NoError(t, s.Flush(ctx))
+	require.Zero(t, buf.Len(), "the window isn't over")
+
+	now = now.Add(5 * time.Second)
+	require.NoError(t, s.Flush(ctx))
+	exp := `--- nftrace summary 2024-05-01T10:20:30Z .. 2024-05-01T10:20:40Z (10s) ---
+#  RULE                                                          VERDICT  PACKETS  BYTES  SHARE
+1  ip filter/input tcp dport 80 meta mark set 0x1 comment "a]b"  drop     3        0      50.0%
+2  ip filter/input#3 tcp dport 22 accept                         accept   2        120    33.3%
+   other (1 groups)                                                       1        1000   16.7%
+   total (3 groups)                                                       6        1120   100.0%
+`
+	require.Equal(t, exp, buf.String())
+
+	buf.Reset()
+	now = now.Add(time.Minute)
+	require.NoError(t, s.Flush(ctx))
+	require.Zero(t, buf.Len(), "the window is empty")
+
+	for i := len(traces) - 1; i >= 0; i-- {
+		require.NoError(t, s.Write(ctx, traces[i:i+1]))
+	}
+	now = now.Add(time.Second)
+	require.NoError(t, s.Close())
+	exp = strings.Replace(exp, "10:20:30Z .. 2024-05-01T10:20:40Z (10s)", "10:21:40Z .. 2024-05-01T10:21:41Z (1s)", 1)
+	require.Equal(t, exp, buf.String())
+}
+
+func Test_SummarySinkBy(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)
+	s, buf := openTestSummary(t, "by=tuple,verdict&top=0", &now)
+	reply := syslogTestTrace
+	reply.SAddr, reply.DAddr, reply.SPort, reply.DPort = syslogTestTrace.DAddr, syslogTestTrace.SAddr, 80, 1234
+	v6 := syslogTestTrace
+	v6.SAddr, v6.DAddr, v6.Cnt = netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::2"), 5
+	require.NoError(t, s.Write(context.Background(), []model.Trace{syslogTestTrace, reply, v6}))
+	require.NoError(t, s.Close())
+	require.Equal(t, `--- nftrace summary 2024-05-01T10:20:30Z .. 2024-05-01T10:20:30Z (0s) ---
+#  TUPLE                                       VERDICT  PACKETS  BYTES  SHARE
+1  tcp [2001:db8::1]:1234 -> [2001:db8::2]:80  drop     5        0      71.4%
+2  tcp 10.0.0.1:1234 -> 10.0.0.2:80            drop     1        0      14.3%
+3  tcp 10.0.0.2:80 -> 10.0.0.1:1234            drop     1        0      14.3%
+   total (3 groups)                                     7        0      100.0%
+`, buf.String())
+}
+
+func Test_SummaryTrunc(t *testing.T) {
+	require.Equal(t, "short", summaryTrunc("short"))
+	long := strings.Repeat("ab", summaryMaxColumn)
+	require.Equal(t, long[:summaryMaxColumn-1]+"…", summaryTrunc(long))
+}
@@ -0,0 +1,243 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defSyslogSocket     = "/dev/log"
+	defSyslogPort       = "514"
+	defSyslogAppName    = "nftrace"
+	defSyslogEnterprise = "32473"
+	syslogMsgId         = "trace"
+	syslogDialTimeout   = 5 * time.Second
+	syslogTimeLayout    = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// syslogSink - RFC 5424 messages with the trace fields in the structured data element 'nftrace@<enterprise>':
+//
+//	syslog:///dev/log - unix datagram socket, the default one
+//	syslog://host:514?proto=udp - UDP, the default protocol for a host
+//	syslog://host:6514?proto=tcp - TCP with octet counting framing (RFC 6587)
+//
+// the query also takes: app-name, enterprise, facility, severity (see priorityMap) and format of the message text
+type syslogSink struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn
+	bw       *bufio.Writer
+	f        Formatter
+	prio     priorityMap
+	header   string // ' HOSTNAME APP-NAME PROCID MSGID '
+	sdId     string
+	msg, buf []byte
+}
+
+func init() {
+	Register("syslog", openSyslogSink)
+}
+
+func openSyslogSink(u *url.URL) (Sink, error) {
+	q := u.Query()
+	s := &syslogSink{network: strings.ToLower(q.Get("proto"))}
+	switch {
+	case u.Host == "":
+		if s.network != "" && s.network != "unixgram" {
+			return nil, errors.Errorf("protocol '%s' needs a host", s.network)
+		}
+		s.network, s.addr = "unixgram", u.Path
+		if s.addr == "" {
+			s.addr = defSyslogSocket
+		}
+	case s.network == "" || s.network == "udp" || s.network == "tcp":
+		if s.network == "" {
+			s.network = "udp"
+		}
+		s.addr = u.Host
+		if u.Port() == "" {
+			s.addr = net.JoinHostPort(u.Hostname(), defSyslogPort)
+		}
+	default:
+		return nil, errors.Errorf("unknown protocol '%s', expected one of: unixgram, udp, tcp", s.network)
+	}
+	var err error
+	if s.f, err = formatterFromURL(u, "text"); err != nil {
+		return nil, err
+	}
+	if s.prio, err = parsePriorityMap(q); err != nil {
+		return nil, err
+	}
+	appName := q.Get("app-name")
+	if appName == "" {
+		appName = defSyslogAppName
+	}
+	enterprise := q.Get("enterprise")
+	if enterprise == "" {
+		enterprise = defSyslogEnterprise
+	}
+	if _, err = strconv.ParseUint(enterprise, 10, 32); err != nil {
+		return nil, errors.Errorf("invalid enterprise number '%s'", enterprise)
+	}
+	s.sdId = "nftrace@" + enterprise
+	hostname, _ := os.Hostname()
+	s.header = " " + syslogHeaderField(hostname, 255) + " " + syslogHeaderField(appName, 48) +
+		" " + strconv.Itoa(os.Getpid()) + " " + syslogMsgId + " "
+	return s, nil
+}
+
+// Write - one message per datagram, the messages are buffered until Flush for TCP
+func (s *syslogSink) Write(ctx context.Context, traces []model.Trace) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = s.connect(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.disconnect()
+		}
+	}()
+	for i := range traces {
+		if s.buf, err = s.format(s.buf[:0], &traces[i]); err != nil {
+			return err
+		}
+		if s.bw != nil {
+			_, _ = s.bw.WriteString(strconv.Itoa(len(s.buf)))
+			_ = s.bw.WriteByte(' ')
+			_, err = s.bw.Write(s.buf)
+		} else {
+			_, err = s.conn.Write(s.buf)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *syslogSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bw == nil {
+		return nil
+	}
+	setDeadline(ctx, s.conn)
+	if err := s.bw.Flush(); err != nil {
+		s.disconnect()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close -
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.bw != nil {
+		err = s.bw.Flush()
+	}
+	s.disconnect()
+	return errors.WithStack(err)
+}
+
+// connect - the connection is made on the first write and after a failure
+func (s *syslogSink) connect(ctx context.Context) error {
+	if s.conn == nil {
+		d := net.Dialer{Timeout: syslogDialTimeout}
+		conn, err := d.DialContext(ctx, s.network, s.addr)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to connect to syslog '%s://%s'", s.network, s.addr)
+		}
+		s.conn = conn
+		if s.network == "tcp" {
+			s.bw = bufio.NewWriterSize(conn, streamBuffLen)
+		}
+	}
+	setDeadline(ctx, s.conn)
+	return nil
+}
+
+func (s *syslogSink) disconnect() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.conn, s.bw = nil, nil
+}
+
+// format - <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [nftrace@32473 name="value" ...] MSG
+func (s *syslogSink) format(dst []byte, t *model.Trace) (_ []byte, err error) {
+	facility, severity := s.prio.get(t)
+	dst = append(dst, '<')
+	dst = strconv.AppendInt(dst, int64(facility<<3|severity), 10)
+	dst = append(dst, ">1 "...)
+	ts := t.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	dst = ts.AppendFormat(dst, syslogTimeLayout)
+	dst = append(dst, s.header...)
+	dst = append(dst, '[')
+	dst = append(dst, s.sdId...)
+	traceFields(t, func(name, value string) {
+		dst = append(dst, ' ')
+		dst = append(dst, name...)
+		dst = append(dst, `="`...)
+		dst = appendSdValue(dst, value)
+		dst = append(dst, '"')
+	})
+	dst = append(dst, "] "...)
+	if s.msg, err = s.f.Format(s.msg[:0], t); err != nil {
+		return dst, errors.WithMessage(err, "failed to format trace")
+	}
+	return append(dst, s.msg...), nil
+}
+
+// appendSdValue - '"', '\' and ']' are escaped in the structured data param value
+func appendSdValue(dst []byte, v string) []byte {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '"', '\\', ']':
+			dst = append(dst, '\\', c)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// syslogHeaderField - printable US-ASCII without spaces limited by the length, NILVALUE if empty
+func syslogHeaderField(v string, maxLen int) string {
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, v)
+	if v == "" {
+		return "-"
+	}
+	if len(v) > maxLen {
+		v = v[:maxLen]
+	}
+	return v
+}
+
+func setDeadline(ctx context.Context, conn net.Conn) {
+	d, _ := ctx.Deadline()
+	_ = conn.SetWriteDeadline(d)
+}
@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PriorityMap(t *testing.T) {
+	testCases := []struct {
+		query    string
+		verdict  string
+		final    string
+		facility int
+		severity int
+		expErr   bool
+	}{
+		{query: "", final: "accept", facility: 16, severity: 6},
+		{query: "", final: "drop", facility: 16, severity: 4},
+		{query: "", verdict: "drop", facility: 16, severity: 4},
+		{query: "facility=auth&severity=drop:err,notice", final: "drop", facility: 4, severity: 3},
+		{query: "facility=auth&severity=drop:err,notice", final: "accept", facility: 4, severity: 5},
+		{query: "facility=drop:local1,local2&severity=debug", final: "DROP", facility: 17, severity: 7},
+		{query: "facility=local9", expErr: true},
+		{query: "severity=drop:loud", expErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query+"/"+tc.final+tc.verdict, func(t *testing.T) {
+			q, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+			p, err := parsePriorityMap(q)
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			facility, severity := p.get(&model.Trace{Verdict: tc.verdict, Final: tc.final})
+			require.Equal(t, tc.facility, facility)
+			require.Equal(t, tc.severity, severity)
+		})
+	}
+}
+
+var syslogTestTrace = model.Trace{
+	TrId:      7,
+	Table:     "filter",
+	Chain:     "input",
+	Family:    "ip",
+	SAddr:     netip.MustParseAddr("10.0.0.1"),
+	DAddr:     netip.MustParseAddr("10.0.0.2"),
+	SPort:     1234,
+	DPort:     80,
+	IpProto:   "tcp",
+	Verdict:   "drop",
+	Final:     "drop",
+	Rule:      `tcp dport 80 meta mark set 0x1 comment "a]b"`,
+	Cnt:       1,
+	Timestamp: time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.UTC),
+}
+
+var syslogRe = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) nftrace (\d+) trace \[nftrace@32473 (.*)\] (.*)$`)
+
+func checkSyslogMsg(t *testing.T, msg string) {
+	m := syslogRe.FindStringSubmatch(msg)
+	require.NotNil(t, m, msg)
+	require.Equal(t, strconv.Itoa(16<<3|4), m[1])
+	require.Equal(t, "2024-05-01T10:20:30.123456Z", m[2])
+	require.Contains(t, m[5], `trace_id="7" table="filter" chain="input" family="ip" src="10.0.0.1" dst="10.0.0.2"`)
+	require.Contains(t, m[5], `rule="tcp dport 80 meta mark set 0x1 comment \"a\]b\""`)
+	require.Contains(t, m[6], "src=10.0.0.1:1234")
+}
+
+func Test_SyslogSink(t *testing.T) {
+	ctx := context.Background()
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pc.Close() //nolint:errcheck
+		s, err := Open("syslog://" + pc.LocalAddr().String())
+		require.NoError(t, err)
+		defer s.Close() //nolint:errcheck
+		require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace, syslogTestTrace}))
+		buf := make([]byte, 64<<10)
+		for range 2 {
+			_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := pc.ReadFrom(buf)
+			require.NoError(t, err)
+			checkSyslogMsg(t, string(buf[:n]))
+		}
+	})
+	t.Run("unixgram", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.sock")
+		pc, err := net.ListenPacket("unixgram", path)
+		require.NoError(t, err)
+		defer pc.Close() //nolint:errcheck
+		s, err := Open("syslog://" + path)
+		require.NoError(t, err)
+		defer s.Close() //nolint:errcheck
+		require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace}))
+		buf := make([]byte, 64<<10)
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		checkSyslogMsg(t, string(buf[:n]))
+	})
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close() //nolint:errcheck
+		s, err := Open("syslog://" + l.Addr().String() + "?proto=tcp")
+		require.NoError(t, err)
+		require.NoError(t, s.Write(ctx, []model.Trace{syslogTestTrace, syslogTestTrace}))
+		require.NoError(t, s.Flush(ctx))
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+		require.NoError(t, s.Close())
+		r := bufio.NewReader(conn)
+		for range 2 {
+			ln, err := r.ReadString(' ')
+			require.NoError(t, err)
+			n, err := strconv.Atoi(ln[:len(ln)-1])
+			require.NoError(t, err)
+			msg := make([]byte, n)
+			_, err = io.ReadFull(r, msg)
+			require.NoError(t, err)
+			checkSyslogMsg(t, string(msg))
+		}
+	})
+	t.Run("bad proto", func(t *testing.T) {
+		_, err := Open("syslog://127.0.0.1?proto=sctp")
+		require.Error(t, err)
+	})
+}
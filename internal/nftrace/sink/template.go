@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/Morwran/ebpf-nftrace/internal/nftrace/printer"
+
+	"github.com/pkg/errors"
+)
+
+// the 'template' format renders the trace by the 'template' query parameter, e.g. format=template&template={{.Table}},
+// and the built-in templates are the formats of their own, e.g. format=nft-monitor, see printer.Template.
+// The ANSI colors are turned on by color=true, the stdout and log sinks turn them on by default if the stdout is a terminal
+func init() {
+	RegisterFormat("template", func(q url.Values) (Formatter, error) {
+		return templateFormatter(q.Get("template"), q)
+	})
+	for _, name := range printer.BuiltinTemplates() {
+		RegisterFormat(name, func(q url.Values) (Formatter, error) {
+			return templateFormatter(name, q)
+		})
+	}
+}
+
+func templateFormatter(text string, q url.Values) (Formatter, error) {
+	colors, err := colorParam(q, false)
+	if err != nil {
+		return nil, err
+	}
+	t, err := printer.ParseTemplate(text, colors)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// colorParam - the 'color' query parameter, def if it isn't set
+func colorParam(q url.Values, def bool) (bool, error) {
+	v := q.Get("color")
+	if v == "" {
+		return def, nil
+	}
+	ret, err := strconv.ParseBool(v)
+	return ret, errors.WithMessagef(err, "invalid color '%s'", v)
+}
+
+// isTerminal - the file is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
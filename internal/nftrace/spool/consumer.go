@@ -0,0 +1,220 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// Consumer - reader of the spool. The traces are read from the current position,
+// Commit makes the position durable, so the traces read after the last commit are read again after restart
+type Consumer struct {
+	s       *Spool
+	name    string
+	read    Offset // guarded by s.mu
+	mu      sync.Mutex
+	f       *os.File
+	fseg    uint64
+	buf     []byte
+	ch      chan model.Trace
+	runOnce sync.Once
+	stopped chan struct{}
+}
+
+// Name -
+func (c *Consumer) Name() string {
+	return c.name
+}
+
+// ReadBatch - blocks until at least one trace is available and reads up to len(dst) traces
+func (c *Consumer) ReadBatch(ctx context.Context, dst []model.Trace) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		s := c.s
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return 0, ErrSpoolClosed
+		}
+		off := c.read
+		var seg segInfo
+		idx := -1
+		for i := range s.segs {
+			if s.segs[i].id >= off.Segment {
+				seg, idx = s.segs[i], i
+				break
+			}
+		}
+		if seg.id != off.Segment {
+			off = Offset{Segment: seg.id}
+		}
+		var next *Offset
+		if idx < len(s.segs)-1 {
+			next = &Offset{Segment: s.segs[idx+1].id}
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		if off.Pos >= seg.size {
+			if next != nil {
+				c.advance(off, *next, 0)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-s.done:
+				return 0, ErrSpoolClosed
+			case <-wake:
+			}
+			continue
+		}
+		n, to, corrupt, err := c.readSegment(off, seg, dst)
+		if err != nil {
+			return 0, err
+		}
+		c.advance(off, to, corrupt)
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Commit - stores the position of the traces read so far
+func (c *Consumer) Commit() error {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSpoolClosed
+	}
+	return s.commit(c.name, c.read)
+}
+
+// Reader - channel of the traces, the traces are committed once they are taken from the channel.
+// It is an alternative to ReadBatch and must not be used along with it
+func (c *Consumer) Reader() <-chan model.Trace {
+	c.runOnce.Do(func() {
+		c.ch = make(chan model.Trace)
+		c.stopped = make(chan struct{})
+		go c.run()
+	})
+	return c.ch
+}
+
+func (c *Consumer) run() {
+	defer func() {
+		close(c.ch)
+		close(c.stopped)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.s.done
+		cancel()
+	}()
+	buf := make([]model.Trace, pumpBatchSize)
+	for {
+		n, err := c.ReadBatch(ctx, buf)
+		if err != nil {
+			return
+		}
+		for i := range buf[:n] {
+			select {
+			case <-ctx.Done():
+				return
+			case c.ch <- buf[i]:
+			}
+		}
+		_ = c.Commit()
+	}
+}
+
+func (c *Consumer) close() {
+	c.runOnce.Do(func() {})
+	if c.stopped != nil {
+		<-c.stopped
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.f != nil {
+		_ = c.f.Close()
+		c.f = nil
+	}
+}
+
+// advance - moves the read position unless the segment has been discarded meanwhile,
+// and accounts the records that failed to decode
+func (c *Consumer) advance(from, to Offset, corrupt uint64) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.corrupt += corrupt
+	if c.read.Segment <= from.Segment {
+		c.read = to
+	}
+}
+
+// readSegment - decodes the records of the segment from the offset up to the segment size,
+// returns the position after the last read record and the count of records that failed to decode
+func (c *Consumer) readSegment(off Offset, seg segInfo, dst []model.Trace) (n int, to Offset, corrupt uint64, err error) {
+	limit := seg.size
+	end := Offset{Segment: off.Segment, Pos: limit, Rec: seg.records}
+	if c.f == nil || c.fseg != off.Segment {
+		if c.f != nil {
+			_ = c.f.Close()
+			c.f = nil
+		}
+		f, e := os.Open(c.s.segmentPath(off.Segment))
+		if os.IsNotExist(e) {
+			// the segment is discarded, the position is moved to the next one
+			return 0, end, 0, nil
+		}
+		if e != nil {
+			return 0, off, 0, errors.WithMessage(e, "failed to open spool segment")
+		}
+		c.f, c.fseg = f, off.Segment
+	}
+	want := min(limit-off.Pos, readChunkLen)
+	if int64(cap(c.buf)) < want {
+		c.buf = make([]byte, want)
+	}
+	b := c.buf[:want]
+	if _, err = c.f.ReadAt(b, off.Pos); err != nil && !errors.Is(err, io.EOF) {
+		return 0, off, 0, errors.WithMessage(err, "failed to read spool segment")
+	}
+	to = off
+	for n < len(dst) {
+		payload, l, e := nextRecord(b)
+		if e != nil {
+			// the rest of the segment is unreadable, skip it
+			return n, end, corrupt, nil
+		}
+		if l == 0 {
+			if off.Pos+want >= limit {
+				// the writer appends whole records, so it's a torn tail left by a crash
+				return n, end, corrupt, nil
+			}
+			break
+		}
+		b = b[l:]
+		to.Pos += int64(l)
+		to.Rec++
+		dst[n] = model.Trace{}
+		if json.Unmarshal(payload, &dst[n]) != nil {
+			corrupt++
+			continue
+		}
+		n++
+	}
+	return n, to, corrupt, nil
+}
@@ -0,0 +1,24 @@
+package spool
+
+import "github.com/H-BF/corlib/pkg/patterns/observer"
+
+type (
+	SpoolSizeEvent struct {
+		observer.EventType
+		Size     int64
+		Segments int
+	}
+	SpoolLagEvent struct {
+		observer.EventType
+		Consumer string
+		Lag      int64
+	}
+	CountSpoolDiscardEvent struct {
+		observer.EventType
+		Cnt uint64
+	}
+	CountSpoolCorruptEvent struct {
+		observer.EventType
+		Cnt uint64
+	}
+)
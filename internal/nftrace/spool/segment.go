@@ -0,0 +1,199 @@
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// Record layout: | payload length uint32 BE | crc32c of payload uint32 BE | payload (trace JSON) |
+const (
+	recordHeaderLen = 8
+	maxRecordLen    = 1 << 20
+	segmentExt      = ".seg"
+	offsetExt       = ".offset"
+	readChunkLen    = 4 * maxRecordLen
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type (
+	segInfo struct {
+		id       uint64
+		size     int64
+		records  uint64
+		modified time.Time
+	}
+
+	// Offset - position of the consumer in the spool
+	Offset struct {
+		Segment uint64
+		Pos     int64
+		// Rec - ordinal of the record at Pos in the segment, it is kept in memory only
+		Rec uint64
+	}
+)
+
+func segmentName(id uint64) string {
+	return fmt.Sprintf("%020d%s", id, segmentExt)
+}
+
+func appendRecord(dst []byte, t *model.Trace) ([]byte, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return dst, err
+	}
+	if len(payload) > maxRecordLen {
+		// the reader takes such a record for the corruption and skips the rest of the segment
+		return dst, errRecordTooLarge
+	}
+	var hdr [recordHeaderLen]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(payload))) //nolint:gosec
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(payload, crcTable))
+	dst = append(dst, hdr[:]...)
+	return append(dst, payload...), nil
+}
+
+// nextRecord - payload of the record at the start of b and the record length.
+// Zero length means the record is incomplete, errBadRecord means the rest of the segment is unreadable
+func nextRecord(b []byte) (payload []byte, n int, err error) {
+	if len(b) < recordHeaderLen {
+		return nil, 0, nil
+	}
+	l := binary.BigEndian.Uint32(b[:4])
+	if l > maxRecordLen {
+		return nil, 0, errBadRecord
+	}
+	n = recordHeaderLen + int(l)
+	if len(b) < n {
+		return nil, 0, nil
+	}
+	payload = b[recordHeaderLen:n]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(b[4:8]) {
+		return nil, 0, errBadRecord
+	}
+	return payload, n, nil
+}
+
+// countRecords - number of readable records in the segment file before the position
+func countRecords(path string, pos int64) (cnt uint64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close() //nolint:errcheck
+	b, err := io.ReadAll(io.LimitReader(f, pos))
+	if err != nil {
+		return 0
+	}
+	for len(b) > 0 {
+		_, n, e := nextRecord(b)
+		if e != nil || n == 0 {
+			break
+		}
+		b = b[n:]
+		cnt++
+	}
+	return cnt
+}
+
+func listSegments(dir string) ([]segInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []segInfo
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, segInfo{id: id, size: fi.Size(), modified: fi.ModTime()})
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].id < segs[j].id })
+	return segs, nil
+}
+
+func loadOffsets(dir string) (map[string]Offset, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]Offset)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, offsetExt) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != 16 {
+			continue
+		}
+		ret[strings.TrimSuffix(name, offsetExt)] = Offset{
+			Segment: binary.BigEndian.Uint64(b[:8]),
+			Pos:     int64(binary.BigEndian.Uint64(b[8:])), //nolint:gosec
+		}
+	}
+	return ret, nil
+}
+
+// storeOffset - replaces the offset file of the consumer, with sync the file and the directory
+// are synced to the disk, so the offset survives a crash of the host
+func storeOffset(dir, consumer string, off Offset, sync bool) error {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], off.Segment)
+	binary.BigEndian.PutUint64(b[8:], uint64(off.Pos)) //nolint:gosec
+	path := filepath.Join(dir, consumer+offsetExt)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = f.Write(b[:])
+	if err == nil && sync {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = os.Rename(tmp, path); err != nil || !sync {
+		return errors.WithStack(err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir - syncs the directory entries, i.e. created, renamed and removed files, to the disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer d.Close() //nolint:errcheck
+	return errors.WithStack(d.Sync())
+}
@@ -0,0 +1,544 @@
+package spool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/H-BF/corlib/logger"
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefSegmentSize = 64 << 20
+	DefMaxSize     = 1 << 30
+	DefMaxAge      = 24 * time.Hour
+	DefSyncEvery   = time.Second
+
+	pumpBatchSize  = 256
+	reportInterval = time.Second
+)
+
+var (
+	ErrSpoolClosed    = errors.New("spool is closed")
+	errBadRecord      = errors.New("bad record")
+	errRecordTooLarge = errors.New("record is too large")
+)
+
+type (
+	traceBatchReader interface {
+		ReadBatch(ctx context.Context, dst []model.Trace) (int, error)
+	}
+
+	// Deps -
+	Deps struct {
+		// Source - traces Run writes into the spool
+		Source traceBatchReader
+		Subj   observer.Subject
+	}
+
+	// Option -
+	Option func(*Spool)
+
+	// Spool - write-ahead log of the traces on the disk. The traces are written into segment files,
+	// every consumer reads them at its own offset, and segments are removed once all the consumers
+	// have committed them, or when the spool exceeds its size or age cap
+	Spool struct {
+		Deps
+		dir       string
+		segSize   int64
+		maxSize   int64
+		maxAge    time.Duration
+		syncEvery time.Duration
+		mu        sync.Mutex
+		segs      []segInfo
+		active    *os.File
+		size      int64
+		wbuf      []byte
+		consumers map[string]*Consumer
+		offsets   map[string]Offset
+		wake      chan struct{}
+		discarded uint64
+		reported  uint64
+		corrupt   uint64
+		corruptRp uint64
+		dirty     bool
+		segSynced time.Time
+		offSynced time.Time
+		closed    bool
+		done      chan struct{}
+		onceRun   sync.Once
+		onceClose sync.Once
+		stopped   chan struct{}
+	}
+)
+
+// WithSegmentSize - the segment is closed and a new one is started when it reaches the size
+func WithSegmentSize(n int64) Option {
+	return func(s *Spool) {
+		s.segSize = n
+	}
+}
+
+// WithMaxSize - the oldest segments are discarded when the spool exceeds the size
+func WithMaxSize(n int64) Option {
+	return func(s *Spool) {
+		s.maxSize = n
+	}
+}
+
+// WithMaxAge - segments last written earlier than the age are discarded, zero disables the age cap
+func WithMaxAge(d time.Duration) Option {
+	return func(s *Spool) {
+		s.maxAge = d
+	}
+}
+
+// WithSyncEvery - the spool files are synced to the disk at most once per the interval, zero syncs them on every
+// write and commit, negative leaves syncing to the OS, so the traces written just before a crash of the host may be lost
+func WithSyncEvery(d time.Duration) Option {
+	return func(s *Spool) {
+		s.syncEvery = d
+	}
+}
+
+// New - opens the spool in the directory. Segments and consumer offsets left by the previous run
+// are kept, so the traces not committed by the consumers are read again
+func New(d Deps, dir string, opts ...Option) (*Spool, error) {
+	s := &Spool{
+		Deps:      d,
+		dir:       dir,
+		segSize:   DefSegmentSize,
+		maxSize:   DefMaxSize,
+		maxAge:    DefMaxAge,
+		syncEvery: DefSyncEvery,
+		consumers: make(map[string]*Consumer),
+		wake:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.segSize <= 0 || s.maxSize < s.segSize {
+		return nil, errors.Errorf("invalid spool caps: segment size %d, max size %d", s.segSize, s.maxSize)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.WithMessage(err, "failed to create spool dir")
+	}
+	var err error
+	if s.segs, err = listSegments(dir); err != nil {
+		return nil, errors.WithMessage(err, "failed to list spool segments")
+	}
+	if s.offsets, err = loadOffsets(dir); err != nil {
+		return nil, errors.WithMessage(err, "failed to load consumer offsets")
+	}
+	for i := range s.segs {
+		seg := &s.segs[i]
+		s.size += seg.size
+		seg.records = countRecords(s.segmentPath(seg.id), seg.size)
+	}
+	for name, off := range s.offsets {
+		off.Rec = countRecords(s.segmentPath(off.Segment), off.Pos)
+		s.offsets[name] = off
+	}
+	// the tail of the last segment may be torn, so writing always starts with a new segment
+	if err = s.rotate(); err != nil {
+		return nil, err
+	}
+	s.enforceCaps(time.Now())
+	return s, nil
+}
+
+// Write - append the traces to the spool
+func (s *Spool) Write(traces ...model.Trace) (err error) {
+	if len(traces) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSpoolClosed
+	}
+	s.wbuf = s.wbuf[:0]
+	var recs uint64 // records in the buffer
+	for i := range traces {
+		n := len(s.wbuf)
+		if s.wbuf, err = appendRecord(s.wbuf, &traces[i]); errors.Is(err, errRecordTooLarge) {
+			s.discarded++
+			continue
+		} else if err != nil {
+			return errors.WithMessage(err, "failed to encode trace")
+		}
+		if n > 0 && s.segs[len(s.segs)-1].size+int64(len(s.wbuf)) > s.segSize {
+			// the segment is full, the record goes to the next one
+			if err = s.flush(s.wbuf[:n], recs); err != nil {
+				return err
+			}
+			s.wbuf, recs = append(s.wbuf[:0], s.wbuf[n:]...), 0
+			if err = s.rotate(); err != nil {
+				return err
+			}
+		}
+		recs++
+	}
+	if s.segs[len(s.segs)-1].size >= s.segSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	if err = s.flush(s.wbuf, recs); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err = s.syncActive(now, false); err != nil {
+		return err
+	}
+	s.enforceCaps(now)
+	close(s.wake)
+	s.wake = make(chan struct{})
+	return nil
+}
+
+func (s *Spool) flush(b []byte, recs uint64) error {
+	n, err := s.active.Write(b)
+	seg := &s.segs[len(s.segs)-1]
+	seg.size += int64(n)
+	seg.modified = time.Now()
+	s.size += int64(n)
+	s.dirty = s.dirty || n > 0
+	if err == nil {
+		seg.records += recs
+	}
+	return errors.WithMessage(err, "failed to write spool segment")
+}
+
+// syncActive - syncs the active segment to the disk if the sync interval has passed, or unconditionally with force
+func (s *Spool) syncActive(now time.Time, force bool) error {
+	if !s.dirty || s.syncEvery < 0 || (!force && now.Sub(s.segSynced) < s.syncEvery) {
+		return nil
+	}
+	if err := s.active.Sync(); err != nil {
+		return errors.WithMessage(err, "failed to sync spool segment")
+	}
+	s.dirty, s.segSynced = false, now
+	return nil
+}
+
+// Consumer - consumer of the spool with the name. It starts at its committed offset,
+// or at the oldest segment if it has never committed
+func (s *Spool) Consumer(name string) (*Consumer, error) {
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return nil, errors.Errorf("invalid spool consumer name '%s'", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrSpoolClosed
+	}
+	if c := s.consumers[name]; c != nil {
+		return c, nil
+	}
+	off, ok := s.offsets[name]
+	if !ok || off.Segment < s.segs[0].id {
+		off = Offset{Segment: s.segs[0].id}
+		s.offsets[name] = off
+	}
+	c := &Consumer{s: s, name: name, read: off}
+	s.consumers[name] = c
+	return c, nil
+}
+
+// Retain - forgets the offsets of the consumers left by the previous run that are not in the names,
+// e.g. of the outputs removed from the configuration, so they don't hold the segments anymore
+func (s *Spool) Retain(names ...string) error {
+	keep := make(map[string]bool, len(names))
+	for _, n := range names {
+		keep[n] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSpoolClosed
+	}
+	for name := range s.offsets {
+		if keep[name] || s.consumers[name] != nil {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.dir, name+offsetExt))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithMessagef(err, "failed to remove offset of consumer '%s'", name)
+		}
+		delete(s.offsets, name)
+	}
+	s.removeCommitted()
+	return nil
+}
+
+// Run - moves the traces from the source into the spool and reports the spool metrics
+func (s *Spool) Run(ctx context.Context) (err error) {
+	var doRun bool
+	s.onceRun.Do(func() {
+		doRun = true
+		s.stopped = make(chan struct{})
+	})
+	if !doRun {
+		return errors.New("it has been run or closed yet")
+	}
+	defer close(s.stopped)
+	log := logger.FromContext(ctx).Named("spool")
+	log.Info("start")
+	defer log.Info("stop")
+
+	ctx1, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		t := time.NewTicker(reportInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx1.Done():
+				return
+			case <-s.done:
+				return
+			case now := <-t.C:
+				s.mu.Lock()
+				if err := s.syncActive(now, false); err != nil {
+					log.Errorf("%v", err)
+				}
+				s.enforceCaps(now)
+				s.mu.Unlock()
+				s.report()
+			}
+		}
+	}()
+	go func() {
+		select {
+		case <-ctx1.Done():
+		case <-s.done:
+			cancel()
+		}
+	}()
+
+	buf := make([]model.Trace, pumpBatchSize)
+	for {
+		n, err := s.Source.ReadBatch(ctx1, buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			return errors.WithMessage(err, "failed to read traces")
+		}
+		if err = s.Write(buf[:n]...); err != nil {
+			return err
+		}
+	}
+}
+
+// Close - the consumers must not be read after the spool is closed
+func (s *Spool) Close() error {
+	var err error
+	s.onceClose.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.done)
+		consumers := make([]*Consumer, 0, len(s.consumers))
+		for _, c := range s.consumers {
+			consumers = append(consumers, c)
+		}
+		s.mu.Unlock()
+		s.onceRun.Do(func() {})
+		if s.stopped != nil {
+			<-s.stopped
+		}
+		for _, c := range consumers {
+			c.close()
+		}
+		s.mu.Lock()
+		err = s.syncActive(time.Now(), true)
+		if e := s.active.Close(); err == nil {
+			err = e
+		}
+		s.mu.Unlock()
+	})
+	return err
+}
+
+// Size - size of the spool on the disk
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Lag - bytes the consumer has not committed yet
+func (s *Spool) Lag(consumer string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lag(s.offsets[consumer])
+}
+
+// Discarded - count of the traces discarded by the size and age caps, or too large to be spooled
+func (s *Spool) Discarded() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.discarded
+}
+
+// Corrupt - count of the records read by the consumers that passed the checksum but failed to decode
+func (s *Spool) Corrupt() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.corrupt
+}
+
+func (s *Spool) report() {
+	if s.Subj == nil {
+		return
+	}
+	s.mu.Lock()
+	size, segs := s.size, len(s.segs)
+	discarded := s.discarded - s.reported
+	s.reported = s.discarded
+	corrupt := s.corrupt - s.corruptRp
+	s.corruptRp = s.corrupt
+	lags := make(map[string]int64, len(s.consumers))
+	for name := range s.consumers {
+		lags[name] = s.lag(s.offsets[name])
+	}
+	s.mu.Unlock()
+
+	s.Subj.Notify(SpoolSizeEvent{Size: size, Segments: segs})
+	for name, lag := range lags {
+		s.Subj.Notify(SpoolLagEvent{Consumer: name, Lag: lag})
+	}
+	if discarded > 0 {
+		s.Subj.Notify(CountSpoolDiscardEvent{Cnt: discarded})
+	}
+	if corrupt > 0 {
+		s.Subj.Notify(CountSpoolCorruptEvent{Cnt: corrupt})
+	}
+}
+
+func (s *Spool) lag(off Offset) (ret int64) {
+	for _, seg := range s.segs {
+		switch {
+		case seg.id == off.Segment:
+			ret += max(seg.size-off.Pos, 0)
+		case seg.id > off.Segment:
+			ret += seg.size
+		}
+	}
+	return ret
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, segmentName(id))
+}
+
+// rotate - closes the active segment and starts a new one
+func (s *Spool) rotate() error {
+	var id uint64
+	if n := len(s.segs); n > 0 {
+		id = s.segs[n-1].id + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return errors.WithMessage(err, "failed to create spool segment")
+	}
+	if s.active != nil {
+		// the closed segment is not written anymore, so it is synced once
+		if err = s.syncActive(time.Now(), true); err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			return err
+		}
+		_ = s.active.Close()
+	}
+	s.active = f
+	s.segs = append(s.segs, segInfo{id: id, modified: time.Now()})
+	return nil
+}
+
+// commit - stores the consumer offset and removes segments committed by all the consumers
+func (s *Spool) commit(name string, off Offset) error {
+	now := time.Now()
+	sync := s.syncEvery == 0 || (s.syncEvery > 0 && now.Sub(s.offSynced) >= s.syncEvery)
+	if err := storeOffset(s.dir, name, off, sync); err != nil {
+		return errors.WithMessage(err, "failed to store consumer offset")
+	}
+	if sync {
+		s.offSynced = now
+	}
+	s.offsets[name] = off
+	s.removeCommitted()
+	return nil
+}
+
+// removeCommitted - removes the segments committed by all the consumers
+func (s *Spool) removeCommitted() {
+	for len(s.segs) > 1 {
+		first := s.segs[0].id
+		for _, o := range s.offsets {
+			if o.Segment <= first {
+				return
+			}
+		}
+		s.removeOldest()
+	}
+}
+
+// enforceCaps - discards the oldest segments if the spool exceeds the size or age cap,
+// the active segment is never discarded
+func (s *Spool) enforceCaps(now time.Time) {
+	for len(s.segs) > 1 {
+		oldest := s.segs[0]
+		if s.size <= s.maxSize && (s.maxAge <= 0 || now.Sub(oldest.modified) <= s.maxAge) {
+			return
+		}
+		s.discarded += s.undelivered(oldest)
+		s.removeOldest()
+	}
+}
+
+// undelivered - count of records in the segment not committed by at least one consumer
+func (s *Spool) undelivered(seg segInfo) uint64 {
+	if len(s.offsets) == 0 {
+		return seg.records
+	}
+	rec := seg.records // min record of the consumers that haven't passed the segment
+	for _, o := range s.offsets {
+		switch {
+		case o.Segment < seg.id:
+			rec = 0
+		case o.Segment == seg.id:
+			rec = min(rec, o.Rec)
+		}
+	}
+	return seg.records - rec
+}
+
+func (s *Spool) removeOldest() {
+	seg := s.segs[0]
+	s.segs = s.segs[1:]
+	s.size -= seg.size
+	_ = os.Remove(s.segmentPath(seg.id))
+	next := Offset{Segment: s.segs[0].id}
+	for name, o := range s.offsets {
+		if o.Segment <= seg.id {
+			s.offsets[name] = next
+		}
+	}
+	for _, c := range s.consumers {
+		if c.read.Segment <= seg.id {
+			c.read = next
+		}
+	}
+}
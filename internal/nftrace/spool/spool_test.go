@@ -0,0 +1,251 @@
+package spool
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func traces(from, to uint32) (ret []model.Trace) {
+	for i := from; i < to; i++ {
+		ret = append(ret, model.Trace{TrId: i, Table: "filter", Chain: "input", Cnt: 1})
+	}
+	return ret
+}
+
+func readIds(t *testing.T, c *Consumer, n int) (ids []uint32) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buf := make([]model.Trace, n)
+	for len(ids) < n {
+		cnt, err := c.ReadBatch(ctx, buf[:n-len(ids)])
+		require.NoError(t, err)
+		for _, tr := range buf[:cnt] {
+			ids = append(ids, tr.TrId)
+		}
+	}
+	return ids
+}
+
+func ids(from, to uint32) (ret []uint32) {
+	for i := from; i < to; i++ {
+		ret = append(ret, i)
+	}
+	return ret
+}
+
+func Test_SpoolReadCommit(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Deps{}, dir, WithSegmentSize(512), WithMaxSize(1<<20))
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+
+	c1, err := s.Consumer("c1")
+	require.NoError(t, err)
+	c2, err := s.Consumer("c2")
+	require.NoError(t, err)
+
+	for i := uint32(0); i < 50; i += 10 {
+		require.NoError(t, s.Write(traces(i, i+10)...))
+	}
+	require.Greater(t, len(s.segs), 2)
+
+	require.Equal(t, ids(0, 50), readIds(t, c1, 50))
+	require.NoError(t, c1.Commit())
+	require.Zero(t, s.Lag("c1"))
+	require.Equal(t, s.Size(), s.Lag("c2"))
+
+	require.Equal(t, ids(0, 50), readIds(t, c2, 50))
+	require.NoError(t, c2.Commit())
+	require.Len(t, s.segs, 1, "segments committed by all the consumers are removed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c1.ReadBatch(ctx, make([]model.Trace, 1))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_SpoolReplay(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Deps{}, dir, WithSegmentSize(256))
+	require.NoError(t, err)
+	c, err := s.Consumer("out")
+	require.NoError(t, err)
+	require.NoError(t, s.Write(traces(0, 20)...))
+	require.Equal(t, ids(0, 5), readIds(t, c, 5))
+	require.NoError(t, c.Commit())
+	require.Equal(t, ids(5, 8), readIds(t, c, 3))
+	require.NoError(t, s.Close())
+
+	// torn tail of the last segment written before the crash
+	segs, err := listSegments(dir)
+	require.NoError(t, err)
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(segs[len(segs)-1].id)), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = New(Deps{}, dir, WithSegmentSize(256))
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	c, err = s.Consumer("out")
+	require.NoError(t, err)
+	require.NoError(t, s.Write(traces(20, 25)...))
+	require.Equal(t, ids(5, 25), readIds(t, c, 20))
+}
+
+func Test_SpoolCaps(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []Option
+		wait time.Duration
+	}{
+		{
+			name: "size cap",
+			opts: []Option{WithSegmentSize(256), WithMaxSize(1024)},
+		},
+		{
+			name: "age cap",
+			opts: []Option{WithSegmentSize(256), WithMaxAge(50 * time.Millisecond)},
+			wait: 100 * time.Millisecond,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(Deps{}, t.TempDir(), tc.opts...)
+			require.NoError(t, err)
+			defer s.Close() //nolint:errcheck
+			c, err := s.Consumer("slow")
+			require.NoError(t, err)
+
+			require.NoError(t, s.Write(traces(0, 50)...))
+			require.NoError(t, s.Write(traces(50, 60)...))
+			time.Sleep(tc.wait)
+			require.NoError(t, s.Write(traces(60, 100)...))
+			require.LessOrEqual(t, s.Size(), s.maxSize)
+			require.NotZero(t, s.Discarded())
+
+			var got []uint32
+			for len(got) < 100-int(s.Discarded()) {
+				got = append(got, readIds(t, c, 1)...)
+			}
+			require.Equal(t, ids(uint32(s.Discarded()), 100), got) //nolint:gosec
+		})
+	}
+}
+
+func Test_SpoolCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Deps{}, dir, WithSyncEvery(0))
+	require.NoError(t, err)
+	require.NoError(t, s.Write(traces(0, 2)...))
+	require.NoError(t, s.Close())
+
+	// a record with the valid checksum but not a trace
+	b := []byte("not a trace")
+	var hdr [recordHeaderLen]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(b)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(b, crcTable))
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(0)), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write(append(hdr[:], b...))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = New(Deps{}, dir, WithSyncEvery(0))
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	require.EqualValues(t, 3, s.segs[0].records)
+	c, err := s.Consumer("out")
+	require.NoError(t, err)
+	require.NoError(t, s.Write(traces(2, 4)...))
+	require.Equal(t, ids(0, 4), readIds(t, c, 4))
+	require.EqualValues(t, 1, s.Corrupt())
+	require.Equal(t, Offset{Segment: s.segs[len(s.segs)-1].id, Pos: s.segs[len(s.segs)-1].size, Rec: 2}, c.read)
+}
+
+func Test_SpoolRecordTooLarge(t *testing.T) {
+	s, err := New(Deps{}, t.TempDir())
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	c, err := s.Consumer("out")
+	require.NoError(t, err)
+
+	huge := traces(1, 2)
+	huge[0].Rule = strings.Repeat("x", maxRecordLen)
+	require.NoError(t, s.Write(append(append(traces(0, 1), huge...), traces(2, 3)...)...))
+	require.EqualValues(t, 1, s.Discarded())
+	require.Equal(t, []uint32{0, 2}, readIds(t, c, 2))
+}
+
+func Test_SpoolRetain(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Deps{}, dir, WithSegmentSize(256))
+	require.NoError(t, err)
+	for _, name := range []string{"kept", "gone"} {
+		_, err = s.Consumer(name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Write(traces(0, 20)...))
+	c, err := s.Consumer("kept")
+	require.NoError(t, err)
+	require.Equal(t, ids(0, 20), readIds(t, c, 20))
+	require.NoError(t, c.Commit())
+	require.Greater(t, len(s.segs), 1, "the segments are held by the consumer 'gone'")
+	require.NoError(t, s.Close())
+
+	s, err = New(Deps{}, dir, WithSegmentSize(256))
+	require.NoError(t, err)
+	defer s.Close() //nolint:errcheck
+	require.NoError(t, s.Retain("kept"))
+	require.Equal(t, s.offsets["kept"].Segment, s.segs[0].id, "the segments before the consumer 'kept' are removed")
+	require.NotContains(t, s.offsets, "gone")
+	_, err = os.Stat(filepath.Join(dir, "gone"+offsetExt))
+	require.True(t, os.IsNotExist(err))
+}
+
+type sliceSource struct {
+	data []model.Trace
+}
+
+func (s *sliceSource) ReadBatch(ctx context.Context, dst []model.Trace) (int, error) {
+	if len(s.data) == 0 {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	n := copy(dst, s.data)
+	s.data = s.data[n:]
+	return n, nil
+}
+
+func Test_SpoolRun(t *testing.T) {
+	s, err := New(Deps{Source: &sliceSource{data: traces(0, 1000)}}, t.TempDir())
+	require.NoError(t, err)
+	c, err := s.Consumer("out")
+	require.NoError(t, err)
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(context.Background()) }()
+
+	r := c.Reader()
+	for i := range uint32(1000) {
+		select {
+		case tr := <-r:
+			require.Equal(t, i, tr.TrId)
+		case <-time.After(time.Second):
+			require.FailNow(t, "no traces from the spool")
+		}
+	}
+	require.NoError(t, s.Close())
+	require.NoError(t, <-errc)
+}
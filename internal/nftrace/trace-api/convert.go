@@ -0,0 +1,68 @@
+package traceapi
+
+import (
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TraceToProto -
+func TraceToProto(t *model.Trace) *api.Trace {
+	ret := &api.Trace{
+		TraceId:    t.TrId,
+		Table:      t.Table,
+		Chain:      t.Chain,
+		JumpTarget: t.JumpTarget,
+		RuleHandle: t.RuleHandle,
+		Family:     t.Family,
+		L3Proto:    t.L3Proto,
+		Iif:        t.Iifname,
+		Oif:        t.Oifname,
+		HwSrc:      t.SMacAddr.String(),
+		HwDst:      t.DMacAddr.String(),
+		IpSrc:      model.AddrString(t.SAddr),
+		IpDst:      model.AddrString(t.DAddr),
+		Sport:      t.SPort,
+		Dport:      t.DPort,
+		Len:        t.Length,
+		Proto:      t.IpProto,
+		Verdict:    t.Verdict,
+		Final:      t.Final,
+		Rule:       t.Rule,
+		CtId:       t.CtId,
+		CtState:    t.CtState,
+		CtDir:      t.CtDirection,
+		CtStatus:   t.CtStatus,
+		Cnt:        t.Cnt,
+		Bytes:      t.Bytes,
+		FirstSeen:  timeToProto(t.FirstSeen),
+		LastSeen:   timeToProto(t.LastSeen),
+		Incomplete: t.Incomplete,
+		Timestamp:  timeToProto(t.Timestamp),
+	}
+	if len(t.Path) > 0 {
+		ret.Path = make([]*api.Hop, 0, len(t.Path))
+		for _, h := range t.Path {
+			ret.Path = append(ret.Path, &api.Hop{
+				Type:       h.Type,
+				Table:      h.Table,
+				Chain:      h.Chain,
+				Handle:     h.Handle,
+				Rule:       h.Rule,
+				Verdict:    h.Verdict,
+				JumpTarget: h.JumpTarget,
+			})
+		}
+	}
+	return ret
+}
+
+func timeToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
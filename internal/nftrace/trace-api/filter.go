@@ -0,0 +1,156 @@
+package traceapi
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Matcher - compiled api.Filter
+	Matcher struct {
+		tables   set[string]
+		chains   set[string]
+		families set[string]
+		verdicts set[string]
+		ifaces   set[string]
+		protos   set[string]
+		ports    set[uint32]
+		nets     []netip.Prefix
+	}
+
+	set[T comparable] map[T]struct{}
+)
+
+func newSet[T comparable](vals []T, conv func(T) T) set[T] {
+	if len(vals) == 0 {
+		return nil
+	}
+	ret := make(set[T], len(vals))
+	for _, v := range vals {
+		ret[conv(v)] = struct{}{}
+	}
+	return ret
+}
+
+func (s set[T]) has(v ...T) bool {
+	if s == nil {
+		return true
+	}
+	for i := range v {
+		if _, ok := s[v[i]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func same[T any](v T) T { return v }
+
+// CompileFilter - the nil filter matches everything
+func CompileFilter(f *api.Filter) (m Matcher, err error) {
+	m.tables = newSet(f.GetTables(), same)
+	m.chains = newSet(f.GetChains(), same)
+	m.families = newSet(f.GetFamilies(), strings.ToLower)
+	m.verdicts = newSet(f.GetVerdicts(), strings.ToLower)
+	m.ifaces = newSet(f.GetIfaces(), same)
+	m.protos = newSet(f.GetProtos(), strings.ToLower)
+	m.ports = newSet(f.GetPorts(), same)
+	for _, n := range f.GetNets() {
+		var p netip.Prefix
+		if strings.Contains(n, "/") {
+			if p, err = netip.ParsePrefix(n); err != nil {
+				return m, errors.WithMessagef(err, "invalid net '%s'", n)
+			}
+		} else {
+			a, e := netip.ParseAddr(n)
+			if e != nil {
+				return m, errors.WithMessagef(e, "invalid net '%s'", n)
+			}
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		m.nets = append(m.nets, p.Masked())
+	}
+	return m, nil
+}
+
+// ParseFilter - filter from the string like 'table=filter,nat;verdict=drop;net=10.0.0.0/8;port=443',
+// the keys are table, chain, family, verdict, iface, proto, net and port
+func ParseFilter(s string) (*api.Filter, error) {
+	var f api.Filter
+	for _, kv := range strings.Split(s, ";") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid filter term '%s': expected key=values", kv)
+		}
+		var vals []string
+		for _, val := range strings.Split(v, ",") {
+			if val = strings.TrimSpace(val); val != "" {
+				vals = append(vals, val)
+			}
+		}
+		switch strings.TrimSpace(k) {
+		case "table":
+			f.Tables = append(f.Tables, vals...)
+		case "chain":
+			f.Chains = append(f.Chains, vals...)
+		case "family":
+			f.Families = append(f.Families, vals...)
+		case "verdict":
+			f.Verdicts = append(f.Verdicts, vals...)
+		case "iface":
+			f.Ifaces = append(f.Ifaces, vals...)
+		case "proto":
+			f.Protos = append(f.Protos, vals...)
+		case "net":
+			f.Nets = append(f.Nets, vals...)
+		case "port":
+			for _, val := range vals {
+				port, err := strconv.ParseUint(val, 10, 16)
+				if err != nil {
+					return nil, errors.Errorf("invalid port '%s'", val)
+				}
+				f.Ports = append(f.Ports, uint32(port))
+			}
+		default:
+			return nil, errors.Errorf("unknown filter key '%s'", k)
+		}
+	}
+	return &f, nil
+}
+
+// Match - every non-empty field of the filter matches the trace
+func (m *Matcher) Match(t *model.Trace) bool {
+	verdict := t.Final
+	if verdict == "" {
+		verdict = t.Verdict
+	}
+	return m.tables.has(t.Table) &&
+		m.chains.has(t.Chain) &&
+		m.families.has(strings.ToLower(t.Family)) &&
+		m.verdicts.has(strings.ToLower(verdict)) &&
+		m.ifaces.has(t.Iifname, t.Oifname) &&
+		m.protos.has(strings.ToLower(t.IpProto)) &&
+		m.ports.has(t.SPort, t.DPort) &&
+		m.matchNets(t)
+}
+
+func (m *Matcher) matchNets(t *model.Trace) bool {
+	if len(m.nets) == 0 {
+		return true
+	}
+	for _, p := range m.nets {
+		if p.Contains(t.SAddr) || p.Contains(t.DAddr) {
+			return true
+		}
+	}
+	return false
+}
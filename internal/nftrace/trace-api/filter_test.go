@@ -0,0 +1,98 @@
+package traceapi
+
+import (
+	"net/netip"
+	"testing"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Filter(t *testing.T) {
+	tr := model.Trace{
+		Table:   "filter",
+		Chain:   "input",
+		Family:  "ip",
+		Iifname: "eth0",
+		SAddr:   netip.MustParseAddr("10.0.0.1"),
+		DAddr:   netip.MustParseAddr("192.168.1.2"),
+		SPort:   40000,
+		DPort:   443,
+		IpProto: "tcp",
+		Verdict: "accept",
+		Final:   "drop",
+	}
+	testCases := []struct {
+		name   string
+		filter *api.Filter
+		match  bool
+		expErr bool
+	}{
+		{name: "nil", filter: nil, match: true},
+		{name: "empty", filter: &api.Filter{}, match: true},
+		{name: "table", filter: &api.Filter{Tables: []string{"nat", "filter"}}, match: true},
+		{name: "other table", filter: &api.Filter{Tables: []string{"nat"}}},
+		{name: "final verdict", filter: &api.Filter{Verdicts: []string{"DROP"}}, match: true},
+		{name: "rule verdict", filter: &api.Filter{Verdicts: []string{"accept"}}},
+		{name: "iif", filter: &api.Filter{Ifaces: []string{"eth0"}}, match: true},
+		{name: "dst net", filter: &api.Filter{Nets: []string{"192.168.0.0/16"}}, match: true},
+		{name: "src addr", filter: &api.Filter{Nets: []string{"10.0.0.1"}}, match: true},
+		{name: "other net", filter: &api.Filter{Nets: []string{"172.16.0.0/12"}}},
+		{name: "dport", filter: &api.Filter{Ports: []uint32{443}, Protos: []string{"tcp"}}, match: true},
+		{name: "all but one", filter: &api.Filter{Ports: []uint32{443}, Protos: []string{"udp"}}},
+		{name: "bad net", filter: &api.Filter{Nets: []string{"10.0.0/8"}}, expErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := CompileFilter(tc.filter)
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.match, m.Match(&tr))
+		})
+	}
+}
+
+func Test_ParseFilter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		s      string
+		exp    *api.Filter
+		expErr bool
+	}{
+		{name: "empty", s: "", exp: &api.Filter{}},
+		{
+			name: "all keys",
+			s:    "table=filter, nat;chain=input;family=ip;verdict=drop;iface=eth0;proto=tcp;net=10.0.0.0/8;port=443,80;",
+			exp: &api.Filter{
+				Tables:   []string{"filter", "nat"},
+				Chains:   []string{"input"},
+				Families: []string{"ip"},
+				Verdicts: []string{"drop"},
+				Ifaces:   []string{"eth0"},
+				Protos:   []string{"tcp"},
+				Nets:     []string{"10.0.0.0/8"},
+				Ports:    []uint32{443, 80},
+			},
+		},
+		{name: "repeated key", s: "table=filter;table=nat", exp: &api.Filter{Tables: []string{"filter", "nat"}}},
+		{name: "no value", s: "table", expErr: true},
+		{name: "unknown key", s: "rule=1", expErr: true},
+		{name: "bad port", s: "port=70000", expErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseFilter(tc.s)
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.exp.String(), f.String())
+		})
+	}
+}
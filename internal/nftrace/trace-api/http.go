@@ -0,0 +1,189 @@
+package traceapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+type streamError struct {
+	Error string `json:"error"`
+}
+
+// HttpHandler - HTTP trace API:
+//
+//	GET /stream?filter=...&buffer=N - live traces as Server-Sent Events, or as WebSocket messages
+//	                                  when the request asks to upgrade
+//	GET /recent?filter=...&n=N      - JSON array of the last N recent traces
+//
+// the filter is described by ParseFilter, every trace is JSON encoded model.Trace
+func (s *Service) HttpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", s.serveStream)
+	mux.HandleFunc("GET /recent", s.serveRecent)
+	return mux
+}
+
+func (s *Service) serveStream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	m, err := matcherFromQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bufLen, err := queryInt(q, "buffer")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub, err := s.Subscribe(m, bufLen)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			s.pumpWebSocket(ws, sub)
+		}}.ServeHTTP(w, r)
+		return
+	}
+	s.pumpSSE(w, r, sub)
+}
+
+func (s *Service) serveRecent(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	m, err := matcherFromQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n, err := queryInt(q, "n")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	traces := s.recentMatched(m, n)
+	if traces == nil {
+		traces = []*model.Trace{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(traces)
+}
+
+func (s *Service) pumpSSE(w http.ResponseWriter, r *http.Request, sub *Subscription) {
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if rc.Flush() != nil {
+		return
+	}
+	ping := time.NewTicker(s.sseKeepAlive)
+	defer ping.Stop()
+	// the deadline is set right before the write, the stream may be idle for longer than the write timeout
+	deadline := func() {
+		_ = rc.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	}
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			deadline()
+			_ = writeSSE(w, "error", streamError{Error: sub.Err().Error()})
+			_ = rc.Flush()
+			return
+		case <-ping.C:
+			deadline()
+			_, err = io.WriteString(w, ": ping\n\n")
+		case t := <-sub.Traces():
+			deadline()
+			// the buffered traces are sent within one flush
+			for err = writeSSE(w, "", t); err == nil && len(sub.Traces()) > 0; {
+				err = writeSSE(w, "", <-sub.Traces())
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w io.Writer, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if event != "" {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	} else {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	return err
+}
+
+func (s *Service) pumpWebSocket(ws *websocket.Conn, sub *Subscription) {
+	defer ws.Close() //nolint:errcheck
+	gone := make(chan struct{})
+	go func() { // the client messages are ignored, the receive fails when the client goes away
+		defer close(gone)
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+	for {
+		var v any
+		select {
+		case <-gone:
+			return
+		case <-sub.Done():
+			v = streamError{Error: sub.Err().Error()}
+		case t := <-sub.Traces():
+			v = t
+		}
+		_ = ws.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+		if websocket.JSON.Send(ws, v) != nil {
+			return
+		}
+		if _, ok := v.(streamError); ok {
+			return
+		}
+	}
+}
+
+func matcherFromQuery(q url.Values) (Matcher, error) {
+	f, err := ParseFilter(q.Get("filter"))
+	if err != nil {
+		return Matcher{}, err
+	}
+	return CompileFilter(f)
+}
+
+func queryInt(q url.Values, key string) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid '%s' value '%s'", key, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,195 @@
+package traceapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func runHttp(t *testing.T, opts ...Option) (*Service, *httptest.Server) {
+	svc := NewService(Deps{IfaceProvider: listerMock{}, RuleProvider: listerMock{}}, opts...)
+	srv := httptest.NewServer(http.StripPrefix("/traces", svc.HttpHandler()))
+	t.Cleanup(srv.Close)
+	return svc, srv
+}
+
+// readSSE - data of the next event and its type
+func readSSE(t *testing.T, r *bufio.Reader) (event, data string) {
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && data != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func Test_HttpStreamSSE(t *testing.T) {
+	svc, srv := runHttp(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/traces/stream?filter=table=nat", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	waitWatchers(t, svc, 1)
+
+	require.NoError(t, svc.Write(ctx, []model.Trace{
+		{TrId: 1, Table: "filter"}, {TrId: 2, Table: "nat"}, {TrId: 3, Table: "nat"},
+	}))
+	r := bufio.NewReader(resp.Body)
+	for _, id := range []uint32{2, 3} {
+		ev, data := readSSE(t, r)
+		require.Empty(t, ev)
+		var tr model.Trace
+		require.NoError(t, json.Unmarshal([]byte(data), &tr))
+		require.Equal(t, id, tr.TrId)
+	}
+
+	require.NoError(t, svc.Close())
+	ev, data := readSSE(t, r)
+	require.Equal(t, "error", ev)
+	require.Contains(t, data, ErrShutdown.Error())
+}
+
+func Test_HttpStreamSSEIdle(t *testing.T) {
+	svc, srv := runHttp(t, WithSSEKeepAlive(30*time.Millisecond), WithStreamWriteTimeout(10*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/traces/stream", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	waitWatchers(t, svc, 1)
+
+	// the stream is idle for several keepalive periods, every one is longer than the write timeout
+	r := bufio.NewReader(resp.Body)
+	for pings := 0; pings < 3; {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == ": ping\n" {
+			pings++
+		}
+	}
+	require.NoError(t, svc.Write(ctx, []model.Trace{{TrId: 7}}))
+	_, data := readSSE(t, r)
+	var tr model.Trace
+	require.NoError(t, json.Unmarshal([]byte(data), &tr))
+	require.Equal(t, uint32(7), tr.TrId)
+}
+
+func Test_HttpStreamSlowClient(t *testing.T) {
+	svc, srv := runHttp(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/traces/stream?buffer=2", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	waitWatchers(t, svc, 1)
+	// the client reads nothing, the traces above the buffer and the socket buffers disconnect it
+	for i := 0; ; i++ {
+		require.NoError(t, svc.Write(ctx, []model.Trace{{TrId: uint32(i), Rule: string(make([]byte, 1024))}})) //nolint:gosec
+		svc.mu.Lock()
+		n := len(svc.watchers)
+		svc.mu.Unlock()
+		if n == 0 {
+			break
+		}
+	}
+	r := bufio.NewReader(resp.Body)
+	for {
+		ev, data := readSSE(t, r)
+		if ev == "error" {
+			require.Contains(t, data, ErrSlowSubscriber.Error())
+			break
+		}
+	}
+}
+
+func Test_HttpStreamWebSocket(t *testing.T) {
+	svc, srv := runHttp(t)
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/traces/stream?filter=verdict=drop", "", srv.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+	waitWatchers(t, svc, 1)
+
+	require.NoError(t, svc.Write(context.Background(), []model.Trace{
+		{TrId: 1, Verdict: "accept"}, {TrId: 2, Verdict: "drop"},
+	}))
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var tr model.Trace
+	require.NoError(t, websocket.JSON.Receive(ws, &tr))
+	require.Equal(t, uint32(2), tr.TrId)
+
+	require.NoError(t, svc.Close())
+	var se streamError
+	require.NoError(t, websocket.JSON.Receive(ws, &se))
+	require.Equal(t, ErrShutdown.Error(), se.Error)
+	waitWatchers(t, svc, 0)
+}
+
+func Test_HttpRecent(t *testing.T) {
+	svc, srv := runHttp(t, WithRecentSize(3))
+	for i := range 5 {
+		table := "filter"
+		if i%2 == 1 {
+			table = "nat"
+		}
+		require.NoError(t, svc.Write(context.Background(), []model.Trace{{TrId: uint32(i), Table: table}})) //nolint:gosec
+	}
+	testCases := []struct {
+		name    string
+		query   string
+		exp     []uint32
+		expCode int
+	}{
+		{name: "all recent", query: "", exp: []uint32{2, 3, 4}, expCode: http.StatusOK},
+		{name: "filtered", query: "?filter=table=filter", exp: []uint32{2, 4}, expCode: http.StatusOK},
+		{name: "limited", query: "?n=2", exp: []uint32{3, 4}, expCode: http.StatusOK},
+		{name: "none matched", query: "?filter=table=raw", exp: []uint32{}, expCode: http.StatusOK},
+		{name: "bad filter", query: "?filter=rule=1", expCode: http.StatusBadRequest},
+		{name: "bad n", query: "?n=-1", expCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/traces/recent" + tc.query) //nolint:noctx
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tc.expCode, resp.StatusCode)
+			if tc.expCode != http.StatusOK {
+				return
+			}
+			var traces []model.Trace
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&traces))
+			ids := []uint32{}
+			for _, tr := range traces {
+				ids = append(ids, tr.TrId)
+			}
+			require.Equal(t, tc.exp, ids)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package traceapi
+
+import "github.com/H-BF/corlib/pkg/patterns/observer"
+
+type (
+	// CountWatchTraceEvent - traces sent to the gRPC watchers
+	CountWatchTraceEvent struct {
+		observer.EventType
+		Cnt int
+	}
+	// WatchersEvent - number of the subscribers: gRPC watchers and HTTP streams
+	WatchersEvent struct {
+		observer.EventType
+		Cnt int
+	}
+	// CountSlowWatcherEvent - subscriber is disconnected because it doesn't keep up with the traces
+	CountSlowWatcherEvent struct {
+		observer.EventType
+	}
+)
@@ -0,0 +1,377 @@
+package traceapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	"github.com/Morwran/ebpf-nftrace/internal/nftables/parser"
+	iface "github.com/Morwran/ebpf-nftrace/internal/providers/iface-provider"
+	"github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefRecentSize     = 10000
+	DefWatchBuffer    = 1024
+	DefMaxWatchBuffer = 65536
+
+	// DefSSEKeepAlive - period of the SSE comments keeping the idle stream alive through the proxies
+	DefSSEKeepAlive = 15 * time.Second
+	// DefStreamWriteTimeout - the stream client is disconnected when a write to it takes longer
+	DefStreamWriteTimeout = 10 * time.Second
+)
+
+type (
+	ifaceLister interface {
+		ListIfaces() []iface.Iface
+	}
+
+	ruleLister interface {
+		ListRules() []nfrule.RuleEntry
+	}
+
+	// Deps -
+	Deps struct {
+		IfaceProvider ifaceLister
+		RuleProvider  ruleLister
+		Subj          observer.Subject
+	}
+
+	// Option -
+	Option func(*Service)
+
+	// Service - trace API. It's the trace sink as well: the traces written to it are kept for the snapshots
+	// and sent to the subscribers. Every subscriber has its own buffer and is disconnected when the buffer overflows
+	Service struct {
+		api.UnimplementedTraceServiceServer
+		Deps
+		recentSize     int
+		watchBuffer    int
+		maxWatchBuffer int
+		sseKeepAlive   time.Duration
+		writeTimeout   time.Duration
+
+		mu       sync.Mutex
+		recent   []model.Trace
+		head     int
+		watchers map[*Subscription]struct{}
+		closed   bool
+	}
+
+	// Subscription - live traces matched by the filter
+	Subscription struct {
+		svc  *Service
+		m    Matcher
+		ch   chan *model.Trace
+		gone chan struct{}
+		err  error
+	}
+)
+
+var (
+	// ErrSlowSubscriber - the subscriber buffer is overflowed
+	ErrSlowSubscriber = errors.New("the client doesn't keep up with the traces")
+
+	// ErrShutdown -
+	ErrShutdown = errors.New("the service is shutting down")
+)
+
+var _ api.TraceServiceServer = (*Service)(nil)
+
+// WithRecentSize - number of the recent traces kept for the snapshots
+func WithRecentSize(n int) Option {
+	return func(s *Service) {
+		s.recentSize = n
+	}
+}
+
+// WithWatchBuffer - default number of the traces buffered for the watcher
+func WithWatchBuffer(n int) Option {
+	return func(s *Service) {
+		s.watchBuffer = n
+	}
+}
+
+// WithMaxWatchBuffer - max number of the traces buffered for the watcher the client may ask for
+func WithMaxWatchBuffer(n int) Option {
+	return func(s *Service) {
+		s.maxWatchBuffer = n
+	}
+}
+
+// WithSSEKeepAlive - period of the SSE comments sent to the idle HTTP stream
+func WithSSEKeepAlive(d time.Duration) Option {
+	return func(s *Service) {
+		s.sseKeepAlive = d
+	}
+}
+
+// WithStreamWriteTimeout - max time of a write to the HTTP stream client
+func WithStreamWriteTimeout(d time.Duration) Option {
+	return func(s *Service) {
+		s.writeTimeout = d
+	}
+}
+
+// NewService -
+func NewService(d Deps, opts ...Option) *Service {
+	s := &Service{
+		Deps:           d,
+		recentSize:     DefRecentSize,
+		watchBuffer:    DefWatchBuffer,
+		maxWatchBuffer: DefMaxWatchBuffer,
+		sseKeepAlive:   DefSSEKeepAlive,
+		writeTimeout:   DefStreamWriteTimeout,
+		watchers:       make(map[*Subscription]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.recent = make([]model.Trace, 0, s.recentSize)
+	return s
+}
+
+// Description -
+func (s *Service) Description() grpc.ServiceDesc {
+	return api.TraceService_ServiceDesc
+}
+
+// RegisterGRPC -
+func (s *Service) RegisterGRPC(_ context.Context, srv *grpc.Server) error {
+	api.RegisterTraceServiceServer(srv, s)
+	return nil
+}
+
+// Write - implements the sink
+func (s *Service) Write(_ context.Context, traces []model.Trace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	for i := range traces {
+		s.remember(&traces[i])
+		var t *model.Trace
+		for w := range s.watchers {
+			if !w.m.Match(&traces[i]) {
+				continue
+			}
+			if t == nil { // the subscribers share the copy of the trace and must not modify it
+				t = new(model.Trace)
+				*t = traces[i]
+			}
+			select {
+			case w.ch <- t:
+			default:
+				s.dropWatcher(w, ErrSlowSubscriber)
+				s.notify(CountSlowWatcherEvent{})
+			}
+		}
+	}
+	return nil
+}
+
+// Flush -
+func (s *Service) Flush(context.Context) error {
+	return nil
+}
+
+// Close - disconnects the watchers
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		for w := range s.watchers {
+			s.dropWatcher(w, ErrShutdown)
+		}
+	}
+	return nil
+}
+
+// Watch -
+func (s *Service) Watch(req *api.WatchReq, stream api.TraceService_WatchServer) error {
+	m, err := CompileFilter(req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub, err := s.Subscribe(m, int(req.GetBuffer()))
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer sub.Close()
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-sub.Done():
+			code := codes.Unavailable
+			if errors.Is(sub.Err(), ErrSlowSubscriber) {
+				code = codes.ResourceExhausted
+			}
+			return status.Error(code, sub.Err().Error())
+		case t := <-sub.Traces():
+			if err = stream.Send(TraceToProto(t)); err != nil {
+				return err
+			}
+			s.notify(CountWatchTraceEvent{Cnt: 1})
+		}
+	}
+}
+
+// Subscribe - live traces matched by the filter, the default buffer length is used if 0
+func (s *Service) Subscribe(m Matcher, bufLen int) (*Subscription, error) {
+	if bufLen <= 0 {
+		bufLen = s.watchBuffer
+	}
+	sub := &Subscription{
+		svc:  s,
+		m:    m,
+		ch:   make(chan *model.Trace, max(min(bufLen, s.maxWatchBuffer), 1)),
+		gone: make(chan struct{}),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrShutdown
+	}
+	s.watchers[sub] = struct{}{}
+	s.notify(WatchersEvent{Cnt: len(s.watchers)})
+	return sub, nil
+}
+
+// Traces - the traces must not be modified
+func (sub *Subscription) Traces() <-chan *model.Trace {
+	return sub.ch
+}
+
+// Done - closed when the subscription is dropped by the service
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.gone
+}
+
+// Err - reason of the drop: ErrSlowSubscriber or ErrShutdown
+func (sub *Subscription) Err() error {
+	select {
+	case <-sub.gone:
+		return sub.err
+	default:
+		return nil
+	}
+}
+
+// Close - unsubscribes
+func (sub *Subscription) Close() {
+	s := sub.svc
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watchers[sub]; ok {
+		delete(s.watchers, sub)
+		s.notify(WatchersEvent{Cnt: len(s.watchers)})
+	}
+}
+
+// Snapshot -
+func (s *Service) Snapshot(_ context.Context, req *api.SnapshotReq) (*api.SnapshotResp, error) {
+	m, err := CompileFilter(req.GetFilter())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	matched := s.recentMatched(m, int(req.GetLimit()))
+	resp := &api.SnapshotResp{Traces: make([]*api.Trace, 0, len(matched))}
+	for _, t := range matched {
+		resp.Traces = append(resp.Traces, TraceToProto(t))
+	}
+	return resp, nil
+}
+
+// ListRules -
+func (s *Service) ListRules(context.Context, *api.ListRulesReq) (*api.ListRulesResp, error) {
+	if s.RuleProvider == nil {
+		return nil, status.Error(codes.Unavailable, "rule provider is not set")
+	}
+	rules := s.RuleProvider.ListRules()
+	resp := &api.ListRulesResp{Rules: make([]*api.Rule, 0, len(rules))}
+	for _, r := range rules {
+		resp.Rules = append(resp.Rules, &api.Rule{
+			Table:  r.RuleNative.Table.Name,
+			Family: parser.TableFamily(r.RuleNative.Table.Family).String(),
+			Chain:  r.RuleNative.Chain.Name,
+			Handle: r.RuleNative.Handle,
+			Rule:   r.RuleStr,
+		})
+	}
+	return resp, nil
+}
+
+// ListIfaces -
+func (s *Service) ListIfaces(context.Context, *api.ListIfacesReq) (*api.ListIfacesResp, error) {
+	if s.IfaceProvider == nil {
+		return nil, status.Error(codes.Unavailable, "iface provider is not set")
+	}
+	ifaces := s.IfaceProvider.ListIfaces()
+	resp := &api.ListIfacesResp{Ifaces: make([]*api.Iface, 0, len(ifaces))}
+	for _, i := range ifaces {
+		resp.Ifaces = append(resp.Ifaces, &api.Iface{Index: uint32(i.Index), Name: i.Name}) //nolint:gosec
+	}
+	return resp, nil
+}
+
+// Recent - recent traces from the oldest to the newest
+func (s *Service) Recent() []model.Trace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]model.Trace, 0, len(s.recent))
+	ret = append(ret, s.recent[s.head:]...)
+	return append(ret, s.recent[:s.head]...)
+}
+
+// recentMatched - last recent traces matched by the filter, all if the limit is 0
+func (s *Service) recentMatched(m Matcher, limit int) []*model.Trace {
+	var matched []*model.Trace
+	recent := s.Recent()
+	for i := range recent {
+		if m.Match(&recent[i]) {
+			matched = append(matched, &recent[i])
+		}
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+	return matched
+}
+
+func (s *Service) remember(t *model.Trace) {
+	if s.recentSize <= 0 {
+		return
+	}
+	if len(s.recent) < s.recentSize {
+		s.recent = append(s.recent, *t)
+		return
+	}
+	s.recent[s.head] = *t
+	s.head = (s.head + 1) % s.recentSize
+}
+
+// dropWatcher - the subscription ends with the error, it's called under the lock
+func (s *Service) dropWatcher(w *Subscription, err error) {
+	w.err = err
+	close(w.gone)
+	delete(s.watchers, w)
+	s.notify(WatchersEvent{Cnt: len(s.watchers)})
+}
+
+func (s *Service) notify(ev observer.EventType) {
+	if s.Subj != nil {
+		s.Subj.Notify(ev)
+	}
+}
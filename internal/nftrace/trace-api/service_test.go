@@ -0,0 +1,166 @@
+package traceapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	iface "github.com/Morwran/ebpf-nftrace/internal/providers/iface-provider"
+	"github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+	"github.com/Morwran/ebpf-nftrace/pkg/client"
+
+	nftLib "github.com/google/nftables"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type listerMock struct{}
+
+func (listerMock) ListIfaces() []iface.Iface {
+	return []iface.Iface{{Index: 1, Name: "lo"}, {Index: 2, Name: "eth0"}}
+}
+
+func (listerMock) ListRules() []nfrule.RuleEntry {
+	return []nfrule.RuleEntry{{
+		RuleNative: &nftLib.Rule{
+			Table:  &nftLib.Table{Name: "filter", Family: nftLib.TableFamilyINet},
+			Chain:  &nftLib.Chain{Name: "input"},
+			Handle: 5,
+		},
+		RuleStr: "tcp dport 22 accept",
+	}}
+}
+
+func runService(t *testing.T, opts ...Option) (*Service, *client.Client) {
+	svc := NewService(Deps{IfaceProvider: listerMock{}, RuleProvider: listerMock{}}, opts...)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	require.NoError(t, svc.RegisterGRPC(context.Background(), srv))
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+	c, err := client.New(context.Background(), l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return svc, c
+}
+
+func waitWatchers(t *testing.T, svc *Service, n int) {
+	require.Eventually(t, func() bool {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		return len(svc.watchers) == n
+	}, time.Second, time.Millisecond)
+}
+
+func Test_Watch(t *testing.T) {
+	svc, c := runService(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errStop := errors.New("stop")
+	got := make(chan *api.Trace, 10)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Watch(ctx, &api.WatchReq{Filter: &api.Filter{Tables: []string{"nat"}}}, func(tr *api.Trace) error {
+			got <- tr
+			if len(got) == 2 {
+				return errStop
+			}
+			return nil
+		})
+	}()
+	waitWatchers(t, svc, 1)
+	require.NoError(t, svc.Write(ctx, []model.Trace{
+		{TrId: 1, Table: "filter"}, {TrId: 2, Table: "nat"}, {TrId: 3, Table: "filter"}, {TrId: 4, Table: "nat"},
+	}))
+	require.ErrorIs(t, <-errc, errStop)
+	require.Equal(t, uint32(2), (<-got).GetTraceId())
+	require.Equal(t, uint32(4), (<-got).GetTraceId())
+	waitWatchers(t, svc, 0)
+
+	_, err := c.Snapshot(ctx, &api.SnapshotReq{Filter: &api.Filter{Nets: []string{"bad"}}})
+	require.Equal(t, codes.InvalidArgument, status.Code(errors.Cause(err)))
+}
+
+func Test_WatchSlowClient(t *testing.T) {
+	svc, c := runService(t, WithWatchBuffer(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	block := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Watch(ctx, &api.WatchReq{}, func(*api.Trace) error {
+			<-block
+			return nil
+		})
+	}()
+	waitWatchers(t, svc, 1)
+	// the client reads nothing, the traces above the watcher buffer and the transport windows disconnect it
+	for i := 0; ; i++ {
+		require.NoError(t, svc.Write(ctx, []model.Trace{{TrId: uint32(i), Rule: string(make([]byte, 1024))}})) //nolint:gosec
+		svc.mu.Lock()
+		n := len(svc.watchers)
+		svc.mu.Unlock()
+		if n == 0 {
+			break
+		}
+	}
+	close(block)
+	require.Equal(t, codes.ResourceExhausted, status.Code(errors.Cause(<-errc)))
+}
+
+func Test_Snapshot(t *testing.T) {
+	svc, c := runService(t, WithRecentSize(3))
+	ctx := context.Background()
+	for i := range 5 {
+		table := "filter"
+		if i%2 == 1 {
+			table = "nat"
+		}
+		require.NoError(t, svc.Write(ctx, []model.Trace{{TrId: uint32(i), Table: table}})) //nolint:gosec
+	}
+	testCases := []struct {
+		name string
+		req  *api.SnapshotReq
+		exp  []uint32
+	}{
+		{name: "all recent", req: &api.SnapshotReq{}, exp: []uint32{2, 3, 4}},
+		{name: "filtered", req: &api.SnapshotReq{Filter: &api.Filter{Tables: []string{"filter"}}}, exp: []uint32{2, 4}},
+		{name: "limited", req: &api.SnapshotReq{Limit: 2}, exp: []uint32{3, 4}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			traces, err := c.Snapshot(ctx, tc.req)
+			require.NoError(t, err)
+			var ids []uint32
+			for _, tr := range traces {
+				ids = append(ids, tr.GetTraceId())
+			}
+			require.Equal(t, tc.exp, ids)
+		})
+	}
+}
+
+func Test_List(t *testing.T) {
+	_, c := runService(t)
+	ctx := context.Background()
+	ifaces, err := c.ListIfaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, ifaces, 2)
+	require.Equal(t, "eth0", ifaces[1].GetName())
+
+	rules, err := c.ListRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.Equal(t, "inet", rules[0].GetFamily())
+	require.Equal(t, uint64(5), rules[0].GetHandle())
+	require.Equal(t, "tcp dport 22 accept", rules[0].GetRule())
+}
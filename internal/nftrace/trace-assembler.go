@@ -0,0 +1,135 @@
+package nftrace
+
+import (
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/pkg/errors"
+)
+
+const gaugeReportInterval = time.Second
+
+type (
+	// traceAssemblerDeps - dependencies of the trace assembler
+	traceAssemblerDeps struct {
+		TraceGroup *TraceGroup
+		Que        queue.CachedQueFace
+		Subj       observer.Subject
+	}
+
+	// traceAssembler - common pipeline of the collectors: it groups trace events into paths,
+	// converts completed paths into the model and pushes them into the queue.
+	// Stale groups are evicted, traces of unknown rules wait in the pending stage
+	traceAssembler struct {
+		traceAssemblerDeps
+		resolver   *ruleResolver
+		agg        Aggregation
+		waitReady  bool
+		sampler    flowSampler
+		shard      int
+		nextReport time.Time
+	}
+)
+
+func newTraceAssembler(d traceAssemblerDeps, agg Aggregation, waitReady bool, sampler flowSampler,
+	rrOpts ...RuleResolverOption) *traceAssembler {
+	return &traceAssembler{
+		traceAssemblerDeps: d,
+		resolver:           newRuleResolver(d.TraceGroup.ruleProvider, rrOpts...),
+		agg:                agg,
+		waitReady:          waitReady,
+		sampler:            sampler,
+	}
+}
+
+// Add - add the trace event. If the group is completed it's pushed into the queue
+func (a *traceAssembler) Add(tr NftTrace, now time.Time) error {
+	tg := a.TraceGroup
+	if err := tg.AddTrace(tr); err != nil {
+		return err
+	}
+	if err := a.Tick(now); err != nil {
+		return err
+	}
+	if a.waitReady && !tg.GroupReady() {
+		return nil
+	}
+	if !a.sampler.Sample(tg.FlowHash()) {
+		tg.Reset()
+		return nil
+	}
+	m, err := tg.ToModel()
+	tg.Reset()
+
+	var unresolved ErrRuleUnresolved
+	if errors.As(err, &unresolved) {
+		outcome := ResolveOutcomeDeferred
+		if !a.resolver.Defer(m, unresolved.Rule, now) {
+			outcome = ResolveOutcomeDropped
+		}
+		a.Subj.Notify(CountRuleResolveEvent{Outcome: outcome, Cnt: 1})
+		return nil
+	}
+	if err != nil {
+		return errors.WithMessage(err, "failed to convert obtained trace into model")
+	}
+	return a.push(m)
+}
+
+// Tick - evict stale trace groups and retry rule resolution of the pending traces
+func (a *traceAssembler) Tick(now time.Time) error {
+	evicted, est := a.TraceGroup.Evict(now)
+	if est.ByAge > 0 {
+		a.Subj.Notify(CountEvictTraceGroupEvent{Reason: EvictReasonAge, Cnt: est.ByAge})
+	}
+	if est.BySize > 0 {
+		a.Subj.Notify(CountEvictTraceGroupEvent{Reason: EvictReasonSize, Cnt: est.BySize})
+	}
+	resolved, rst := a.resolver.Resolve(now)
+	if rst.Resolved > 0 {
+		a.Subj.Notify(CountRuleResolveEvent{Outcome: ResolveOutcomeResolved, Cnt: rst.Resolved})
+	}
+	if rst.Unresolved > 0 {
+		a.Subj.Notify(CountRuleResolveEvent{Outcome: ResolveOutcomeUnresolved, Cnt: rst.Unresolved})
+	}
+	if !now.Before(a.nextReport) {
+		a.nextReport = now.Add(gaugeReportInterval)
+		a.Subj.Notify(OpenTraceGroupsEvent{Shard: a.shard, Cnt: a.TraceGroup.Len()})
+		a.Subj.Notify(PendingTracesEvent{Shard: a.shard, Cnt: a.resolver.Len()})
+		if a.shard == 0 {
+			a.Subj.Notify(QueDepthEvent{Depth: a.Que.Len()})
+		}
+	}
+	for _, m := range evicted {
+		if err := a.push(m); err != nil {
+			return err
+		}
+	}
+	for _, m := range resolved {
+		if err := a.push(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close -
+func (a *traceAssembler) Close() {
+	a.TraceGroup.Close()
+}
+
+func (a *traceAssembler) push(m model.Trace) (err error) {
+	if a.agg.Enabled {
+		err = a.Que.Upsert(m.Key(a.agg.key()), m)
+	} else {
+		err = a.Que.Enque(m)
+	}
+	if errors.Is(err, queue.ErrQueIsFull) {
+		// the drop is reported by the drop handler of the que
+		err = nil
+	}
+	return err
+}
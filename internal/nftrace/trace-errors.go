@@ -3,6 +3,8 @@ package nftrace
 import (
 	"errors"
 	"fmt"
+
+	rl "github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
 )
 
 // ErrCollect -
@@ -13,6 +15,11 @@ type (
 	ErrPrint struct {
 		Err error
 	}
+	// ErrRuleUnresolved - the trace is converted into the model, but its rule is not known yet
+	ErrRuleUnresolved struct {
+		Rule rl.TraceRuleDescriptor
+		Err  error
+	}
 )
 
 // Error -
@@ -35,6 +42,21 @@ func (e ErrPrint) Cause() error {
 	return e.Err
 }
 
+// Error -
+func (e ErrRuleUnresolved) Error() string {
+	return fmt.Sprintf("Rule %s/%s#%d: %v", e.Rule.TableName, e.Rule.ChainName, e.Rule.RuleHandle, e.Err)
+}
+
+// Cause -
+func (e ErrRuleUnresolved) Cause() error {
+	return e.Err
+}
+
+// Unwrap -
+func (e ErrRuleUnresolved) Unwrap() error {
+	return e.Err
+}
+
 // Error messages
 var (
 	ErrTraceDataNotReady = errors.New("trace not ready")
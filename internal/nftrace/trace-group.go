@@ -1,6 +1,7 @@
 package nftrace
 
 import (
+	"container/list"
 	"strings"
 	"time"
 
@@ -10,25 +11,82 @@ import (
 	"github.com/Morwran/ebpf-nftrace/internal/nftables/parser"
 	rl "github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
 
+	nftLib "github.com/google/nftables"
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
 
+const (
+	// DefTraceGroupMaxAge - default max age of an open trace group
+	DefTraceGroupMaxAge = 10 * time.Second
+	// DefMaxOpenTraceGroups - default max number of open trace groups
+	DefMaxOpenTraceGroups = 100000
+
+	maxFreeTraceGroups = 1024
+)
+
+const ( // trace group eviction reasons
+	// EvictReasonAge -
+	EvictReasonAge = "age"
+	// EvictReasonSize -
+	EvictReasonSize = "size"
+)
+
 type (
+	// TraceGroupOption - option of the trace group
+	TraceGroupOption func(*TraceGroup)
+
+	// EvictStats - number of trace groups evicted by reason
+	EvictStats struct {
+		ByAge  uint64
+		BySize uint64
+	}
+
+	traceGroupEntry struct {
+		traces   []NftTrace
+		openedAt time.Time
+		el       *list.Element
+	}
+
 	TraceGroup struct {
 		ifaceProvider ifaceProvider
 		ruleProvider  ruleProvider
 		topTrace      NftTrace
-		traceCache    map[uint32][]NftTrace
+		traceCache    map[uint32]*traceGroupEntry
+		order         *list.List
+		free          []*traceGroupEntry
+		maxAge        time.Duration
+		maxGroups     int
 	}
 )
 
-func NewTraceGroup(iface ifaceProvider, rule ruleProvider) *TraceGroup {
-	return &TraceGroup{
+// WithGroupMaxAge - max age of a trace group which has not got its final verdict yet
+func WithGroupMaxAge(d time.Duration) TraceGroupOption {
+	return func(t *TraceGroup) {
+		t.maxAge = d
+	}
+}
+
+// WithMaxOpenGroups - max number of trace groups which have not got their final verdict yet
+func WithMaxOpenGroups(n int) TraceGroupOption {
+	return func(t *TraceGroup) {
+		t.maxGroups = n
+	}
+}
+
+func NewTraceGroup(iface ifaceProvider, rule ruleProvider, opts ...TraceGroupOption) *TraceGroup {
+	t := &TraceGroup{
 		ifaceProvider: iface,
 		ruleProvider:  rule,
-		traceCache:    make(map[uint32][]NftTrace),
+		traceCache:    make(map[uint32]*traceGroupEntry),
+		order:         list.New(),
+		maxAge:        DefTraceGroupMaxAge,
+		maxGroups:     DefMaxOpenTraceGroups,
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	return t
 }
 
 func (t *TraceGroup) AddTrace(tr NftTrace) error {
@@ -39,7 +97,14 @@ func (t *TraceGroup) AddTrace(tr NftTrace) error {
 	if tr.Type == unix.NFT_TRACETYPE_POLICY {
 		tr.Verdict = tr.Policy
 	}
-	t.traceCache[tr.Id] = append(t.traceCache[tr.Id], tr)
+	g, ok := t.traceCache[tr.Id]
+	if !ok {
+		g = t.newEntry()
+		g.openedAt = time.Now()
+		g.el = t.order.PushBack(tr.Id)
+		t.traceCache[tr.Id] = g
+	}
+	g.traces = append(g.traces, tr)
 	t.topTrace = tr
 	return nil
 }
@@ -48,56 +113,115 @@ func (t *TraceGroup) GroupReady() bool {
 	if len(t.traceCache) == 0 {
 		return false
 	}
-	v := expr.VerdictKind(t.topTrace.Verdict).String()
-	return v == expr.VerdictAccept || v == expr.VerdictDrop
+	return traceVerdictScope(t.topTrace, baseChain{}) != verdictScopeNone
+}
+
+// Len - number of open trace groups
+func (t *TraceGroup) Len() int {
+	return len(t.traceCache)
+}
+
+// FlowHash - flow hash of the current group. The first trace of a packet is the one
+// carrying the packet headers, so the hash is taken from it
+func (t *TraceGroup) FlowHash() uint64 {
+	g := t.traceCache[t.topTrace.Id]
+	if g == nil || len(g.traces) == 0 {
+		return 0
+	}
+	return g.traces[0].FlowHash()
 }
 
 func (t *TraceGroup) Close() {
 	t.traceCache = nil
+	t.free = nil
+	t.order.Init()
 	t.topTrace.Reset()
 }
 
 func (t *TraceGroup) Reset() {
-	delete(t.traceCache, t.topTrace.Id)
+	t.remove(t.topTrace.Id)
 	t.topTrace.Reset()
 }
 
-func (t *TraceGroup) ToModel() (m model.Trace, err error) {
-	verdict := strings.Builder{}
-	traces, ok := t.traceCache[t.topTrace.Id]
-	if !ok {
-		return m, ErrTraceGroupEmpty
-	}
-	t.topTrace.Reset()
-	for i, tr := range traces {
-		if tr.Type == unix.NFT_TRACETYPE_RETURN {
-			continue
+// Evict - remove trace groups which are older than max age or exceed max number of open groups.
+// Partial paths of the evicted groups are returned as incomplete traces
+func (t *TraceGroup) Evict(now time.Time) (traces []model.Trace, st EvictStats) {
+	for e := t.order.Front(); e != nil; e = t.order.Front() {
+		id := e.Value.(uint32)
+		g := t.traceCache[id]
+		switch {
+		case t.maxGroups > 0 && t.order.Len() > t.maxGroups:
+			st.BySize++
+		case t.maxAge > 0 && now.Sub(g.openedAt) >= t.maxAge:
+			st.ByAge++
+		default:
+			return traces, st
 		}
-		verdict.WriteString(traceTypes[tr.Type])
-		verdict.WriteString("::")
-		v := expr.VerdictKind(int32(tr.Verdict)).String() //nolint:gosec
-		verdict.WriteString(v)
-		if v != expr.VerdictDrop && v != expr.VerdictAccept && i < len(traces)-1 {
-			verdict.WriteString("->")
+		if m, err := t.incompleteModel(g.traces); err == nil {
+			traces = append(traces, m)
 		}
-		if tr.Type == unix.NFT_TRACETYPE_RULE && tr.RuleHandle != 0 && t.topTrace.RuleHandle == 0 {
-			t.topTrace = tr
+		if t.topTrace.Id == id {
+			t.topTrace.Reset()
 		}
+		t.remove(id)
 	}
+	return traces, st
+}
 
-	if t.topTrace.Type != unix.NFT_TRACETYPE_RULE {
-		return m, errors.New("failed to find trace of rule type")
+func (t *TraceGroup) remove(id uint32) {
+	if g, ok := t.traceCache[id]; ok {
+		t.order.Remove(g.el)
+		delete(t.traceCache, id)
+		if len(t.free) < maxFreeTraceGroups {
+			clear(g.traces)
+			g.traces, g.el = g.traces[:0], nil
+			t.free = append(t.free, g)
+		}
 	}
+}
 
-	re, err := t.ruleProvider.GetRuleForTrace(rl.TraceRuleDescriptor{
-		TableName:  t.topTrace.Table,
-		ChainName:  t.topTrace.Chain,
-		RuleHandle: t.topTrace.RuleHandle,
-		Family:     t.topTrace.Family,
-		TracedAt:   time.Now(),
-	})
-	if err != nil {
-		return m, errors.WithMessagef(err, "trace data: %+v", t.topTrace)
+// newEntry - trace group entries are reused, so steady traffic doesn't allocate them
+func (t *TraceGroup) newEntry() *traceGroupEntry {
+	if n := len(t.free); n > 0 {
+		g := t.free[n-1]
+		t.free = t.free[:n-1]
+		return g
+	}
+	return &traceGroupEntry{}
+}
+
+func (t *TraceGroup) ToModel() (m model.Trace, err error) {
+	g, ok := t.traceCache[t.topTrace.Id]
+	if !ok {
+		return m, ErrTraceGroupEmpty
+	}
+	t.topTrace.Reset()
+	verdict, top := tracePath(g.traces)
+	if top < 0 {
+		// path is terminated by the base chain policy without any matched rule
+		top = len(g.traces) - 1
+	}
+	t.topTrace = g.traces[top]
+
+	var (
+		re         rl.RuleEntry
+		unresolved error
+	)
+	if t.topTrace.Type == unix.NFT_TRACETYPE_RULE {
+		rd := rl.TraceRuleDescriptor{
+			TableName:  t.topTrace.Table,
+			ChainName:  t.topTrace.Chain,
+			RuleHandle: t.topTrace.RuleHandle,
+			Family:     t.topTrace.Family,
+			TracedAt:   time.Now(),
+		}
+		re, err = t.ruleProvider.GetRuleForTrace(rd)
+		switch {
+		case errors.Is(err, rl.ErrNotFoundRule) || errors.Is(err, rl.ErrExpiredTrace):
+			unresolved = ErrRuleUnresolved{Rule: rd, Err: err}
+		case err != nil:
+			return m, errors.WithMessagef(err, "trace data: %+v", t.topTrace)
+		}
 	}
 
 	iifname := t.topTrace.Iifname
@@ -120,32 +244,176 @@ func (t *TraceGroup) ToModel() (m model.Trace, err error) {
 		}
 	}
 
-	m = model.Trace{
-		TrId:       t.topTrace.Id,
-		Table:      t.topTrace.Table,
-		Chain:      t.topTrace.Chain,
-		JumpTarget: t.topTrace.JumpTarget,
-		RuleHandle: t.topTrace.RuleHandle,
-		Family:     parser.TableFamily(t.topTrace.Family).String(),
-		Iifname:    iifname,
-		Oifname:    oifname,
-		SMacAddr:   t.topTrace.SMacAddr,
-		DMacAddr:   t.topTrace.DMacAddr,
-		SAddr:      t.topTrace.SAddr,
-		DAddr:      t.topTrace.DAddr,
-		SPort:      t.topTrace.SPort,
-		DPort:      t.topTrace.DPort,
-		Length:     t.topTrace.Length,
-		IpProto:    protocols.ProtoType(t.topTrace.IpProtocol).String(),
-		Verdict:    verdict.String(),
-		Rule:       re.RuleStr,
-		Cnt:        t.topTrace.Cnt,
-		Timestamp:  time.Now(),
+	m = newModel(g.traces, t.topTrace, verdict, t.baseChain(g.traces[0]))
+	m.Iifname, m.Oifname, m.Rule = iifname, oifname, re.RuleStr
+	m.Path = t.hops(g.traces, top, re.RuleStr)
+	return m, unresolved
+}
+
+// hops - structured path of the trace group. The rule of the top trace is already resolved,
+// rules of other hops are resolved on the best effort basis
+func (t *TraceGroup) hops(traces []NftTrace, top int, topRule string) []model.Hop {
+	path := make([]model.Hop, 0, len(traces))
+	for i, tr := range traces {
+		h := model.Hop{
+			Type:       traceTypes[tr.Type],
+			Table:      tr.Table,
+			Chain:      tr.Chain,
+			Handle:     tr.RuleHandle,
+			Verdict:    verdictKind(tr.Verdict).String(),
+			JumpTarget: tr.JumpTarget,
+		}
+		switch {
+		case i == top:
+			h.Rule = topRule
+		case tr.Type == unix.NFT_TRACETYPE_RULE && tr.RuleHandle != 0:
+			re, _ := t.ruleProvider.GetRuleForTrace(rl.TraceRuleDescriptor{
+				TableName:  tr.Table,
+				ChainName:  tr.Chain,
+				RuleHandle: tr.RuleHandle,
+				Family:     tr.Family,
+				TracedAt:   time.Now(),
+			})
+			h.Rule = re.RuleStr
+		}
+		path = append(path, h)
 	}
+	return path
+}
 
+// incompleteModel - best effort conversion of a partial path, lookup failures are not fatal here
+func (t *TraceGroup) incompleteModel(traces []NftTrace) (m model.Trace, err error) {
+	if len(traces) == 0 {
+		return m, ErrTraceGroupEmpty
+	}
+	verdict, top := tracePath(traces)
+	if top < 0 {
+		top = 0
+	}
+	tr := traces[top]
+	m = newModel(traces, tr, verdict, baseChain{})
+	m.Incomplete = true
+	m.Iifname, m.Oifname = tr.Iifname, tr.Oifname
+	if m.Iifname == "" && tr.Iif != 0 {
+		m.Iifname, _ = t.ifaceProvider.GetIface(int(tr.Iif))
+	}
+	if m.Oifname == "" && tr.Oif != 0 {
+		m.Oifname, _ = t.ifaceProvider.GetIface(int(tr.Oif))
+	}
+	m.Path = t.hops(traces, -1, "")
+	if tr.Type == unix.NFT_TRACETYPE_RULE && tr.RuleHandle != 0 {
+		m.Rule = m.Path[top].Rule
+	}
 	return m, nil
 }
 
+// tracePath - render the path of a trace group and find the index of the first
+// trace of rule type. The index is negative if there is no such trace
+func tracePath(traces []NftTrace) (string, int) {
+	const hopVerdictLen = 16
+	verdict := strings.Builder{}
+	verdict.Grow(len(traces) * hopVerdictLen)
+	top := -1
+	for i, tr := range traces {
+		if tr.Type == unix.NFT_TRACETYPE_RETURN {
+			continue
+		}
+		verdict.WriteString(traceTypes[tr.Type])
+		verdict.WriteString("::")
+		verdict.WriteString(verdictKind(tr.Verdict).String())
+		if traceVerdictScope(tr, baseChain{}) == verdictScopeNone && i < len(traces)-1 {
+			verdict.WriteString("->")
+		}
+		if tr.Type == unix.NFT_TRACETYPE_RULE && tr.RuleHandle != 0 && top < 0 {
+			top = i
+		}
+	}
+	return verdict.String(), top
+}
+
+// baseChain - base chain of the group, the traversal starts in it. It's unknown if the chain isn't found
+// or the first trace isn't of a base chain since the first events of the group are lost
+func (t *TraceGroup) baseChain(first NftTrace) baseChain {
+	ce, err := t.ruleProvider.GetChainForTrace(rl.TraceRuleDescriptor{
+		TableName: first.Table,
+		ChainName: first.Chain,
+		Family:    first.Family,
+		TracedAt:  time.Now(),
+	})
+	if err != nil || ce.ChainNative == nil || ce.ChainNative.Hooknum == nil {
+		return baseChain{}
+	}
+	ch := *ce.ChainNative
+	if ch.Table == nil {
+		ch.Table = &nftLib.Table{Name: first.Table, Family: nftLib.TableFamily(first.Family)}
+	}
+	return baseChain{known: true, last: lastBaseChain(&ch, first.Nfproto, t.ruleProvider.ListBaseChains())}
+}
+
+// newModel - the final verdict is set if the last trace finishes the packet in the base chain
+func newModel(traces []NftTrace, top NftTrace, verdict string, bc baseChain) model.Trace {
+	var (
+		ct    CtInfo
+		final string
+	)
+	if last := traces[len(traces)-1]; traceVerdictScope(last, bc) == verdictScopePacket {
+		final = verdictKind(last.Verdict).String()
+	}
+	var pkt []byte
+	for _, tr := range traces {
+		if !ct.Valid && tr.Ct.Valid {
+			ct = tr.Ct
+		}
+		if pkt == nil {
+			pkt = tr.Packet
+		}
+	}
+	var l3proto string
+	if top.Nfproto != 0 {
+		l3proto = parser.TableFamily(top.Nfproto).String()
+	}
+	m := model.Trace{
+		TrId:       top.Id,
+		Table:      top.Table,
+		Chain:      top.Chain,
+		JumpTarget: top.JumpTarget,
+		RuleHandle: top.RuleHandle,
+		Family:     parser.TableFamily(top.Family).String(),
+		L3Proto:    l3proto,
+		Iif:        top.Iif,
+		Oif:        top.Oif,
+		SMacAddr:   top.SMacAddr,
+		DMacAddr:   top.DMacAddr,
+		SAddr:      top.SAddr,
+		DAddr:      top.DAddr,
+		SPort:      top.SPort,
+		DPort:      top.DPort,
+		Length:     top.Length,
+		IpProto:    protocols.ProtoType(top.IpProtocol).String(),
+		Verdict:    verdict,
+		Final:      final,
+		Cnt:        top.Cnt,
+		Bytes:      top.Bytes,
+		FirstSeen:  top.FirstSeen,
+		LastSeen:   top.LastSeen,
+		Timestamp:  time.Now(),
+		Packet:     pkt,
+	}
+	if m.FirstSeen.IsZero() {
+		m.FirstSeen = m.Timestamp
+	}
+	if m.LastSeen.IsZero() {
+		m.LastSeen = m.Timestamp
+	}
+	if ct.Valid {
+		m.CtId = ct.Id
+		m.CtState = expr.CtState(ct.State).String()
+		m.CtDirection = expr.CtDir(ct.Direction).String()
+		m.CtStatus = expr.CtStatus(ct.Status).String()
+	}
+	return m
+}
+
 var traceTypes = map[uint32]string{
 	unix.NFT_TRACETYPE_RULE:   "rule",
 	unix.NFT_TRACETYPE_RETURN: "return",
@@ -1,10 +1,17 @@
 package nftrace
 
 import (
+	"context"
+	"slices"
 	"testing"
+	"time"
 
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
 	rl "github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
 
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	nftLib "github.com/google/nftables"
 	nfte "github.com/google/nftables/expr"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -36,6 +43,14 @@ func (r *ruleProviderMock) GetRuleForTrace(tr rl.TraceRuleDescriptor) (rl.RuleEn
 	return rl.RuleEntry{}, nil
 }
 
+func (r *ruleProviderMock) GetChainForTrace(tr rl.TraceRuleDescriptor) (rl.ChainEntry, error) {
+	return rl.ChainEntry{}, rl.ErrNotFoundChain
+}
+
+func (r *ruleProviderMock) ListBaseChains() []rl.ChainEntry {
+	return nil
+}
+
 func Test_TraceGroup(t *testing.T) {
 	verdictGoTo := nfte.VerdictGoto
 	verdictContinue := nfte.VerdictContinue
@@ -112,7 +127,531 @@ func Test_TraceGroup(t *testing.T) {
 			require.NoError(t, err)
 			require.Equal(t, tc.verdict, md.Verdict)
 			require.Equal(t, tc.expHandle, md.RuleHandle)
+			require.Len(t, md.Path, len(tc.data))
+			for i := range tc.data {
+				require.Equal(t, tc.data[i].RuleHandle, md.Path[i].Handle)
+			}
 			tg.Close()
 		})
 	}
 }
+
+func Test_TraceGroupFlowHash(t *testing.T) {
+	verdictJump := nfte.VerdictJump
+	mock := DepsMock{&ifaceProviderMock{}, &ruleProviderMock{}}
+	path := []NetlinkTrace{
+		{Id: 1, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 1, Verdict: uint32(verdictJump)},
+		{Id: 1, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 2, Verdict: uint32(nfte.VerdictAccept)},
+	}
+	path[0].Nh.SAddr = []byte{10, 0, 0, 1}
+	path[0].Nh.DAddr = []byte{10, 0, 0, 2}
+	path[0].Nh.Protocol = unix.IPPROTO_TCP
+	path[0].Th.SPort, path[0].Th.DPort = 1000, 80
+
+	tg := NewTraceGroup(mock.iface, mock.rule)
+	defer tg.Close()
+	require.Zero(t, tg.FlowHash())
+	for i := range path {
+		require.NoError(t, tg.AddTrace(path[i].ToNftTrace()))
+	}
+	first := path[0].ToNftTrace()
+	require.Equal(t, first.FlowHash(), tg.FlowHash())
+
+	other := path[0]
+	other.Th.DPort = 443
+	otherNft := other.ToNftTrace()
+	require.NotEqual(t, first.FlowHash(), otherNft.FlowHash())
+}
+
+func Test_NetlinkTraceParity(t *testing.T) {
+	tr := NetlinkTrace{Iif: 2, Oif: 3}
+	tr.ResolveIfaces(&ifaceProviderMock{})
+	nft := tr.ToNftTrace()
+	require.Equal(t, ifaceName, nft.Iifname)
+	require.Equal(t, ifaceName, nft.Oifname)
+	require.False(t, nft.SAddr.IsValid())
+	require.True(t, nft.SMacAddr.IsZero())
+	require.Equal(t, uint64(1), nft.Cnt)
+
+	var ebpfTr EbpfTrace
+	ebpfNft := ebpfTr.ToNftTrace(nil)
+	require.False(t, ebpfNft.SAddr.IsValid())
+	require.True(t, ebpfNft.SMacAddr.IsZero())
+}
+
+func Test_FlowSampler(t *testing.T) {
+	require.False(t, flowSampler(0).Enabled())
+	require.True(t, flowSampler(0).Sample(7))
+	s := flowSampler(4)
+	require.True(t, s.Enabled())
+	require.True(t, s.Sample(8))
+	require.False(t, s.Sample(9))
+}
+
+func Test_TraceAssemblerFlowSampling(t *testing.T) {
+	const (
+		flows   = 64
+		packets = 3
+	)
+	verdictJump := nfte.VerdictJump
+	mock := DepsMock{&ifaceProviderMock{}, &ruleProviderMock{}}
+	que := queue.NewCachedQue(flows * packets)
+	asm := newTraceAssembler(traceAssemblerDeps{
+		TraceGroup: NewTraceGroup(mock.iface, mock.rule),
+		Que:        que,
+		Subj:       observer.NewSubject(),
+	}, Aggregation{}, true, flowSampler(4))
+	id := uint32(0)
+	for p := range packets {
+		for f := range uint32(flows) {
+			id++
+			// only the first event of the packet carries the headers
+			require.NoError(t, asm.Add(NftTrace{
+				Id: id, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 1, Verdict: uint32(verdictJump),
+				Family: unix.NFPROTO_IPV4, IpProtocol: unix.IPPROTO_TCP, SPort: 1000 + f, DPort: 80, Length: uint32(p),
+			}, time.Now()))
+			require.NoError(t, asm.Add(NftTrace{
+				Id: id, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 2, Verdict: uint32(nfte.VerdictAccept),
+			}, time.Now()))
+		}
+	}
+	perFlow := make(map[uint32]int)
+	buf := make([]model.Trace, flows*packets)
+	for rest := que.Len(); rest > 0; {
+		n, err := que.ReadBatch(context.Background(), buf)
+		require.NoError(t, err)
+		for _, m := range buf[:n] {
+			require.Len(t, m.Path, 2)
+			perFlow[m.SPort]++
+		}
+		rest -= n
+	}
+	require.NotEmpty(t, perFlow)
+	require.Less(t, len(perFlow), flows)
+	for port, n := range perFlow {
+		require.Equalf(t, packets, n, "every packet of the sampled flow %d is traced", port)
+	}
+}
+
+func Test_TraceGroupEvict(t *testing.T) {
+	verdictJump := nfte.VerdictJump
+	mock := DepsMock{&ifaceProviderMock{}, &ruleProviderMock{}}
+	open := func(tg *TraceGroup, ids ...uint32) {
+		for _, id := range ids {
+			require.NoError(t, tg.AddTrace(NftTrace{
+				Id: id, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 1, Verdict: uint32(verdictJump),
+			}))
+		}
+	}
+
+	t.Run("by age", func(t *testing.T) {
+		tg := NewTraceGroup(mock.iface, mock.rule, WithGroupMaxAge(time.Minute))
+		defer tg.Close()
+		open(tg, 1, 2)
+		traces, st := tg.Evict(time.Now())
+		require.Empty(t, traces)
+		require.Equal(t, EvictStats{}, st)
+
+		traces, st = tg.Evict(time.Now().Add(time.Minute))
+		require.Equal(t, EvictStats{ByAge: 2}, st)
+		require.Len(t, traces, 2)
+		require.True(t, traces[0].Incomplete)
+		require.Equal(t, uint32(1), traces[0].TrId)
+		require.Equal(t, "rule::jump", traces[0].Verdict)
+		require.Zero(t, tg.Len())
+	})
+
+	t.Run("by size", func(t *testing.T) {
+		tg := NewTraceGroup(mock.iface, mock.rule, WithMaxOpenGroups(2))
+		defer tg.Close()
+		open(tg, 1, 2, 3)
+		traces, st := tg.Evict(time.Now())
+		require.Equal(t, EvictStats{BySize: 1}, st)
+		require.Len(t, traces, 1)
+		require.Equal(t, uint32(1), traces[0].TrId)
+		require.Equal(t, 2, tg.Len())
+	})
+
+	t.Run("completed group is not evicted", func(t *testing.T) {
+		tg := NewTraceGroup(mock.iface, mock.rule, WithGroupMaxAge(time.Minute))
+		defer tg.Close()
+		open(tg, 1)
+		require.NoError(t, tg.AddTrace(NftTrace{
+			Id: 1, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 2, Verdict: uint32(nfte.VerdictAccept),
+		}))
+		require.True(t, tg.GroupReady())
+		_, err := tg.ToModel()
+		require.NoError(t, err)
+		tg.Reset()
+		traces, st := tg.Evict(time.Now().Add(time.Hour))
+		require.Empty(t, traces)
+		require.Equal(t, EvictStats{}, st)
+	})
+}
+
+func Test_TraceGroupVerdicts(t *testing.T) {
+	var (
+		verdictJump     = nfte.VerdictJump
+		verdictGoTo     = nfte.VerdictGoto
+		verdictContinue = nfte.VerdictContinue
+		verdictReturn   = nfte.VerdictReturn
+	)
+	const queueNum = 5
+	rule := func(chain string, handle uint64, verdict uint32, jt string) NftTrace {
+		return NftTrace{Id: 1, Type: unix.NFT_TRACETYPE_RULE, Table: "filter", Chain: chain,
+			RuleHandle: handle, Verdict: verdict, JumpTarget: jt}
+	}
+	ret := func(chain string) NftTrace {
+		return NftTrace{Id: 1, Type: unix.NFT_TRACETYPE_RETURN, Table: "filter", Chain: chain,
+			Verdict: uint32(verdictContinue)}
+	}
+	policy := func(chain string, policy uint32) NftTrace {
+		return NftTrace{Id: 1, Type: unix.NFT_TRACETYPE_POLICY, Table: "filter", Chain: chain, Policy: policy}
+	}
+
+	testCases := []struct {
+		name       string
+		data       []NftTrace
+		verdict    string
+		final      string
+		expHandle  uint64
+		readyAfter int
+	}{
+		{
+			name: "jump to subchain then policy drop",
+			data: []NftTrace{
+				rule("input", 4, uint32(verdictJump), "web"),
+				rule("web", 9, uint32(verdictContinue), ""),
+				ret("web"),
+				policy("input", uint32(nfte.VerdictDrop)),
+			},
+			verdict:    "rule::jump->rule::continue->policy::drop",
+			final:      "drop",
+			expHandle:  4,
+			readyAfter: 4,
+		},
+		{
+			name: "policy accept without matched rules",
+			data: []NftTrace{
+				policy("input", uint32(nfte.VerdictAccept)),
+			},
+			verdict:    "policy::accept",
+			final:      "accept",
+			readyAfter: 1,
+		},
+		{
+			name: "queue to userspace with queue number",
+			data: []NftTrace{
+				rule("input", 4, uint32(verdictGoTo), "ips"),
+				rule("ips", 12, uint32(nfte.VerdictQueue)|queueNum<<16, ""),
+			},
+			verdict:    "rule::goto->rule::queue",
+			final:      "queue",
+			expHandle:  4,
+			readyAfter: 2,
+		},
+		{
+			name: "stolen",
+			data: []NftTrace{
+				rule("input", 7, uint32(nfte.VerdictStolen), ""),
+			},
+			verdict:    "rule::stolen",
+			final:      "stolen",
+			expHandle:  7,
+			readyAfter: 1,
+		},
+		{
+			name: "return from subchain and accept in base chain",
+			data: []NftTrace{
+				rule("forward", 2, uint32(verdictJump), "limits"),
+				rule("limits", 21, uint32(verdictReturn), ""),
+				rule("forward", 3, uint32(nfte.VerdictAccept), ""),
+			},
+			verdict:    "rule::jump->rule::return->rule::accept",
+			final:      "accept",
+			expHandle:  2,
+			readyAfter: 3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tg := NewTraceGroup(&ifaceProviderMock{}, &ruleProviderMock{})
+			defer tg.Close()
+			for i := range tc.data {
+				require.NoError(t, tg.AddTrace(tc.data[i]))
+				require.Equal(t, i+1 == tc.readyAfter, tg.GroupReady())
+			}
+			md, err := tg.ToModel()
+			require.NoError(t, err)
+			require.Equal(t, tc.verdict, md.Verdict)
+			require.Equal(t, tc.final, md.Final)
+			require.Equal(t, tc.expHandle, md.RuleHandle)
+			require.Len(t, md.Path, len(tc.data))
+			require.Equal(t, tc.final, md.Path[len(md.Path)-1].Verdict)
+		})
+	}
+}
+
+type chainProviderMock struct {
+	ruleProviderMock
+	chains  map[string]*nftLib.Chain
+	ruleset []string // base chains of the ruleset, all of the chains if empty
+}
+
+func (r *chainProviderMock) GetChainForTrace(tr rl.TraceRuleDescriptor) (rl.ChainEntry, error) {
+	if ch := r.chains[tr.ChainName]; ch != nil {
+		return rl.ChainEntry{ChainNative: ch}, nil
+	}
+	return rl.ChainEntry{}, rl.ErrNotFoundChain
+}
+
+func (r *chainProviderMock) ListBaseChains() (ret []rl.ChainEntry) {
+	for name, ch := range r.chains {
+		if ch.Hooknum != nil && (len(r.ruleset) == 0 || slices.Contains(r.ruleset, name)) {
+			ret = append(ret, rl.ChainEntry{ChainNative: ch})
+		}
+	}
+	return ret
+}
+
+func Test_TraceGroupFinalByHook(t *testing.T) {
+	verdictJump := nfte.VerdictJump
+	table := &nftLib.Table{Name: "filter", Family: nftLib.TableFamilyINet}
+	base := func(name string, hook *nftLib.ChainHook, typ nftLib.ChainType, prio *nftLib.ChainPriority) *nftLib.Chain {
+		return &nftLib.Chain{Name: name, Table: table, Hooknum: hook, Type: typ, Priority: prio}
+	}
+	chains := map[string]*nftLib.Chain{
+		"prerouting":  base("prerouting", nftLib.ChainHookPrerouting, nftLib.ChainTypeFilter, nftLib.ChainPriorityFilter),
+		"input":       base("input", nftLib.ChainHookInput, nftLib.ChainTypeFilter, nftLib.ChainPriorityFilter),
+		"forward":     base("forward", nftLib.ChainHookForward, nftLib.ChainTypeFilter, nftLib.ChainPriorityFilter),
+		"output":      base("output", nftLib.ChainHookOutput, nftLib.ChainTypeFilter, nftLib.ChainPriorityFilter),
+		"nat-post":    base("nat-post", nftLib.ChainHookPostrouting, nftLib.ChainTypeNAT, nftLib.ChainPriorityNATSource),
+		"postrouting": base("postrouting", nftLib.ChainHookPostrouting, nftLib.ChainTypeFilter, nftLib.ChainPriorityFilter),
+		"web":         {Name: "web", Table: table},
+	}
+	noPostrouting := []string{"prerouting", "input", "forward", "output", "nat-post"}
+	rule := func(chain string, handle uint64, verdict uint32, jt string) NftTrace {
+		return NftTrace{Id: 1, Type: unix.NFT_TRACETYPE_RULE, Family: unix.NFPROTO_INET, Nfproto: unix.NFPROTO_IPV4,
+			Table: "filter", Chain: chain, RuleHandle: handle, Verdict: verdict, JumpTarget: jt}
+	}
+	policy := func(chain string, policy uint32) NftTrace {
+		return NftTrace{Id: 1, Type: unix.NFT_TRACETYPE_POLICY, Family: unix.NFPROTO_INET, Nfproto: unix.NFPROTO_IPV4,
+			Table: "filter", Chain: chain, Policy: policy}
+	}
+
+	testCases := []struct {
+		name    string
+		ruleset []string
+		data    []NftTrace
+		verdict string
+		final   string
+	}{
+		{
+			name:    "accept in prerouting, the packet goes on",
+			data:    []NftTrace{rule("prerouting", 1, uint32(nfte.VerdictAccept), "")},
+			verdict: "rule::accept",
+		},
+		{
+			name: "jump to subchain then accept in input",
+			data: []NftTrace{
+				rule("input", 4, uint32(verdictJump), "web"),
+				rule("web", 9, uint32(nfte.VerdictAccept), ""),
+			},
+			verdict: "rule::jump->rule::accept",
+			final:   "accept",
+		},
+		{
+			name:    "policy accept in forward, the packet goes on to postrouting",
+			data:    []NftTrace{policy("forward", uint32(nfte.VerdictAccept))},
+			verdict: "policy::accept",
+		},
+		{
+			name:    "accept in forward without postrouting chains",
+			ruleset: noPostrouting,
+			data:    []NftTrace{rule("forward", 2, uint32(nfte.VerdictAccept), "")},
+			verdict: "rule::accept",
+			final:   "accept",
+		},
+		{
+			name:    "policy accept in forward without postrouting chains",
+			ruleset: noPostrouting,
+			data:    []NftTrace{policy("forward", uint32(nfte.VerdictAccept))},
+			verdict: "policy::accept",
+			final:   "accept",
+		},
+		{
+			name:    "accept in output, the packet goes on to postrouting",
+			data:    []NftTrace{rule("output", 5, uint32(nfte.VerdictAccept), "")},
+			verdict: "rule::accept",
+		},
+		{
+			name:    "accept in output without postrouting chains",
+			ruleset: noPostrouting,
+			data:    []NftTrace{rule("output", 5, uint32(nfte.VerdictAccept), "")},
+			verdict: "rule::accept",
+			final:   "accept",
+		},
+		{
+			name:    "drop in forward",
+			data:    []NftTrace{rule("forward", 2, uint32(nfte.VerdictDrop), "")},
+			verdict: "rule::drop",
+			final:   "drop",
+		},
+		{
+			name:    "accept in nat postrouting after the filter one",
+			data:    []NftTrace{rule("nat-post", 3, uint32(nfte.VerdictAccept), "")},
+			verdict: "rule::accept",
+			final:   "accept",
+		},
+		{
+			name:    "policy accept in filter postrouting, the nat chain doesn't filter",
+			data:    []NftTrace{policy("postrouting", uint32(nfte.VerdictAccept))},
+			verdict: "policy::accept",
+			final:   "accept",
+		},
+		{
+			name:    "first events are lost, the base chain is unknown",
+			data:    []NftTrace{rule("web", 9, uint32(nfte.VerdictAccept), "")},
+			verdict: "rule::accept",
+			final:   "accept",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tg := NewTraceGroup(&ifaceProviderMock{}, &chainProviderMock{chains: chains, ruleset: tc.ruleset})
+			defer tg.Close()
+			for i := range tc.data {
+				require.NoError(t, tg.AddTrace(tc.data[i]))
+			}
+			require.True(t, tg.GroupReady())
+			md, err := tg.ToModel()
+			require.NoError(t, err)
+			require.Equal(t, tc.verdict, md.Verdict)
+			require.Equal(t, tc.final, md.Final)
+		})
+	}
+}
+
+type lateRuleProviderMock struct {
+	known    bool
+	replaced bool
+	lookups  []rl.TraceRuleDescriptor
+}
+
+func (r *lateRuleProviderMock) GetRuleForTrace(tr rl.TraceRuleDescriptor) (rl.RuleEntry, error) {
+	r.lookups = append(r.lookups, tr)
+	switch {
+	case r.replaced:
+		return rl.RuleEntry{RuleStr: "tcp dport 81 accept"}, rl.ErrExpiredTrace
+	case !r.known:
+		return rl.RuleEntry{}, rl.ErrNotFoundRule
+	}
+	return rl.RuleEntry{RuleStr: "tcp dport 80 accept"}, nil
+}
+
+func (r *lateRuleProviderMock) GetChainForTrace(tr rl.TraceRuleDescriptor) (rl.ChainEntry, error) {
+	return rl.ChainEntry{}, rl.ErrNotFoundChain
+}
+
+func (r *lateRuleProviderMock) ListBaseChains() []rl.ChainEntry {
+	return nil
+}
+
+func Test_RuleResolver(t *testing.T) {
+	rule := &lateRuleProviderMock{}
+	tg := NewTraceGroup(&ifaceProviderMock{}, rule)
+	defer tg.Close()
+
+	toModel := func(id uint32) (model.Trace, rl.TraceRuleDescriptor) {
+		require.NoError(t, tg.AddTrace(NftTrace{
+			Id: id, Type: unix.NFT_TRACETYPE_RULE, Table: "filter", Chain: "input",
+			RuleHandle: 5, Verdict: uint32(nfte.VerdictAccept),
+		}))
+		m, err := tg.ToModel()
+		tg.Reset()
+		var unresolved ErrRuleUnresolved
+		require.ErrorAs(t, err, &unresolved)
+		require.Equal(t, uint64(5), unresolved.Rule.RuleHandle)
+		require.Empty(t, m.Rule)
+		return m, unresolved.Rule
+	}
+	now := time.Now()
+
+	t.Run("resolved on retry", func(t *testing.T) {
+		r := newRuleResolver(rule, WithRuleResolveWindow(time.Second), WithMaxPendingTraces(10))
+		m, rd := toModel(1)
+		require.True(t, r.Defer(m, rd, now))
+
+		traces, st := r.Resolve(now.Add(ruleResolveRetryInterval))
+		require.Empty(t, traces)
+		require.Equal(t, ResolveStats{}, st)
+		require.Equal(t, 1, r.Len())
+
+		rule.known = true
+		defer func() { rule.known = false }()
+		traces, st = r.Resolve(now.Add(2 * ruleResolveRetryInterval))
+		require.Equal(t, ResolveStats{Resolved: 1}, st)
+		require.Len(t, traces, 1)
+		require.Equal(t, "tcp dport 80 accept", traces[0].Rule)
+		require.Equal(t, "tcp dport 80 accept", traces[0].Path[0].Rule)
+		require.Zero(t, r.Len())
+	})
+
+	t.Run("handle only after the window", func(t *testing.T) {
+		r := newRuleResolver(rule, WithRuleResolveWindow(time.Second), WithMaxPendingTraces(10))
+		m, rd := toModel(2)
+		require.True(t, r.Defer(m, rd, now))
+
+		traces, st := r.Resolve(now.Add(time.Second))
+		require.Equal(t, ResolveStats{Unresolved: 1}, st)
+		require.Len(t, traces, 1)
+		require.Equal(t, "handle 5", traces[0].Rule)
+		require.Equal(t, uint32(2), traces[0].TrId)
+	})
+
+	t.Run("rule is looked up once per retry at the trace time", func(t *testing.T) {
+		r := newRuleResolver(rule, WithRuleResolveWindow(time.Second), WithMaxPendingTraces(10))
+		var tracedAt []time.Time
+		for id := uint32(10); id < 13; id++ {
+			m, rd := toModel(id)
+			require.True(t, r.Defer(m, rd, now))
+			tracedAt = append(tracedAt, rd.TracedAt)
+		}
+		rule.lookups = nil
+		traces, _ := r.Resolve(now.Add(ruleResolveRetryInterval))
+		require.Empty(t, traces)
+		require.Len(t, rule.lookups, 1)
+
+		rule.known = true
+		defer func() { rule.known = false }()
+		rule.lookups = nil
+		traces, st := r.Resolve(now.Add(2 * ruleResolveRetryInterval))
+		require.Equal(t, ResolveStats{Resolved: 3}, st)
+		require.Len(t, traces, 3)
+		require.Len(t, rule.lookups, 3)
+		for i, rd := range rule.lookups {
+			require.Equal(t, tracedAt[i], rd.TracedAt)
+		}
+	})
+
+	t.Run("rule replaced after the trace", func(t *testing.T) {
+		r := newRuleResolver(rule, WithRuleResolveWindow(time.Second), WithMaxPendingTraces(10))
+		m, rd := toModel(4)
+		require.True(t, r.Defer(m, rd, now))
+		rule.replaced = true
+		defer func() { rule.replaced = false }()
+		traces, st := r.Resolve(now.Add(ruleResolveRetryInterval))
+		require.Equal(t, ResolveStats{Unresolved: 1}, st)
+		require.Len(t, traces, 1)
+		require.Equal(t, "handle 5", traces[0].Rule)
+		require.Zero(t, r.Len())
+	})
+
+	t.Run("no room for pending trace", func(t *testing.T) {
+		r := newRuleResolver(rule, WithRuleResolveWindow(time.Second), WithMaxPendingTraces(1))
+		m, rd := toModel(3)
+		require.True(t, r.Defer(m, rd, now))
+		require.False(t, r.Defer(m, rd, now))
+		require.Equal(t, 1, r.Len())
+	})
+}
@@ -0,0 +1,129 @@
+package cachedque
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	// QueOption -
+	QueOption func(*queConfig)
+
+	// Policy - what the que does with a new record when it's full
+	Policy int
+
+	// DropHandler - called with count of the records dropped by the policy
+	DropHandler func(p Policy, cnt int)
+
+	queConfig struct {
+		window       time.Duration
+		policy       Policy
+		blockTimeout time.Duration
+		dropHandler  DropHandler
+	}
+)
+
+const (
+	// PolicyDropNewest - the new record is rejected with ErrQueIsFull
+	PolicyDropNewest Policy = iota
+	// PolicyDropOldest - the oldest record is dropped to make room for the new one
+	PolicyDropOldest
+	// PolicyBlock - the writer waits for free room up to the block timeout, then the new record is rejected
+	PolicyBlock
+	// PolicyPriority - records with the drop verdict evict the oldest records with other verdicts,
+	// other records are rejected
+	PolicyPriority
+)
+
+// DefBlockTimeout - default wait time of PolicyBlock
+const DefBlockTimeout = 100 * time.Millisecond
+
+var (
+	ErrQueIsFull   = errors.New("que is full")
+	ErrQueIsClosed = errors.New("que is closed")
+)
+
+var policyNames = [...]string{
+	PolicyDropNewest: "drop-newest",
+	PolicyDropOldest: "drop-oldest",
+	PolicyBlock:      "block",
+	PolicyPriority:   "priority",
+}
+
+// String -
+func (p Policy) String() string {
+	if p >= 0 && int(p) < len(policyNames) {
+		return policyNames[p]
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy - parse the policy name
+func ParsePolicy(s string) (Policy, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, n := range policyNames {
+		if n == s {
+			return Policy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown que policy '%s', expected one of: %s", s, strings.Join(policyNames[:], ", "))
+}
+
+// Policies - all the policies
+func Policies() []Policy {
+	ret := make([]Policy, len(policyNames))
+	for i := range ret {
+		ret[i] = Policy(i)
+	}
+	return ret
+}
+
+// WithFlushWindow - aggregated records are held in the que for the window before they are read,
+// so all traces of the same key within the window are merged into one record
+func WithFlushWindow(d time.Duration) QueOption {
+	return func(c *queConfig) {
+		c.window = d
+	}
+}
+
+// WithPolicy - overflow policy of the que, PolicyDropNewest by default
+func WithPolicy(p Policy) QueOption {
+	return func(c *queConfig) {
+		c.policy = p
+	}
+}
+
+// WithBlockTimeout - max time the writer waits for free room with PolicyBlock
+func WithBlockTimeout(d time.Duration) QueOption {
+	return func(c *queConfig) {
+		c.blockTimeout = d
+	}
+}
+
+// WithDropHandler - handler of the records dropped due to overflow
+func WithDropHandler(h DropHandler) QueOption {
+	return func(c *queConfig) {
+		c.dropHandler = h
+	}
+}
+
+func newQueConfig(opts []QueOption) queConfig {
+	c := queConfig{blockTimeout: DefBlockTimeout}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c *queConfig) onDropped(n int) {
+	if n > 0 && c.dropHandler != nil {
+		c.dropHandler(c.policy, n)
+	}
+}
+
+// isPriority - traces with the drop verdict are kept in favor of the others when the que is full
+func isPriority(final string) bool {
+	return final == "drop"
+}
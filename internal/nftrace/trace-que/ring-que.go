@@ -0,0 +1,411 @@
+package cachedque
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+)
+
+type (
+	// traceRingQue - bounded MPSC ring of records (the sequence-number ring by D. Vyukov).
+	// Writers never take a lock to enqueue a record, upserts lock one stripe of the index only.
+	// The single consumer is either the Reader goroutine or the ReadBatch caller. The writers
+	// of PolicyDropOldest and PolicyPriority take the records of the full ring as the consumer does,
+	// under the same pop lock
+	traceRingQue struct {
+		queConfig
+		cells   []ringCell
+		mask    uint64
+		tail    atomic.Uint64
+		head    atomic.Uint64
+		index   [ringIndexStripes]ringIndexStripe
+		pool    sync.Pool
+		readMu  sync.Mutex
+		popMu   sync.Mutex // the consumer and the evicting writers
+		ready   chan struct{}
+		space   chan struct{}
+		done    chan struct{}
+		ch      chan model.Trace
+		stopped chan struct{}
+		runOnce sync.Once
+		once    sync.Once
+		pending atomic.Int32
+	}
+
+	ringCell struct {
+		seq atomic.Uint64
+		e   *ringEntry
+	}
+
+	ringEntry struct {
+		key uint64
+		at  time.Time
+		val model.Trace
+	}
+
+	ringIndexStripe struct {
+		sync.Mutex
+		m map[uint64]*ringEntry
+		_ [48]byte // keeps stripes on separate cache lines
+	}
+)
+
+const (
+	ringIndexStripes = 64
+	ringReadBatch    = 256
+	ringBlockPoll    = time.Millisecond
+)
+
+var _ CachedQueFace = (*traceRingQue)(nil)
+
+// NewRingQue - lock-free ring implementation of CachedQueFace. The size is rounded up to a power of two, at least 2
+func NewRingQue(size int, opts ...QueOption) (*traceRingQue, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("NewRingQue incorrect size=%d. size must be > 0", size)
+	}
+	c := newQueConfig(opts)
+	if c.policy < 0 || int(c.policy) >= len(policyNames) {
+		return nil, fmt.Errorf("ring que doesn't support '%s' policy", c.policy)
+	}
+	// the sequence numbers of one cell can't tell a full ring from an empty one
+	n := max(uint64(1)<<bits.Len64(uint64(size-1)), 2)
+	q := &traceRingQue{
+		queConfig: c,
+		cells:     make([]ringCell, n),
+		mask:      n - 1,
+		ready:     make(chan struct{}, 1),
+		space:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		ch:        make(chan model.Trace),
+	}
+	for i := range q.cells {
+		q.cells[i].seq.Store(uint64(i))
+	}
+	for i := range q.index {
+		q.index[i].m = make(map[uint64]*ringEntry)
+	}
+	q.pool.New = func() any { return new(ringEntry) }
+	return q, nil
+}
+
+// Enque -
+func (q *traceRingQue) Enque(vals ...model.Trace) (err error) {
+	var dropped int
+	for i := range vals {
+		e := q.pool.Get().(*ringEntry)
+		e.key, e.val = 0, vals[i]
+		n, ok := q.push(e)
+		if dropped += n; !ok {
+			q.pool.Put(e)
+			dropped++
+			err = ErrQueIsFull
+		}
+	}
+	q.onDropped(dropped)
+	return err
+}
+
+// Upsert -
+func (q *traceRingQue) Upsert(key uint64, val model.Trace) error {
+	if key == 0 {
+		return q.Enque(val)
+	}
+	s := &q.index[key%ringIndexStripes]
+	var (
+		deadline time.Time
+		dropped  int
+	)
+	defer func() { q.onDropped(dropped) }()
+	for {
+		s.Lock()
+		if e, ok := s.m[key]; ok {
+			e.val.Merge(val)
+			s.Unlock()
+			return nil
+		}
+		e := q.pool.Get().(*ringEntry)
+		e.key, e.at, e.val = key, time.Now(), val
+		if q.tryPush(e) {
+			s.m[key] = e
+			s.Unlock()
+			q.signal(q.ready)
+			return nil
+		}
+		s.Unlock()
+		q.pool.Put(e)
+		n, ok := q.makeRoom(val.Final, &deadline)
+		dropped += n
+		if !ok {
+			break
+		}
+	}
+	dropped++
+	return ErrQueIsFull
+}
+
+// Len -
+func (q *traceRingQue) Len() int {
+	head := q.head.Load()
+	return int(q.tail.Load()-head) + int(q.pending.Load())
+}
+
+// Reader -
+func (q *traceRingQue) Reader() <-chan model.Trace {
+	q.runOnce.Do(func() {
+		q.stopped = make(chan struct{})
+		go q.run()
+	})
+	return q.ch
+}
+
+// ReadBatch -
+func (q *traceRingQue) ReadBatch(ctx context.Context, dst []model.Trace) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	q.readMu.Lock()
+	defer q.readMu.Unlock()
+	for {
+		n, wait := q.pop(dst)
+		if n > 0 {
+			q.signal(q.space)
+			return n, nil
+		}
+		if err := q.waitReady(ctx, wait); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (q *traceRingQue) waitReady(ctx context.Context, wait time.Duration) error {
+	var timer <-chan time.Time
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.done:
+		return ErrQueIsClosed
+	case <-q.ready:
+	case <-timer:
+	}
+	return nil
+}
+
+// Close -
+func (q *traceRingQue) Close() error {
+	q.runOnce.Do(func() {})
+	q.once.Do(func() {
+		close(q.done)
+		if q.stopped != nil {
+			<-q.stopped
+		}
+		close(q.ch)
+	})
+	return nil
+}
+
+func (q *traceRingQue) run() {
+	defer close(q.stopped)
+
+	buf := make([]model.Trace, ringReadBatch)
+	for {
+		n, err := q.ReadBatch(context.Background(), buf)
+		if err != nil {
+			return
+		}
+		q.pending.Store(int32(n)) //nolint:gosec
+		for i := range buf[:n] {
+			select {
+			case <-q.done:
+				return
+			case q.ch <- buf[i]:
+				q.pending.Add(-1)
+			}
+		}
+	}
+}
+
+// push - enques the record, returns count of the records dropped by the policy to make room for it
+func (q *traceRingQue) push(e *ringEntry) (dropped int, ok bool) {
+	var deadline time.Time
+	for {
+		if q.tryPush(e) {
+			q.signal(q.ready)
+			return dropped, true
+		}
+		n, ok := q.makeRoom(e.val.Final, &deadline)
+		if dropped += n; !ok {
+			return dropped, false
+		}
+	}
+}
+
+// makeRoom - makes room in the full ring for a record of the final verdict according to the overflow policy,
+// returns count of the dropped records and false if the new record is rejected
+func (q *traceRingQue) makeRoom(final string, deadline *time.Time) (int, bool) {
+	switch q.policy {
+	case PolicyBlock:
+		if deadline.IsZero() {
+			*deadline = time.Now().Add(q.blockTimeout)
+		}
+		return 0, q.waitSpace(*deadline)
+	case PolicyDropOldest:
+		return q.evict(false)
+	case PolicyPriority:
+		if isPriority(final) {
+			return q.evict(true)
+		}
+	}
+	return 0, false
+}
+
+// evict - frees a cell of the full ring dropping the oldest record, or the oldest record without priority
+// if the priority is kept. The records before the dropped one are shifted toward the tail, so the free cell
+// is the head one and the order of the records is kept. It returns false if there is no record to drop
+func (q *traceRingQue) evict(keepPriority bool) (int, bool) {
+	q.popMu.Lock()
+	defer q.popMu.Unlock()
+
+	head := q.head.Load()
+	pos := head
+	for ; ; pos++ {
+		if pos-head > q.mask {
+			return 0, false
+		}
+		c := &q.cells[pos&q.mask]
+		for c.seq.Load() != pos+1 {
+			if q.tail.Load()-head <= q.mask {
+				return 0, true // the consumer has made room
+			}
+			runtime.Gosched() // the writer of the cell is publishing the record
+		}
+		if !keepPriority || !isPriority(q.final(c.e)) {
+			break
+		}
+	}
+	e := q.cells[pos&q.mask].e
+	for ; pos != head; pos-- {
+		q.cells[pos&q.mask].e = q.cells[(pos-1)&q.mask].e
+	}
+	q.release(head, e)
+	return 1, true
+}
+
+// final - final verdict of the record, the upserts merge into the indexed records under the stripe lock
+func (q *traceRingQue) final(e *ringEntry) string {
+	if e.key == 0 {
+		return e.val.Final
+	}
+	s := &q.index[e.key%ringIndexStripes]
+	s.Lock()
+	defer s.Unlock()
+	return e.val.Final
+}
+
+func (q *traceRingQue) tryPush(e *ringEntry) bool {
+	pos := q.tail.Load()
+	for {
+		c := &q.cells[pos&q.mask]
+		seq := c.seq.Load()
+		switch dif := int64(seq - pos); { //nolint:gosec
+		case dif == 0:
+			if q.tail.CompareAndSwap(pos, pos+1) {
+				c.e = e
+				c.seq.Store(pos + 1)
+				return true
+			}
+			pos = q.tail.Load()
+		case dif < 0:
+			return false
+		default:
+			pos = q.tail.Load()
+		}
+	}
+}
+
+// pop - takes ready records, returns time to wait for the head record if it's held by the flush window
+func (q *traceRingQue) pop(dst []model.Trace) (n int, wait time.Duration) {
+	q.popMu.Lock()
+	defer q.popMu.Unlock()
+
+	pos := q.head.Load()
+	for n < len(dst) {
+		c := &q.cells[pos&q.mask]
+		if c.seq.Load() != pos+1 {
+			break
+		}
+		e := c.e
+		if e.key != 0 {
+			if q.window > 0 {
+				if wait = q.window - time.Since(e.at); wait > 0 {
+					break
+				}
+			}
+			s := &q.index[e.key%ringIndexStripes]
+			s.Lock()
+			delete(s.m, e.key)
+			dst[n] = e.val
+			s.Unlock()
+		} else {
+			dst[n] = e.val
+		}
+		n++
+		q.release(pos, nil)
+		pos++
+		e.val = model.Trace{}
+		q.pool.Put(e)
+	}
+	return n, wait
+}
+
+// release - frees the head cell, the dropped record of the cell is removed from the index
+func (q *traceRingQue) release(head uint64, dropped *ringEntry) {
+	c := &q.cells[head&q.mask]
+	c.e = nil
+	c.seq.Store(head + q.mask + 1)
+	q.head.Store(head + 1)
+	if dropped == nil {
+		return
+	}
+	if dropped.key != 0 {
+		s := &q.index[dropped.key%ringIndexStripes]
+		s.Lock()
+		delete(s.m, dropped.key)
+		s.Unlock()
+	}
+	dropped.val = model.Trace{}
+	q.pool.Put(dropped)
+}
+
+func (q *traceRingQue) waitSpace(deadline time.Time) bool {
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		return false
+	}
+	t := time.NewTimer(min(wait, ringBlockPoll))
+	defer t.Stop()
+	select {
+	case <-q.done:
+		return false
+	case <-q.space:
+	case <-t.C:
+	}
+	return true
+}
+
+func (q *traceRingQue) signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
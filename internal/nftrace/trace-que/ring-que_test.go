@@ -0,0 +1,309 @@
+package cachedque
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/Morwran/ebpf-nftrace/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RingQue(t *testing.T) {
+	testCases := []struct {
+		name    string
+		size    int
+		enque   []model.Trace
+		keys    []uint64
+		expErrs int
+		exp     []model.Trace
+	}{
+		{
+			name:  "arrival order",
+			size:  4,
+			enque: []model.Trace{{TrId: 1}, {TrId: 2}, {TrId: 3}},
+			exp:   []model.Trace{{TrId: 1}, {TrId: 2}, {TrId: 3}},
+		},
+		{
+			name:    "drop newest when full",
+			size:    2,
+			enque:   []model.Trace{{TrId: 1}, {TrId: 2}, {TrId: 3}},
+			expErrs: 1,
+			exp:     []model.Trace{{TrId: 1}, {TrId: 2}},
+		},
+		{
+			name:  "upsert merges records of the same key",
+			size:  4,
+			enque: []model.Trace{{TrId: 1, Cnt: 1}, {TrId: 2, Cnt: 1}, {TrId: 1, Cnt: 2}, {TrId: 2, Cnt: 3}},
+			keys:  []uint64{10, 20, 10, 20},
+			exp:   []model.Trace{{TrId: 1, Cnt: 3}, {TrId: 2, Cnt: 4}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var drops int
+			q, err := NewRingQue(tc.size, WithDropHandler(func(_ Policy, cnt int) { drops += cnt }))
+			require.NoError(t, err)
+			defer q.Close() //nolint:errcheck
+
+			var errs int
+			for i, v := range tc.enque {
+				if tc.keys != nil {
+					err = q.Upsert(tc.keys[i], v)
+				} else {
+					err = q.Enque(v)
+				}
+				if err != nil {
+					require.ErrorIs(t, err, ErrQueIsFull)
+					errs++
+				}
+			}
+			require.Equal(t, tc.expErrs, errs)
+			require.Equal(t, tc.expErrs, drops)
+			require.Equal(t, len(tc.exp), q.Len())
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			buf := make([]model.Trace, 16)
+			n, err := q.ReadBatch(ctx, buf)
+			require.NoError(t, err)
+			require.Equal(t, tc.exp, buf[:n])
+			require.Equal(t, 0, q.Len())
+		})
+	}
+}
+
+func Test_RingQueEvictUpserted(t *testing.T) {
+	q, err := NewRingQue(2, WithPolicy(PolicyDropOldest))
+	require.NoError(t, err)
+	defer q.Close() //nolint:errcheck
+
+	require.NoError(t, q.Upsert(1, model.Trace{TrId: 1, Cnt: 1}))
+	require.NoError(t, q.Upsert(2, model.Trace{TrId: 2, Cnt: 1}))
+	require.NoError(t, q.Upsert(3, model.Trace{TrId: 3, Cnt: 1}))
+	// the record of the key 1 is dropped, the upsert makes a new one
+	require.NoError(t, q.Upsert(1, model.Trace{TrId: 1, Cnt: 5}))
+	require.NoError(t, q.Upsert(3, model.Trace{TrId: 3, Cnt: 1}))
+
+	buf := make([]model.Trace, 4)
+	n, err := q.ReadBatch(context.Background(), buf)
+	require.NoError(t, err)
+	require.Equal(t, []model.Trace{{TrId: 3, Cnt: 2}, {TrId: 1, Cnt: 5}}, buf[:n])
+}
+
+func Test_RingQueConcurrentEviction(t *testing.T) {
+	const (
+		writers = 8
+		perWr   = 10000
+	)
+	for _, p := range []Policy{PolicyDropOldest, PolicyPriority} {
+		t.Run(p.String(), func(t *testing.T) {
+			var drops atomic.Int64
+			q, err := NewRingQue(64, WithPolicy(p), WithDropHandler(func(_ Policy, cnt int) { drops.Add(int64(cnt)) }))
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var read atomic.Int64
+			readerDone := make(chan struct{})
+			go func() {
+				defer close(readerDone)
+				buf := make([]model.Trace, 16)
+				for {
+					n, err := q.ReadBatch(ctx, buf)
+					if err != nil {
+						return
+					}
+					read.Add(int64(n))
+				}
+			}()
+			var wg sync.WaitGroup
+			for w := range writers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range perWr {
+						v := model.Trace{Final: "accept"}
+						if i%2 == 0 {
+							v.Final = "drop"
+						}
+						if w%2 == 0 {
+							_ = q.Enque(v)
+						} else {
+							_ = q.Upsert(uint64(w*perWr+i)%100+1, v) //nolint:gosec
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			require.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, time.Millisecond)
+			cancel()
+			<-readerDone
+			require.NoError(t, q.Close())
+			require.LessOrEqual(t, read.Load()+drops.Load(), int64(writers*perWr))
+			require.Positive(t, read.Load())
+		})
+	}
+}
+
+func Test_RingQueFlushWindow(t *testing.T) {
+	const window = 100 * time.Millisecond
+	q, err := NewRingQue(4, WithFlushWindow(window))
+	require.NoError(t, err)
+	defer q.Close() //nolint:errcheck
+
+	start := time.Now()
+	require.NoError(t, q.Upsert(1, model.Trace{TrId: 1, Cnt: 1}))
+	require.NoError(t, q.Upsert(1, model.Trace{TrId: 1, Cnt: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buf := make([]model.Trace, 4)
+	n, err := q.ReadBatch(ctx, buf)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), window)
+	require.Equal(t, []model.Trace{{TrId: 1, Cnt: 2}}, buf[:n])
+}
+
+func Test_RingQueBlockPolicy(t *testing.T) {
+	q, err := NewRingQue(2, WithPolicy(PolicyBlock), WithBlockTimeout(time.Second))
+	require.NoError(t, err)
+	defer q.Close() //nolint:errcheck
+	require.NoError(t, q.Enque(model.Trace{TrId: 1}, model.Trace{TrId: 2}))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		buf := make([]model.Trace, 1)
+		_, _ = q.ReadBatch(context.Background(), buf)
+	}()
+	start := time.Now()
+	require.NoError(t, q.Enque(model.Trace{TrId: 3}))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	q1, err := NewRingQue(2, WithPolicy(PolicyBlock), WithBlockTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	defer q1.Close() //nolint:errcheck
+	require.NoError(t, q1.Enque(model.Trace{TrId: 1}, model.Trace{TrId: 2}))
+	require.ErrorIs(t, q1.Enque(model.Trace{TrId: 3}), ErrQueIsFull)
+}
+
+func Test_RingQueConcurrentWriters(t *testing.T) {
+	const (
+		writers = 8
+		perWr   = 10000
+	)
+	q, err := NewRingQue(1024, WithPolicy(PolicyBlock), WithBlockTimeout(10*time.Second))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWr {
+				key := uint64(w*perWr+i)%100 + 1
+				_ = q.Upsert(key, model.Trace{TrId: uint32(key), Cnt: 1}) //nolint:gosec
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var total uint64
+	r := q.Reader()
+loop:
+	for {
+		select {
+		case v := <-r:
+			total += v.Cnt
+		case <-done:
+			if q.Len() == 0 {
+				break loop
+			}
+			select {
+			case v := <-r:
+				total += v.Cnt
+			case <-time.After(time.Second):
+				break loop
+			}
+		}
+	}
+	require.NoError(t, q.Close())
+	require.Equal(t, uint64(writers*perWr), total)
+}
+
+func Test_CachedQueReadBatch(t *testing.T) {
+	q := NewCachedQue(10)
+	defer q.Close() //nolint:errcheck
+	require.NoError(t, q.Enque(model.Trace{TrId: 1}, model.Trace{TrId: 2}, model.Trace{TrId: 3}))
+
+	buf := make([]model.Trace, 2)
+	n, err := q.ReadBatch(context.Background(), buf)
+	require.NoError(t, err)
+	require.Equal(t, []model.Trace{{TrId: 1}, {TrId: 2}}, buf[:n])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n, err = q.ReadBatch(ctx, buf)
+	require.NoError(t, err)
+	require.Equal(t, []model.Trace{{TrId: 3}}, buf[:n])
+	_, err = q.ReadBatch(ctx, buf)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func benchQue(b *testing.B, q CachedQueFace, upsert bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]model.Trace, ringReadBatch)
+		for {
+			if _, err := q.ReadBatch(ctx, buf); err != nil {
+				return
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i uint64
+		for pb.Next() {
+			i++
+			if upsert {
+				_ = q.Upsert(i%1000+1, model.Trace{Cnt: 1})
+			} else {
+				_ = q.Enque(model.Trace{Cnt: 1})
+			}
+		}
+	})
+	b.StopTimer()
+	cancel()
+	<-done
+	_ = q.Close()
+}
+
+func Benchmark_Que(b *testing.B) {
+	const size = 1 << 16
+	newRing := func() CachedQueFace {
+		q, _ := NewRingQue(size)
+		return q
+	}
+	newList := func() CachedQueFace {
+		return NewCachedQue(size)
+	}
+	for _, bc := range []struct {
+		name   string
+		newQue func() CachedQueFace
+	}{
+		{"list", newList},
+		{"ring", newRing},
+	} {
+		b.Run(bc.name+"/enque", func(b *testing.B) { benchQue(b, bc.newQue(), false) })
+		b.Run(bc.name+"/upsert", func(b *testing.B) { benchQue(b, bc.newQue(), true) })
+	}
+}
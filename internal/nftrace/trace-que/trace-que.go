@@ -1,15 +1,14 @@
 package cachedque
 
 import (
-	"errors"
+	"container/list"
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	model "github.com/Morwran/ebpf-nftrace/internal/models"
-
-	llq "github.com/emirpasic/gods/queues/linkedlistqueue"
 )
 
 type (
@@ -19,16 +18,20 @@ type (
 		Len() int
 		Reader() <-chan model.Trace
 		Upsert(key uint64, val model.Trace) error
+		// ReadBatch - blocks until at least one record is ready and reads up to len(dst) records,
+		// returns ErrQueIsClosed when the que is closed
+		ReadBatch(ctx context.Context, dst []model.Trace) (int, error)
 	}
 	queData struct {
 		key uint64
 		val model.Trace
+		at  time.Time
 	}
 
 	traceCachedQue struct {
 		size        int
 		cache       map[uint64]model.Trace
-		que         *llq.Queue
+		que         *list.List
 		close       chan struct{}
 		stopped     chan struct{}
 		ch          chan model.Trace
@@ -36,37 +39,53 @@ type (
 		closeOnce   sync.Once
 		runOnce     sync.Once
 		sendPending uint32
+		closed      bool
+		queConfig
 	}
 )
 
-func NewCachedQue(size int) *traceCachedQue {
+func NewCachedQue(size int, opts ...QueOption) *traceCachedQue {
 	if size < 0 {
 		panic(fmt.Errorf("NewCachedQue incorrect size=%d. size must be > 0", size))
 	}
-	return &traceCachedQue{
-		size:  size,
-		que:   llq.New(),
-		cache: make(map[uint64]model.Trace, size),
-		close: make(chan struct{}),
-		ch:    make(chan model.Trace),
-		cv:    sync.NewCond(new(sync.Mutex)),
+	cq := &traceCachedQue{
+		size:      size,
+		que:       list.New(),
+		cache:     make(map[uint64]model.Trace, size),
+		close:     make(chan struct{}),
+		ch:        make(chan model.Trace),
+		cv:        sync.NewCond(new(sync.Mutex)),
+		queConfig: newQueConfig(opts),
 	}
+	return cq
 }
 
 func (cq *traceCachedQue) Upsert(key uint64, val model.Trace) error {
+	var dropped int
 	cq.cv.L.Lock()
-	defer cq.cv.L.Unlock()
+	defer func() {
+		cq.cv.L.Unlock()
+		cq.onDropped(dropped)
+	}()
 
 	if item, ok := cq.cache[key]; ok {
-		item.Cnt += val.Cnt
+		item.Merge(val)
 		cq.cache[key] = item
 		return nil
 	}
-	if cq.que.Size() >= cq.size {
-		return ErrQueIsFull
+	n, err := cq.reserve(&val, time.Now())
+	dropped += n
+	if err != nil {
+		return err
+	}
+	if item, ok := cq.cache[key]; ok {
+		// the record was added while the writer was blocked
+		item.Merge(val)
+		cq.cache[key] = item
+		return nil
 	}
 	cq.cache[key] = val
-	cq.que.Enqueue(queData{key: key, val: val})
+	cq.que.PushBack(queData{key: key, val: val, at: time.Now()})
 	cq.cv.Broadcast()
 	return nil
 }
@@ -75,7 +94,7 @@ func (cq *traceCachedQue) Upsert(key uint64, val model.Trace) error {
 func (cq *traceCachedQue) Len() int {
 	cq.cv.L.Lock()
 	defer cq.cv.L.Unlock()
-	return cq.que.Size() + int(atomic.LoadUint32(&cq.sendPending))
+	return cq.que.Len() + int(atomic.LoadUint32(&cq.sendPending))
 }
 
 // Reader -
@@ -89,20 +108,74 @@ func (cq *traceCachedQue) Reader() <-chan model.Trace {
 
 // Enque -
 func (cq *traceCachedQue) Enque(vals ...model.Trace) (err error) {
+	var dropped int
 	cq.cv.L.Lock()
 	defer func() {
-		if len(vals) > 0 && err == nil {
+		if len(vals) > 0 {
 			cq.cv.Broadcast()
 		}
 		cq.cv.L.Unlock()
+		cq.onDropped(dropped)
 	}()
-	if cq.que.Size()+len(vals) > cq.size {
+	if cq.policy == PolicyDropNewest && cq.que.Len()+len(vals) > cq.size {
+		dropped = len(vals)
 		return ErrQueIsFull
 	}
-	for _, v := range vals {
-		cq.que.Enqueue(queData{val: v})
+	now := time.Now()
+	for i := range vals {
+		n, e := cq.reserve(&vals[i], now)
+		dropped += n
+		if e != nil {
+			err = e
+			continue
+		}
+		cq.que.PushBack(queData{val: vals[i]})
+	}
+	return err
+}
+
+// reserve - makes room for the value according to the overflow policy,
+// returns count of the dropped records including the value itself if it's rejected
+func (cq *traceCachedQue) reserve(val *model.Trace, now time.Time) (int, error) {
+	var dropped int
+	for cq.que.Len() >= cq.size {
+		switch cq.policy {
+		case PolicyDropOldest:
+			cq.remove(cq.que.Front())
+			dropped++
+		case PolicyPriority:
+			if !isPriority(val.Final) {
+				return dropped + 1, ErrQueIsFull
+			}
+			e := cq.que.Front()
+			for e != nil && isPriority(e.Value.(queData).val.Final) {
+				e = e.Next()
+			}
+			if e == nil {
+				return dropped + 1, ErrQueIsFull
+			}
+			cq.remove(e)
+			dropped++
+		case PolicyBlock:
+			wait := cq.blockTimeout - time.Since(now)
+			if wait <= 0 || cq.closed {
+				return dropped + 1, ErrQueIsFull
+			}
+			t := time.AfterFunc(wait, cq.cv.Broadcast)
+			cq.cv.Wait()
+			t.Stop()
+		default:
+			return dropped + 1, ErrQueIsFull
+		}
+	}
+	return dropped, nil
+}
+
+func (cq *traceCachedQue) remove(e *list.Element) {
+	data := cq.que.Remove(e).(queData)
+	if data.key != 0 {
+		delete(cq.cache, data.key)
 	}
-	return nil
 }
 
 // Close -
@@ -117,7 +190,9 @@ func (cq *traceCachedQue) Close() error {
 		close(cl)
 		defer close(ch)
 		cv.L.Lock()
-		cq.que.Clear()
+		cq.que.Init()
+		cq.closed = true
+		cv.Broadcast()
 		cv.L.Unlock()
 		if stopped != nil {
 		loop:
@@ -136,43 +211,81 @@ func (cq *traceCachedQue) Close() error {
 func (cq *traceCachedQue) run() {
 	defer close(cq.stopped)
 
+	var buf [1]model.Trace
 	for closed := false; !closed; {
-		if v, ok := cq.fetch(); !ok {
+		if cq.fetch(context.Background(), buf[:]) == 0 {
 			break
-		} else {
-			atomic.StoreUint32(&cq.sendPending, 1)
-			select {
-			case <-cq.close:
-				closed = true
-			case cq.ch <- v:
-			}
-			atomic.StoreUint32(&cq.sendPending, 0)
 		}
+		atomic.StoreUint32(&cq.sendPending, 1)
+		select {
+		case <-cq.close:
+			closed = true
+		case cq.ch <- buf[0]:
+		}
+		atomic.StoreUint32(&cq.sendPending, 0)
 	}
 }
 
-func (cq *traceCachedQue) fetch() (v model.Trace, ok bool) {
+// ReadBatch -
+func (cq *traceCachedQue) ReadBatch(ctx context.Context, dst []model.Trace) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		cq.cv.L.Lock()
+		cq.cv.Broadcast()
+		cq.cv.L.Unlock()
+	})
+	defer stop()
+	n := cq.fetch(ctx, dst)
+	if n > 0 {
+		return n, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 0, ErrQueIsClosed
+}
+
+func (cq *traceCachedQue) fetch(ctx context.Context, dst []model.Trace) (n int) {
 	cq.cv.L.Lock()
 	defer cq.cv.L.Unlock()
-	var (
-		data queData
-		item any
-	)
 
 	que := cq.que
-	for que.Size() == 0 {
-		cq.cv.Wait()
-	}
-	if item, ok = que.Dequeue(); ok {
-		data = item.(queData)
-		v = data.val
-		if val, exist := cq.cache[data.key]; exist {
-			v = val
-			delete(cq.cache, data.key)
+	for !cq.closed && ctx.Err() == nil {
+		var wait time.Duration
+		for n < len(dst) {
+			item := que.Front()
+			if item == nil {
+				break
+			}
+			data := item.Value.(queData)
+			if data.key != 0 && cq.window > 0 {
+				if wait = cq.window - time.Since(data.at); wait > 0 {
+					break
+				}
+			}
+			que.Remove(item)
+			dst[n] = data.val
+			if val, exist := cq.cache[data.key]; exist {
+				dst[n] = val
+				delete(cq.cache, data.key)
+			}
+			n++
 		}
+		if n > 0 {
+			if cq.policy == PolicyBlock {
+				cq.cv.Broadcast()
+			}
+			return n
+		}
+		if wait > 0 {
+			t := time.AfterFunc(wait, cq.cv.Broadcast)
+			cq.cv.Wait()
+			t.Stop()
+			continue
+		}
+		cq.cv.Wait()
 	}
-
-	return v, ok
+	return 0
 }
-
-var ErrQueIsFull = errors.New("que is full")
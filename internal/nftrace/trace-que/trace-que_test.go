@@ -99,3 +99,167 @@ func (sui *cachedQueTestSuite) Test_Aggregate() {
 	sui.Require().Equal(0, len(que.cache))
 	sui.Require().Equal(exp, got)
 }
+
+func (sui *cachedQueTestSuite) Test_FlushWindow() {
+	const window = 200 * time.Millisecond
+	que := NewCachedQue(10, WithFlushWindow(window))
+	defer que.Close() //nolint:errcheck
+	r := que.Reader()
+
+	start := time.Now()
+	sui.Require().NoError(que.Upsert(1, model.Trace{TrId: 1, Cnt: 1, Bytes: 10}))
+	sui.Require().NoError(que.Upsert(1, model.Trace{TrId: 1, Cnt: 1, Bytes: 20}))
+	select {
+	case <-r:
+		sui.FailNow("record is flushed before the window")
+	case <-time.After(window / 2):
+	}
+	sui.Require().NoError(que.Upsert(1, model.Trace{TrId: 1, Cnt: 1, Bytes: 30}))
+
+	select {
+	case got := <-r:
+		sui.Require().GreaterOrEqual(time.Since(start), window)
+		sui.Require().Equal(uint64(3), got.Cnt)
+		sui.Require().Equal(uint64(60), got.Bytes)
+	case <-time.After(time.Second):
+		sui.FailNow("record is not flushed after the window")
+	}
+}
+
+func (sui *cachedQueTestSuite) Test_OverflowPolicy() {
+	accept := func(id uint32) model.Trace { return model.Trace{TrId: id, Final: "accept"} }
+	drop := func(id uint32) model.Trace { return model.Trace{TrId: id, Final: "drop"} }
+	testCases := []struct {
+		name     string
+		policy   Policy
+		data     []model.Trace
+		expErrs  int
+		expDrops int
+		exp      []uint32
+	}{
+		{
+			name:     "drop newest",
+			policy:   PolicyDropNewest,
+			data:     []model.Trace{accept(1), accept(2), accept(3), accept(4), accept(5)},
+			expErrs:  1,
+			expDrops: 1,
+			exp:      []uint32{1, 2, 3, 4},
+		},
+		{
+			name:     "drop oldest",
+			policy:   PolicyDropOldest,
+			data:     []model.Trace{accept(1), accept(2), accept(3), accept(4), accept(5), accept(6)},
+			expDrops: 2,
+			exp:      []uint32{3, 4, 5, 6},
+		},
+		{
+			name:     "block with timeout",
+			policy:   PolicyBlock,
+			data:     []model.Trace{accept(1), accept(2), accept(3), accept(4), accept(5)},
+			expErrs:  1,
+			expDrops: 1,
+			exp:      []uint32{1, 2, 3, 4},
+		},
+		{
+			name:   "priority keeps drops over accepts",
+			policy: PolicyPriority,
+			data: []model.Trace{accept(1), drop(2), accept(3), accept(4), drop(5), accept(6), drop(7), drop(8),
+				drop(9)},
+			expErrs:  2,
+			expDrops: 5,
+			exp:      []uint32{2, 5, 7, 8},
+		},
+	}
+	ques := []struct {
+		name   string
+		newQue func(opts ...QueOption) CachedQueFace
+	}{
+		{"list", func(opts ...QueOption) CachedQueFace { return NewCachedQue(4, opts...) }},
+		{"ring", func(opts ...QueOption) CachedQueFace {
+			q, err := NewRingQue(4, opts...)
+			sui.Require().NoError(err)
+			return q
+		}},
+	}
+	for _, qc := range ques {
+		for _, tc := range testCases {
+			sui.Run(qc.name+"/"+tc.name, func() {
+				var drops int
+				que := qc.newQue(
+					WithPolicy(tc.policy),
+					WithBlockTimeout(10*time.Millisecond),
+					WithDropHandler(func(p Policy, cnt int) {
+						sui.Require().Equal(tc.policy, p)
+						drops += cnt
+					}),
+				)
+				defer que.Close() //nolint:errcheck
+				var errs int
+				for _, v := range tc.data {
+					if err := que.Enque(v); err != nil {
+						sui.Require().ErrorIs(err, ErrQueIsFull)
+						errs++
+					}
+				}
+				sui.Require().Equal(tc.expErrs, errs)
+				sui.Require().Equal(tc.expDrops, drops)
+				sui.Require().Equal(len(tc.exp), que.Len())
+
+				r := que.Reader()
+				var got []uint32
+				for range tc.exp {
+					select {
+					case v := <-r:
+						got = append(got, v.TrId)
+					case <-time.After(time.Second):
+						sui.FailNow("no data in the que")
+					}
+				}
+				sui.Require().Equal(tc.exp, got)
+			})
+		}
+	}
+}
+
+func (sui *cachedQueTestSuite) Test_BlockPolicyWaitsForRoom() {
+	que := NewCachedQue(1, WithPolicy(PolicyBlock), WithBlockTimeout(time.Second))
+	defer que.Close() //nolint:errcheck
+	r := que.Reader()
+	sui.Require().NoError(que.Upsert(1, model.Trace{TrId: 1}))
+	sui.Require().Eventually(func() bool {
+		que.cv.L.Lock()
+		defer que.cv.L.Unlock()
+		return que.que.Len() == 0
+	}, time.Second, time.Millisecond)
+	sui.Require().NoError(que.Upsert(2, model.Trace{TrId: 2}))
+
+	first := make(chan uint32, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		first <- (<-r).TrId
+	}()
+	start := time.Now()
+	sui.Require().NoError(que.Upsert(3, model.Trace{TrId: 3}))
+	sui.Require().GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+
+	got := []uint32{<-first}
+	for range 2 {
+		select {
+		case v := <-r:
+			got = append(got, v.TrId)
+		case <-time.After(time.Second):
+			sui.FailNow("blocked record is not enqueued")
+		}
+	}
+	sui.Require().Equal([]uint32{1, 2, 3}, got)
+}
+
+func (sui *cachedQueTestSuite) Test_ParsePolicy() {
+	for _, p := range Policies() {
+		got, err := ParsePolicy(p.String())
+		sui.Require().NoError(err)
+		sui.Require().Equal(p, got)
+	}
+	_, err := ParsePolicy("unknown")
+	sui.Require().Error(err)
+}
@@ -0,0 +1,65 @@
+package nftrace
+
+import (
+	"sync/atomic"
+)
+
+// traceRing - lock-free single producer/single consumer ring of trace events.
+// The producer is the collector reader, the consumer is the shard worker
+type traceRing struct {
+	buf   []NftTrace
+	mask  uint64
+	head  atomic.Uint64 // next slot to read, it's moved by the consumer only
+	tail  atomic.Uint64 // next slot to write, it's moved by the producer only
+	ready chan struct{} // wakes up the consumer
+	space chan struct{} // wakes up the producer
+}
+
+func newTraceRing(size int) *traceRing {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &traceRing{
+		buf:   make([]NftTrace, n),
+		mask:  uint64(n - 1),
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}, 1),
+	}
+}
+
+// TryPush - put the event into the ring. It returns false if the ring is full
+func (r *traceRing) TryPush(tr NftTrace) bool {
+	tail := r.tail.Load()
+	if tail-r.head.Load() == uint64(len(r.buf)) {
+		return false
+	}
+	r.buf[tail&r.mask] = tr
+	r.tail.Store(tail + 1)
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Pop - get the event from the ring. It returns false if the ring is empty
+func (r *traceRing) Pop() (tr NftTrace, ok bool) {
+	head := r.head.Load()
+	if head == r.tail.Load() {
+		return tr, false
+	}
+	i := head & r.mask
+	tr, r.buf[i] = r.buf[i], NftTrace{}
+	r.head.Store(head + 1)
+	select {
+	case r.space <- struct{}{}:
+	default:
+	}
+	return tr, true
+}
+
+// Len - number of events in the ring
+func (r *traceRing) Len() int {
+	return int(r.tail.Load() - r.head.Load()) //nolint:gosec
+}
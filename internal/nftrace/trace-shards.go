@@ -0,0 +1,213 @@
+package nftrace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefTraceShards - default number of trace assembly workers
+	DefTraceShards = 1
+
+	traceRingSize     = 4096
+	shardBatchSize    = 256
+	shardTickInterval = ruleResolveRetryInterval
+
+	// traceRouteGen - number of the trace ids in one generation of the routes
+	traceRouteGen = 1 << 16
+)
+
+var errShardsStopped = errors.New("trace shards have been stopped")
+
+type (
+	traceShard struct {
+		id        int
+		ring      *traceRing
+		asm       *traceAssembler
+		processed uint64
+	}
+
+	// traceShards - parallel trace assembly. Events are dispatched to the workers by the flow hash of
+	// the first event of the trace, the later events of the trace follow it by the trace id,
+	// so all events of the trace are handled by the same worker in order of arrival and a flow stays
+	// on one worker. Each worker owns its trace group and pending stage, the output queue is shared
+	traceShards struct {
+		subj     observer.Subject
+		shards   []*traceShard
+		routes   traceRoutes
+		done     chan struct{}
+		doneOnce sync.Once
+		err      error
+	}
+
+	// traceRoutes - shard of the recent trace ids. It keeps two generations of the ids,
+	// the older one is dropped when the current one is full. It's used by the dispatcher only
+	traceRoutes struct {
+		cur, prev map[uint32]int
+	}
+)
+
+func newTraceShards(n int, subj observer.Subject, newAsm func() *traceAssembler) *traceShards {
+	if n < 1 {
+		n = 1
+	}
+	s := &traceShards{
+		subj:   subj,
+		shards: make([]*traceShard, n),
+		done:   make(chan struct{}),
+	}
+	for i := range s.shards {
+		asm := newAsm()
+		asm.shard = i
+		s.shards[i] = &traceShard{id: i, ring: newTraceRing(traceRingSize), asm: asm}
+	}
+	return s
+}
+
+// Run - run the workers. It returns when the shards are closed or one of the workers has failed
+func (s *traceShards) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, sh := range s.shards {
+		wg.Add(1)
+		go func(sh *traceShard) {
+			defer wg.Done()
+			defer sh.asm.Close()
+			if err := s.work(ctx, sh); err != nil {
+				s.stop(errors.WithMessagef(err, "trace shard %d", sh.id))
+			}
+		}(sh)
+	}
+	wg.Wait()
+	s.stop(errShardsStopped)
+	if errors.Is(s.err, errShardsStopped) {
+		return nil
+	}
+	return s.err
+}
+
+// Dispatch - pass the event to its worker. It waits for the room in the worker's ring
+func (s *traceShards) Dispatch(tr NftTrace) error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+	}
+	sh := s.shards[s.route(&tr)]
+	for !sh.ring.TryPush(tr) {
+		select {
+		case <-sh.ring.space:
+		case <-s.done:
+			return s.err
+		}
+	}
+	return nil
+}
+
+// route - shard of the trace, the first event of the trace id picks it by the flow hash
+func (s *traceShards) route(tr *NftTrace) int {
+	if len(s.shards) == 1 {
+		return 0
+	}
+	r := &s.routes
+	if i, ok := r.cur[tr.Id]; ok {
+		return i
+	}
+	i, ok := r.prev[tr.Id]
+	if !ok {
+		i = int(tr.FlowHash() % uint64(len(s.shards))) //nolint:gosec
+	}
+	if len(r.cur) >= traceRouteGen {
+		r.prev, r.cur = r.cur, nil
+	}
+	if r.cur == nil {
+		r.cur = make(map[uint32]int, traceRouteGen)
+	}
+	r.cur[tr.Id] = i
+	return i
+}
+
+// Close - stop the workers
+func (s *traceShards) Close() {
+	s.stop(errShardsStopped)
+}
+
+func (s *traceShards) stop(err error) {
+	s.doneOnce.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+func (s *traceShards) work(ctx context.Context, sh *traceShard) error {
+	ticker := time.NewTicker(shardTickInterval)
+	defer ticker.Stop()
+	nextReport := time.Now().Add(gaugeReportInterval)
+
+	tick := func(now time.Time) error {
+		if !now.Before(nextReport) {
+			nextReport = now.Add(gaugeReportInterval)
+			s.report(sh)
+		}
+		return sh.asm.Tick(now)
+	}
+	for {
+		for n := 0; n < shardBatchSize; n++ {
+			tr, ok := sh.ring.Pop()
+			if !ok {
+				break
+			}
+			if err := sh.asm.Add(tr, time.Now()); err != nil {
+				return err
+			}
+			sh.processed++
+		}
+		if sh.ring.Len() > 0 {
+			select {
+			case now := <-ticker.C:
+				if err := tick(now); err != nil {
+					return err
+				}
+			default:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return s.drain(sh)
+		case <-s.done:
+			return s.drain(sh)
+		case <-sh.ring.ready:
+		case now := <-ticker.C:
+			if err := tick(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// drain - assemble the events left in the ring on stop
+func (s *traceShards) drain(sh *traceShard) error {
+	for {
+		tr, ok := sh.ring.Pop()
+		if !ok {
+			break
+		}
+		if err := sh.asm.Add(tr, time.Now()); err != nil {
+			return err
+		}
+		sh.processed++
+	}
+	return sh.asm.Tick(time.Now())
+}
+
+func (s *traceShards) report(sh *traceShard) {
+	s.subj.Notify(ShardQueDepthEvent{Shard: sh.id, Depth: sh.ring.Len()})
+	if sh.processed > 0 {
+		s.subj.Notify(CountShardTraceEvent{Shard: sh.id, Cnt: sh.processed})
+		sh.processed = 0
+	}
+}
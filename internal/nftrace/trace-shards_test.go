@@ -0,0 +1,128 @@
+package nftrace
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	queue "github.com/Morwran/ebpf-nftrace/internal/nftrace/trace-que"
+
+	"github.com/H-BF/corlib/pkg/patterns/observer"
+	nfte "github.com/google/nftables/expr"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_TraceRing(t *testing.T) {
+	r := newTraceRing(3)
+	require.Len(t, r.buf, 4)
+	for i := uint32(1); i <= 4; i++ {
+		require.True(t, r.TryPush(NftTrace{Id: i}))
+	}
+	require.False(t, r.TryPush(NftTrace{Id: 5}))
+	require.Equal(t, 4, r.Len())
+	for i := uint32(1); i <= 4; i++ {
+		tr, ok := r.Pop()
+		require.True(t, ok)
+		require.Equal(t, i, tr.Id)
+	}
+	_, ok := r.Pop()
+	require.False(t, ok)
+	require.True(t, r.TryPush(NftTrace{Id: 6}))
+}
+
+func Test_TraceShards(t *testing.T) {
+	const traces = 1000
+	verdictJump := nfte.VerdictJump
+	mock := DepsMock{&ifaceProviderMock{}, &ruleProviderMock{}}
+	subj := observer.NewSubject()
+	que := queue.NewCachedQue(traces)
+
+	shards := newTraceShards(4, subj, func() *traceAssembler {
+		return newTraceAssembler(traceAssemblerDeps{
+			TraceGroup: NewTraceGroup(mock.iface, mock.rule),
+			Que:        que,
+			Subj:       subj,
+		}, Aggregation{}, true, 0)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- shards.Run(ctx) }()
+
+	for id := uint32(1); id <= traces; id++ {
+		require.NoError(t, shards.Dispatch(NftTrace{
+			Id: id, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 1, Verdict: uint32(verdictJump), SPort: id,
+		}))
+		require.NoError(t, shards.Dispatch(NftTrace{
+			Id: id, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 2, Verdict: uint32(nfte.VerdictAccept),
+		}))
+	}
+
+	seen := make(map[uint32]bool, traces)
+	for len(seen) < traces {
+		select {
+		case m := <-que.Reader():
+			require.Len(t, m.Path, 2)
+			require.Equal(t, uint64(1), m.Path[0].Handle)
+			require.Equal(t, uint64(2), m.Path[1].Handle)
+			require.False(t, seen[m.TrId])
+			seen[m.TrId] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d traces of %d", len(seen), traces)
+		}
+	}
+	shards.Close()
+	require.NoError(t, <-done)
+	require.ErrorIs(t, shards.Dispatch(NftTrace{Id: 1}), errShardsStopped)
+}
+
+func Test_TraceShardsRoute(t *testing.T) {
+	shards := newTraceShards(8, observer.NewSubject(), func() *traceAssembler { return &traceAssembler{} })
+	first := NftTrace{
+		Id: 1, Family: unix.NFPROTO_IPV4, IpProtocol: unix.IPPROTO_TCP,
+		SAddr: netip.MustParseAddr("10.0.0.1"), DAddr: netip.MustParseAddr("10.0.0.2"), SPort: 1234, DPort: 80,
+	}
+	i := shards.route(&first)
+	require.Equal(t, int(first.FlowHash()%8), i)
+
+	next := NftTrace{Id: 1} // the later events don't carry the headers
+	require.Equal(t, i, shards.route(&next))
+	other := first
+	other.Id = 2
+	require.Equal(t, i, shards.route(&other), "the packets of one flow are on one shard")
+
+	for id := uint32(3); id < 3+traceRouteGen; id++ {
+		shards.route(&NftTrace{Id: id})
+	}
+	require.Equal(t, i, shards.route(&next), "the previous generation is kept")
+}
+
+func Test_TraceShardsDrain(t *testing.T) {
+	const traces = 100
+	mock := DepsMock{&ifaceProviderMock{}, &ruleProviderMock{}}
+	subj := observer.NewSubject()
+	que := queue.NewCachedQue(traces)
+	shards := newTraceShards(2, subj, func() *traceAssembler {
+		return newTraceAssembler(traceAssemblerDeps{
+			TraceGroup: NewTraceGroup(mock.iface, mock.rule),
+			Que:        que,
+			Subj:       subj,
+		}, Aggregation{}, true, 0)
+	})
+	for id := uint32(1); id <= traces; id++ {
+		require.NoError(t, shards.Dispatch(NftTrace{
+			Id: id, Type: unix.NFT_TRACETYPE_RULE, RuleHandle: 1, Verdict: uint32(nfte.VerdictAccept),
+		}))
+	}
+	shards.Close()
+	require.NoError(t, shards.Run(context.Background()))
+	for range traces {
+		select {
+		case <-que.Reader():
+		case <-time.After(5 * time.Second):
+			t.Fatal("the events in the rings aren't assembled on stop")
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package nftrace
+
+import (
+	"slices"
+
+	expr "github.com/Morwran/ebpf-nftrace/internal/nftables/expr-encoders"
+	rl "github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
+
+	nftLib "github.com/google/nftables"
+	nfte "github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// Netfilter hook verdicts (NF_ACCEPT, NF_QUEUE, ...) are not negative and may carry extra data
+// in the upper bits: queue number for NF_QUEUE and errno for NF_DROP_ERR
+const nfVerdictMask = 0xff
+
+type verdictScope uint8
+
+const (
+	// verdict doesn't finish the traversal of the base chain: jump, goto, continue, return
+	verdictScopeNone verdictScope = iota
+	// verdict finishes the traversal of the current base chain only, the packet goes on
+	// to the base chains of the same hook with a higher priority and to the next hooks
+	verdictScopeChain
+	// verdict finishes the packet: it's dropped, stolen or queued to userspace
+	verdictScopePacket
+)
+
+// verdictKind - nftables verdict of the trace with the hook data stripped
+func verdictKind(v uint32) expr.VerdictKind {
+	if code := int32(v); code < 0 { //nolint:gosec
+		return expr.VerdictKind(code)
+	}
+	return expr.VerdictKind(v & nfVerdictMask)
+}
+
+// nfInetIngress - ingress hook of the inet family, it isn't defined by the unix package
+const nfInetIngress = 5
+
+// baseChain - the base chain the trace group traverses
+type baseChain struct {
+	known bool // false if the base chain of the group is not known, the verdict is taken as final then
+	last  bool // no other base chain follows the chain on the packet path
+}
+
+// nextHooks - hooks of the family the packet may go through after the hook
+func nextHooks(family byte, hook nftLib.ChainHook) []nftLib.ChainHook {
+	switch family {
+	case unix.NFPROTO_IPV4, unix.NFPROTO_IPV6, unix.NFPROTO_INET, unix.NFPROTO_BRIDGE:
+		switch hook {
+		case nfInetIngress:
+			return []nftLib.ChainHook{unix.NF_INET_PRE_ROUTING, unix.NF_INET_LOCAL_IN, unix.NF_INET_FORWARD, unix.NF_INET_POST_ROUTING}
+		case unix.NF_INET_PRE_ROUTING:
+			return []nftLib.ChainHook{unix.NF_INET_LOCAL_IN, unix.NF_INET_FORWARD, unix.NF_INET_POST_ROUTING}
+		case unix.NF_INET_FORWARD, unix.NF_INET_LOCAL_OUT:
+			return []nftLib.ChainHook{unix.NF_INET_POST_ROUTING}
+		}
+	case unix.NFPROTO_NETDEV:
+		if hook == unix.NF_NETDEV_INGRESS {
+			return []nftLib.ChainHook{unix.NF_NETDEV_EGRESS}
+		}
+	}
+	return nil
+}
+
+// samePath - the chains of the family see the packet of the chain family. The ip and ip6 chains
+// share the hooks with the inet ones, the nfproto tells which of them the packet goes through
+func samePath(chainFamily, family byte, nfproto uint32) bool {
+	switch chainFamily {
+	case unix.NFPROTO_IPV4, unix.NFPROTO_IPV6, unix.NFPROTO_INET:
+		switch family {
+		case unix.NFPROTO_INET:
+			return true
+		case unix.NFPROTO_IPV4:
+			return chainFamily != unix.NFPROTO_IPV6 && nfproto != unix.NFPROTO_IPV6
+		case unix.NFPROTO_IPV6:
+			return chainFamily != unix.NFPROTO_IPV4 && nfproto != unix.NFPROTO_IPV4
+		}
+		return false
+	}
+	return chainFamily == family
+}
+
+func chainPriority(ch *nftLib.Chain) int32 {
+	if ch.Priority == nil {
+		return 0
+	}
+	return int32(*ch.Priority)
+}
+
+// lastBaseChain - no other base chain follows the chain on the packet path: neither a chain of the same
+// hook with a higher priority nor a chain of a hook the packet may go on to. The nat chains are skipped,
+// they see the first packet of a connection only and don't filter it. The path isn't known ahead, e.g.
+// after prerouting the packet goes to input or to forward, so a chain of either of them follows prerouting.
+// The netdev ingress is followed by the chains of any family, the bridge and ip stacks are taken apart
+func lastBaseChain(ch *nftLib.Chain, nfproto uint32, chains []rl.ChainEntry) bool {
+	if ch.Table == nil || ch.Hooknum == nil {
+		return false
+	}
+	family, hook, prio := byte(ch.Table.Family), *ch.Hooknum, chainPriority(ch)
+	next := nextHooks(family, hook)
+	for _, ce := range chains {
+		c := ce.ChainNative
+		if c == nil || c.Table == nil || c.Hooknum == nil || c.Type == nftLib.ChainTypeNAT ||
+			(c.Name == ch.Name && c.Table.Name == ch.Table.Name && c.Table.Family == ch.Table.Family) {
+			continue
+		}
+		f := byte(c.Table.Family)
+		if family == unix.NFPROTO_NETDEV && hook == unix.NF_NETDEV_INGRESS && f != unix.NFPROTO_NETDEV {
+			return false
+		}
+		if !samePath(family, f, nfproto) {
+			continue
+		}
+		if h := *c.Hooknum; (h == hook && chainPriority(c) >= prio) || slices.Contains(next, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// traceVerdictScope - semantics of the trace verdict in the base chain. Drop, stolen and queue
+// finish the packet in any chain. Accept, either of a rule or of the base chain policy, finishes
+// the packet only in the last base chain of the packet path: after an accept in prerouting
+// the packet goes on to input or forward, after an accept in forward or output it goes on to
+// the postrouting chains if there are any. Repeat restarts the hook, so it finishes the chain only.
+// A trace group is built per base chain traversal, hence any verdict except none completes the group
+func traceVerdictScope(tr NftTrace, bc baseChain) verdictScope {
+	v := verdictKind(tr.Verdict)
+	switch nfte.VerdictKind(v) {
+	case nfte.VerdictDrop, nfte.VerdictStolen, nfte.VerdictQueue:
+		return verdictScopePacket
+	case nfte.VerdictRepeat:
+		return verdictScopeChain
+	case nfte.VerdictAccept, nfte.VerdictStop:
+	default:
+		if tr.Type != unix.NFT_TRACETYPE_POLICY {
+			return verdictScopeNone
+		}
+	}
+	if !bc.known || bc.last {
+		return verdictScopePacket
+	}
+	return verdictScopeChain
+}
@@ -0,0 +1,123 @@
+package nftrace
+
+import (
+	"testing"
+
+	rl "github.com/Morwran/ebpf-nftrace/internal/providers/nfrule-provider"
+
+	nftLib "github.com/google/nftables"
+	nfte "github.com/google/nftables/expr"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func Test_TraceVerdictScope(t *testing.T) {
+	var (
+		last        = baseChain{known: true, last: true}
+		followed    = baseChain{known: true}
+		verdictJump = nfte.VerdictJump
+		verdictCont = nfte.VerdictContinue
+	)
+	rule := func(v nfte.VerdictKind) NftTrace {
+		return NftTrace{Type: unix.NFT_TRACETYPE_RULE, Verdict: uint32(v)}
+	}
+	policy := func(v nfte.VerdictKind) NftTrace {
+		return NftTrace{Type: unix.NFT_TRACETYPE_POLICY, Verdict: uint32(v)}
+	}
+	testCases := []struct {
+		name  string
+		tr    NftTrace
+		chain baseChain
+		exp   verdictScope
+	}{
+		{"accept in the last chain", rule(nfte.VerdictAccept), last, verdictScopePacket},
+		{"accept in a followed chain", rule(nfte.VerdictAccept), followed, verdictScopeChain},
+		{"accept in unknown chain", rule(nfte.VerdictAccept), baseChain{}, verdictScopePacket},
+		{"policy accept in the last chain", policy(nfte.VerdictAccept), last, verdictScopePacket},
+		{"policy accept in a followed chain", policy(nfte.VerdictAccept), followed, verdictScopeChain},
+		{"policy drop in a followed chain", policy(nfte.VerdictDrop), followed, verdictScopePacket},
+		{"drop in a followed chain", rule(nfte.VerdictDrop), followed, verdictScopePacket},
+		{"queue in a followed chain", rule(nfte.VerdictQueue), followed, verdictScopePacket},
+		{"stolen in a followed chain", rule(nfte.VerdictStolen), followed, verdictScopePacket},
+		{"repeat in the last chain", rule(nfte.VerdictRepeat), last, verdictScopeChain},
+		{"stop in the last chain", rule(nfte.VerdictStop), last, verdictScopePacket},
+		{"jump in the last chain", rule(verdictJump), last, verdictScopeNone},
+		{"continue in the last chain", rule(verdictCont), last, verdictScopeNone},
+		{"return to the policy", NftTrace{Type: unix.NFT_TRACETYPE_RETURN, Verdict: uint32(verdictCont)}, last,
+			verdictScopeNone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.exp, traceVerdictScope(tc.tr, tc.chain))
+		})
+	}
+}
+
+func Test_LastBaseChain(t *testing.T) {
+	var (
+		inet   = &nftLib.Table{Name: "filter", Family: nftLib.TableFamilyINet}
+		ip     = &nftLib.Table{Name: "filter", Family: nftLib.TableFamilyIPv4}
+		ip6    = &nftLib.Table{Name: "filter", Family: nftLib.TableFamilyIPv6}
+		netdev = &nftLib.Table{Name: "filter", Family: nftLib.TableFamilyNetdev}
+		raw    = nftLib.ChainPriorityRaw
+		filter = nftLib.ChainPriorityFilter
+		mangle = nftLib.ChainPriorityMangle
+		snat   = nftLib.ChainPriorityNATSource
+	)
+	chain := func(tb *nftLib.Table, name string, hook *nftLib.ChainHook, typ nftLib.ChainType, prio *nftLib.ChainPriority) *nftLib.Chain {
+		return &nftLib.Chain{Table: tb, Name: name, Hooknum: hook, Type: typ, Priority: prio}
+	}
+	var (
+		pre       = chain(inet, "prerouting", nftLib.ChainHookPrerouting, nftLib.ChainTypeFilter, filter)
+		rawPre    = chain(inet, "raw-pre", nftLib.ChainHookPrerouting, nftLib.ChainTypeFilter, raw)
+		in        = chain(inet, "input", nftLib.ChainHookInput, nftLib.ChainTypeFilter, filter)
+		fwd       = chain(inet, "forward", nftLib.ChainHookForward, nftLib.ChainTypeFilter, filter)
+		ipFwd     = chain(ip, "forward", nftLib.ChainHookForward, nftLib.ChainTypeFilter, filter)
+		out       = chain(inet, "output", nftLib.ChainHookOutput, nftLib.ChainTypeFilter, filter)
+		routeOut  = chain(ip, "route-out", nftLib.ChainHookOutput, nftLib.ChainTypeRoute, mangle)
+		post      = chain(inet, "postrouting", nftLib.ChainHookPostrouting, nftLib.ChainTypeFilter, filter)
+		ipPost    = chain(ip, "postrouting", nftLib.ChainHookPostrouting, nftLib.ChainTypeFilter, filter)
+		ip6Post   = chain(ip6, "postrouting", nftLib.ChainHookPostrouting, nftLib.ChainTypeFilter, filter)
+		natPost   = chain(inet, "nat-post", nftLib.ChainHookPostrouting, nftLib.ChainTypeNAT, snat)
+		netdevIn  = chain(netdev, "ingress", nftLib.ChainHookIngress, nftLib.ChainTypeFilter, filter)
+		netdevEgr = chain(netdev, "egress", nftLib.ChainHookEgress, nftLib.ChainTypeFilter, filter)
+		entries   = func(chains ...*nftLib.Chain) (ret []rl.ChainEntry) {
+			for _, ch := range chains {
+				ret = append(ret, rl.ChainEntry{ChainNative: ch})
+			}
+			return ret
+		}
+	)
+	testCases := []struct {
+		name    string
+		chain   *nftLib.Chain
+		nfproto uint32
+		chains  []rl.ChainEntry
+		exp     bool
+	}{
+		{"forward without postrouting chains", fwd, unix.NFPROTO_IPV4, entries(pre, in, fwd, out), true},
+		{"forward followed by postrouting", fwd, unix.NFPROTO_IPV4, entries(pre, fwd, post), false},
+		{"forward followed by nat postrouting only", fwd, unix.NFPROTO_IPV4, entries(fwd, natPost), true},
+		{"output without postrouting chains", out, unix.NFPROTO_IPV4, entries(in, out), true},
+		{"output followed by postrouting", out, unix.NFPROTO_IPV6, entries(out, post), false},
+		{"route output followed by filter output", routeOut, unix.NFPROTO_IPV4, entries(routeOut, out), false},
+		{"filter output after route output", out, unix.NFPROTO_IPV4, entries(routeOut, out), true},
+		{"prerouting followed by input", pre, unix.NFPROTO_IPV4, entries(pre, in), false},
+		{"raw prerouting followed by filter prerouting", rawPre, unix.NFPROTO_IPV4, entries(rawPre, pre), false},
+		{"filter prerouting after raw prerouting", pre, unix.NFPROTO_IPV4, entries(rawPre, pre), true},
+		{"input followed by nothing", in, unix.NFPROTO_IPV4, entries(pre, in, fwd, out, post), true},
+		{"ip forward followed by inet postrouting", ipFwd, unix.NFPROTO_IPV4, entries(ipFwd, post), false},
+		{"inet forward followed by ip postrouting", fwd, unix.NFPROTO_IPV4, entries(fwd, ipPost), false},
+		{"ip6 postrouting skipped for ipv4", fwd, unix.NFPROTO_IPV4, entries(fwd, ip6Post), true},
+		{"ip postrouting skipped for ipv6", fwd, unix.NFPROTO_IPV6, entries(fwd, ipPost), true},
+		{"netdev ingress followed by the stack", netdevIn, unix.NFPROTO_IPV4, entries(netdevIn, in), false},
+		{"netdev ingress followed by egress", netdevIn, unix.NFPROTO_IPV4, entries(netdevIn, netdevEgr), false},
+		{"netdev ingress alone", netdevIn, unix.NFPROTO_IPV4, entries(netdevIn), true},
+		{"netdev egress", netdevEgr, unix.NFPROTO_IPV4, entries(netdevIn, netdevEgr, pre), true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.exp, lastBaseChain(tc.chain, tc.nfproto, tc.chains))
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 // IfaceProvider - common interface for the interface trace
 type IfaceProvider interface {
 	GetIface(index int) (string, error)
+	ListIfaces() []Iface
 	Run(ctx context.Context) (err error)
 	Close() error
 }
@@ -55,6 +56,11 @@ func (i *ifaceProviderImpl) GetIface(index int) (ifname string, err error) {
 	return ifc.ifName, err
 }
 
+// ListIfaces -
+func (i *ifaceProviderImpl) ListIfaces() []Iface {
+	return i.cache.List()
+}
+
 func (i *ifaceProviderImpl) Run(ctx context.Context) (err error) {
 	var doRun bool
 	i.onceRun.Do(func() {
@@ -1,6 +1,7 @@
 package iface
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/Morwran/ebpf-nftrace/internal/bimap"
@@ -9,6 +10,12 @@ import (
 	link "github.com/vishvananda/netlink"
 )
 
+// Iface - network interface known by the cache
+type Iface struct {
+	Index int
+	Name  string
+}
+
 type ifCacheItem struct {
 	ifName  string
 	ifIndex int
@@ -33,6 +40,19 @@ func (c *IfaceCache) GetItemById(index int) (ifc ifCacheItem, err error) {
 	return item.V, nil
 }
 
+// List - all the cached ifaces ordered by the index
+func (c *IfaceCache) List() []Iface {
+	c.mu.RLock()
+	ret := make([]Iface, 0, c.cache.Len())
+	c.cache.Iterate(func(index int, name string, _ ifCacheItem) bool {
+		ret = append(ret, Iface{Index: index, Name: name})
+		return true
+	})
+	c.mu.RUnlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Index < ret[j].Index })
+	return ret
+}
+
 func (c *IfaceCache) Update(ifc ifCacheItem) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -23,6 +23,7 @@ func (sui *ifCacheTestSuite) Test_IfCacheAddGetRmOneThread() {
 		cache.Update(t)
 	}
 	sui.Require().Equal(len(testData), cache.cache.Len())
+	sui.Require().Equal([]Iface{{1, "if1"}, {2, "if2"}, {3, "if3"}, {4, "if4"}}, cache.List())
 	for _, t := range testData {
 		ifc, err := cache.GetItemById(t.ifIndex)
 		sui.Require().NoError(err)
@@ -1,6 +1,7 @@
 package nfrule
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ type (
 		RuleStr    string
 		removed    bool
 		At         time.Time
+		replacedAt time.Time // the rule expression was replaced under the same handle, zero if never
 	}
 
 	RuleEntryKey struct {
@@ -26,9 +28,24 @@ type (
 		Handle      uint64
 	}
 
-	// RuleCache - cache to store nftables rules
+	// ChainEntry - chain of the rules, the hook and the type are set for a base chain only
+	ChainEntry struct {
+		ChainNative *nftLib.Chain
+		removed     bool
+		At          time.Time
+	}
+
+	ChainEntryKey struct {
+		TableName   string
+		TableFamily nftLib.TableFamily
+		ChainName   string
+	}
+
+	// RuleCache - cache to store nftables rules and their chains
 	RuleCache struct {
 		cache     dict.HDict[RuleEntryKey, RuleEntry]
+		chains    dict.HDict[ChainEntryKey, ChainEntry]
+		bases     []ChainEntry // snapshot of the base chains, nil if the chains were updated since it was taken
 		ttl       time.Duration
 		mu        sync.RWMutex
 		onceClose sync.Once
@@ -84,6 +101,15 @@ func (r *RuleCache) clean() {
 		return true
 	})
 	r.cache.Del(keys...)
+
+	chains := make([]ChainEntryKey, 0, r.chains.Len())
+	r.chains.Iterate(func(k ChainEntryKey, ce ChainEntry) bool {
+		if ce.removed && (time.Since(ce.At) >= r.ttl) {
+			chains = append(chains, k)
+		}
+		return true
+	})
+	r.chains.Del(chains...)
 }
 
 // Refresh - update rule cache
@@ -94,11 +120,18 @@ func (r *RuleCache) Refresh() error {
 	}
 	defer conn.CloseLasting() //nolint:errcheck
 
+	chains, err := conn.ListChains()
+	if err != nil {
+		return errors.WithMessage(err, "failed to obtain chains from the netfilter")
+	}
 	rules, err := conn.GetAllRules()
 	if err != nil {
 		return errors.WithMessage(err, "failed to obtain rules from the netfilter")
 	}
 	t := time.Now()
+	for _, ch := range chains {
+		r.UpdChain(ChainEntry{ChainNative: ch, At: t})
+	}
 	for _, rl := range rules {
 		pr := (*parser.Rule)(rl)
 		strRule, err := pr.String()
@@ -133,6 +166,39 @@ func (r *RuleCache) GetRule(k RuleEntryKey) (RuleEntry, bool) {
 	return r.cache.Get(k)
 }
 
+// List - rules in the cache except the removed ones, ordered by the table, family, chain and handle
+func (r *RuleCache) List() []RuleEntry {
+	r.mu.RLock()
+	keys := make([]RuleEntryKey, 0, r.cache.Len())
+	rules := make(map[RuleEntryKey]RuleEntry, r.cache.Len())
+	r.cache.Iterate(func(k RuleEntryKey, re RuleEntry) bool {
+		if !re.removed {
+			keys = append(keys, k)
+			rules[k] = re
+		}
+		return true
+	})
+	r.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.TableName != b.TableName {
+			return a.TableName < b.TableName
+		}
+		if a.TableFamily != b.TableFamily {
+			return a.TableFamily < b.TableFamily
+		}
+		if a.ChainName != b.ChainName {
+			return a.ChainName < b.ChainName
+		}
+		return a.Handle < b.Handle
+	})
+	ret := make([]RuleEntry, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, rules[k])
+	}
+	return ret
+}
+
 // RmRule remove rule by key
 func (r *RuleCache) RmRule(k RuleEntryKey) {
 	r.mu.Lock()
@@ -155,19 +221,72 @@ func (r *RuleCache) InsertRule(rl RuleEntry) {
 	)
 }
 
-// UpdRule update rule in cache
+// UpdRule update rule in cache. The rule of the known handle with another expression is a replacement
+// (nft replace rule), the traces taken before it don't belong to the new expression
 func (r *RuleCache) UpdRule(rl RuleEntry) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.cache.Put(
-		RuleEntryKey{
-			rl.RuleNative.Table.Name,
-			rl.RuleNative.Table.Family,
-			rl.RuleNative.Chain.Name,
-			rl.RuleNative.Handle,
-		},
-		rl,
-	)
+	k := RuleEntryKey{
+		rl.RuleNative.Table.Name,
+		rl.RuleNative.Table.Family,
+		rl.RuleNative.Chain.Name,
+		rl.RuleNative.Handle,
+	}
+	if prev, ok := r.cache.Get(k); ok && !prev.removed {
+		rl.replacedAt = prev.replacedAt
+		if !rl.removed && prev.RuleStr != rl.RuleStr {
+			rl.replacedAt = rl.At
+		}
+	}
+	r.cache.Put(k, rl)
+}
+
+// expired - the rule doesn't describe the trace: it was removed before the packet was traced,
+// or replaced after it
+func (re RuleEntry) expired(tr TraceRuleDescriptor) bool {
+	return (re.removed && !re.At.After(tr.TracedAt)) || re.replacedAt.After(tr.TracedAt) ||
+		re.RuleNative.Table.Name != tr.TableName || re.RuleNative.Chain.Name != tr.ChainName
+}
+
+// GetChain - chain by key
+func (r *RuleCache) GetChain(k ChainEntryKey) (ChainEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.chains.Get(k)
+}
+
+// UpdChain - insert or update the chain, the removed chain keeps its hook and type
+func (r *RuleCache) UpdChain(ce ChainEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := ChainEntryKey{ce.ChainNative.Table.Name, ce.ChainNative.Table.Family, ce.ChainNative.Name}
+	if prev, ok := r.chains.Get(k); ok && ce.removed {
+		ce.ChainNative = prev.ChainNative
+	}
+	r.chains.Put(k, ce)
+	r.bases = nil
+}
+
+// BaseChains - base chains in the cache except the removed ones. The slice is shared, it must not be modified
+func (r *RuleCache) BaseChains() []ChainEntry {
+	r.mu.RLock()
+	bases := r.bases
+	r.mu.RUnlock()
+	if bases != nil {
+		return bases
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bases == nil {
+		r.bases = make([]ChainEntry, 0)
+		r.chains.Iterate(func(_ ChainEntryKey, ce ChainEntry) bool {
+			if !ce.removed && ce.ChainNative != nil && ce.ChainNative.Hooknum != nil {
+				r.bases = append(r.bases, ce)
+			}
+			return true
+		})
+	}
+	return r.bases
 }
 
 // Close rule cache
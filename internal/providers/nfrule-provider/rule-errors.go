@@ -23,6 +23,7 @@ func (e ErrRule) Cause() error {
 // Error messages which can be returned by ruler.
 var (
 	ErrNotFoundRule      = errors.New("rule is not found")
+	ErrNotFoundChain     = errors.New("chain is not found")
 	ErrConvertRuleToJson = errors.New("failed conversion rule to json")
 	ErrExpiredTrace      = errors.New("expired trace")
 )
@@ -22,6 +22,9 @@ type (
 	RuleProvider interface {
 		Run(ctx context.Context) (err error)
 		GetRuleForTrace(tr TraceRuleDescriptor) (re RuleEntry, err error)
+		GetChainForTrace(tr TraceRuleDescriptor) (ce ChainEntry, err error)
+		ListRules() []RuleEntry
+		ListBaseChains() []ChainEntry
 		Close() error
 	}
 	NetlinkWatcher interface {
@@ -114,15 +117,43 @@ func (r *ruleProviderImpl) GetRuleForTrace(tr TraceRuleDescriptor) (re RuleEntry
 		return re, nil
 	}
 
-	if re.removed || re.At.After(tr.TracedAt) ||
-		!(re.RuleNative.Table.Name == tr.TableName &&
-			re.RuleNative.Chain.Name == tr.ChainName) {
+	if re.expired(tr) {
 		return re, ErrExpiredTrace
 	}
 
 	return re, nil
 }
 
+// GetChainForTrace - chain of the trace, the rule handle of the descriptor isn't used
+func (r *ruleProviderImpl) GetChainForTrace(tr TraceRuleDescriptor) (ce ChainEntry, err error) {
+	k := ChainEntryKey{tr.TableName, nftLib.TableFamily(tr.Family), tr.ChainName}
+	if ce, ok := r.cache.GetChain(k); ok {
+		return ce, nil
+	}
+	conn, err := nftLib.New()
+	if err != nil {
+		return ce, err
+	}
+	defer conn.CloseLasting() //nolint:errcheck
+	ch, err := conn.ListChain(&nftLib.Table{Name: tr.TableName, Family: nftLib.TableFamily(tr.Family)}, tr.ChainName)
+	if err != nil {
+		return ce, errors.WithMessage(ErrNotFoundChain, err.Error())
+	}
+	ce = ChainEntry{ChainNative: ch, At: time.Now()}
+	r.cache.UpdChain(ce)
+	return ce, nil
+}
+
+// ListRules - rules known by the provider
+func (r *ruleProviderImpl) ListRules() []RuleEntry {
+	return r.cache.List()
+}
+
+// ListBaseChains - base chains known by the provider
+func (r *ruleProviderImpl) ListBaseChains() []ChainEntry {
+	return r.cache.BaseChains()
+}
+
 func (r *ruleProviderImpl) Run(ctx context.Context) (err error) {
 	var doRun bool
 
@@ -217,6 +248,25 @@ func (r *ruleProviderImpl) handleMsg(ctx context.Context, msg netlink.Message) e
 		}
 		r.cache.UpdRule(re)
 		log.Debug(dbgLog)
+	case unix.NFT_MSG_NEWCHAIN, unix.NFT_MSG_DELCHAIN:
+		chain := new(parser.Chain)
+		if err := chain.InitFromMsg(msg); err != nil {
+			return errors.WithMessage(err, "failed to fetch chain from netlink message")
+		}
+		if chain.Table == nil {
+			return nil
+		}
+		ce := ChainEntry{
+			ChainNative: (*nftLib.Chain)(chain),
+			removed:     t == unix.NFT_MSG_DELCHAIN,
+			At:          time.Now(),
+		}
+		r.cache.UpdChain(ce)
+		if ce.removed {
+			log.Debugf("removed chain %s/%s", chain.Table.Name, chain.Name)
+		} else {
+			log.Debugf("added new chain %s/%s", chain.Table.Name, chain.Name)
+		}
 	}
 	return nil
 }
@@ -224,6 +224,89 @@ func (sui *ruleTestSuite) Test_RuleGetRmMultiThread() {
 	wg.Wait()
 }
 
+func (sui *ruleTestSuite) Test_RuleExpiry() {
+	c := NewRuleCache(time.Minute)
+	defer c.Close() //nolint:errcheck
+	rule := func(str string, at time.Time, removed bool) RuleEntry {
+		return RuleEntry{
+			RuleNative: &nftables.Rule{
+				Table:  &nftables.Table{Name: "filter", Family: nftables.TableFamilyIPv4},
+				Chain:  &nftables.Chain{Name: "input"},
+				Handle: 5,
+			},
+			RuleStr: str,
+			removed: removed,
+			At:      at,
+		}
+	}
+	key := RuleEntryKey{"filter", nftables.TableFamilyIPv4, "input", 5}
+	rd := func(traced time.Time) TraceRuleDescriptor {
+		return TraceRuleDescriptor{TableName: "filter", ChainName: "input", RuleHandle: 5, Family: 2, TracedAt: traced}
+	}
+	t0 := time.Now()
+
+	// the rule learned after the packet was traced is the one the packet hit
+	c.UpdRule(rule("tcp dport 80 accept", t0.Add(time.Second), false))
+	re, _ := c.GetRule(key)
+	sui.Require().False(re.expired(rd(t0)))
+
+	// the same expression notified again is not a replacement
+	c.UpdRule(rule("tcp dport 80 accept", t0.Add(2*time.Second), false))
+	re, _ = c.GetRule(key)
+	sui.Require().False(re.expired(rd(t0)))
+
+	// nft replace rule
+	c.UpdRule(rule("tcp dport 81 accept", t0.Add(3*time.Second), false))
+	re, _ = c.GetRule(key)
+	sui.Require().True(re.expired(rd(t0)))
+	sui.Require().False(re.expired(rd(t0.Add(4 * time.Second))))
+
+	// removed after the packet was traced
+	c.UpdRule(rule("tcp dport 81 accept", t0.Add(5*time.Second), true))
+	re, _ = c.GetRule(key)
+	sui.Require().False(re.expired(rd(t0.Add(4 * time.Second))))
+	sui.Require().True(re.expired(rd(t0.Add(6 * time.Second))))
+	sui.Require().True(re.expired(TraceRuleDescriptor{TableName: "filter", ChainName: "output", TracedAt: t0.Add(4 * time.Second)}))
+}
+
+func (sui *ruleTestSuite) Test_ChainRemoved() {
+	c := NewRuleCache(time.Minute)
+	defer c.Close() //nolint:errcheck
+	table := &nftables.Table{Name: "filter", Family: nftables.TableFamilyINet}
+	key := ChainEntryKey{"filter", nftables.TableFamilyINet, "input"}
+
+	c.UpdChain(ChainEntry{ChainNative: &nftables.Chain{
+		Table: table, Name: "input", Hooknum: nftables.ChainHookInput, Type: nftables.ChainTypeFilter,
+	}})
+	// the delete notification doesn't carry the hook, the traces taken before it still need it
+	c.UpdChain(ChainEntry{ChainNative: &nftables.Chain{Table: table, Name: "input"}, removed: true})
+	ce, ok := c.GetChain(key)
+	sui.Require().True(ok)
+	sui.Require().True(ce.removed)
+	sui.Require().Equal(nftables.ChainHookInput, ce.ChainNative.Hooknum)
+	sui.Require().Equal(nftables.ChainTypeFilter, ce.ChainNative.Type)
+}
+
+func (sui *ruleTestSuite) Test_BaseChains() {
+	c := NewRuleCache(time.Minute)
+	defer c.Close() //nolint:errcheck
+	table := &nftables.Table{Name: "filter", Family: nftables.TableFamilyINet}
+
+	c.UpdChain(ChainEntry{ChainNative: &nftables.Chain{Table: table, Name: "input", Hooknum: nftables.ChainHookInput}})
+	c.UpdChain(ChainEntry{ChainNative: &nftables.Chain{Table: table, Name: "web"}})
+	bases := c.BaseChains()
+	sui.Require().Len(bases, 1)
+	sui.Require().Equal("input", bases[0].ChainNative.Name)
+
+	c.UpdChain(ChainEntry{ChainNative: &nftables.Chain{Table: table, Name: "output", Hooknum: nftables.ChainHookOutput}})
+	sui.Require().Len(c.BaseChains(), 2)
+
+	c.UpdChain(ChainEntry{ChainNative: &nftables.Chain{Table: table, Name: "input"}, removed: true})
+	bases = c.BaseChains()
+	sui.Require().Len(bases, 1)
+	sui.Require().Equal("output", bases[0].ChainNative.Name)
+}
+
 func Test_Rule(t *testing.T) {
 	suite.Run(t, new(ruleTestSuite))
 }
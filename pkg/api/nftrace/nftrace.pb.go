@@ -0,0 +1,1344 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.33.0
+// 	protoc        v4.25.3
+// source: nftrace/nftrace.proto
+
+package nftrace
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Hop - single step of the packet path through the ruleset
+type Hop struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// trace type (rule/return/policy)
+	Type       string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Table      string `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`
+	Chain      string `protobuf:"bytes,3,opt,name=chain,proto3" json:"chain,omitempty"`
+	Handle     uint64 `protobuf:"varint,4,opt,name=handle,proto3" json:"handle,omitempty"`
+	Rule       string `protobuf:"bytes,5,opt,name=rule,proto3" json:"rule,omitempty"`
+	Verdict    string `protobuf:"bytes,6,opt,name=verdict,proto3" json:"verdict,omitempty"`
+	JumpTarget string `protobuf:"bytes,7,opt,name=jump_target,json=jumpTarget,proto3" json:"jump_target,omitempty"`
+}
+
+func (x *Hop) Reset() {
+	*x = Hop{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Hop) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hop) ProtoMessage() {}
+
+func (x *Hop) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hop.ProtoReflect.Descriptor instead.
+func (*Hop) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Hop) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Hop) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *Hop) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+func (x *Hop) GetHandle() uint64 {
+	if x != nil {
+		return x.Handle
+	}
+	return 0
+}
+
+func (x *Hop) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *Hop) GetVerdict() string {
+	if x != nil {
+		return x.Verdict
+	}
+	return ""
+}
+
+func (x *Hop) GetJumpTarget() string {
+	if x != nil {
+		return x.JumpTarget
+	}
+	return ""
+}
+
+// Trace - see model.Trace
+type Trace struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TraceId    uint32 `protobuf:"varint,1,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	Table      string `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`
+	Chain      string `protobuf:"bytes,3,opt,name=chain,proto3" json:"chain,omitempty"`
+	JumpTarget string `protobuf:"bytes,4,opt,name=jump_target,json=jumpTarget,proto3" json:"jump_target,omitempty"`
+	RuleHandle uint64 `protobuf:"varint,5,opt,name=rule_handle,json=ruleHandle,proto3" json:"rule_handle,omitempty"`
+	Family     string `protobuf:"bytes,6,opt,name=family,proto3" json:"family,omitempty"`
+	L3Proto    string `protobuf:"bytes,7,opt,name=l3proto,proto3" json:"l3proto,omitempty"`
+	Iif        string `protobuf:"bytes,8,opt,name=iif,proto3" json:"iif,omitempty"`
+	Oif        string `protobuf:"bytes,9,opt,name=oif,proto3" json:"oif,omitempty"`
+	HwSrc      string `protobuf:"bytes,10,opt,name=hw_src,json=hwSrc,proto3" json:"hw_src,omitempty"`
+	HwDst      string `protobuf:"bytes,11,opt,name=hw_dst,json=hwDst,proto3" json:"hw_dst,omitempty"`
+	IpSrc      string `protobuf:"bytes,12,opt,name=ip_src,json=ipSrc,proto3" json:"ip_src,omitempty"`
+	IpDst      string `protobuf:"bytes,13,opt,name=ip_dst,json=ipDst,proto3" json:"ip_dst,omitempty"`
+	Sport      uint32 `protobuf:"varint,14,opt,name=sport,proto3" json:"sport,omitempty"`
+	Dport      uint32 `protobuf:"varint,15,opt,name=dport,proto3" json:"dport,omitempty"`
+	Len        uint32 `protobuf:"varint,16,opt,name=len,proto3" json:"len,omitempty"`
+	Proto      string `protobuf:"bytes,17,opt,name=proto,proto3" json:"proto,omitempty"`
+	Verdict    string `protobuf:"bytes,18,opt,name=verdict,proto3" json:"verdict,omitempty"`
+	// final verdict of the path, empty if the path is incomplete
+	Final      string                 `protobuf:"bytes,19,opt,name=final,proto3" json:"final,omitempty"`
+	Rule       string                 `protobuf:"bytes,20,opt,name=rule,proto3" json:"rule,omitempty"`
+	Path       []*Hop                 `protobuf:"bytes,21,rep,name=path,proto3" json:"path,omitempty"`
+	CtId       uint32                 `protobuf:"varint,22,opt,name=ct_id,json=ctId,proto3" json:"ct_id,omitempty"`
+	CtState    string                 `protobuf:"bytes,23,opt,name=ct_state,json=ctState,proto3" json:"ct_state,omitempty"`
+	CtDir      string                 `protobuf:"bytes,24,opt,name=ct_dir,json=ctDir,proto3" json:"ct_dir,omitempty"`
+	CtStatus   string                 `protobuf:"bytes,25,opt,name=ct_status,json=ctStatus,proto3" json:"ct_status,omitempty"`
+	Cnt        uint64                 `protobuf:"varint,26,opt,name=cnt,proto3" json:"cnt,omitempty"`
+	Bytes      uint64                 `protobuf:"varint,27,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	FirstSeen  *timestamppb.Timestamp `protobuf:"bytes,28,opt,name=first_seen,json=firstSeen,proto3" json:"first_seen,omitempty"`
+	LastSeen   *timestamppb.Timestamp `protobuf:"bytes,29,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Incomplete bool                   `protobuf:"varint,30,opt,name=incomplete,proto3" json:"incomplete,omitempty"`
+	Timestamp  *timestamppb.Timestamp `protobuf:"bytes,31,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *Trace) Reset() {
+	*x = Trace{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Trace) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trace) ProtoMessage() {}
+
+func (x *Trace) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trace.ProtoReflect.Descriptor instead.
+func (*Trace) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Trace) GetTraceId() uint32 {
+	if x != nil {
+		return x.TraceId
+	}
+	return 0
+}
+
+func (x *Trace) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *Trace) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+func (x *Trace) GetJumpTarget() string {
+	if x != nil {
+		return x.JumpTarget
+	}
+	return ""
+}
+
+func (x *Trace) GetRuleHandle() uint64 {
+	if x != nil {
+		return x.RuleHandle
+	}
+	return 0
+}
+
+func (x *Trace) GetFamily() string {
+	if x != nil {
+		return x.Family
+	}
+	return ""
+}
+
+func (x *Trace) GetL3Proto() string {
+	if x != nil {
+		return x.L3Proto
+	}
+	return ""
+}
+
+func (x *Trace) GetIif() string {
+	if x != nil {
+		return x.Iif
+	}
+	return ""
+}
+
+func (x *Trace) GetOif() string {
+	if x != nil {
+		return x.Oif
+	}
+	return ""
+}
+
+func (x *Trace) GetHwSrc() string {
+	if x != nil {
+		return x.HwSrc
+	}
+	return ""
+}
+
+func (x *Trace) GetHwDst() string {
+	if x != nil {
+		return x.HwDst
+	}
+	return ""
+}
+
+func (x *Trace) GetIpSrc() string {
+	if x != nil {
+		return x.IpSrc
+	}
+	return ""
+}
+
+func (x *Trace) GetIpDst() string {
+	if x != nil {
+		return x.IpDst
+	}
+	return ""
+}
+
+func (x *Trace) GetSport() uint32 {
+	if x != nil {
+		return x.Sport
+	}
+	return 0
+}
+
+func (x *Trace) GetDport() uint32 {
+	if x != nil {
+		return x.Dport
+	}
+	return 0
+}
+
+func (x *Trace) GetLen() uint32 {
+	if x != nil {
+		return x.Len
+	}
+	return 0
+}
+
+func (x *Trace) GetProto() string {
+	if x != nil {
+		return x.Proto
+	}
+	return ""
+}
+
+func (x *Trace) GetVerdict() string {
+	if x != nil {
+		return x.Verdict
+	}
+	return ""
+}
+
+func (x *Trace) GetFinal() string {
+	if x != nil {
+		return x.Final
+	}
+	return ""
+}
+
+func (x *Trace) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *Trace) GetPath() []*Hop {
+	if x != nil {
+		return x.Path
+	}
+	return nil
+}
+
+func (x *Trace) GetCtId() uint32 {
+	if x != nil {
+		return x.CtId
+	}
+	return 0
+}
+
+func (x *Trace) GetCtState() string {
+	if x != nil {
+		return x.CtState
+	}
+	return ""
+}
+
+func (x *Trace) GetCtDir() string {
+	if x != nil {
+		return x.CtDir
+	}
+	return ""
+}
+
+func (x *Trace) GetCtStatus() string {
+	if x != nil {
+		return x.CtStatus
+	}
+	return ""
+}
+
+func (x *Trace) GetCnt() uint64 {
+	if x != nil {
+		return x.Cnt
+	}
+	return 0
+}
+
+func (x *Trace) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *Trace) GetFirstSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FirstSeen
+	}
+	return nil
+}
+
+func (x *Trace) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *Trace) GetIncomplete() bool {
+	if x != nil {
+		return x.Incomplete
+	}
+	return false
+}
+
+func (x *Trace) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+// Filter - the trace matches if every non-empty field matches,
+// a repeated field matches if any of its values matches
+type Filter struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tables   []string `protobuf:"bytes,1,rep,name=tables,proto3" json:"tables,omitempty"`
+	Chains   []string `protobuf:"bytes,2,rep,name=chains,proto3" json:"chains,omitempty"`
+	Families []string `protobuf:"bytes,3,rep,name=families,proto3" json:"families,omitempty"`
+	// final verdicts, the rule verdict is used for the incomplete path
+	Verdicts []string `protobuf:"bytes,4,rep,name=verdicts,proto3" json:"verdicts,omitempty"`
+	Ifaces   []string `protobuf:"bytes,5,rep,name=ifaces,proto3" json:"ifaces,omitempty"`
+	Protos   []string `protobuf:"bytes,6,rep,name=protos,proto3" json:"protos,omitempty"`
+	// CIDR or address, matches the source or the destination
+	Nets []string `protobuf:"bytes,7,rep,name=nets,proto3" json:"nets,omitempty"`
+	// matches the source or the destination port
+	Ports []uint32 `protobuf:"varint,8,rep,packed,name=ports,proto3" json:"ports,omitempty"`
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Filter) GetTables() []string {
+	if x != nil {
+		return x.Tables
+	}
+	return nil
+}
+
+func (x *Filter) GetChains() []string {
+	if x != nil {
+		return x.Chains
+	}
+	return nil
+}
+
+func (x *Filter) GetFamilies() []string {
+	if x != nil {
+		return x.Families
+	}
+	return nil
+}
+
+func (x *Filter) GetVerdicts() []string {
+	if x != nil {
+		return x.Verdicts
+	}
+	return nil
+}
+
+func (x *Filter) GetIfaces() []string {
+	if x != nil {
+		return x.Ifaces
+	}
+	return nil
+}
+
+func (x *Filter) GetProtos() []string {
+	if x != nil {
+		return x.Protos
+	}
+	return nil
+}
+
+func (x *Filter) GetNets() []string {
+	if x != nil {
+		return x.Nets
+	}
+	return nil
+}
+
+func (x *Filter) GetPorts() []uint32 {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+type WatchReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Filter *Filter `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	// number of traces buffered for the client, the client is disconnected when its buffer overflows;
+	// the server default is used if 0
+	Buffer uint32 `protobuf:"varint,2,opt,name=buffer,proto3" json:"buffer,omitempty"`
+}
+
+func (x *WatchReq) Reset() {
+	*x = WatchReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchReq) ProtoMessage() {}
+
+func (x *WatchReq) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchReq.ProtoReflect.Descriptor instead.
+func (*WatchReq) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *WatchReq) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *WatchReq) GetBuffer() uint32 {
+	if x != nil {
+		return x.Buffer
+	}
+	return 0
+}
+
+type SnapshotReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Filter *Filter `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	// max number of the traces, all the matched recent traces if 0
+	Limit uint32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (x *SnapshotReq) Reset() {
+	*x = SnapshotReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SnapshotReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotReq) ProtoMessage() {}
+
+func (x *SnapshotReq) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotReq.ProtoReflect.Descriptor instead.
+func (*SnapshotReq) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SnapshotReq) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *SnapshotReq) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type SnapshotResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// from the oldest to the newest
+	Traces []*Trace `protobuf:"bytes,1,rep,name=traces,proto3" json:"traces,omitempty"`
+}
+
+func (x *SnapshotResp) Reset() {
+	*x = SnapshotResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SnapshotResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotResp) ProtoMessage() {}
+
+func (x *SnapshotResp) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotResp.ProtoReflect.Descriptor instead.
+func (*SnapshotResp) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SnapshotResp) GetTraces() []*Trace {
+	if x != nil {
+		return x.Traces
+	}
+	return nil
+}
+
+type ListRulesReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListRulesReq) Reset() {
+	*x = ListRulesReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListRulesReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRulesReq) ProtoMessage() {}
+
+func (x *ListRulesReq) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRulesReq.ProtoReflect.Descriptor instead.
+func (*ListRulesReq) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{6}
+}
+
+type Rule struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Table  string `protobuf:"bytes,1,opt,name=table,proto3" json:"table,omitempty"`
+	Family string `protobuf:"bytes,2,opt,name=family,proto3" json:"family,omitempty"`
+	Chain  string `protobuf:"bytes,3,opt,name=chain,proto3" json:"chain,omitempty"`
+	Handle uint64 `protobuf:"varint,4,opt,name=handle,proto3" json:"handle,omitempty"`
+	Rule   string `protobuf:"bytes,5,opt,name=rule,proto3" json:"rule,omitempty"`
+}
+
+func (x *Rule) Reset() {
+	*x = Rule{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Rule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rule) ProtoMessage() {}
+
+func (x *Rule) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rule.ProtoReflect.Descriptor instead.
+func (*Rule) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Rule) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *Rule) GetFamily() string {
+	if x != nil {
+		return x.Family
+	}
+	return ""
+}
+
+func (x *Rule) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+func (x *Rule) GetHandle() uint64 {
+	if x != nil {
+		return x.Handle
+	}
+	return 0
+}
+
+func (x *Rule) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+type ListRulesResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rules []*Rule `protobuf:"bytes,1,rep,name=rules,proto3" json:"rules,omitempty"`
+}
+
+func (x *ListRulesResp) Reset() {
+	*x = ListRulesResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListRulesResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRulesResp) ProtoMessage() {}
+
+func (x *ListRulesResp) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRulesResp.ProtoReflect.Descriptor instead.
+func (*ListRulesResp) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListRulesResp) GetRules() []*Rule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+type ListIfacesReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListIfacesReq) Reset() {
+	*x = ListIfacesReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListIfacesReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListIfacesReq) ProtoMessage() {}
+
+func (x *ListIfacesReq) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListIfacesReq.ProtoReflect.Descriptor instead.
+func (*ListIfacesReq) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{9}
+}
+
+type Iface struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Index uint32 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Name  string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *Iface) Reset() {
+	*x = Iface{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Iface) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Iface) ProtoMessage() {}
+
+func (x *Iface) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Iface.ProtoReflect.Descriptor instead.
+func (*Iface) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Iface) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Iface) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ListIfacesResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ifaces []*Iface `protobuf:"bytes,1,rep,name=ifaces,proto3" json:"ifaces,omitempty"`
+}
+
+func (x *ListIfacesResp) Reset() {
+	*x = ListIfacesResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_nftrace_nftrace_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListIfacesResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListIfacesResp) ProtoMessage() {}
+
+func (x *ListIfacesResp) ProtoReflect() protoreflect.Message {
+	mi := &file_nftrace_nftrace_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListIfacesResp.ProtoReflect.Descriptor instead.
+func (*ListIfacesResp) Descriptor() ([]byte, []int) {
+	return file_nftrace_nftrace_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListIfacesResp) GetIfaces() []*Iface {
+	if x != nil {
+		return x.Ifaces
+	}
+	return nil
+}
+
+var File_nftrace_nftrace_proto protoreflect.FileDescriptor
+
+var file_nftrace_nftrace_proto_rawDesc = []byte{
+	0x0a, 0x15, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2f, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65,
+	0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x22, 0xac, 0x01, 0x0a, 0x03, 0x48, 0x6f, 0x70, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a,
+	0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x61,
+	0x62, 0x6c, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x61, 0x6e,
+	0x64, 0x6c, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x68, 0x61, 0x6e, 0x64, 0x6c,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x72, 0x75, 0x6c, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x64, 0x69, 0x63, 0x74,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x76, 0x65, 0x72, 0x64, 0x69, 0x63, 0x74, 0x12,
+	0x1f, 0x0a, 0x0b, 0x6a, 0x75, 0x6d, 0x70, 0x5f, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6a, 0x75, 0x6d, 0x70, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x22, 0xd6, 0x06, 0x0a, 0x05, 0x54, 0x72, 0x61, 0x63, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x74, 0x72,
+	0x61, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x74, 0x72,
+	0x61, 0x63, 0x65, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x63,
+	0x68, 0x61, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x68, 0x61, 0x69,
+	0x6e, 0x12, 0x1f, 0x0a, 0x0b, 0x6a, 0x75, 0x6d, 0x70, 0x5f, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6a, 0x75, 0x6d, 0x70, 0x54, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x75, 0x6c, 0x65, 0x5f, 0x68, 0x61, 0x6e, 0x64, 0x6c,
+	0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x72, 0x75, 0x6c, 0x65, 0x48, 0x61, 0x6e,
+	0x64, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x6c,
+	0x33, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6c, 0x33,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x10, 0x0a, 0x03, 0x69, 0x69, 0x66, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x69, 0x69, 0x66, 0x12, 0x10, 0x0a, 0x03, 0x6f, 0x69, 0x66, 0x18, 0x09,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6f, 0x69, 0x66, 0x12, 0x15, 0x0a, 0x06, 0x68, 0x77, 0x5f,
+	0x73, 0x72, 0x63, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x68, 0x77, 0x53, 0x72, 0x63,
+	0x12, 0x15, 0x0a, 0x06, 0x68, 0x77, 0x5f, 0x64, 0x73, 0x74, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x68, 0x77, 0x44, 0x73, 0x74, 0x12, 0x15, 0x0a, 0x06, 0x69, 0x70, 0x5f, 0x73, 0x72,
+	0x63, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x69, 0x70, 0x53, 0x72, 0x63, 0x12, 0x15,
+	0x0a, 0x06, 0x69, 0x70, 0x5f, 0x64, 0x73, 0x74, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x69, 0x70, 0x44, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x0e,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x73, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x64,
+	0x70, 0x6f, 0x72, 0x74, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x64, 0x70, 0x6f, 0x72,
+	0x74, 0x12, 0x10, 0x0a, 0x03, 0x6c, 0x65, 0x6e, 0x18, 0x10, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03,
+	0x6c, 0x65, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x18, 0x11, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72,
+	0x64, 0x69, 0x63, 0x74, 0x18, 0x12, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x76, 0x65, 0x72, 0x64,
+	0x69, 0x63, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x18, 0x13, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x75, 0x6c,
+	0x65, 0x18, 0x14, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x12, 0x20, 0x0a,
+	0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x15, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x6e, 0x66,
+	0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x48, 0x6f, 0x70, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12,
+	0x13, 0x0a, 0x05, 0x63, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x16, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04,
+	0x63, 0x74, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x74, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x65,
+	0x18, 0x17, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x74, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12,
+	0x15, 0x0a, 0x06, 0x63, 0x74, 0x5f, 0x64, 0x69, 0x72, 0x18, 0x18, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x63, 0x74, 0x44, 0x69, 0x72, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x74, 0x5f, 0x73, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x18, 0x19, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x74, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x6e, 0x74, 0x18, 0x1a, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x03, 0x63, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x1b,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x12, 0x39, 0x0a, 0x0a, 0x66,
+	0x69, 0x72, 0x73, 0x74, 0x5f, 0x73, 0x65, 0x65, 0x6e, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x66, 0x69, 0x72,
+	0x73, 0x74, 0x53, 0x65, 0x65, 0x6e, 0x12, 0x37, 0x0a, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x5f, 0x73,
+	0x65, 0x65, 0x6e, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x08, 0x6c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x65, 0x6e, 0x12,
+	0x1e, 0x0a, 0x0a, 0x69, 0x6e, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x18, 0x1e, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x6e, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x12,
+	0x38, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x1f, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0xca, 0x01, 0x0a, 0x06, 0x46, 0x69,
+	0x6c, 0x74, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06,
+	0x63, 0x68, 0x61, 0x69, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x63, 0x68,
+	0x61, 0x69, 0x6e, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x69, 0x65, 0x73,
+	0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x69, 0x65, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x76, 0x65, 0x72, 0x64, 0x69, 0x63, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x08, 0x76, 0x65, 0x72, 0x64, 0x69, 0x63, 0x74, 0x73, 0x12, 0x16, 0x0a, 0x06,
+	0x69, 0x66, 0x61, 0x63, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x69, 0x66,
+	0x61, 0x63, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x18, 0x06,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x12, 0x12, 0x0a, 0x04,
+	0x6e, 0x65, 0x74, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x65, 0x74, 0x73,
+	0x12, 0x14, 0x0a, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0d, 0x52,
+	0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x22, 0x4b, 0x0a, 0x08, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52,
+	0x65, 0x71, 0x12, 0x27, 0x0a, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x46, 0x69, 0x6c,
+	0x74, 0x65, 0x72, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x62,
+	0x75, 0x66, 0x66, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x62, 0x75, 0x66,
+	0x66, 0x65, 0x72, 0x22, 0x4c, 0x0a, 0x0b, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52,
+	0x65, 0x71, 0x12, 0x27, 0x0a, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x46, 0x69, 0x6c,
+	0x74, 0x65, 0x72, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x6c,
+	0x69, 0x6d, 0x69, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x22, 0x36, 0x0a, 0x0c, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x73,
+	0x70, 0x12, 0x26, 0x0a, 0x06, 0x74, 0x72, 0x61, 0x63, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x0e, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x54, 0x72, 0x61, 0x63,
+	0x65, 0x52, 0x06, 0x74, 0x72, 0x61, 0x63, 0x65, 0x73, 0x22, 0x0e, 0x0a, 0x0c, 0x4c, 0x69, 0x73,
+	0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x71, 0x22, 0x76, 0x0a, 0x04, 0x52, 0x75, 0x6c,
+	0x65, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x74, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x61, 0x6d, 0x69, 0x6c,
+	0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x12,
+	0x14, 0x0a, 0x05, 0x63, 0x68, 0x61, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x63, 0x68, 0x61, 0x69, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x61, 0x6e, 0x64, 0x6c, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x68, 0x61, 0x6e, 0x64, 0x6c, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x72, 0x75, 0x6c, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x72, 0x75, 0x6c,
+	0x65, 0x22, 0x34, 0x0a, 0x0d, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65,
+	0x73, 0x70, 0x12, 0x23, 0x0a, 0x05, 0x72, 0x75, 0x6c, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x0d, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x52, 0x75, 0x6c, 0x65,
+	0x52, 0x05, 0x72, 0x75, 0x6c, 0x65, 0x73, 0x22, 0x0f, 0x0a, 0x0d, 0x4c, 0x69, 0x73, 0x74, 0x49,
+	0x66, 0x61, 0x63, 0x65, 0x73, 0x52, 0x65, 0x71, 0x22, 0x31, 0x0a, 0x05, 0x49, 0x66, 0x61, 0x63,
+	0x65, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x38, 0x0a, 0x0e, 0x4c,
+	0x69, 0x73, 0x74, 0x49, 0x66, 0x61, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x12, 0x26, 0x0a,
+	0x06, 0x69, 0x66, 0x61, 0x63, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e,
+	0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x49, 0x66, 0x61, 0x63, 0x65, 0x52, 0x06, 0x69,
+	0x66, 0x61, 0x63, 0x65, 0x73, 0x32, 0xf0, 0x01, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x63, 0x65, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x2c, 0x0a, 0x05, 0x57, 0x61, 0x74, 0x63, 0x68, 0x12,
+	0x11, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x57, 0x61, 0x74, 0x63, 0x68, 0x52,
+	0x65, 0x71, 0x1a, 0x0e, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x54, 0x72, 0x61,
+	0x63, 0x65, 0x30, 0x01, 0x12, 0x37, 0x0a, 0x08, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74,
+	0x12, 0x14, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x52, 0x65, 0x71, 0x1a, 0x15, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65,
+	0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x3a, 0x0a,
+	0x09, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x12, 0x15, 0x2e, 0x6e, 0x66, 0x74,
+	0x72, 0x61, 0x63, 0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65,
+	0x71, 0x1a, 0x16, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74,
+	0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x12, 0x3d, 0x0a, 0x0a, 0x4c, 0x69, 0x73,
+	0x74, 0x49, 0x66, 0x61, 0x63, 0x65, 0x73, 0x12, 0x16, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63,
+	0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x49, 0x66, 0x61, 0x63, 0x65, 0x73, 0x52, 0x65, 0x71, 0x1a,
+	0x17, 0x2e, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x49, 0x66,
+	0x61, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x42, 0x39, 0x5a, 0x37, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x4d, 0x6f, 0x72, 0x77, 0x72, 0x61, 0x6e, 0x2f, 0x65,
+	0x62, 0x70, 0x66, 0x2d, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x2f, 0x70, 0x6b, 0x67, 0x2f,
+	0x61, 0x70, 0x69, 0x2f, 0x6e, 0x66, 0x74, 0x72, 0x61, 0x63, 0x65, 0x3b, 0x6e, 0x66, 0x74, 0x72,
+	0x61, 0x63, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_nftrace_nftrace_proto_rawDescOnce sync.Once
+	file_nftrace_nftrace_proto_rawDescData = file_nftrace_nftrace_proto_rawDesc
+)
+
+func file_nftrace_nftrace_proto_rawDescGZIP() []byte {
+	file_nftrace_nftrace_proto_rawDescOnce.Do(func() {
+		file_nftrace_nftrace_proto_rawDescData = protoimpl.X.CompressGZIP(file_nftrace_nftrace_proto_rawDescData)
+	})
+	return file_nftrace_nftrace_proto_rawDescData
+}
+
+var file_nftrace_nftrace_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_nftrace_nftrace_proto_goTypes = []interface{}{
+	(*Hop)(nil),                   // 0: nftrace.Hop
+	(*Trace)(nil),                 // 1: nftrace.Trace
+	(*Filter)(nil),                // 2: nftrace.Filter
+	(*WatchReq)(nil),              // 3: nftrace.WatchReq
+	(*SnapshotReq)(nil),           // 4: nftrace.SnapshotReq
+	(*SnapshotResp)(nil),          // 5: nftrace.SnapshotResp
+	(*ListRulesReq)(nil),          // 6: nftrace.ListRulesReq
+	(*Rule)(nil),                  // 7: nftrace.Rule
+	(*ListRulesResp)(nil),         // 8: nftrace.ListRulesResp
+	(*ListIfacesReq)(nil),         // 9: nftrace.ListIfacesReq
+	(*Iface)(nil),                 // 10: nftrace.Iface
+	(*ListIfacesResp)(nil),        // 11: nftrace.ListIfacesResp
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_nftrace_nftrace_proto_depIdxs = []int32{
+	0,  // 0: nftrace.Trace.path:type_name -> nftrace.Hop
+	12, // 1: nftrace.Trace.first_seen:type_name -> google.protobuf.Timestamp
+	12, // 2: nftrace.Trace.last_seen:type_name -> google.protobuf.Timestamp
+	12, // 3: nftrace.Trace.timestamp:type_name -> google.protobuf.Timestamp
+	2,  // 4: nftrace.WatchReq.filter:type_name -> nftrace.Filter
+	2,  // 5: nftrace.SnapshotReq.filter:type_name -> nftrace.Filter
+	1,  // 6: nftrace.SnapshotResp.traces:type_name -> nftrace.Trace
+	7,  // 7: nftrace.ListRulesResp.rules:type_name -> nftrace.Rule
+	10, // 8: nftrace.ListIfacesResp.ifaces:type_name -> nftrace.Iface
+	3,  // 9: nftrace.TraceService.Watch:input_type -> nftrace.WatchReq
+	4,  // 10: nftrace.TraceService.Snapshot:input_type -> nftrace.SnapshotReq
+	6,  // 11: nftrace.TraceService.ListRules:input_type -> nftrace.ListRulesReq
+	9,  // 12: nftrace.TraceService.ListIfaces:input_type -> nftrace.ListIfacesReq
+	1,  // 13: nftrace.TraceService.Watch:output_type -> nftrace.Trace
+	5,  // 14: nftrace.TraceService.Snapshot:output_type -> nftrace.SnapshotResp
+	8,  // 15: nftrace.TraceService.ListRules:output_type -> nftrace.ListRulesResp
+	11, // 16: nftrace.TraceService.ListIfaces:output_type -> nftrace.ListIfacesResp
+	13, // [13:17] is the sub-list for method output_type
+	9,  // [9:13] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_nftrace_nftrace_proto_init() }
+func file_nftrace_nftrace_proto_init() {
+	if File_nftrace_nftrace_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_nftrace_nftrace_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Hop); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Trace); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Filter); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WatchReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SnapshotReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SnapshotResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListRulesReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Rule); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListRulesResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListIfacesReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Iface); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_nftrace_nftrace_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListIfacesResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_nftrace_nftrace_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_nftrace_nftrace_proto_goTypes,
+		DependencyIndexes: file_nftrace_nftrace_proto_depIdxs,
+		MessageInfos:      file_nftrace_nftrace_proto_msgTypes,
+	}.Build()
+	File_nftrace_nftrace_proto = out.File
+	file_nftrace_nftrace_proto_rawDesc = nil
+	file_nftrace_nftrace_proto_goTypes = nil
+	file_nftrace_nftrace_proto_depIdxs = nil
+}
@@ -0,0 +1,256 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: nftrace/nftrace.proto
+
+package nftrace
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TraceService_Watch_FullMethodName      = "/nftrace.TraceService/Watch"
+	TraceService_Snapshot_FullMethodName   = "/nftrace.TraceService/Snapshot"
+	TraceService_ListRules_FullMethodName  = "/nftrace.TraceService/ListRules"
+	TraceService_ListIfaces_FullMethodName = "/nftrace.TraceService/ListIfaces"
+)
+
+// TraceServiceClient is the client API for TraceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TraceServiceClient interface {
+	// Watch - live traces matched by the filter
+	Watch(ctx context.Context, in *WatchReq, opts ...grpc.CallOption) (TraceService_WatchClient, error)
+	// Snapshot - most recent traces matched by the filter
+	Snapshot(ctx context.Context, in *SnapshotReq, opts ...grpc.CallOption) (*SnapshotResp, error)
+	// ListRules - rules known by the tracer
+	ListRules(ctx context.Context, in *ListRulesReq, opts ...grpc.CallOption) (*ListRulesResp, error)
+	// ListIfaces - network interfaces known by the tracer
+	ListIfaces(ctx context.Context, in *ListIfacesReq, opts ...grpc.CallOption) (*ListIfacesResp, error)
+}
+
+type traceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTraceServiceClient(cc grpc.ClientConnInterface) TraceServiceClient {
+	return &traceServiceClient{cc}
+}
+
+func (c *traceServiceClient) Watch(ctx context.Context, in *WatchReq, opts ...grpc.CallOption) (TraceService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TraceService_ServiceDesc.Streams[0], TraceService_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &traceServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TraceService_WatchClient interface {
+	Recv() (*Trace, error)
+	grpc.ClientStream
+}
+
+type traceServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *traceServiceWatchClient) Recv() (*Trace, error) {
+	m := new(Trace)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *traceServiceClient) Snapshot(ctx context.Context, in *SnapshotReq, opts ...grpc.CallOption) (*SnapshotResp, error) {
+	out := new(SnapshotResp)
+	err := c.cc.Invoke(ctx, TraceService_Snapshot_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *traceServiceClient) ListRules(ctx context.Context, in *ListRulesReq, opts ...grpc.CallOption) (*ListRulesResp, error) {
+	out := new(ListRulesResp)
+	err := c.cc.Invoke(ctx, TraceService_ListRules_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *traceServiceClient) ListIfaces(ctx context.Context, in *ListIfacesReq, opts ...grpc.CallOption) (*ListIfacesResp, error) {
+	out := new(ListIfacesResp)
+	err := c.cc.Invoke(ctx, TraceService_ListIfaces_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TraceServiceServer is the server API for TraceService service.
+// All implementations must embed UnimplementedTraceServiceServer
+// for forward compatibility
+type TraceServiceServer interface {
+	// Watch - live traces matched by the filter
+	Watch(*WatchReq, TraceService_WatchServer) error
+	// Snapshot - most recent traces matched by the filter
+	Snapshot(context.Context, *SnapshotReq) (*SnapshotResp, error)
+	// ListRules - rules known by the tracer
+	ListRules(context.Context, *ListRulesReq) (*ListRulesResp, error)
+	// ListIfaces - network interfaces known by the tracer
+	ListIfaces(context.Context, *ListIfacesReq) (*ListIfacesResp, error)
+	mustEmbedUnimplementedTraceServiceServer()
+}
+
+// UnimplementedTraceServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTraceServiceServer struct {
+}
+
+func (UnimplementedTraceServiceServer) Watch(*WatchReq, TraceService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedTraceServiceServer) Snapshot(context.Context, *SnapshotReq) (*SnapshotResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Snapshot not implemented")
+}
+func (UnimplementedTraceServiceServer) ListRules(context.Context, *ListRulesReq) (*ListRulesResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRules not implemented")
+}
+func (UnimplementedTraceServiceServer) ListIfaces(context.Context, *ListIfacesReq) (*ListIfacesResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListIfaces not implemented")
+}
+func (UnimplementedTraceServiceServer) mustEmbedUnimplementedTraceServiceServer() {}
+
+// UnsafeTraceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TraceServiceServer will
+// result in compilation errors.
+type UnsafeTraceServiceServer interface {
+	mustEmbedUnimplementedTraceServiceServer()
+}
+
+func RegisterTraceServiceServer(s grpc.ServiceRegistrar, srv TraceServiceServer) {
+	s.RegisterService(&TraceService_ServiceDesc, srv)
+}
+
+func _TraceService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TraceServiceServer).Watch(m, &traceServiceWatchServer{stream})
+}
+
+type TraceService_WatchServer interface {
+	Send(*Trace) error
+	grpc.ServerStream
+}
+
+type traceServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *traceServiceWatchServer) Send(m *Trace) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _TraceService_Snapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TraceServiceServer).Snapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TraceService_Snapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TraceServiceServer).Snapshot(ctx, req.(*SnapshotReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TraceService_ListRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRulesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TraceServiceServer).ListRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TraceService_ListRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TraceServiceServer).ListRules(ctx, req.(*ListRulesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TraceService_ListIfaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListIfacesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TraceServiceServer).ListIfaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TraceService_ListIfaces_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TraceServiceServer).ListIfaces(ctx, req.(*ListIfacesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TraceService_ServiceDesc is the grpc.ServiceDesc for TraceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TraceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nftrace.TraceService",
+	HandlerType: (*TraceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Snapshot",
+			Handler:    _TraceService_Snapshot_Handler,
+		},
+		{
+			MethodName: "ListRules",
+			Handler:    _TraceService_ListRules_Handler,
+		},
+		{
+			MethodName: "ListIfaces",
+			Handler:    _TraceService_ListIfaces_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _TraceService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "nftrace/nftrace.proto",
+}
@@ -0,0 +1,120 @@
+// Package client - client of the nftrace gRPC trace API
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	api "github.com/Morwran/ebpf-nftrace/pkg/api/nftrace"
+
+	grpcClient "github.com/H-BF/corlib/client/grpc"
+	"github.com/pkg/errors"
+)
+
+// DefDialDuration -
+const DefDialDuration = 10 * time.Second
+
+type (
+	// Client -
+	Client struct {
+		conn grpcClient.ClientConn
+		api  api.TraceServiceClient
+	}
+
+	// Option -
+	Option func(*config)
+
+	config struct {
+		dialDuration time.Duration
+		userAgent    string
+	}
+)
+
+// WithDialDuration - max time to connect to the server
+func WithDialDuration(d time.Duration) Option {
+	return func(c *config) {
+		c.dialDuration = d
+	}
+}
+
+// WithUserAgent -
+func WithUserAgent(ua string) Option {
+	return func(c *config) {
+		c.userAgent = ua
+	}
+}
+
+// New - connects to the tracer telemetry endpoint, e.g. '127.0.0.1:5000'
+func New(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	cfg := config{dialDuration: DefDialDuration, userAgent: "nftrace-client"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	conn, err := grpcClient.ClientFromAddress(addr).
+		WithDialDuration(cfg.dialDuration).
+		WithUserAgent(cfg.userAgent).
+		New(ctx)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to connect to '%s'", addr)
+	}
+	return &Client{conn: conn, api: api.NewTraceServiceClient(conn)}, nil
+}
+
+// Watch - calls the handler for every live trace matched by the filter until the context is done,
+// the handler error stops the watch and is returned
+func (c *Client) Watch(ctx context.Context, req *api.WatchReq, h func(*api.Trace) error) error {
+	ctx1, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.api.Watch(ctx1, req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for {
+		tr, e := stream.Recv()
+		if e != nil {
+			if errors.Is(e, io.EOF) {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.WithStack(e)
+		}
+		if e = h(tr); e != nil {
+			return e
+		}
+	}
+}
+
+// Snapshot - recent traces matched by the filter from the oldest to the newest
+func (c *Client) Snapshot(ctx context.Context, req *api.SnapshotReq) ([]*api.Trace, error) {
+	resp, err := c.api.Snapshot(ctx, req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resp.GetTraces(), nil
+}
+
+// ListRules -
+func (c *Client) ListRules(ctx context.Context) ([]*api.Rule, error) {
+	resp, err := c.api.ListRules(ctx, &api.ListRulesReq{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resp.GetRules(), nil
+}
+
+// ListIfaces -
+func (c *Client) ListIfaces(ctx context.Context) ([]*api.Iface, error) {
+	resp, err := c.api.ListIfaces(ctx, &api.ListIfacesReq{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resp.GetIfaces(), nil
+}
+
+// Close -
+func (c *Client) Close() error {
+	return c.conn.Close()
+}